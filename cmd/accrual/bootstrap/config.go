@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"flag"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/accrual/config"
+)
+
+func Config() (config.Config, error) {
+	cfg := config.Config{}
+
+	if err := env.Parse(&cfg); err != nil {
+		return config.Config{}, err
+	}
+
+	flag.StringVar(&cfg.ServerListenAddr, "a", cfg.ServerListenAddr, "Address to listen on")
+	flag.DurationVar(
+		&cfg.ServerShutdownTimeout, "server.shutdown-timeout", time.Second*5,
+		"The maximum duration the server should wait for connections to finish before exiting",
+	)
+	flag.DurationVar(
+		&cfg.ProcessingDelay, "processing-delay", time.Second,
+		"Time a registered order spends in each of the REGISTERED and PROCESSING statuses",
+	)
+	flag.IntVar(
+		&cfg.RequestsPerMinute, "rate-limit", 0,
+		"Maximum number of order status requests per minute. No limit is applied unless set",
+	)
+	flag.Float64Var(
+		&cfg.TooManyRequestsRate, "fault.429-rate", 0,
+		"Probability of answering an order status request with 429 Too Many Requests",
+	)
+	flag.DurationVar(
+		&cfg.RetryAfter, "fault.retry-after", time.Second*60,
+		"Retry-After value of the injected 429 responses",
+	)
+	flag.Float64Var(
+		&cfg.NoContentRate, "fault.204-rate", 0,
+		"Probability of answering an order status request with 204 No Content",
+	)
+	flag.Float64Var(
+		&cfg.InternalErrorRate, "fault.500-rate", 0,
+		"Probability of answering an order status request with 500 Internal Server Error",
+	)
+	flag.Float64Var(
+		&cfg.MalformedRate, "fault.malformed-rate", 0,
+		"Probability of answering an order status request with a malformed json body",
+	)
+	flag.DurationVar(
+		&cfg.Latency, "fault.latency", time.Second*5,
+		"Delay of the order status requests picked with -fault.latency-rate",
+	)
+	flag.Float64Var(
+		&cfg.LatencyRate, "fault.latency-rate", 0,
+		"Probability of delaying an order status request",
+	)
+	flag.StringVar(
+		&cfg.LogLevel, "log.level", "info",
+		"Only log messages with the given severity or above",
+	)
+
+	flag.Parse()
+
+	return cfg, nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"time"
+)
+
+type Config struct {
+	ServerListenAddr      string `env:"RUN_ADDRESS" envDefault:"localhost:8081"`
+	ServerShutdownTimeout time.Duration
+	ProcessingDelay       time.Duration
+	RequestsPerMinute     int
+	TooManyRequestsRate   float64
+	RetryAfter            time.Duration
+	NoContentRate         float64
+	InternalErrorRate     float64
+	MalformedRate         float64
+	Latency               time.Duration
+	LatencyRate           float64
+	LogLevel              string
+}
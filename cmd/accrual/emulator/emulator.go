@@ -0,0 +1,143 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/validation"
+)
+
+type Emulator struct {
+	store   *Store
+	faults  Faults
+	limiter *rateLimiter
+	// chance returns a random number in [0, 1) to decide whether a fault happens
+	chance func() float64
+}
+
+type RegisterOrderReq struct {
+	Order string `json:"order" binding:"required"`
+	Goods []Good `json:"goods" binding:"required,min=1,dive"`
+}
+
+// New configures a router implementing the accrual system protocol on top of the store
+func New(store *Store, faults Faults) *gin.Engine {
+	e := &Emulator{
+		store:   store,
+		faults:  faults,
+		limiter: &rateLimiter{limit: faults.RequestsPerMinute},
+		chance:  mrand.Float64, // nolint: gosec
+	}
+	router := gin.New()
+	router.Use(gin.LoggerWithWriter(log.Logger))
+	router.Use(gin.Recovery())
+	router.GET("/api/orders/:number", e.ShowOrderStatus)
+	router.POST("/api/orders", e.RegisterOrder)
+	router.POST("/api/goods", e.RegisterReward)
+	return router
+}
+
+func (e *Emulator) ShowOrderStatus(c *gin.Context) {
+	if e.injectFault(c) {
+		return
+	}
+	number := c.Param("number")
+	os, err := e.store.OrderStatus(number, time.Now())
+	if err != nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if e.happens(e.faults.MalformedRate) {
+		c.Data(http.StatusOK, "application/json", []byte(fmt.Sprintf(`{"order": "%s", "status": `, number)))
+		return
+	}
+	c.JSON(http.StatusOK, os)
+}
+
+func (e *Emulator) RegisterOrder(c *gin.Context) {
+	var req RegisterOrderReq
+	if err := c.ShouldBindJSON(&req); err != nil || !validation.CheckLuhnNumber(req.Order) {
+		c.String(http.StatusBadRequest, "invalid request format")
+		return
+	}
+	if err := e.store.RegisterOrder(req.Order, req.Goods); err != nil {
+		if errors.Is(err, ErrOrderAlreadyRegistered) {
+			c.String(http.StatusConflict, err.Error())
+		} else {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	log.Info().Str("order", req.Order).Int("goods", len(req.Goods)).Msg("Registered order")
+	c.Status(http.StatusAccepted)
+}
+
+func (e *Emulator) RegisterReward(c *gin.Context) {
+	var reward Reward
+	if err := c.ShouldBindJSON(&reward); err != nil || !isValidReward(reward) {
+		c.String(http.StatusBadRequest, "invalid request format")
+		return
+	}
+	if err := e.store.RegisterReward(reward); err != nil {
+		if errors.Is(err, ErrRewardAlreadyRegistered) {
+			c.String(http.StatusConflict, err.Error())
+		} else {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	log.Info().
+		Str("match", reward.Match).Stringer("reward", reward.Reward).Str("type", string(reward.RewardType)).
+		Msg("Registered reward")
+	c.Status(http.StatusOK)
+}
+
+// injectFault answers the request with one of the configured faults, if any happens.
+// The method tells whether the request has been answered
+func (e *Emulator) injectFault(c *gin.Context) bool {
+	if e.happens(e.faults.LatencyRate) {
+		select {
+		case <-time.After(e.faults.Latency):
+		case <-c.Request.Context().Done():
+			return true
+		}
+	}
+	if ok, wait := e.limiter.allow(time.Now()); !ok {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		c.String(
+			http.StatusTooManyRequests,
+			fmt.Sprintf("No more than %d requests per minute allowed", e.faults.RequestsPerMinute),
+		)
+		return true
+	}
+	switch {
+	case e.happens(e.faults.TooManyRequestsRate):
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(e.faults.RetryAfter)))
+		c.String(http.StatusTooManyRequests, "Too many requests")
+	case e.happens(e.faults.InternalErrorRate):
+		c.String(http.StatusInternalServerError, "Internal server error")
+	case e.happens(e.faults.NoContentRate):
+		c.Status(http.StatusNoContent)
+	default:
+		return false
+	}
+	return true
+}
+
+func (e *Emulator) happens(rate float64) bool {
+	return rate > 0 && e.chance() < rate
+}
+
+func isValidReward(r Reward) bool {
+	if r.Match == "" || !r.Reward.IsPositive() {
+		return false
+	}
+	return r.RewardType == RewardTypePercent || r.RewardType == RewardTypePoints
+}
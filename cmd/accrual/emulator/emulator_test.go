@@ -0,0 +1,188 @@
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/accrual/emulator"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+)
+
+func newTestServer(t *testing.T, store *emulator.Store, faults emulator.Faults) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ts := httptest.NewServer(emulator.New(store, faults))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, ts *httptest.Server, path, body string) int {
+	t.Helper()
+	resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body)) // nolint: noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestEmulator_RegisterReward(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"percent reward", `{"match": "Bork", "reward": 10, "reward_type": "%"}`, 200},
+		{"points reward", `{"match": "Acer", "reward": 20.5, "reward_type": "pt"}`, 200},
+		{"duplicate match", `{"match": "Bork", "reward": 5, "reward_type": "pt"}`, 409},
+		{"unknown reward type", `{"match": "Asus", "reward": 5, "reward_type": "usd"}`, 400},
+		{"zero reward", `{"match": "Asus", "reward": 0, "reward_type": "pt"}`, 400},
+		{"empty match", `{"match": "", "reward": 5, "reward_type": "pt"}`, 400},
+		{"invalid json", `{"match": "Asus"`, 400},
+	}
+	ts := newTestServer(t, emulator.NewStore(0), emulator.Faults{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, post(t, ts, "/api/goods", tt.body))
+		})
+	}
+}
+
+func TestEmulator_RegisterOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"positive case", `{"order": "79927398713", "goods": [{"description": "Чайник Bork", "price": 7000}]}`, 202},
+		{"already registered", `{"order": "79927398713", "goods": [{"description": "Чайник Bork", "price": 1}]}`, 409},
+		{"invalid number", `{"order": "79927398714", "goods": [{"description": "Чайник Bork", "price": 1}]}`, 400},
+		{"no goods", `{"order": "4561261212345467", "goods": []}`, 400},
+		{"no number", `{"goods": [{"description": "Чайник Bork", "price": 1}]}`, 400},
+		{"invalid json", `{"order": "4561261212345467"`, 400},
+	}
+	ts := newTestServer(t, emulator.NewStore(0), emulator.Faults{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, post(t, ts, "/api/orders", tt.body))
+		})
+	}
+}
+
+func TestEmulator_OrderLifecycle(t *testing.T) {
+	ts := newTestServer(t, emulator.NewStore(time.Millisecond*100), emulator.Faults{})
+	require.Equal(t, 200, post(t, ts, "/api/goods", `{"match": "Bork", "reward": 10, "reward_type": "%"}`))
+	require.Equal(t, 200, post(t, ts, "/api/goods", `{"match": "Acer", "reward": 20.5, "reward_type": "pt"}`))
+	require.Equal(t, 202, post(t, ts, "/api/orders", `{"order": "79927398713", "goods": [
+		{"description": "Чайник Bork", "price": 7000.55},
+		{"description": "Ноутбук Acer", "price": 50000},
+		{"description": "Кабель", "price": 100}
+	]}`))
+	require.Equal(t, 202, post(t, ts, "/api/orders", `{"order": "4561261212345467", "goods": [
+		{"description": "Кабель", "price": 100}
+	]}`))
+
+	client, err := accrual.New(ts.URL)
+	require.NoError(t, err)
+
+	os, err := client.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "REGISTERED", os.Status)
+	<-time.After(time.Millisecond * 100)
+	os, err = client.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSING", os.Status)
+	<-time.After(time.Millisecond * 100)
+	os, err = client.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", os.Status)
+	assert.Equal(t, "79927398713", os.Number)
+	assert.Equal(t, "720.56", os.Accrual.String())
+
+	// none of the goods is eligible for reward
+	os, err = client.CheckOrder(context.TODO(), "4561261212345467")
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID", os.Status)
+	assert.True(t, os.Accrual.IsZero())
+
+	_, err = client.CheckOrder(context.TODO(), "1234567812345670")
+	assert.ErrorIs(t, err, accrual.ErrOrderNotFound)
+}
+
+func TestEmulator_Faults(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  emulator.Faults
+		wantErr func(error) bool
+	}{
+		{
+			"too many requests",
+			emulator.Faults{TooManyRequestsRate: 1, RetryAfter: time.Second * 30},
+			func(err error) bool {
+				var tooManyReqs *accrual.TooManyRequestError
+				return errors.As(err, &tooManyReqs) && tooManyReqs.RetryAfter == 30
+			},
+		},
+		{
+			"no content",
+			emulator.Faults{NoContentRate: 1},
+			func(err error) bool { return errors.Is(err, accrual.ErrOrderNotFound) },
+		},
+		{
+			"internal error",
+			emulator.Faults{InternalErrorRate: 1},
+			func(err error) bool { return errors.Is(err, accrual.ErrRespInvalidStatus) },
+		},
+		{
+			"malformed body",
+			emulator.Faults{MalformedRate: 1},
+			func(err error) bool { return errors.Is(err, accrual.ErrRespInvalidData) },
+		},
+		{
+			"latency",
+			emulator.Faults{LatencyRate: 1, Latency: time.Second},
+			func(err error) bool {
+				var timeout *accrual.TimeoutError
+				return errors.As(err, &timeout)
+			},
+		},
+		{
+			"no faults",
+			emulator.Faults{LatencyRate: 0, Latency: time.Second},
+			func(err error) bool { return err == nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := emulator.NewStore(0)
+			require.NoError(t, store.RegisterOrder("79927398713", []emulator.Good{{Description: "Bork"}}))
+			ts := newTestServer(t, store, tt.faults)
+			client, err := accrual.New(ts.URL, accrual.WithTimeout(time.Millisecond*100))
+			require.NoError(t, err)
+			_, err = client.CheckOrder(context.TODO(), "79927398713")
+			assert.True(t, tt.wantErr(err), err)
+		})
+	}
+}
+
+func TestEmulator_RateLimit(t *testing.T) {
+	ts := newTestServer(t, emulator.NewStore(0), emulator.Faults{RequestsPerMinute: 2})
+	client, err := accrual.New(ts.URL)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = client.CheckOrder(context.TODO(), "79927398713")
+		assert.ErrorIs(t, err, accrual.ErrOrderNotFound)
+	}
+	_, err = client.CheckOrder(context.TODO(), "79927398713")
+	var tooManyReqs *accrual.TooManyRequestError
+	require.ErrorAs(t, err, &tooManyReqs)
+	assert.True(t, tooManyReqs.RetryAfter > 0 && tooManyReqs.RetryAfter <= 60)
+}
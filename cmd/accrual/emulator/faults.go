@@ -0,0 +1,59 @@
+package emulator
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Faults configures the misbehaviour of the order status endpoint.
+// The rates are probabilities between 0 and 1 of the fault happening on a request
+type Faults struct {
+	// TooManyRequestsRate is the rate of 429 responses with the Retry-After header set to RetryAfter
+	TooManyRequestsRate float64
+	RetryAfter          time.Duration
+	// NoContentRate is the rate of 204 responses as if the order has not been registered
+	NoContentRate float64
+	// InternalErrorRate is the rate of 500 responses
+	InternalErrorRate float64
+	// MalformedRate is the rate of 200 responses with a broken json body
+	MalformedRate float64
+	// Latency delays the responses picked with LatencyRate
+	Latency     time.Duration
+	LatencyRate float64
+	// RequestsPerMinute limits the number of requests per minute, like the real accrual system does.
+	// The requests over the limit are answered with 429 until the minute is over
+	RequestsPerMinute int
+}
+
+// rateLimiter counts the requests within fixed one-minute windows
+type rateLimiter struct {
+	limit       int
+	windowStart time.Time
+	count       int
+	mu          sync.Mutex
+}
+
+// allow registers a request and tells whether it fits into the limit.
+// Otherwise, the time left until the current window is over is returned
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart = now
+		l.count = 0
+	}
+	l.count++
+	if l.count <= l.limit {
+		return true, 0
+	}
+	return false, l.windowStart.Add(time.Minute).Sub(now)
+}
+
+// retryAfterSeconds rounds the wait time up to whole seconds, as required by the Retry-After header
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,137 @@
+package emulator
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+type RewardType string
+
+const (
+	// RewardTypePercent rewards a percentage of the price of the matching goods
+	RewardTypePercent RewardType = "%"
+	// RewardTypePoints rewards a fixed number of points for the matching goods
+	RewardTypePoints RewardType = "pt"
+)
+
+var ErrOrderAlreadyRegistered = errors.New("order is already registered")
+var ErrOrderNotRegistered = errors.New("order is not registered")
+var ErrRewardAlreadyRegistered = errors.New("reward for this match is already registered")
+
+type Good struct {
+	Description string          `json:"description"`
+	Price       decimal.Decimal `json:"price"`
+}
+
+type Reward struct {
+	Match      string          `json:"match"`
+	Reward     decimal.Decimal `json:"reward"`
+	RewardType RewardType      `json:"reward_type"` // nolint: tagliatelle
+}
+
+type OrderStatus struct {
+	Number  string           `json:"order"`
+	Status  string           `json:"status"`
+	Accrual *decimal.Decimal `json:"accrual,omitempty"`
+}
+
+type order struct {
+	goods        []Good
+	registeredAt time.Time
+}
+
+// Store keeps the registered orders and reward rules in memory.
+// A registered order goes through the REGISTERED and PROCESSING statuses,
+// spending the processing delay in each of them, before its accrual is calculated
+type Store struct {
+	orders          map[string]order
+	rewards         []Reward
+	processingDelay time.Duration
+	mu              sync.RWMutex
+}
+
+func NewStore(processingDelay time.Duration) *Store {
+	return &Store{
+		orders:          make(map[string]order),
+		processingDelay: processingDelay,
+	}
+}
+
+func (s *Store) RegisterOrder(number string, goods []Good) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[number]; ok {
+		return ErrOrderAlreadyRegistered
+	}
+	s.orders[number] = order{goods: goods, registeredAt: time.Now()}
+	return nil
+}
+
+// RegisterReward adds a reward rule for the goods whose description contains the match.
+// The rules are applied in the order they have been registered, so a good is rewarded by the first matching rule
+func (s *Store) RegisterReward(reward Reward) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rewards {
+		if r.Match == reward.Match {
+			return ErrRewardAlreadyRegistered
+		}
+	}
+	s.rewards = append(s.rewards, reward)
+	return nil
+}
+
+// OrderStatus reports the order's status as of the specified time
+func (s *Store) OrderStatus(number string, now time.Time) (OrderStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.orders[number]
+	if !ok {
+		return OrderStatus{}, ErrOrderNotRegistered
+	}
+	elapsed := now.Sub(o.registeredAt)
+	switch {
+	case elapsed < s.processingDelay:
+		return OrderStatus{Number: number, Status: StatusRegistered}, nil
+	case elapsed < s.processingDelay*2:
+		return OrderStatus{Number: number, Status: StatusProcessing}, nil
+	}
+	accrual, matched := s.calculateAccrual(o.goods)
+	// none of the goods is eligible for reward
+	if !matched {
+		return OrderStatus{Number: number, Status: StatusInvalid}, nil
+	}
+	return OrderStatus{Number: number, Status: StatusProcessed, Accrual: &accrual}, nil
+}
+
+func (s *Store) calculateAccrual(goods []Good) (decimal.Decimal, bool) {
+	var matched bool
+	accrual := decimal.Zero
+	for _, g := range goods {
+		for _, r := range s.rewards {
+			if !strings.Contains(g.Description, r.Match) {
+				continue
+			}
+			matched = true
+			switch r.RewardType {
+			case RewardTypePercent:
+				accrual = accrual.Add(g.Price.Mul(r.Reward).Div(decimal.NewFromInt(100)))
+			case RewardTypePoints:
+				accrual = accrual.Add(r.Reward)
+			}
+			break
+		}
+	}
+	return accrual.Round(2), matched
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/accrual/bootstrap"
+	"github.com/sergeii/practikum-go-gophermart/cmd/accrual/emulator"
+	httpserver "github.com/sergeii/practikum-go-gophermart/pkg/http/server"
+	"github.com/sergeii/practikum-go-gophermart/pkg/random"
+)
+
+func main() {
+	cfg, err := bootstrap.Config()
+	if err != nil {
+		panic(err)
+	}
+
+	lvl, err := zerolog.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		panic(err)
+	}
+	zerolog.SetGlobalLevel(lvl)
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+
+	if err = random.Seed(); err != nil {
+		log.Panic().Err(err).Msg("Unable to seed random generator")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := emulator.New(
+		emulator.NewStore(cfg.ProcessingDelay),
+		emulator.Faults{
+			TooManyRequestsRate: cfg.TooManyRequestsRate,
+			RetryAfter:          cfg.RetryAfter,
+			NoContentRate:       cfg.NoContentRate,
+			InternalErrorRate:   cfg.InternalErrorRate,
+			MalformedRate:       cfg.MalformedRate,
+			Latency:             cfg.Latency,
+			LatencyRate:         cfg.LatencyRate,
+			RequestsPerMinute:   cfg.RequestsPerMinute,
+		},
+	)
+	svr, err := httpserver.New(
+		cfg.ServerListenAddr,
+		httpserver.WithShutdownTimeout(cfg.ServerShutdownTimeout),
+		httpserver.WithHandler(router),
+	)
+	if err != nil {
+		log.Panic().Err(err).Msg("Failed to setup HTTP server")
+	}
+	if err = svr.ListenAndServe(ctx); err != nil {
+		log.Panic().Err(err).Msg("HTTP server exited prematurely")
+	}
+}
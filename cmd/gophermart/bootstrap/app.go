@@ -1,47 +1,169 @@
 package bootstrap
 
 import (
+	"errors"
+
 	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
 
 	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
 	"github.com/sergeii/practikum-go-gophermart/internal/application"
+	adjustmentsPG "github.com/sergeii/practikum-go-gophermart/internal/core/adjustments/postgres"
+	balanceRepairsPG "github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs/postgres"
+	holdsPG "github.com/sergeii/practikum-go-gophermart/internal/core/holds/postgres"
+	idempotencyKeysPG "github.com/sergeii/practikum-go-gophermart/internal/core/idempotencykeys/postgres"
+	ledgerEntriesPG "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	orderEventsPG "github.com/sergeii/practikum-go-gophermart/internal/core/orderevents/postgres"
 	ordersPG "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	transfersPG "github.com/sergeii/practikum-go-gophermart/internal/core/transfers/postgres"
 	usersPG "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	webhookDeliveriesPG "github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries/postgres"
+	webhooksPG "github.com/sergeii/practikum-go-gophermart/internal/core/webhooks/postgres"
 	withdrawalsPG "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/limiter"
+	pubsubMemory "github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub/memory"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue/memory"
+	queuePG "github.com/sergeii/practikum-go-gophermart/internal/ports/queue/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/account"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/balancecheck"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/expiry"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/idempotency"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/reconciliation"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/transfer"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/webhook"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
 	"github.com/sergeii/practikum-go-gophermart/pkg/security/hasher/bcrypt"
 )
 
+var ErrConfigInvalidQueueBackend = errors.New("unknown accrual queue backend")
+
 func App(cfg config.Config, pg *postgres.Database) (*application.App, error) {
-	accrualService, err := accrual.New(cfg.AccrualSystemURL)
+	accrualService, err := accrual.New(
+		cfg.AccrualSystemURL,
+		accrual.WithTimeout(cfg.AccrualTimeout),
+		accrual.WithConnectTimeout(cfg.AccrualConnectTimeout),
+	)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to configure accrual service")
 		return nil, err
 	}
+	// the limiter is shared by all workers, so that the accrual system is never asked more often than allowed.
+	// It is wrapped by the breaker, so that no token is spent on the requests that the open breaker rejects
+	accrualLimiter := limiter.New(
+		accrualService,
+		limiter.WithRate(cfg.AccrualRateLimit),
+		limiter.WithBurst(cfg.AccrualRateBurst),
+	)
+	accrualBreaker := breaker.New(
+		accrualLimiter,
+		breaker.WithFailureThreshold(cfg.AccrualBreakerThreshold),
+		breaker.WithCoolDown(cfg.AccrualBreakerCoolDown),
+	)
 
-	accrualQueue, err := memory.New(cfg.AccrualQueueSize)
+	reconcilePolicy, err := reconciliation.ParsePolicy(cfg.ReconcilePolicy)
 	if err != nil {
+		log.Error().Err(err).Str("policy", cfg.ReconcilePolicy).Msg("Unable to configure reconciliation")
+		return nil, err
+	}
+
+	// the events are only delivered to the users connected to the same instance of the service
+	events := pubsubMemory.New(pubsubMemory.DefaultBufferSize)
+
+	accrualQueue, err := AccrualQueue(cfg, pg)
+	if err != nil {
+		log.Error().Err(err).Str("backend", cfg.AccrualQueueBackend).Msg("Unable to configure accrual queue")
 		return nil, err
 	}
 
 	// repos
-	users := usersPG.New(pg)
+	users := usersPG.New(pg, usersPG.WithPointsTTL(cfg.PointsTTL))
+	ledger := ledgerEntriesPG.New(pg)
 	orders := ordersPG.New(pg)
+	orderEvents := orderEventsPG.New(pg)
 	withdrawals := withdrawalsPG.New(pg)
+	adjustments := adjustmentsPG.New(pg)
+	idempotencyKeys := idempotencyKeysPG.New(pg)
+
+	webhookService := webhook.New(
+		webhooksPG.New(pg), webhookDeliveriesPG.New(pg),
+		webhook.WithTimeout(cfg.WebhookTimeout),
+		webhook.WithMaxAttempts(cfg.WebhookMaxAttempts),
+		webhook.WithDisableAfter(cfg.WebhookDisableAfter),
+		webhook.WithPrivateNetworks(cfg.WebhookAllowPrivate),
+	)
 
 	app := application.NewApp(
 		cfg,
-		account.New(users, bcrypt.New()),
+		account.New(users, ledger, pg, bcrypt.New()),
 		order.New(
-			orders, users, pg,
-			accrualQueue, accrualService,
+			orders, orderEvents, users, ledger, pg,
+			accrualQueue, accrualBreaker,
+			order.WithRetryPolicy(order.RetryPolicy{
+				MaxAttempts: cfg.AccrualMaxAttempts,
+				BaseDelay:   cfg.AccrualRetryBaseDelay,
+				MaxDelay:    cfg.AccrualRetryMaxDelay,
+			}),
+			order.WithLeaseTimeout(cfg.AccrualLeaseTimeout),
+			// the changes are streamed to the connected users once committed,
+			// whereas the notifications to the users' webhooks are stored along with the changes
+			order.WithPublisher(events),
+			order.WithOutbox(webhookService),
+		),
+		withdrawal.New(
+			withdrawals, holdsPG.New(pg), users, ledger, pg,
+			withdrawal.WithPublisher(events),
+			withdrawal.WithOutbox(webhookService),
+			withdrawal.WithHoldTTL(cfg.HoldTTL),
+		),
+		transfer.New(
+			transfersPG.New(pg), users, ledger, pg,
+			transfer.WithPublisher(events),
+			transfer.WithOutbox(webhookService),
+			transfer.WithMaxAmount(decimal.NewFromFloat(cfg.TransferMaxAmount)),
+			transfer.WithDailyLimit(decimal.NewFromFloat(cfg.TransferDailyLimit)),
 		),
-		withdrawal.New(withdrawals, users, pg),
+		reconciliation.New(
+			orders, adjustments, users, ledger, pg, accrualBreaker,
+			reconciliation.WithPolicy(reconcilePolicy),
+			reconciliation.WithWindow(cfg.ReconcileWindow),
+		),
+		balancecheck.New(users, ledger, balanceRepairsPG.New(pg), pg),
+		expiry.New(users, ledger, pg),
+		idempotency.New(
+			idempotencyKeys,
+			idempotency.WithTTL(cfg.IdempotencyKeyTTL),
+			idempotency.WithReservationTimeout(cfg.IdempotencyKeyTimeout),
+		),
+		webhookService,
+		accrualBreaker,
+		events,
 	)
 	return app, nil
 }
+
+// AccrualQueue configures the processing queue with the backend chosen in the config.
+// The durable Postgres-backed queue is used unless specified otherwise;
+// a config with no backend set (e.g. in tests) falls back to the in-memory queue.
+// Unless configured, the size of the queue is the default one of the backend
+func AccrualQueue(cfg config.Config, pg *postgres.Database) (queue.Repository, error) {
+	switch cfg.AccrualQueueBackend {
+	case "postgres":
+		return queuePG.New(pg, queueSize(cfg.AccrualQueueSize, queuePG.DefaultSize))
+	case "memory", "":
+		return memory.New(queueSize(cfg.AccrualQueueSize, memory.DefaultSize))
+	default:
+		return nil, ErrConfigInvalidQueueBackend
+	}
+}
+
+func queueSize(size, defaultSize int) int {
+	if size == 0 {
+		return defaultSize
+	}
+	return size
+}
@@ -3,16 +3,26 @@ package bootstrap
 import (
 	crand "crypto/rand"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 
 	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/idempotency"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/reconciliation"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/webhook"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
 )
 
 const SecretKeyLength = 32
 
+var ErrConfigInvalidRecoveryBatchSize = errors.New("accrual recovery batch size must be positive")
+
 func Config() (config.Config, error) {
 	cfg := config.Config{}
 
@@ -48,9 +58,151 @@ func Config() (config.Config, error) {
 		&cfg.LogOutput, "log.output", "console",
 		"Output format of log messages. Available options: console, stdout, json",
 	)
+	flag.DurationVar(
+		&cfg.AccrualTimeout, "accrual.timeout", accrual.DefaultTimeout,
+		"Maximum time a request to the accrual system may take",
+	)
+	flag.DurationVar(
+		&cfg.AccrualConnectTimeout, "accrual.connect-timeout", accrual.DefaultConnectTimeout,
+		"Maximum time spent on connecting to the accrual system",
+	)
+	flag.Float64Var(
+		&cfg.AccrualRateLimit, "accrual.rps", 0,
+		"Maximum number of requests per second sent to the accrual system. Zero means no limit",
+	)
+	flag.IntVar(
+		&cfg.AccrualRateBurst, "accrual.burst", 0,
+		"Maximum number of requests sent to the accrual system at once. Defaults to the rate limit",
+	)
+	flag.StringVar(
+		&cfg.AccrualWebhookSecret, "accrual.webhook-secret", cfg.AccrualWebhookSecret,
+		"Secret shared with the accrual system to sign order results pushed by the system. "+
+			"The callback endpoint is disabled unless the secret is set",
+	)
+	flag.DurationVar(
+		&cfg.AccrualWebhookTolerance, "accrual.webhook-tolerance", time.Minute*5,
+		"Maximum difference between the time an order result is signed at and the time it is received",
+	)
+	flag.IntVar(
+		&cfg.AccrualBreakerThreshold, "accrual.breaker-threshold", breaker.DefaultFailureThreshold,
+		"Number of consecutive accrual system failures after which requests to the system are suspended",
+	)
+	flag.DurationVar(
+		&cfg.AccrualBreakerCoolDown, "accrual.breaker-cooldown", breaker.DefaultCoolDown,
+		"Time for which requests to the accrual system are suspended after it has failed",
+	)
+	flag.IntVar(
+		&cfg.AccrualQueueSize, "accrual.queue-size", 0,
+		"Maximum size of the accrual processing queue. "+
+			"By default, the queue holds up to 100000 orders in postgres and up to 100 orders in memory",
+	)
+	flag.StringVar(
+		&cfg.AccrualQueueBackend, "accrual.queue", "postgres",
+		"Storage of the accrual processing queue. Available options: postgres, memory",
+	)
+	flag.IntVar(
+		&cfg.AccrualRecoveryBatchSize, "accrual.recovery-batch-size", 100,
+		"Number of unfinished orders fetched at once when they are put back into the queue on startup",
+	)
+	flag.IntVar(
+		&cfg.AccrualWorkers, "accrual.workers", 4,
+		"Number of workers checking queued orders with the accrual system concurrently",
+	)
+	flag.IntVar(
+		&cfg.AccrualMaxAttempts, "accrual.max-attempts", order.DefaultMaxAttempts,
+		"Number of failed checks with the accrual system after which an order is moved to the FAILED status",
+	)
+	flag.DurationVar(
+		&cfg.AccrualRetryBaseDelay, "accrual.retry-base-delay", order.DefaultRetryBaseDelay,
+		"Delay before checking an order again after its first failed check. The delay doubles after each failure",
+	)
+	flag.DurationVar(
+		&cfg.AccrualRetryMaxDelay, "accrual.retry-max-delay", order.DefaultRetryMaxDelay,
+		"Maximum delay between checks of a failing order",
+	)
+	flag.DurationVar(
+		&cfg.AccrualLeaseTimeout, "accrual.lease-timeout", order.DefaultLeaseTimeout,
+		"Time after which a picked order is delivered to another worker, unless the order has been handled",
+	)
+	flag.IntVar(
+		&cfg.OrderBatchMaxSize, "orders.batch-max-size", config.DefaultOrderBatchMaxSize,
+		"Maximum number of order numbers uploaded at once with the batch upload endpoint",
+	)
+	flag.DurationVar(
+		&cfg.IdempotencyKeyTTL, "idempotency.ttl", idempotency.DefaultTTL,
+		"Time for which the responses to the requests bearing an Idempotency-Key header are replayed",
+	)
+	flag.DurationVar(
+		&cfg.IdempotencyKeyTimeout, "idempotency.reservation-timeout", idempotency.DefaultReservationTimeout,
+		"Time after which a key reserved for a request that is still in progress can be taken over by a retry",
+	)
+	flag.DurationVar(
+		&cfg.WebhookPollInterval, "webhooks.poll-interval", time.Second,
+		"Interval between checks for notifications due to be sent to user webhooks. Zero disables the notifications",
+	)
+	flag.DurationVar(
+		&cfg.WebhookTimeout, "webhooks.timeout", webhook.DefaultTimeout,
+		"Maximum time a user webhook may take to respond to a notification",
+	)
+	flag.IntVar(
+		&cfg.WebhookMaxAttempts, "webhooks.max-attempts", webhook.DefaultMaxAttempts,
+		"Number of failed attempts after which a notification to a user webhook is given up",
+	)
 	flag.IntVar(
-		&cfg.AccrualQueueSize, "accrual.queue-size", 100,
-		"Maximum size of the accrual processing queue",
+		&cfg.WebhookDisableAfter, "webhooks.disable-after", webhook.DefaultDisableAfter,
+		"Number of failed notifications in a row after which a user webhook is disabled",
+	)
+	flag.BoolVar(
+		&cfg.WebhookAllowPrivate, "webhooks.allow-private-networks", false,
+		"Let user webhooks point at loopback and private addresses. Only meant for development",
+	)
+	flag.DurationVar(
+		&cfg.ReconcileInterval, "reconcile.interval", 0,
+		"Interval between checks of processed orders for accrual changes. Zero disables the checks",
+	)
+	flag.DurationVar(
+		&cfg.ReconcileWindow, "reconcile.window", reconciliation.DefaultWindow,
+		"Only the processed orders uploaded within this window are checked for accrual changes",
+	)
+	flag.StringVar(
+		&cfg.ReconcilePolicy, "reconcile.policy", string(reconciliation.PolicyLog),
+		"What happens to orders whose accrual has changed. Available options: log, review, adjust",
+	)
+	flag.DurationVar(
+		&cfg.BalanceCheckInterval, "balances.check-interval", time.Hour*24,
+		"Interval between checks of user balances against the ledger. Zero disables the checks",
+	)
+	flag.BoolVar(
+		&cfg.BalanceCheckRepair, "balances.repair", false,
+		"Repair the user balances that do not match the ledger during the scheduled checks",
+	)
+	flag.DurationVar(
+		&cfg.HoldTTL, "holds.ttl", withdrawal.DefaultHoldTTL,
+		"Time the points stay held for an order unless the hold is captured or released",
+	)
+	flag.DurationVar(
+		&cfg.HoldExpiryInterval, "holds.expiry-interval", time.Minute,
+		"Interval between releases of expired holds. Zero disables the releases",
+	)
+	flag.DurationVar(
+		&cfg.PointsTTL, "points.ttl", 0,
+		"Time after which the accrued points expire, for example 8760h for a year. Zero means the points never expire",
+	)
+	flag.DurationVar(
+		&cfg.PointsExpiryInterval, "points.expiry-interval", time.Hour,
+		"Interval between expiries of the points past their expiry date. Zero disables the expiries",
+	)
+	flag.Float64Var(
+		&cfg.TransferMaxAmount, "transfers.max-amount", 1000,
+		"Maximum number of points a user may give to another user at once. Zero means no limit",
+	)
+	flag.Float64Var(
+		&cfg.TransferDailyLimit, "transfers.daily-limit", 5000,
+		"Maximum number of points a user may give to other users within a day. Zero means no limit",
+	)
+	flag.StringVar(
+		&cfg.AdminToken, "admin.token", cfg.AdminToken,
+		"Bearer token granting access to the admin API. The admin API is disabled unless the token is set",
 	)
 	flag.BoolVar(
 		&cfg.Production, "production", false,
@@ -59,6 +211,10 @@ func Config() (config.Config, error) {
 
 	flag.Parse()
 
+	if cfg.AccrualRecoveryBatchSize < 1 {
+		return config.Config{}, ErrConfigInvalidRecoveryBatchSize
+	}
+
 	// ensure we have a non-empty secret key configured
 	if err := configureSecretKey(&cfg); err != nil {
 		return config.Config{}, err
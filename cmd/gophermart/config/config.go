@@ -4,18 +4,56 @@ import (
 	"time"
 )
 
+// DefaultOrderBatchMaxSize is the number of orders a user may upload at once, unless configured otherwise
+const DefaultOrderBatchMaxSize = 100
+
 type Config struct {
-	ServerListenAddr       string `env:"RUN_ADDRESS" envDefault:"localhost:8000"`
-	ServerShutdownTimeout  time.Duration
-	ServerReadTimeout      time.Duration
-	ServerWriteTimeout     time.Duration
-	DatabaseDSN            string `env:"DATABASE_URI" envDefault:"postgres://gophermart@localhost:5432/gophermart?sslmode=disable"` // nolint: lll
-	DatabaseConnectTimeout time.Duration
-	AccrualSystemURL       string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8081"`
-	AccrualQueueSize       int
-	SecretKeyEncoded       string `env:"SECRET_KEY"`
-	SecretKey              []byte
-	LogLevel               string
-	LogOutput              string
-	Production             bool
+	ServerListenAddr         string `env:"RUN_ADDRESS" envDefault:"localhost:8000"`
+	ServerShutdownTimeout    time.Duration
+	ServerReadTimeout        time.Duration
+	ServerWriteTimeout       time.Duration
+	DatabaseDSN              string `env:"DATABASE_URI" envDefault:"postgres://gophermart@localhost:5432/gophermart?sslmode=disable"` // nolint: lll
+	DatabaseConnectTimeout   time.Duration
+	AccrualSystemURL         string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8081"`
+	AccrualTimeout           time.Duration
+	AccrualConnectTimeout    time.Duration
+	AccrualRateLimit         float64
+	AccrualRateBurst         int
+	AccrualBreakerThreshold  int
+	AccrualBreakerCoolDown   time.Duration
+	AccrualWebhookSecret     string `env:"ACCRUAL_WEBHOOK_SECRET"`
+	AccrualWebhookTolerance  time.Duration
+	AccrualQueueSize         int
+	AccrualQueueBackend      string
+	AccrualRecoveryBatchSize int
+	AccrualWorkers           int
+	AccrualMaxAttempts       int
+	AccrualRetryBaseDelay    time.Duration
+	AccrualRetryMaxDelay     time.Duration
+	AccrualLeaseTimeout      time.Duration
+	OrderBatchMaxSize        int
+	IdempotencyKeyTTL        time.Duration
+	IdempotencyKeyTimeout    time.Duration
+	WebhookPollInterval      time.Duration
+	WebhookTimeout           time.Duration
+	WebhookMaxAttempts       int
+	WebhookDisableAfter      int
+	WebhookAllowPrivate      bool
+	ReconcileInterval        time.Duration
+	ReconcileWindow          time.Duration
+	ReconcilePolicy          string
+	BalanceCheckInterval     time.Duration
+	BalanceCheckRepair       bool
+	HoldTTL                  time.Duration
+	HoldExpiryInterval       time.Duration
+	PointsTTL                time.Duration
+	PointsExpiryInterval     time.Duration
+	TransferMaxAmount        float64
+	TransferDailyLimit       float64
+	SecretKeyEncoded         string `env:"SECRET_KEY"`
+	SecretKey                []byte
+	AdminToken               string `env:"ADMIN_TOKEN"`
+	LogLevel                 string
+	LogOutput                string
+	Production               bool
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"sync"
@@ -57,11 +58,40 @@ func main() {
 		}
 	}()
 
+	// one-off commands run instead of the service and exit with their own code
+	if args := flag.Args(); len(args) > 0 {
+		code := run.Command(ctx, app, args)
+		cancel()
+		pg.Close()
+		os.Exit(code) // nolint: gocritic
+	}
+
+	// orders waiting for their final status must be back in the queue before processing starts
+	run.Recovery(ctx, app)
+
 	wg.Add(1)
 	go run.RestAPI(ctx, app, wg, failure)
 
 	wg.Add(1)
 	go run.Processing(ctx, app, wg, failure)
 
+	wg.Add(1)
+	go run.Reconciliation(ctx, app, wg)
+
+	wg.Add(1)
+	go run.IdempotencyCleanup(ctx, app, wg)
+
+	wg.Add(1)
+	go run.WebhookDelivery(ctx, app, wg)
+
+	wg.Add(1)
+	go run.BalanceCheck(ctx, app, wg)
+
+	wg.Add(1)
+	go run.HoldExpiry(ctx, app, wg)
+
+	wg.Add(1)
+	go run.PointsExpiry(ctx, app, wg)
+
 	wg.Wait()
 }
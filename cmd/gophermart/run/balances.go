@@ -0,0 +1,152 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/balancecheck"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+)
+
+// Exit codes of the balance check command
+const (
+	ExitBalancesOK       = 0
+	ExitBalancesMismatch = 1
+	ExitBalancesFailure  = 2
+)
+
+type balanceReportAmounts struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+	Held      float64 `json:"held"`
+}
+
+type balanceReportItem struct {
+	UserID   int                  `json:"user_id"` // nolint: tagliatelle
+	Recorded balanceReportAmounts `json:"recorded"`
+	Expected balanceReportAmounts `json:"expected"`
+	Repaired bool                 `json:"repaired"`
+}
+
+type balanceReport struct {
+	CheckedAt     time.Time           `json:"checked_at"` // nolint: tagliatelle
+	Mismatched    int                 `json:"mismatched"`
+	Repaired      int                 `json:"repaired"`
+	Discrepancies []balanceReportItem `json:"discrepancies"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// BalanceCheck periodically checks the users' balances against their orders and withdrawals.
+// The checks are disabled unless the interval is configured
+func BalanceCheck(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	interval := app.Cfg.BalanceCheckInterval
+	if interval <= 0 {
+		log.Info().Msg("Balance checks are disabled")
+		return
+	}
+	log.Info().Dur("interval", interval).Bool("repair", app.Cfg.BalanceCheckRepair).Msg("Starting balance checks")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping balance checks")
+			return
+		case <-ticker.C:
+			report, err := app.BalanceCheck.Check(ctx, app.Cfg.BalanceCheckRepair)
+			logEvent := log.Info()
+			if err != nil {
+				logEvent = log.Warn().Err(err)
+			} else if len(report.Discrepancies) > 0 {
+				logEvent = log.Warn()
+			}
+			logEvent.
+				Int("mismatched", len(report.Discrepancies)).
+				Int("repaired", report.Repaired).
+				Msg("Finished balance check")
+		}
+	}
+}
+
+// CheckBalances runs the check-balances command: the users' balances are checked against their orders
+// and withdrawals once and the report is written as JSON. The command exits with a non-zero code
+// in case of any discrepancy, even if it has been repaired, or in case the check has failed
+func CheckBalances(ctx context.Context, app *application.App, args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("check-balances", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "Bring the mismatched balances back in line with the orders and withdrawals")
+	output := flags.String("output", "-", "File to write the report to. The report is written to stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return ExitBalancesFailure
+	}
+
+	out := stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Error().Err(err).Str("output", *output).Msg("Unable to create balance report")
+			return ExitBalancesFailure
+		}
+		defer f.Close()
+		out = f
+	}
+
+	report, checkErr := app.BalanceCheck.Check(ctx, *repair)
+	result := newBalanceReport(report, checkErr)
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Error().Err(err).Msg("Unable to write balance report")
+		return ExitBalancesFailure
+	}
+
+	switch {
+	case checkErr != nil:
+		log.Error().Err(checkErr).Msg("Failed to check balances")
+		return ExitBalancesFailure
+	case result.Mismatched > 0:
+		log.Warn().Int("mismatched", result.Mismatched).Int("repaired", result.Repaired).Msg("Found balance discrepancies")
+		return ExitBalancesMismatch
+	default:
+		log.Info().Msg("All balances match the orders and withdrawals")
+		return ExitBalancesOK
+	}
+}
+
+func newBalanceReport(report balancecheck.Report, err error) balanceReport {
+	result := balanceReport{
+		CheckedAt:     time.Now(),
+		Mismatched:    len(report.Discrepancies),
+		Repaired:      report.Repaired,
+		Discrepancies: make([]balanceReportItem, 0, len(report.Discrepancies)),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	for _, d := range report.Discrepancies {
+		result.Discrepancies = append(result.Discrepancies, balanceReportItem{
+			UserID:   d.UserID,
+			Recorded: newBalanceReportAmounts(d.Recorded),
+			Expected: newBalanceReportAmounts(d.Expected),
+			Repaired: d.Repaired,
+		})
+	}
+	return result
+}
+
+func newBalanceReportAmounts(balance users.UserBalance) balanceReportAmounts {
+	return balanceReportAmounts{
+		Current:   encode.DecimalToFloat(balance.Current),
+		Withdrawn: encode.DecimalToFloat(balance.Withdrawn),
+		Held:      encode.DecimalToFloat(balance.Held),
+	}
+}
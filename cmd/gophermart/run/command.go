@@ -0,0 +1,25 @@
+package run
+
+import (
+	"context"
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+// ExitUsage is the exit code of an unknown command
+const ExitUsage = 2
+
+// Command runs a one-off command instead of the service, returning the code the process should exit with.
+// The command name is the first argument following the flags, the rest are the command's own arguments
+func Command(ctx context.Context, app *application.App, args []string) int {
+	switch args[0] {
+	case "check-balances":
+		return CheckBalances(ctx, app, args[1:], os.Stdout)
+	default:
+		log.Error().Str("command", args[0]).Msg("Unknown command")
+		return ExitUsage
+	}
+}
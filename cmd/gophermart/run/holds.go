@@ -0,0 +1,45 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+// HoldExpiry periodically returns the points held for too long back to the users.
+// The releases are disabled unless the interval is configured
+func HoldExpiry(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	interval := app.Cfg.HoldExpiryInterval
+	if interval <= 0 {
+		log.Info().Msg("Release of expired holds is disabled")
+		return
+	}
+	log.Info().Dur("interval", interval).Dur("ttl", app.Cfg.HoldTTL).Msg("Starting release of expired holds")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping release of expired holds")
+			return
+		case <-ticker.C:
+			expireHolds(ctx, app)
+		}
+	}
+}
+
+func expireHolds(ctx context.Context, app *application.App) {
+	released, err := app.WithdrawalService.ExpireHolds(ctx)
+	if err != nil {
+		log.Warn().Err(err).Int("released", released).Msg("Failed to release expired holds")
+		return
+	}
+	if released > 0 {
+		log.Info().Int("released", released).Msg("Released expired holds")
+	}
+}
@@ -0,0 +1,34 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+const IdempotencyCleanupInterval = time.Hour
+
+// IdempotencyCleanup periodically removes the idempotency keys that have outlived their TTL
+func IdempotencyCleanup(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(IdempotencyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping idempotency key cleanup")
+			return
+		case <-ticker.C:
+			purged, err := app.Idempotency.PurgeExpired(ctx)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to purge expired idempotency keys")
+				continue
+			}
+			log.Debug().Int("purged", purged).Msg("Purged expired idempotency keys")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+// PointsExpiry periodically takes away the points past their expiry date from the users.
+// The expiries are disabled unless the interval is configured
+func PointsExpiry(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	interval := app.Cfg.PointsExpiryInterval
+	if interval <= 0 {
+		log.Info().Msg("Expiry of points is disabled")
+		return
+	}
+	log.Info().Dur("interval", interval).Dur("ttl", app.Cfg.PointsTTL).Msg("Starting expiry of points")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping expiry of points")
+			return
+		case <-ticker.C:
+			expirePoints(ctx, app)
+		}
+	}
+}
+
+func expirePoints(ctx context.Context, app *application.App) {
+	report, err := app.PointsExpiry.Expire(ctx)
+	if err != nil {
+		log.Warn().Err(err).Int("users", report.Users).Msg("Failed to expire points")
+		return
+	}
+	if report.Users > 0 || report.Failed > 0 {
+		log.Info().
+			Int("users", report.Users).
+			Stringer("points", report.Points).
+			Int("failed", report.Failed).
+			Msg("Expired points")
+	}
+}
@@ -13,15 +13,33 @@ import (
 
 var ErrProcessingInterrupted = errors.New("processing is interrupted")
 
+// Processing runs the configured number of workers processing the accrual queue concurrently.
+// Once the context is cancelled, it waits for every worker to finish its current order
 func Processing(ctx context.Context, app *application.App, wg *sync.WaitGroup, failure chan error) {
 	defer wg.Done()
+	workers := app.Cfg.AccrualWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	log.Info().Int("workers", workers).Msg("Starting processing of accrual queue")
+	pool := &sync.WaitGroup{}
+	for i := 1; i <= workers; i++ {
+		pool.Add(1)
+		go processingWorker(ctx, app, i, pool)
+	}
+	pool.Wait()
+	// shutting down
+	log.Info().Msg("Stopping processing of accrual queue")
+	failure <- ErrProcessingInterrupted
+}
+
+func processingWorker(ctx context.Context, app *application.App, workerID int, pool *sync.WaitGroup) {
+	defer pool.Done()
 	wait := time.After(time.Millisecond)
 	for {
 		select {
 		case <-ctx.Done():
-			// shutting down
-			log.Info().Msg("Stopping processing of accrual queue")
-			failure <- ErrProcessingInterrupted
+			log.Debug().Int("worker", workerID).Msg("Accrual processing worker stopped")
 			return
 		case <-wait:
 			wait = app.OrderService.ProcessNextOrder(ctx)
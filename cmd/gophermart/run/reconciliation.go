@@ -0,0 +1,49 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+// Reconciliation periodically checks the processed orders for accrual changes made by the accrual system.
+// The checks are disabled unless the interval is configured
+func Reconciliation(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	interval := app.Cfg.ReconcileInterval
+	if interval <= 0 {
+		log.Info().Msg("Reconciliation of processed orders is disabled")
+		return
+	}
+	log.Info().Dur("interval", interval).Str("policy", app.Cfg.ReconcilePolicy).Msg("Starting reconciliation")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping reconciliation")
+			return
+		case <-ticker.C:
+			reconcile(ctx, app)
+		}
+	}
+}
+
+func reconcile(ctx context.Context, app *application.App) {
+	report, err := app.Reconciliation.Reconcile(ctx)
+	logEvent := log.Info()
+	if err != nil {
+		logEvent = log.Warn().Err(err)
+	}
+	logEvent.
+		Int("checked", report.Checked).
+		Int("mismatched", report.Mismatched).
+		Int("queued", report.Queued).
+		Int("adjusted", report.Adjusted).
+		Int("skipped", report.Skipped).
+		Msg("Finished reconciliation of processed orders")
+}
@@ -0,0 +1,26 @@
+package run
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+)
+
+// Recovery puts the orders that are still waiting for their final status back into the processing queue.
+// Unless the queue is durable, the orders uploaded before the restart would not be checked ever again otherwise
+func Recovery(ctx context.Context, app *application.App) {
+	log.Info().Msg("Recovering unfinished orders")
+	requeued, err := app.OrderService.RequeueUnfinishedOrders(ctx, app.Cfg.AccrualRecoveryBatchSize)
+	switch {
+	case errors.Is(err, queue.ErrQueueIsFull):
+		log.Warn().Int("count", requeued).Msg("Accrual queue is full, not all unfinished orders are recovered")
+	case err != nil:
+		log.Error().Err(err).Int("count", requeued).Msg("Failed to recover unfinished orders")
+	default:
+		log.Info().Int("count", requeued).Msg("Recovered unfinished orders")
+	}
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+)
+
+// WebhookDelivery periodically sends the notifications due to the users' webhooks.
+// The notifications are disabled unless the interval is configured
+func WebhookDelivery(ctx context.Context, app *application.App, wg *sync.WaitGroup) {
+	defer wg.Done()
+	interval := app.Cfg.WebhookPollInterval
+	if interval <= 0 {
+		log.Info().Msg("Webhook notifications are disabled")
+		return
+	}
+	log.Info().Dur("interval", interval).Msg("Starting webhook notifications")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping webhook notifications")
+			return
+		case <-ticker.C:
+			deliverWebhooks(ctx, app)
+		}
+	}
+}
+
+// deliverWebhooks keeps sending the notifications until none are due
+func deliverWebhooks(ctx context.Context, app *application.App) {
+	for ctx.Err() == nil {
+		sent, err := app.WebhookService.DeliverDue(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send webhook notifications")
+			return
+		}
+		if sent == 0 {
+			return
+		}
+		log.Debug().Int("sent", sent).Msg("Sent webhook notifications")
+	}
+}
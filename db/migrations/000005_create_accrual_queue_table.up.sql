@@ -0,0 +1,7 @@
+BEGIN;
+CREATE TABLE accrual_queue (
+    "id"           bigserial NOT NULL PRIMARY KEY,
+    "order_number" text NOT NULL UNIQUE,
+    "enqueued_at"  timestamp with time zone NOT NULL DEFAULT now()
+);
+COMMIT;
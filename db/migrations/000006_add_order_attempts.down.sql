@@ -0,0 +1,11 @@
+BEGIN;
+ALTER TABLE orders DROP COLUMN IF EXISTS "attempts";
+ALTER TABLE orders DROP COLUMN IF EXISTS "next_check_at";
+UPDATE orders SET "status" = 'NEW' WHERE "status" = 'FAILED';
+ALTER TYPE order_status RENAME TO order_status_old;
+CREATE TYPE order_status AS ENUM ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED');
+ALTER TABLE orders ALTER COLUMN "status" DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN "status" TYPE order_status USING "status"::text::order_status;
+ALTER TABLE orders ALTER COLUMN "status" SET DEFAULT 'NEW';
+DROP TYPE order_status_old;
+COMMIT;
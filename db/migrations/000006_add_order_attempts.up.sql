@@ -0,0 +1,5 @@
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'FAILED';
+BEGIN;
+ALTER TABLE orders ADD COLUMN "attempts" integer NOT NULL DEFAULT 0 CHECK ("attempts" >= 0);
+ALTER TABLE orders ADD COLUMN "next_check_at" timestamp with time zone;
+COMMIT;
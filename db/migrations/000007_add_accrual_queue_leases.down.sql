@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS accrual_queue_visible_at_idx;
+ALTER TABLE accrual_queue DROP COLUMN IF EXISTS "lease_id";
+ALTER TABLE accrual_queue DROP COLUMN IF EXISTS "visible_at";
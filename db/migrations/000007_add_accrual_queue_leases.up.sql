@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE accrual_queue ADD COLUMN "visible_at" timestamp with time zone NOT NULL DEFAULT now();
+ALTER TABLE accrual_queue ADD COLUMN "lease_id" text UNIQUE;
+CREATE INDEX accrual_queue_visible_at_idx ON accrual_queue ("visible_at", "id");
+COMMIT;
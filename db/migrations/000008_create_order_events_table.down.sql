@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS order_events_order_id_idx;
+DROP TABLE IF EXISTS order_events;
+DROP TYPE IF EXISTS order_event_source;
@@ -0,0 +1,14 @@
+BEGIN;
+CREATE TYPE order_event_source AS ENUM ('accrual', 'admin', 'webhook');
+CREATE TABLE order_events (
+    "id"         bigserial NOT NULL PRIMARY KEY,
+    "order_id"   integer NOT NULL,
+    "old_status" order_status NOT NULL,
+    "new_status" order_status NOT NULL,
+    "accrual"    decimal(7,2) NOT NULL DEFAULT 0 CHECK ("accrual" >= 0),
+    "source"     order_event_source NOT NULL,
+    "created_at" timestamp with time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE order_events ADD CONSTRAINT "order_events_order_id_fk_orders" FOREIGN KEY ("order_id") REFERENCES orders ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX order_events_order_id_idx ON order_events ("order_id", "id");
+COMMIT;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS accrual_adjustments_status_idx;
+DROP INDEX IF EXISTS accrual_adjustments_pending_order_id_uniq_idx;
+DROP TABLE IF EXISTS accrual_adjustments;
+DROP TYPE IF EXISTS accrual_adjustment_status;
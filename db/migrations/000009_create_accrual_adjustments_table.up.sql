@@ -0,0 +1,17 @@
+BEGIN;
+CREATE TYPE accrual_adjustment_status AS ENUM ('PENDING', 'APPLIED');
+CREATE TABLE accrual_adjustments (
+    "id"               serial NOT NULL PRIMARY KEY,
+    "order_id"         integer NOT NULL,
+    "user_id"          integer NOT NULL,
+    "recorded_accrual" decimal(7,2) NOT NULL CHECK ("recorded_accrual" >= 0),
+    "actual_accrual"   decimal(7,2) NOT NULL CHECK ("actual_accrual" >= 0),
+    "status"           accrual_adjustment_status NOT NULL,
+    "created_at"       timestamp with time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE accrual_adjustments ADD CONSTRAINT "accrual_adjustments_order_id_fk_orders" FOREIGN KEY ("order_id") REFERENCES orders ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE accrual_adjustments ADD CONSTRAINT "accrual_adjustments_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+-- an order awaits review only once, no matter how many times the mismatch is found
+CREATE UNIQUE INDEX accrual_adjustments_pending_order_id_uniq_idx ON accrual_adjustments ("order_id") WHERE "status" = 'PENDING';
+CREATE INDEX accrual_adjustments_status_idx ON accrual_adjustments ("status", "id");
+COMMIT;
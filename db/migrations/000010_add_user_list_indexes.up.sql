@@ -0,0 +1,4 @@
+BEGIN;
+CREATE INDEX orders_user_id_uploaded_at_idx ON orders ("user_id", "uploaded_at", "id");
+CREATE INDEX withdrawals_user_id_processed_at_idx ON withdrawals ("user_id", "processed_at", "id");
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE orders ADD COLUMN "checked_at" timestamp with time zone;
+COMMIT;
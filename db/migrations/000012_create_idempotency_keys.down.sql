@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idempotency_keys_expires_at_idx;
+DROP INDEX IF EXISTS idempotency_keys_user_id_key_uniq_idx;
+DROP TABLE IF EXISTS idempotency_keys;
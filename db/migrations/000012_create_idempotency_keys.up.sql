@@ -0,0 +1,18 @@
+BEGIN;
+CREATE TABLE idempotency_keys (
+    "id"           serial NOT NULL PRIMARY KEY,
+    "key"          varchar(255) NOT NULL,
+    "user_id"      integer NOT NULL,
+    "method"       varchar(16) NOT NULL,
+    "path"         varchar(255) NOT NULL,
+    "fingerprint"  char(64) NOT NULL,
+    "status_code"  integer NULL,
+    "content_type" varchar(255) NOT NULL DEFAULT '',
+    "body"         bytea NULL,
+    "created_at"   timestamp with time zone NOT NULL DEFAULT now(),
+    "expires_at"   timestamp with time zone NOT NULL
+);
+ALTER TABLE idempotency_keys ADD CONSTRAINT "idempotency_keys_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE UNIQUE INDEX idempotency_keys_user_id_key_uniq_idx ON idempotency_keys ("user_id", "key");
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys ("expires_at");
+COMMIT;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS webhook_deliveries_pending_idx;
+DROP INDEX IF EXISTS webhook_deliveries_webhook_id_idx;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TYPE IF EXISTS webhook_delivery_status;
+DROP INDEX IF EXISTS webhooks_user_id_idx;
+DROP TABLE IF EXISTS webhooks;
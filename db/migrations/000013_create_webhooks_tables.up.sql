@@ -0,0 +1,33 @@
+BEGIN;
+CREATE TABLE webhooks (
+    "id"                   serial NOT NULL PRIMARY KEY,
+    "user_id"              integer NOT NULL,
+    "url"                  varchar(2048) NOT NULL,
+    "secret"               varchar(255) NOT NULL,
+    "events"               text[] NOT NULL,
+    "enabled"              boolean NOT NULL DEFAULT true,
+    "consecutive_failures" integer NOT NULL DEFAULT 0,
+    "created_at"           timestamp with time zone NOT NULL DEFAULT now(),
+    "disabled_at"          timestamp with time zone NULL
+);
+ALTER TABLE webhooks ADD CONSTRAINT "webhooks_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX webhooks_user_id_idx ON webhooks ("user_id", "id");
+
+CREATE TYPE webhook_delivery_status AS ENUM ('PENDING', 'DELIVERED', 'FAILED');
+CREATE TABLE webhook_deliveries (
+    "id"               bigserial NOT NULL PRIMARY KEY,
+    "webhook_id"       integer NOT NULL,
+    "event"            varchar(32) NOT NULL,
+    "payload"          jsonb NOT NULL,
+    "status"           webhook_delivery_status NOT NULL DEFAULT 'PENDING',
+    "attempts"         integer NOT NULL DEFAULT 0,
+    "next_attempt_at"  timestamp with time zone NOT NULL DEFAULT now(),
+    "last_status_code" integer NULL,
+    "last_error"       text NOT NULL DEFAULT '',
+    "created_at"       timestamp with time zone NOT NULL DEFAULT now(),
+    "delivered_at"     timestamp with time zone NULL
+);
+ALTER TABLE webhook_deliveries ADD CONSTRAINT "webhook_deliveries_webhook_id_fk_webhooks" FOREIGN KEY ("webhook_id") REFERENCES webhooks ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries ("webhook_id", "id");
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries ("next_attempt_at", "id") WHERE "status" = 'PENDING';
+COMMIT;
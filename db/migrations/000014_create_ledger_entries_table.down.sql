@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ledger_entries_user_id_created_at_idx;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TYPE IF EXISTS ledger_account;
+DROP TYPE IF EXISTS ledger_entry_kind;
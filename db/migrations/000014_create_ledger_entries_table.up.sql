@@ -0,0 +1,25 @@
+BEGIN;
+CREATE TYPE ledger_entry_kind AS ENUM ('OPENING', 'ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL');
+CREATE TYPE ledger_account AS ENUM ('accrual', 'current', 'withdrawn');
+CREATE TABLE ledger_entries (
+    "id"             bigserial NOT NULL PRIMARY KEY,
+    "user_id"        integer NOT NULL,
+    "kind"           ledger_entry_kind NOT NULL,
+    "debit_account"  ledger_account NOT NULL,
+    "credit_account" ledger_account NOT NULL,
+    "amount"         decimal(9,2) NOT NULL CHECK ("amount" > 0),
+    "order_number"   text NOT NULL DEFAULT '',
+    "created_at"     timestamp with time zone NOT NULL DEFAULT clock_timestamp(),
+    CHECK ("debit_account" <> "credit_account")
+);
+ALTER TABLE ledger_entries ADD CONSTRAINT "ledger_entries_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX ledger_entries_user_id_created_at_idx ON ledger_entries ("user_id", "created_at", "id");
+-- the balances accumulated before the ledger was introduced are carried over with opening entries:
+-- all the points the user has ever earned are credited first, then the withdrawn ones are debited
+INSERT INTO ledger_entries ("user_id", "kind", "debit_account", "credit_account", "amount")
+SELECT "id", 'OPENING', 'accrual', 'current', "balance_current" + "balance_withdrawn" FROM users
+WHERE "balance_current" + "balance_withdrawn" > 0 ORDER BY "id";
+INSERT INTO ledger_entries ("user_id", "kind", "debit_account", "credit_account", "amount")
+SELECT "id", 'OPENING', 'current', 'withdrawn', "balance_withdrawn" FROM users
+WHERE "balance_withdrawn" > 0 ORDER BY "id";
+COMMIT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS balance_repairs_user_id_idx;
+DROP TABLE IF EXISTS balance_repairs;
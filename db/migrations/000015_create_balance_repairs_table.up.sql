@@ -0,0 +1,13 @@
+BEGIN;
+CREATE TABLE balance_repairs (
+    "id"                 serial NOT NULL PRIMARY KEY,
+    "user_id"            integer NOT NULL,
+    "recorded_current"   decimal(9,2) NOT NULL,
+    "recorded_withdrawn" decimal(9,2) NOT NULL,
+    "expected_current"   decimal(9,2) NOT NULL,
+    "expected_withdrawn" decimal(9,2) NOT NULL,
+    "created_at"         timestamp with time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE balance_repairs ADD CONSTRAINT "balance_repairs_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX balance_repairs_user_id_idx ON balance_repairs ("user_id", "id");
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS "withdrawals_refunded_check";
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS "refunded_at";
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS "refunded";
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS "status";
+DROP TYPE IF EXISTS withdrawal_status;
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+CREATE TYPE withdrawal_status AS ENUM ('PROCESSED', 'PARTIALLY_REFUNDED', 'REFUNDED');
+ALTER TABLE withdrawals ADD COLUMN "status" withdrawal_status NOT NULL DEFAULT 'PROCESSED';
+ALTER TABLE withdrawals ADD COLUMN "refunded" decimal(9,2) NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD COLUMN "refunded_at" timestamp with time zone;
+-- a withdrawal cannot be refunded for more than has been withdrawn
+ALTER TABLE withdrawals ADD CONSTRAINT "withdrawals_refunded_check" CHECK ("refunded" >= 0 AND "refunded" <= "sum");
+COMMIT;
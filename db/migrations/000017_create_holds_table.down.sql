@@ -0,0 +1,25 @@
+BEGIN;
+DROP INDEX IF EXISTS holds_held_expires_at_idx;
+DROP INDEX IF EXISTS holds_held_number_uniq_idx;
+DROP TABLE IF EXISTS holds;
+DROP TYPE IF EXISTS hold_status;
+ALTER TABLE balance_repairs DROP COLUMN IF EXISTS "expected_held";
+ALTER TABLE balance_repairs DROP COLUMN IF EXISTS "recorded_held";
+-- the held points go back to the users
+UPDATE users SET "balance_current" = "balance_current" + "balance_held" WHERE "balance_held" > 0;
+ALTER TABLE users DROP COLUMN IF EXISTS "balance_held";
+-- holding and releasing the points leave no trace without the held account,
+-- whereas captured points are withdrawn right from the current account
+DELETE FROM ledger_entries WHERE "kind" IN ('HOLD', 'RELEASE');
+UPDATE ledger_entries SET "debit_account" = 'current' WHERE "debit_account" = 'held';
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE text;
+ALTER TABLE ledger_entries ALTER COLUMN "debit_account" TYPE text;
+ALTER TABLE ledger_entries ALTER COLUMN "credit_account" TYPE text;
+DROP TYPE IF EXISTS ledger_entry_kind;
+DROP TYPE IF EXISTS ledger_account;
+CREATE TYPE ledger_entry_kind AS ENUM ('OPENING', 'ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL');
+CREATE TYPE ledger_account AS ENUM ('accrual', 'current', 'withdrawn');
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE ledger_entry_kind USING "kind"::ledger_entry_kind;
+ALTER TABLE ledger_entries ALTER COLUMN "debit_account" TYPE ledger_account USING "debit_account"::ledger_account;
+ALTER TABLE ledger_entries ALTER COLUMN "credit_account" TYPE ledger_account USING "credit_account"::ledger_account;
+COMMIT;
@@ -0,0 +1,24 @@
+ALTER TYPE ledger_entry_kind ADD VALUE IF NOT EXISTS 'HOLD';
+ALTER TYPE ledger_entry_kind ADD VALUE IF NOT EXISTS 'RELEASE';
+ALTER TYPE ledger_account ADD VALUE IF NOT EXISTS 'held';
+BEGIN;
+ALTER TABLE users ADD COLUMN "balance_held" decimal(9,2) NOT NULL DEFAULT 0 CHECK ("balance_held" >= 0);
+ALTER TABLE balance_repairs ADD COLUMN "recorded_held" decimal(9,2) NOT NULL DEFAULT 0;
+ALTER TABLE balance_repairs ADD COLUMN "expected_held" decimal(9,2) NOT NULL DEFAULT 0;
+
+CREATE TYPE hold_status AS ENUM ('HELD', 'CAPTURED', 'RELEASED', 'EXPIRED');
+CREATE TABLE holds (
+    "id"           serial NOT NULL PRIMARY KEY,
+    "user_id"      integer NOT NULL,
+    "number"       text NOT NULL,
+    "sum"          decimal(9,2) NOT NULL CHECK ("sum" > 0),
+    "status"       hold_status NOT NULL DEFAULT 'HELD',
+    "created_at"   timestamp with time zone NOT NULL DEFAULT now(),
+    "expires_at"   timestamp with time zone NOT NULL,
+    "finalized_at" timestamp with time zone NULL
+);
+ALTER TABLE holds ADD CONSTRAINT "holds_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+-- an order is paid with only one hold at a time
+CREATE UNIQUE INDEX holds_held_number_uniq_idx ON holds ("number") WHERE "status" = 'HELD';
+CREATE INDEX holds_held_expires_at_idx ON holds ("expires_at", "id") WHERE "status" = 'HELD';
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+DROP INDEX IF EXISTS point_lots_expires_at_idx;
+DROP INDEX IF EXISTS point_lots_user_id_idx;
+DROP TABLE IF EXISTS point_lots;
+-- the expired points are taken back from the users in the same way as the negative adjustments are
+UPDATE ledger_entries SET "kind" = 'ADJUSTMENT' WHERE "kind" = 'EXPIRATION';
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE text;
+DROP TYPE IF EXISTS ledger_entry_kind;
+CREATE TYPE ledger_entry_kind AS ENUM ('OPENING', 'ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL', 'HOLD', 'RELEASE');
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE ledger_entry_kind USING "kind"::ledger_entry_kind;
+COMMIT;
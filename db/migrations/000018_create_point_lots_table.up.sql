@@ -0,0 +1,20 @@
+ALTER TYPE ledger_entry_kind ADD VALUE IF NOT EXISTS 'EXPIRATION';
+BEGIN;
+CREATE TABLE point_lots (
+    "id"         bigserial NOT NULL PRIMARY KEY,
+    "user_id"    integer NOT NULL,
+    "amount"     decimal(9,2) NOT NULL CHECK ("amount" > 0),
+    "remaining"  decimal(9,2) NOT NULL CHECK ("remaining" >= 0),
+    "created_at" timestamp with time zone NOT NULL DEFAULT now(),
+    "expires_at" timestamp with time zone NULL,
+    CONSTRAINT point_lots_remaining_check CHECK ("remaining" <= "amount")
+);
+ALTER TABLE point_lots ADD CONSTRAINT "point_lots_user_id_fk_users" FOREIGN KEY ("user_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+-- the lots are spent in the order they have been accrued in
+CREATE INDEX point_lots_user_id_idx ON point_lots ("user_id", "id") WHERE "remaining" > 0;
+CREATE INDEX point_lots_expires_at_idx ON point_lots ("expires_at", "user_id") WHERE "remaining" > 0;
+-- the points accrued before the lots were introduced never expire
+INSERT INTO point_lots ("user_id", "amount", "remaining")
+SELECT "id", "balance_current" + "balance_held", "balance_current" + "balance_held"
+FROM users WHERE "balance_current" + "balance_held" > 0 ORDER BY "id";
+COMMIT;
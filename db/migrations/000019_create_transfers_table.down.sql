@@ -0,0 +1,13 @@
+BEGIN;
+DROP INDEX IF EXISTS transfers_recipient_id_idx;
+DROP INDEX IF EXISTS transfers_sender_id_created_at_idx;
+DROP TABLE IF EXISTS transfers;
+-- the transferred points are given and taken back in the same way as the adjustments are
+UPDATE ledger_entries SET "kind" = 'ADJUSTMENT' WHERE "kind" = 'TRANSFER';
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE text;
+DROP TYPE IF EXISTS ledger_entry_kind;
+CREATE TYPE ledger_entry_kind AS ENUM (
+    'OPENING', 'ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL', 'HOLD', 'RELEASE', 'EXPIRATION'
+);
+ALTER TABLE ledger_entries ALTER COLUMN "kind" TYPE ledger_entry_kind USING "kind"::ledger_entry_kind;
+COMMIT;
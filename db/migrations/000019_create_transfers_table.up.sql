@@ -0,0 +1,16 @@
+ALTER TYPE ledger_entry_kind ADD VALUE IF NOT EXISTS 'TRANSFER';
+BEGIN;
+CREATE TABLE transfers (
+    "id"           serial NOT NULL PRIMARY KEY,
+    "sender_id"    integer NOT NULL,
+    "recipient_id" integer NOT NULL,
+    "amount"       decimal(9,2) NOT NULL CHECK ("amount" > 0),
+    "created_at"   timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT transfers_recipient_check CHECK ("recipient_id" <> "sender_id")
+);
+ALTER TABLE transfers ADD CONSTRAINT "transfers_sender_id_fk_users" FOREIGN KEY ("sender_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE transfers ADD CONSTRAINT "transfers_recipient_id_fk_users" FOREIGN KEY ("recipient_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+-- the points sent by a user within a day are summed up to check against the daily limit
+CREATE INDEX transfers_sender_id_created_at_idx ON transfers ("sender_id", "created_at");
+CREATE INDEX transfers_recipient_id_idx ON transfers ("recipient_id");
+COMMIT;
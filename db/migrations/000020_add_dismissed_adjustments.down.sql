@@ -0,0 +1,9 @@
+BEGIN;
+DELETE FROM accrual_adjustments WHERE "status" = 'DISMISSED';
+ALTER TYPE accrual_adjustment_status RENAME TO accrual_adjustment_status_old;
+CREATE TYPE accrual_adjustment_status AS ENUM ('PENDING', 'APPLIED');
+DROP INDEX IF EXISTS accrual_adjustments_pending_order_id_uniq_idx;
+ALTER TABLE accrual_adjustments ALTER COLUMN "status" TYPE accrual_adjustment_status USING "status"::text::accrual_adjustment_status;
+CREATE UNIQUE INDEX accrual_adjustments_pending_order_id_uniq_idx ON accrual_adjustments ("order_id") WHERE "status" = 'PENDING';
+DROP TYPE accrual_adjustment_status_old;
+COMMIT;
@@ -0,0 +1 @@
+ALTER TYPE accrual_adjustment_status ADD VALUE IF NOT EXISTS 'DISMISSED';
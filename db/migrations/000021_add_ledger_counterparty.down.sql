@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS "ledger_entries_counterparty_id_fk_users";
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS "counterparty_id";
+COMMIT;
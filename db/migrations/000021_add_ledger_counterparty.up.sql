@@ -0,0 +1,5 @@
+BEGIN;
+-- the other user of a transfer, so that each side's entry tells whom the points went to or came from
+ALTER TABLE ledger_entries ADD COLUMN "counterparty_id" integer NULL;
+ALTER TABLE ledger_entries ADD CONSTRAINT "ledger_entries_counterparty_id_fk_users" FOREIGN KEY ("counterparty_id") REFERENCES users ("id") DEFERRABLE INITIALLY DEFERRED;
+COMMIT;
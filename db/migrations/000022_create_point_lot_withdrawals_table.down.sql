@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS point_lot_withdrawals;
+COMMIT;
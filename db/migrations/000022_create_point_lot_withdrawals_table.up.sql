@@ -0,0 +1,10 @@
+BEGIN;
+-- the points each withdrawal has taken from the lots, so that a refund returns the points to the same lots
+CREATE TABLE point_lot_withdrawals (
+    "lot_id" bigint NOT NULL,
+    "number" text NOT NULL,
+    "amount" decimal(9,2) NOT NULL CHECK ("amount" >= 0),
+    PRIMARY KEY ("number", "lot_id")
+);
+ALTER TABLE point_lot_withdrawals ADD CONSTRAINT "point_lot_withdrawals_lot_id_fk_point_lots" FOREIGN KEY ("lot_id") REFERENCES point_lots ("id") DEFERRABLE INITIALLY DEFERRED;
+COMMIT;
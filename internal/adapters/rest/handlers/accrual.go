@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+)
+
+type AccrualCallbackReq struct {
+	Order   string          `json:"order" binding:"required,numeric"`
+	Status  string          `json:"status" binding:"required,oneof=REGISTERED PROCESSING INVALID PROCESSED"`
+	Accrual decimal.Decimal `json:"accrual"`
+}
+
+// AcceptAccrualCallback applies the order status pushed by the accrual system,
+// so that the user does not have to wait for the order to be polled.
+// Callbacks with statuses that are not final yet are accepted but leave the order in the queue
+func (h *Handler) AcceptAccrualCallback(c *gin.Context) {
+	var req AccrualCallbackReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate accrual callback")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Accrual.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "accrual cannot be negative"})
+		return
+	}
+	result := accrual.OrderStatus{Number: req.Order, Status: req.Status, Accrual: req.Accrual}
+	if err := h.app.OrderService.ApplyAccrualResult(c.Request.Context(), result); err != nil {
+		switch {
+		case errors.Is(err, order.ErrOrderIsNotProcessedYet):
+			c.JSON(http.StatusAccepted, gin.H{"result": "accepted"})
+		case errors.Is(err, orders.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, order.ErrOrderStatusTransitionNotAllowed):
+			log.Warn().Err(err).Str("path", c.FullPath()).Str("number", req.Order).Msg("Unable to apply accrual callback")
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Error().Err(err).Str("path", c.FullPath()).Str("number", req.Order).Msg("Unable to apply accrual callback")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "applied"})
+}
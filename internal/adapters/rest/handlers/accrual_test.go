@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+	"github.com/sergeii/practikum-go-gophermart/pkg/security/signature"
+)
+
+func withAccrualWebhookSecret(cfg *config.Config) {
+	cfg.AccrualWebhookSecret = "s3cr3t"
+	cfg.AccrualWebhookTolerance = time.Minute
+}
+
+func doAccrualCallback(ts *httptest.Server, body string, sentAt time.Time, secret string) int {
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/internal/accrual/callback", strings.NewReader(body),
+		testutils.WithHeader("X-Accrual-Timestamp", strconv.FormatInt(sentAt.Unix(), 10)),
+		testutils.WithHeader("X-Accrual-Signature", signature.Sign([]byte(secret), sentAt, []byte(body))),
+	)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHandler_AccrualCallback_RequiresSignature(t *testing.T) {
+	body := `{"order":"1234567812345670","status":"PROCESSING"}`
+	tests := []struct {
+		name       string
+		configured bool
+		sentAt     time.Time
+		secret     string
+		wantStatus int
+	}{
+		{
+			"callbacks are disabled",
+			false,
+			time.Now(),
+			"s3cr3t",
+			404,
+		},
+		{
+			"invalid signature",
+			true,
+			time.Now(),
+			"secret",
+			401,
+		},
+		{
+			"request is too old",
+			true,
+			time.Now().Add(-time.Minute * 2),
+			"s3cr3t",
+			401,
+		},
+		{
+			"request is from the future",
+			true,
+			time.Now().Add(time.Minute * 2),
+			"s3cr3t",
+			401,
+		},
+		{
+			"valid signature",
+			true,
+			time.Now(),
+			"s3cr3t",
+			404,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []testutils.TestServerOpt{}
+			if tt.configured {
+				opts = append(opts, withAccrualWebhookSecret)
+			}
+			ts, _, cancel := testutils.PrepareTestServer(opts...)
+			defer cancel()
+			status := doAccrualCallback(ts, body, tt.sentAt, tt.secret)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
+
+func TestHandler_AccrualCallback_MissingHeaders(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer(withAccrualWebhookSecret)
+	defer cancel()
+
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/internal/accrual/callback",
+		strings.NewReader(`{"order":"1234567812345670","status":"PROCESSING"}`),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func TestHandler_AccrualCallback_AppliesResult(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer(withAccrualWebhookSecret)
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	_, err := app.OrderService.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+
+	status := doAccrualCallback(ts, `{"order":"1234567812345670","status":"PROCESSING"}`, time.Now(), "s3cr3t")
+	assert.Equal(t, 202, status)
+	o, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
+	require.Len(t, o, 1)
+	assert.Equal(t, orders.OrderStatusProcessing, o[0].Status)
+
+	body := `{"order":"1234567812345670","status":"PROCESSED","accrual":100.5}`
+	status = doAccrualCallback(ts, body, time.Now(), "s3cr3t")
+	assert.Equal(t, 200, status)
+	o, _, _ = app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
+	assert.Equal(t, orders.OrderStatusProcessed, o[0].Status)
+	assert.Equal(t, "100.5", o[0].Accrual.String())
+	balance, _ := app.UserService.GetBalance(context.TODO(), u.ID)
+	assert.Equal(t, "100.5", balance.Current.String())
+
+	// the same result pushed again does not accrue the points twice
+	status = doAccrualCallback(ts, body, time.Now(), "s3cr3t")
+	assert.Equal(t, 409, status)
+	balance, _ = app.UserService.GetBalance(context.TODO(), u.ID)
+	assert.Equal(t, "100.5", balance.Current.String())
+
+	status = doAccrualCallback(ts, `{"order":"79927398713","status":"INVALID"}`, time.Now(), "s3cr3t")
+	assert.Equal(t, 404, status)
+	status = doAccrualCallback(ts, `{"order":"79927398713","status":"UNKNOWN"}`, time.Now(), "s3cr3t")
+	assert.Equal(t, 400, status)
+	status = doAccrualCallback(ts, `{"order":"79927398713","status":"PROCESSED","accrual":-1}`, time.Now(), "s3cr3t")
+	assert.Equal(t, 400, status)
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/adjustments"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/reconciliation"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+)
+
+const defaultAdminListLimit = 100
+
+type ListFailedOrdersReq struct {
+	After int `form:"after" binding:"gte=0"`
+	Limit int `form:"limit" binding:"omitempty,gt=0,lte=1000"`
+}
+
+type AdminOrderRespItem struct {
+	ID         int                `json:"id"`
+	Number     string             `json:"number"`
+	UserID     int                `json:"user_id"` // nolint: tagliatelle
+	Status     orders.OrderStatus `json:"status"`
+	Attempts   int                `json:"attempts"`
+	UploadedAt time.Time          `json:"uploaded_at"` // nolint: tagliatelle
+}
+
+func newAdminOrderRespItem(o orders.Order) AdminOrderRespItem {
+	return AdminOrderRespItem{
+		ID:         o.ID,
+		Number:     o.Number,
+		UserID:     o.User.ID,
+		Status:     o.Status,
+		Attempts:   o.Attempts,
+		UploadedAt: o.UploadedAt,
+	}
+}
+
+// ListFailedOrders lists the orders that have run out of processing attempts.
+// The list is paginated with the ID of the last order on the previous page passed as the "after" parameter
+func (h *Handler) ListFailedOrders(c *gin.Context) {
+	var query ListFailedOrdersReq
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate failed orders request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultAdminListLimit
+	}
+	failed, err := h.app.OrderService.GetFailedOrders(c.Request.Context(), query.After, query.Limit)
+	if err != nil {
+		log.Error().Err(err).Str("path", c.FullPath()).Msg("Unable to fetch failed orders")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(failed) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]AdminOrderRespItem, 0, len(failed))
+	for _, o := range failed {
+		jsonItems = append(jsonItems, newAdminOrderRespItem(o))
+	}
+	c.JSON(http.StatusOK, jsonItems)
+}
+
+// RequeueFailedOrder puts an order that has run out of processing attempts back into the processing queue
+func (h *Handler) RequeueFailedOrder(c *gin.Context) {
+	number := c.Param("number")
+	o, err := h.app.OrderService.RequeueFailedOrder(c.Request.Context(), number)
+	if err != nil {
+		log.Warn().Err(err).Str("path", c.FullPath()).Str("number", number).Msg("Unable to requeue failed order")
+		switch {
+		case errors.Is(err, orders.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, order.ErrOrderIsNotFailed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, queue.ErrQueueIsFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	log.Info().Str("path", c.FullPath()).Str("number", number).Msg("Requeued failed order")
+	c.JSON(http.StatusOK, gin.H{"result": newAdminOrderRespItem(o)})
+}
+
+type AdjustmentRespItem struct {
+	ID        int                `json:"id"`
+	OrderID   int                `json:"order_id"` // nolint: tagliatelle
+	UserID    int                `json:"user_id"`  // nolint: tagliatelle
+	Recorded  float64            `json:"recorded"`
+	Actual    float64            `json:"actual"`
+	Amount    float64            `json:"amount"`
+	Status    adjustments.Status `json:"status"`
+	CreatedAt time.Time          `json:"created_at"` // nolint: tagliatelle
+}
+
+func newAdjustmentRespItem(a adjustments.Adjustment) AdjustmentRespItem {
+	return AdjustmentRespItem{
+		ID:        a.ID,
+		OrderID:   a.OrderID,
+		UserID:    a.UserID,
+		Recorded:  encode.DecimalToFloat(a.Recorded),
+		Actual:    encode.DecimalToFloat(a.Actual),
+		Amount:    encode.DecimalToFloat(a.Amount()),
+		Status:    a.Status,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+// ListPendingAdjustments lists the accrual mismatches found by reconciliation that await review.
+// The list is paginated the same way the failed orders are
+func (h *Handler) ListPendingAdjustments(c *gin.Context) {
+	var query ListFailedOrdersReq
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate pending adjustments request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultAdminListLimit
+	}
+	pending, err := h.app.Reconciliation.GetPendingAdjustments(c.Request.Context(), query.After, query.Limit)
+	if err != nil {
+		log.Error().Err(err).Str("path", c.FullPath()).Msg("Unable to fetch pending adjustments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(pending) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]AdjustmentRespItem, 0, len(pending))
+	for _, a := range pending {
+		jsonItems = append(jsonItems, newAdjustmentRespItem(a))
+	}
+	c.JSON(http.StatusOK, jsonItems)
+}
+
+// ApplyAdjustment settles a pending accrual mismatch with the user's balance
+func (h *Handler) ApplyAdjustment(c *gin.Context) {
+	adjID, ok := adjustmentIDParam(c)
+	if !ok {
+		return
+	}
+	adj, err := h.app.Reconciliation.ApplyAdjustment(c.Request.Context(), adjID)
+	if err != nil {
+		log.Warn().Err(err).Str("path", c.FullPath()).Int("ID", adjID).Msg("Unable to apply adjustment")
+		switch {
+		case errors.Is(err, adjustments.ErrAdjustmentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, reconciliation.ErrAdjustmentIsStale):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, users.ErrUserHasInsufficientBalance):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": newAdjustmentRespItem(adj)})
+}
+
+// DismissAdjustment closes a pending accrual mismatch without changing the order or the user's balance
+func (h *Handler) DismissAdjustment(c *gin.Context) {
+	adjID, ok := adjustmentIDParam(c)
+	if !ok {
+		return
+	}
+	adj, err := h.app.Reconciliation.DismissAdjustment(c.Request.Context(), adjID)
+	if err != nil {
+		log.Warn().Err(err).Str("path", c.FullPath()).Int("ID", adjID).Msg("Unable to dismiss adjustment")
+		if errors.Is(err, adjustments.ErrAdjustmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": newAdjustmentRespItem(adj)})
+}
+
+// adjustmentIDParam reads the adjustment's ID from the path. Invalid IDs are reported as not found
+func adjustmentIDParam(c *gin.Context) (int, bool) {
+	adjID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || adjID <= 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": adjustments.ErrAdjustmentNotFound.Error()})
+		return 0, false
+	}
+	return adjID, true
+}
+
+type AccrualStatusResp struct {
+	State    breaker.State `json:"state"`
+	Failures int           `json:"failures"`
+	OpenedAt *time.Time    `json:"opened_at,omitempty"` // nolint: tagliatelle
+	RetryIn  float64       `json:"retry_in"`            // nolint: tagliatelle
+}
+
+// ShowAccrualStatus reports the state of the circuit breaker guarding the accrual system.
+// The time left until the breaker lets requests through again is reported in seconds
+func (h *Handler) ShowAccrualStatus(c *gin.Context) {
+	stats := h.app.AccrualBreaker.Stats()
+	resp := AccrualStatusResp{
+		State:    stats.State,
+		Failures: stats.Failures,
+		RetryIn:  stats.RetryIn.Seconds(),
+	}
+	if !stats.OpenedAt.IsZero() {
+		resp.OpenedAt = &stats.OpenedAt
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type RefundWithdrawalReq struct {
+	Sum float64 `json:"sum" binding:"omitempty,gt=0"`
+}
+
+type AdminWithdrawalResp struct {
+	ID          int                          `json:"id"`
+	Order       string                       `json:"order"`
+	UserID      int                          `json:"user_id"` // nolint: tagliatelle
+	Sum         float64                      `json:"sum"`
+	Status      withdrawals.WithdrawalStatus `json:"status"`
+	Refunded    float64                      `json:"refunded"`
+	ProcessedAt time.Time                    `json:"processed_at"`          // nolint: tagliatelle
+	RefundedAt  *time.Time                   `json:"refunded_at,omitempty"` // nolint: tagliatelle
+}
+
+// RefundWithdrawal returns the points spent on a withdrawal back to the user.
+// The withdrawal is refunded in full unless the sum to refund is specified in the request body.
+// Refunding an already refunded withdrawal for the same sum responds with the refunded withdrawal again
+func (h *Handler) RefundWithdrawal(c *gin.Context) {
+	number := c.Param("number")
+	var json RefundWithdrawalReq
+	// the request body is optional
+	if err := c.ShouldBindJSON(&json); err != nil && !errors.Is(err, io.EOF) {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate withdrawal refund request")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	w, err := h.app.WithdrawalService.RefundWithdrawal(c.Request.Context(), number, decimal.NewFromFloat(json.Sum))
+	if err != nil {
+		log.Warn().Err(err).Str("path", c.FullPath()).Str("number", number).Msg("Unable to refund withdrawal")
+		switch {
+		case errors.Is(err, withdrawals.ErrWithdrawalNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, withdrawal.ErrWithdrawalAlreadyRefunded):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, withdrawal.ErrWithdrawalInvalidRefundSum),
+			errors.Is(err, users.ErrUserHasInsufficientWithdrawn):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	resp := AdminWithdrawalResp{
+		ID:          w.ID,
+		Order:       w.Number,
+		UserID:      w.User.ID,
+		Sum:         encode.DecimalToFloat(w.Sum),
+		Status:      w.Status,
+		Refunded:    encode.DecimalToFloat(w.Refunded),
+		ProcessedAt: w.ProcessedAt,
+	}
+	if !w.RefundedAt.IsZero() {
+		resp.RefundedAt = &w.RefundedAt
+	}
+	c.JSON(http.StatusOK, gin.H{"result": resp})
+}
@@ -0,0 +1,349 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type adminOrderItemSchema struct {
+	ID       int    `json:"id"`
+	Number   string `json:"number"`
+	UserID   int    `json:"user_id"` // nolint: tagliatelle
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+}
+
+func withAdminToken(cfg *config.Config) {
+	cfg.AdminToken = "s3cr3t"
+}
+
+func TestHandler_Admin_RequiresToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured bool
+		header     string
+		wantStatus int
+	}{
+		{
+			"admin api is disabled",
+			false,
+			"Bearer s3cr3t",
+			404,
+		},
+		{
+			"no token",
+			true,
+			"",
+			401,
+		},
+		{
+			"not a bearer token",
+			true,
+			"s3cr3t",
+			401,
+		},
+		{
+			"invalid token",
+			true,
+			"Bearer secret",
+			403,
+		},
+		{
+			"valid token",
+			true,
+			"Bearer s3cr3t",
+			204,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []testutils.TestServerOpt{}
+			if tt.configured {
+				opts = append(opts, withAdminToken)
+			}
+			ts, _, cancel := testutils.PrepareTestServer(opts...)
+			defer cancel()
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodGet, "/api/admin/orders/failed", nil,
+				testutils.WithHeader("Authorization", tt.header),
+			)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Admin_FailedOrders(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer(withAdminToken)
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, number := range []string{"1234567812345670", "79927398713"} {
+		_, err := app.OrderService.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+	err := app.OrderService.UpdateOrderStatus(
+		context.TODO(), "79927398713", orders.OrderStatusFailed, decimal.Zero, orderevents.SourceAdmin,
+	)
+	require.NoError(t, err)
+
+	var items []adminOrderItemSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/admin/orders/failed", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+		testutils.MustBindJSON(&items),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, items, 1)
+	assert.Equal(t, "79927398713", items[0].Number)
+	assert.Equal(t, "FAILED", items[0].Status)
+	assert.Equal(t, u.ID, items[0].UserID)
+
+	qLenBefore, _ := app.OrderService.ProcessingLength(context.TODO())
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/admin/orders/79927398713/requeue", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	o, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
+	require.Len(t, o, 2)
+	assert.Equal(t, orders.OrderStatusNew, o[1].Status)
+	qLen, _ := app.OrderService.ProcessingLength(context.TODO())
+	assert.Equal(t, qLenBefore+1, qLen)
+
+	// the order is not failed anymore
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/admin/orders/79927398713/requeue", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/admin/orders/4561261212345467/requeue", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/admin/orders/failed", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+}
+
+func TestHandler_Admin_AccrualStatus(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer(withAdminToken)
+	defer cancel()
+
+	var status struct {
+		State    string  `json:"state"`
+		Failures int     `json:"failures"`
+		RetryIn  float64 `json:"retry_in"` // nolint: tagliatelle
+	}
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/admin/accrual/status", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+		testutils.MustBindJSON(&status),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "closed", status.State)
+	assert.Equal(t, 0, status.Failures)
+	assert.Equal(t, 0.0, status.RetryIn)
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodGet, "/api/admin/accrual/status", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func TestHandler_Admin_PendingAdjustments(t *testing.T) {
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		c.JSON(200, accrual.OrderStatus{Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.NewFromInt(80)})
+	})
+	accrualServer := httptest.NewServer(r)
+	defer accrualServer.Close()
+
+	ts, app, cancel := testutils.PrepareTestServer(withAdminToken, func(cfg *config.Config) {
+		cfg.AccrualSystemURL = accrualServer.URL
+		cfg.ReconcilePolicy = "review"
+	})
+	defer cancel()
+
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/admin/adjustments/pending", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	_, err := app.OrderService.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+	// the points are credited to the user, so that they can be taken back
+	err = app.OrderService.ApplyAccrualResult(context.TODO(), accrual.OrderStatus{
+		Number: "79927398713", Status: "PROCESSED", Accrual: decimal.NewFromInt(100),
+	})
+	require.NoError(t, err)
+	report, err := app.Reconciliation.Reconcile(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Queued)
+
+	var items []struct {
+		ID       int     `json:"id"`
+		UserID   int     `json:"user_id"` // nolint: tagliatelle
+		Recorded float64 `json:"recorded"`
+		Actual   float64 `json:"actual"`
+		Amount   float64 `json:"amount"`
+	}
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/admin/adjustments/pending", nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+		testutils.MustBindJSON(&items),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, items, 1)
+	assert.Equal(t, u.ID, items[0].UserID)
+	assert.Equal(t, 100.0, items[0].Recorded)
+	assert.Equal(t, 80.0, items[0].Actual)
+	assert.Equal(t, -20.0, items[0].Amount)
+
+	path := fmt.Sprintf("/api/admin/adjustments/%d/apply", items[0].ID)
+	var applied struct {
+		Result struct {
+			Status string  `json:"status"`
+			Amount float64 `json:"amount"`
+		} `json:"result"`
+	}
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, path, nil,
+		testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+		testutils.MustBindJSON(&applied),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "APPLIED", applied.Result.Status)
+	assert.Equal(t, -20.0, applied.Result.Amount)
+	balance, _ := app.UserService.GetBalance(context.TODO(), u.ID)
+	assert.Equal(t, "80", balance.Current.String())
+
+	for _, path := range []string{
+		path,
+		fmt.Sprintf("/api/admin/adjustments/%d/dismiss", items[0].ID),
+		"/api/admin/adjustments/foo/dismiss",
+	} {
+		resp, _ = testutils.DoTestRequest(
+			ts, http.MethodPost, path, nil, testutils.WithHeader("Authorization", "Bearer s3cr3t"),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 404, resp.StatusCode, path)
+	}
+}
+
+func TestHandler_Admin_RefundWithdrawal(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer(withAdminToken)
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	require.NoError(t, app.UserService.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	for _, number := range []string{"1234567812345670", "79927398713"} {
+		_, err := app.WithdrawalService.RequestWithdrawal(context.TODO(), number, u.ID, decimal.NewFromInt(4))
+		require.NoError(t, err)
+	}
+
+	type refundRespSchema struct {
+		Result struct {
+			ID       int     `json:"id"`
+			Order    string  `json:"order"`
+			UserID   int     `json:"user_id"` // nolint: tagliatelle
+			Sum      float64 `json:"sum"`
+			Status   string  `json:"status"`
+			Refunded float64 `json:"refunded"`
+		} `json:"result"`
+	}
+	tests := []struct {
+		name         string
+		number       string
+		body         string
+		wantStatus   int
+		wantRefunded float64
+		wantCurrent  string
+	}{
+		{"refund in full", "1234567812345670", "", 200, 4, "6"},
+		{"refund again", "1234567812345670", "", 200, 4, "6"},
+		{"refund again for same sum", "1234567812345670", `{"sum":4}`, 200, 4, "6"},
+		{"refund again for another sum", "1234567812345670", `{"sum":1}`, 409, 0, "6"},
+		{"refund more than withdrawn", "79927398713", `{"sum":4.01}`, 400, 0, "6"},
+		{"refund negative sum", "79927398713", `{"sum":-1}`, 422, 0, "6"},
+		{"invalid body", "79927398713", `{"sum":"foo"}`, 422, 0, "6"},
+		{"refund part of sum", "79927398713", `{"sum":1.5}`, 200, 1.5, "7.5"},
+		{"unknown withdrawal", "4561261212345467", "", 404, 0, "7.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var respJSON refundRespSchema
+			opts := []testutils.TestRequestOpt{testutils.WithHeader("Authorization", "Bearer s3cr3t")}
+			if tt.wantStatus == 200 {
+				opts = append(opts, testutils.MustBindJSON(&respJSON))
+			}
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/admin/withdrawals/"+tt.number+"/refund",
+				strings.NewReader(tt.body), opts...,
+			)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus == 200 {
+				assert.Equal(t, tt.number, respJSON.Result.Order)
+				assert.Equal(t, u.ID, respJSON.Result.UserID)
+				assert.Equal(t, 4.0, respJSON.Result.Sum)
+				assert.Equal(t, tt.wantRefunded, respJSON.Result.Refunded)
+			}
+			balance, _ := app.UserService.GetBalance(context.TODO(), u.ID)
+			assert.Equal(t, tt.wantCurrent, balance.Current.String())
+		})
+	}
+
+	// the user sees the refunds
+	var items []struct {
+		Order    string  `json:"order"`
+		Status   string  `json:"status"`
+		Refunded float64 `json:"refunded"`
+	}
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/withdrawals", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&items),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, items, 2)
+	assert.Equal(t, "REFUNDED", items[0].Status)
+	assert.Equal(t, 4.0, items[0].Refunded)
+	assert.Equal(t, "PARTIALLY_REFUNDED", items[1].Status)
+	assert.Equal(t, 1.5, items[1].Refunded)
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodPost, "/api/admin/withdrawals/79927398713/refund", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
@@ -2,20 +2,30 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
 )
 
+type ExpiringPointsRespItem struct {
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"` // nolint: tagliatelle
+}
+
 type UserBalanceResp struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   float64                  `json:"current"`
+	Withdrawn float64                  `json:"withdrawn"`
+	Held      float64                  `json:"held"`
+	Expiring  []ExpiringPointsRespItem `json:"expiring"`
 }
 
+// ShowUserBalance shows the user's balance along with the nearest expirations of the user's points
 func (h *Handler) ShowUserBalance(c *gin.Context) {
 	u := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
 	balance, err := h.app.UserService.GetBalance(c.Request.Context(), u.ID)
@@ -24,9 +34,83 @@ func (h *Handler) ShowUserBalance(c *gin.Context) {
 			Err(err).Str("path", c.FullPath()).Int("userID", u.ID).
 			Msg("Unable to show user balance due to error")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	expirations, err := h.app.UserService.GetUpcomingExpirations(c.Request.Context(), u.ID)
+	if err != nil {
+		log.Error().
+			Err(err).Str("path", c.FullPath()).Int("userID", u.ID).
+			Msg("Unable to show upcoming expirations due to error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	expiring := make([]ExpiringPointsRespItem, 0, len(expirations))
+	for _, e := range expirations {
+		expiring = append(expiring, ExpiringPointsRespItem{encode.DecimalToFloat(e.Amount), e.ExpiresAt})
 	}
 	c.JSON(http.StatusOK, UserBalanceResp{
 		encode.DecimalToFloat(balance.Current),
 		encode.DecimalToFloat(balance.Withdrawn),
+		encode.DecimalToFloat(balance.Held),
+		expiring,
 	})
 }
+
+type BalanceHistoryRespItem struct {
+	ID        int                `json:"id"`
+	Kind      ledgerentries.Kind `json:"kind"`
+	Amount    float64            `json:"amount"`
+	Order     string             `json:"order,omitempty"`
+	Balance   float64            `json:"balance"`
+	CreatedAt time.Time          `json:"created_at"` // nolint: tagliatelle
+}
+
+// ListBalanceHistory lists the changes of the user's balance page by page, oldest first unless sorted otherwise.
+// Every change comes with the current balance right after it. The changes may be filtered by their time.
+// Unless the page is the last one, the cursor pointing at the next page is returned in the headers
+func (h *Handler) ListBalanceHistory(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	var req ListPageReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate balance history request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := req.cursor()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := ledgerentries.ListQuery{
+		CreatedFrom: req.From,
+		CreatedTo:   req.To,
+		Descending:  req.Sort == "desc",
+		After:       after,
+		Limit:       req.limit(),
+	}
+	entries, next, err := h.app.UserService.GetBalanceHistoryPage(c.Request.Context(), user.ID, query)
+	if err != nil {
+		log.Warn().
+			Err(err).Str("path", c.FullPath()).Int("userID", user.ID).
+			Msg("Unable to fetch balance history for user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]BalanceHistoryRespItem, 0, len(entries))
+	for _, e := range entries {
+		jsonItems = append(jsonItems, BalanceHistoryRespItem{
+			e.ID,
+			e.Kind,
+			encode.DecimalToFloat(e.Change(ledgerentries.AccountCurrent)),
+			e.OrderNumber,
+			encode.DecimalToFloat(e.Balance),
+			e.CreatedAt,
+		})
+	}
+	setNextPageHeaders(c, next)
+	c.JSON(http.StatusOK, jsonItems)
+}
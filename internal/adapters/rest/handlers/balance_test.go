@@ -4,18 +4,27 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
 	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
 )
 
+type expiringPointsSchema struct {
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"` // nolint: tagliatelle
+}
+
 type showBalanceRespSchema struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   float64                `json:"current"`
+	Withdrawn float64                `json:"withdrawn"`
+	Held      float64                `json:"held"`
+	Expiring  []expiringPointsSchema `json:"expiring"`
 }
 
 func TestHandler_ShowUserBalance_OK(t *testing.T) {
@@ -69,10 +78,147 @@ func TestHandler_ShowUserBalance_OK(t *testing.T) {
 			require.Equal(t, 200, resp.StatusCode)
 			assert.Equal(t, encode.DecimalToFloat(current), respJSON.Current)
 			assert.Equal(t, encode.DecimalToFloat(withdrawn), respJSON.Withdrawn)
+			assert.Equal(t, 0.0, respJSON.Held)
+			// the points never expire unless configured otherwise
+			assert.Len(t, respJSON.Expiring, 0)
 		})
 	}
 }
 
+func TestHandler_ShowUserBalance_Expiring(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer(func(cfg *config.Config) {
+		cfg.PointsTTL = time.Hour * 24
+	})
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	before := time.Now()
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.NewFromInt(100)))
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("20.5")))
+	// the oldest points are spent first
+	require.NoError(t, app.UserService.WithdrawPoints(ctx, u.ID, decimal.NewFromInt(90)))
+
+	var respJSON showBalanceRespSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 30.5, respJSON.Current)
+	require.Len(t, respJSON.Expiring, 2)
+	assert.Equal(t, 10.0, respJSON.Expiring[0].Amount)
+	assert.Equal(t, 20.5, respJSON.Expiring[1].Amount)
+	assert.WithinDuration(t, before.Add(time.Hour*24), respJSON.Expiring[0].ExpiresAt, time.Second*5)
+	assert.False(t, respJSON.Expiring[1].ExpiresAt.Before(respJSON.Expiring[0].ExpiresAt))
+}
+
+type balanceHistoryItemSchema struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Amount    float64   `json:"amount"`
+	Order     string    `json:"order"`
+	Balance   float64   `json:"balance"`
+	CreatedAt time.Time `json:"created_at"` // nolint: tagliatelle
+}
+
+func TestHandler_ListBalanceHistory_OK(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret")
+	require.NoError(t, app.UserService.AccruePoints(ctx, other.ID, decimal.NewFromInt(1000)))
+
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/history", nil, testutils.WithUser(u, app),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	before := time.Now()
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.NewFromInt(100)))
+	_, err := app.WithdrawalService.RequestWithdrawal(ctx, "49927398716", u.ID, decimal.RequireFromString("30.5"))
+	require.NoError(t, err)
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.NewFromInt(-20)))
+
+	var respJSON []balanceHistoryItemSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/history", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+	require.Len(t, respJSON, 3)
+	assert.Equal(t, "ADJUSTMENT", respJSON[0].Kind)
+	assert.Equal(t, 100.0, respJSON[0].Amount)
+	assert.Equal(t, "", respJSON[0].Order)
+	assert.Equal(t, 100.0, respJSON[0].Balance)
+	assert.True(t, respJSON[0].CreatedAt.After(before))
+	assert.Equal(t, "WITHDRAWAL", respJSON[1].Kind)
+	assert.Equal(t, -30.5, respJSON[1].Amount)
+	assert.Equal(t, "49927398716", respJSON[1].Order)
+	assert.Equal(t, 69.5, respJSON[1].Balance)
+	assert.Equal(t, "ADJUSTMENT", respJSON[2].Kind)
+	assert.Equal(t, -20.0, respJSON[2].Amount)
+	assert.Equal(t, 49.5, respJSON[2].Balance)
+
+	// the cached balance always equals the ledger's
+	balance, _ := app.UserService.GetBalance(ctx, u.ID)
+	assert.Equal(t, "49.5", balance.Current.String())
+	assert.Equal(t, "30.5", balance.Withdrawn.String())
+
+	var page []balanceHistoryItemSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/history?sort=desc&limit=2", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&page),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.Len(t, page, 2)
+	assert.Equal(t, respJSON[2].ID, page[0].ID)
+	assert.Equal(t, respJSON[1].ID, page[1].ID)
+	cursor := resp.Header.Get("X-Next-Cursor")
+	require.NotEmpty(t, cursor)
+
+	page = nil
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/history?sort=desc&limit=2&cursor="+cursor, nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&page),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.Len(t, page, 1)
+	assert.Equal(t, respJSON[0].ID, page[0].ID)
+	assert.Equal(t, 100.0, page[0].Balance)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+}
+
+func TestHandler_ListBalanceHistory_Errors(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, query := range []string{"limit=1001", "sort=up", "from=yesterday", "cursor=foo"} {
+		resp, _ := testutils.DoTestRequest(
+			ts, http.MethodGet, "/api/user/balance/history?"+query, nil, testutils.WithUser(u, app),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode, query)
+	}
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/balance/history", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
 func TestHandler_ShowUserBalance_RequiresAuth(t *testing.T) {
 	ts, _, cancel := testutils.PrepareTestServer()
 	defer cancel()
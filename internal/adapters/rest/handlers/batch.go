@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+	"github.com/sergeii/practikum-go-gophermart/pkg/validation"
+)
+
+// orderBatchBytesPerNumber is the room a single order number may take in the request body,
+// including the quotes and separators around it
+const orderBatchBytesPerNumber = 64
+
+type BatchOrderResult string
+
+const (
+	BatchOrderAccepted        BatchOrderResult = "accepted"
+	BatchOrderAlreadyUploaded BatchOrderResult = "already_uploaded"
+	BatchOrderConflict        BatchOrderResult = "conflict"
+	BatchOrderInvalidFormat   BatchOrderResult = "invalid_format"
+	BatchOrderQueueIsFull     BatchOrderResult = "queue_full"
+	BatchOrderFailed          BatchOrderResult = "failed"
+)
+
+var errOrderBatchIsEmpty = errors.New("at least one order number is required")
+var errOrderBatchIsTooLarge = errors.New("order batch is too large")
+
+type UploadOrderBatchRespItem struct {
+	Number string           `json:"number"`
+	Result BatchOrderResult `json:"result"`
+}
+
+// UploadOrderBatch uploads several order numbers at once.
+// The numbers are passed either as a JSON array or as plain text, one number per line.
+// Every number is submitted on its own, so a rejected number does not affect the rest of the batch.
+// The outcome of each number is reported in the same order the numbers were passed in
+func (h *Handler) UploadOrderBatch(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	maxSize := h.app.Cfg.OrderBatchMaxSize
+	if maxSize <= 0 {
+		maxSize = config.DefaultOrderBatchMaxSize
+	}
+	numbers, err := readOrderBatch(c, int64(maxSize*orderBatchBytesPerNumber))
+	if err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Int("userID", user.ID).Msg("Invalid order batch")
+		if errors.Is(err, errOrderBatchIsTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(numbers) > maxSize {
+		c.JSON(
+			http.StatusRequestEntityTooLarge,
+			gin.H{"error": fmt.Sprintf("at most %d order numbers can be uploaded at once", maxSize)},
+		)
+		return
+	}
+	results := make([]UploadOrderBatchRespItem, 0, len(numbers))
+	for _, number := range numbers {
+		results = append(results, UploadOrderBatchRespItem{number, h.submitBatchOrder(c, number, user.ID)})
+	}
+	c.JSON(http.StatusOK, gin.H{"result": results})
+}
+
+func (h *Handler) submitBatchOrder(c *gin.Context, number string, userID int) BatchOrderResult {
+	if !validation.CheckLuhnNumber(number) {
+		return BatchOrderInvalidFormat
+	}
+	_, err := h.app.OrderService.SubmitNewOrder(c.Request.Context(), number, userID)
+	switch {
+	case err == nil:
+		return BatchOrderAccepted
+	case errors.Is(err, order.ErrOrderAlreadyUploaded):
+		return BatchOrderAlreadyUploaded
+	case errors.Is(err, order.ErrOrderUploadedByAnotherUser):
+		return BatchOrderConflict
+	case errors.Is(err, queue.ErrQueueIsFull):
+		return BatchOrderQueueIsFull
+	default:
+		log.Warn().
+			Err(err).Str("path", c.FullPath()).Str("number", number).Int("userID", userID).
+			Msg("Unable to upload order from batch")
+		return BatchOrderFailed
+	}
+}
+
+// readOrderBatch reads order numbers from either a JSON array or newline separated text.
+// Blank lines of the text are skipped.
+// The body is never read beyond maxBytes, a larger body is rejected with errOrderBatchIsTooLarge
+func readOrderBatch(c *gin.Context, maxBytes int64) ([]string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+	if err != nil {
+		// the reader gives up once it has read as many bytes as allowed
+		if int64(len(body)) >= maxBytes {
+			return nil, errOrderBatchIsTooLarge
+		}
+		return nil, err
+	}
+	var numbers []string
+	if c.ContentType() == binding.MIMEJSON {
+		if err = json.Unmarshal(body, &numbers); err != nil {
+			return nil, err
+		}
+		for i := range numbers {
+			numbers[i] = strings.TrimSpace(numbers[i])
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				numbers = append(numbers, line)
+			}
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, errOrderBatchIsEmpty
+	}
+	return numbers, nil
+}
@@ -0,0 +1,166 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type uploadOrderBatchRespSchema struct {
+	Result []struct {
+		Number string `json:"number"`
+		Result string `json:"result"`
+	} `json:"result"`
+}
+
+func TestHandler_UploadOrderBatch_OK(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			"json array",
+			"application/json",
+			`["1234567812345670", "79927398713", "4561261212345467", "79927398714", "1234567812345670", "49927398716"]`,
+		},
+		{
+			"newline separated text",
+			"text/plain",
+			"1234567812345670\n79927398713\r\n\n4561261212345467\n79927398714\n 1234567812345670\n49927398716\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, app, cancel := testutils.PrepareTestServer(func(cfg *config.Config) {
+				cfg.AccrualQueueSize = 3
+			})
+			defer cancel()
+
+			other, _ := app.UserService.RegisterNewUser(context.TODO(), "other", "secret")
+			_, err := app.OrderService.SubmitNewOrder(context.TODO(), "79927398713", other.ID)
+			require.NoError(t, err)
+
+			u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+			var respJSON uploadOrderBatchRespSchema
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body),
+				testutils.WithUser(u, app),
+				testutils.WithHeader("Content-Type", tt.contentType),
+				testutils.MustBindJSON(&respJSON),
+			)
+			resp.Body.Close()
+			assert.Equal(t, 200, resp.StatusCode)
+			require.Len(t, respJSON.Result, 6)
+			wantResults := []struct {
+				number string
+				result string
+			}{
+				{"1234567812345670", "accepted"},
+				{"79927398713", "conflict"},
+				{"4561261212345467", "accepted"},
+				{"79927398714", "invalid_format"},
+				{"1234567812345670", "already_uploaded"},
+				{"49927398716", "queue_full"},
+			}
+			for i, want := range wantResults {
+				assert.Equal(t, want.number, respJSON.Result[i].Number)
+				assert.Equal(t, want.result, respJSON.Result[i].Result)
+			}
+
+			userOrders, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
+			assert.Len(t, userOrders, 2)
+		})
+	}
+}
+
+func TestHandler_UploadOrderBatch_Validation(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		want        int
+	}{
+		{
+			"max batch size",
+			"text/plain",
+			strings.NewReader("1234567812345670\n79927398713\n4561261212345467"),
+			200,
+		},
+		{
+			"batch is too large",
+			"text/plain",
+			strings.NewReader("1234567812345670\n79927398713\n4561261212345467\n49927398716"),
+			413,
+		},
+		{
+			"empty text",
+			"text/plain",
+			strings.NewReader("\n \n"),
+			400,
+		},
+		{
+			"empty json array",
+			"application/json",
+			strings.NewReader("[]"),
+			400,
+		},
+		{
+			"invalid json",
+			"application/json",
+			strings.NewReader(`{"order": "1234567812345670"}`),
+			400,
+		},
+		{
+			"no body",
+			"text/plain",
+			nil,
+			400,
+		},
+		{
+			"body is too large",
+			"text/plain",
+			strings.NewReader("1234567812345670" + strings.Repeat(" ", 1024) + "\n79927398713"),
+			413,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, app, cancel := testutils.PrepareTestServer(func(cfg *config.Config) {
+				cfg.OrderBatchMaxSize = 3
+			})
+			defer cancel()
+			u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/user/orders/batch", tt.body,
+				testutils.WithUser(u, app),
+				testutils.WithHeader("Content-Type", tt.contentType),
+			)
+			resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode)
+			if tt.want != 200 {
+				userOrders, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
+				assert.Len(t, userOrders, 0)
+			}
+		})
+	}
+}
+
+func TestHandler_UploadOrderBatch_RequiresAuth(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer()
+	defer cancel()
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/orders/batch", strings.NewReader("1234567812345670"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
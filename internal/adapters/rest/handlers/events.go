@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+	httpserver "github.com/sergeii/practikum-go-gophermart/pkg/http/server"
+)
+
+const (
+	EventStreamKeepAlive = time.Second * 15
+	// EventStreamReconnectDelay is the time a client waits before reconnecting to a closed stream
+	EventStreamReconnectDelay = time.Second
+	// unless the write deadline can be extended, the stream is closed in advance of the server's write timeout
+	eventStreamDeadlineMargin = time.Second
+)
+
+type OrderEventResp struct {
+	Number    string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   float64   `json:"accrual"`
+	UpdatedAt time.Time `json:"updated_at"` // nolint: tagliatelle
+}
+
+type BalanceEventResp struct {
+	Current   float64   `json:"current"`
+	Withdrawn float64   `json:"withdrawn"`
+	Held      float64   `json:"held"`
+	UpdatedAt time.Time `json:"updated_at"` // nolint: tagliatelle
+}
+
+// StreamEvents pushes the changes of the user's orders and balance to the user as Server-Sent Events.
+// The stream is not bound by the server's write timeout, instead every write is given the same time to complete.
+// Should the server be unable to extend the deadline, the stream is closed shortly before the write timeout
+// would break it, and the client is expected to reconnect, which EventSource clients do on their own
+func (h *Handler) StreamEvents(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	ctx := c.Request.Context()
+	sub, err := h.app.Events.Subscribe(ctx, user.ID)
+	if err != nil {
+		log.Error().Err(err).Str("path", c.FullPath()).Int("userID", user.ID).Msg("Unable to subscribe to events")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// prevent reverse proxies from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	writeTimeout := h.app.Cfg.ServerWriteTimeout
+	extendDeadline := func() bool {
+		if writeTimeout <= 0 {
+			return true
+		}
+		return httpserver.ExtendWriteDeadline(ctx, time.Now().Add(writeTimeout)) == nil
+	}
+	var deadline <-chan time.Time
+	if !extendDeadline() {
+		log.Warn().Int("userID", user.ID).Msg("Unable to extend write deadline for event stream")
+		if lifetime := eventStreamLifetime(writeTimeout); lifetime > 0 {
+			timer := time.NewTimer(lifetime)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+	}
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", EventStreamReconnectDelay.Milliseconds())
+	c.Writer.Flush()
+	keepAlive := time.NewTicker(EventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	log.Debug().Int("userID", user.ID).Msg("Streaming events to user")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return false
+		case <-keepAlive.C:
+			extendDeadline()
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case e, ok := <-sub.Events():
+			if !ok {
+				return false
+			}
+			extendDeadline()
+			c.SSEvent(string(e.Type), eventResp(e))
+			return true
+		}
+	})
+}
+
+func eventResp(e pubsub.Event) interface{} {
+	switch {
+	case e.Order != nil:
+		return OrderEventResp{
+			e.Order.Number,
+			e.Order.Status,
+			encode.DecimalToFloat(e.Order.Accrual),
+			e.CreatedAt,
+		}
+	case e.Balance != nil:
+		return BalanceEventResp{
+			encode.DecimalToFloat(e.Balance.Current),
+			encode.DecimalToFloat(e.Balance.Withdrawn),
+			encode.DecimalToFloat(e.Balance.Held),
+			e.CreatedAt,
+		}
+	default:
+		return gin.H{}
+	}
+}
+
+// eventStreamLifetime limits the stream to the time the server lets the response be written for,
+// in case the write deadline cannot be extended. Zero means the stream is not limited
+func eventStreamLifetime(writeTimeout time.Duration) time.Duration {
+	if writeTimeout <= 0 {
+		return 0
+	}
+	if writeTimeout > eventStreamDeadlineMargin*2 {
+		return writeTimeout - eventStreamDeadlineMargin
+	}
+	return writeTimeout / 2
+}
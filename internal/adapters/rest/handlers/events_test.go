@@ -0,0 +1,169 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/application"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type orderEventSchema struct {
+	Number    string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   float64   `json:"accrual"`
+	UpdatedAt time.Time `json:"updated_at"` // nolint: tagliatelle
+}
+
+type balanceEventSchema struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+	Held      float64 `json:"held"`
+}
+
+func openEventStream(
+	t *testing.T, ts *httptest.Server, app *application.App, u users.User,
+) (*http.Response, *bufio.Reader, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/user/events", nil)
+	require.NoError(t, err)
+	testutils.Authenticate(req, app, u)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+	// the stream starts once the user is subscribed
+	name, _ := readStreamEvent(t, reader)
+	require.Equal(t, "", name)
+	return resp, reader, cancel
+}
+
+func readStreamEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return name, data
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestHandler_StreamEvents_OK(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	_, err := app.OrderService.SubmitNewOrder(ctx, "79927398713", u.ID)
+	require.NoError(t, err)
+	other, _ := app.UserService.RegisterNewUser(ctx, "other", "secret")
+	_, err = app.OrderService.SubmitNewOrder(ctx, "49927398716", other.ID)
+	require.NoError(t, err)
+
+	resp, reader, closeStream := openEventStream(t, ts, app, u)
+	defer resp.Body.Close()
+	defer closeStream()
+
+	// orders of other users are not streamed
+	result := accrual.OrderStatus{Number: "49927398716", Status: "PROCESSED", Accrual: decimal.NewFromInt(50)}
+	require.NoError(t, app.OrderService.ApplyAccrualResult(ctx, result))
+	result = accrual.OrderStatus{Number: "79927398713", Status: "PROCESSED", Accrual: decimal.NewFromInt(100)}
+	require.NoError(t, app.OrderService.ApplyAccrualResult(ctx, result))
+
+	name, data := readStreamEvent(t, reader)
+	assert.Equal(t, "order", name)
+	var orderEvent orderEventSchema
+	require.NoError(t, json.Unmarshal([]byte(data), &orderEvent))
+	assert.Equal(t, "79927398713", orderEvent.Number)
+	assert.Equal(t, "PROCESSED", orderEvent.Status)
+	assert.Equal(t, 100.0, orderEvent.Accrual)
+	assert.False(t, orderEvent.UpdatedAt.IsZero())
+
+	name, data = readStreamEvent(t, reader)
+	assert.Equal(t, "balance", name)
+	var balanceEvent balanceEventSchema
+	require.NoError(t, json.Unmarshal([]byte(data), &balanceEvent))
+	assert.Equal(t, 100.0, balanceEvent.Current)
+	assert.Equal(t, 0.0, balanceEvent.Withdrawn)
+
+	withdrawResp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+		testutils.WithUser(u, app),
+	)
+	withdrawResp.Body.Close()
+	require.Equal(t, 200, withdrawResp.StatusCode)
+
+	name, data = readStreamEvent(t, reader)
+	assert.Equal(t, "balance", name)
+	require.NoError(t, json.Unmarshal([]byte(data), &balanceEvent))
+	assert.Equal(t, 90.0, balanceEvent.Current)
+	assert.Equal(t, 10.0, balanceEvent.Withdrawn)
+	assert.Equal(t, 0.0, balanceEvent.Held)
+
+	// the held points are streamed along with the rest of the balance
+	_, err = app.WithdrawalService.ReserveWithdrawal(ctx, "2377225624", u.ID, decimal.RequireFromString("15.5"))
+	require.NoError(t, err)
+
+	name, data = readStreamEvent(t, reader)
+	assert.Equal(t, "balance", name)
+	require.NoError(t, json.Unmarshal([]byte(data), &balanceEvent))
+	assert.Equal(t, 74.5, balanceEvent.Current)
+	assert.Equal(t, 10.0, balanceEvent.Withdrawn)
+	assert.Equal(t, 15.5, balanceEvent.Held)
+}
+
+func TestHandler_StreamEvents_OutlivesWriteTimeout(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer(func(cfg *config.Config) {
+		cfg.ServerWriteTimeout = time.Millisecond * 500
+	})
+	defer cancel()
+
+	ctx := context.TODO()
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	_, err := app.OrderService.SubmitNewOrder(ctx, "79927398713", u.ID)
+	require.NoError(t, err)
+	resp, reader, closeStream := openEventStream(t, ts, app, u)
+	defer resp.Body.Close()
+	defer closeStream()
+
+	// the events published after the server's write timeout are still delivered
+	time.Sleep(time.Second)
+	result := accrual.OrderStatus{Number: "79927398713", Status: "PROCESSED", Accrual: decimal.NewFromInt(100)}
+	require.NoError(t, app.OrderService.ApplyAccrualResult(ctx, result))
+
+	name, data := readStreamEvent(t, reader)
+	assert.Equal(t, "order", name)
+	var orderEvent orderEventSchema
+	require.NoError(t, json.Unmarshal([]byte(data), &orderEvent))
+	assert.Equal(t, "79927398713", orderEvent.Number)
+}
+
+func TestHandler_StreamEvents_RequiresAuth(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer()
+	defer cancel()
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/events", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+)
+
+type HoldResp struct {
+	ID          int              `json:"id"`
+	Order       string           `json:"order"`
+	Sum         float64          `json:"sum"`
+	Status      holds.HoldStatus `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`             // nolint: tagliatelle
+	ExpiresAt   time.Time        `json:"expires_at"`             // nolint: tagliatelle
+	FinalizedAt *time.Time       `json:"finalized_at,omitempty"` // nolint: tagliatelle
+}
+
+func newHoldResp(h holds.Hold) HoldResp {
+	resp := HoldResp{
+		ID:        h.ID,
+		Order:     h.Number,
+		Sum:       encode.DecimalToFloat(h.Sum),
+		Status:    h.Status,
+		CreatedAt: h.CreatedAt,
+		ExpiresAt: h.ExpiresAt,
+	}
+	if !h.FinalizedAt.IsZero() {
+		resp.FinalizedAt = &h.FinalizedAt
+	}
+	return resp
+}
+
+// ReserveWithdrawal holds the points for the order being checked out.
+// The request is validated the same way a withdrawal request is
+func (h *Handler) ReserveWithdrawal(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+
+	var json WithdrawalReq
+	if err := c.ShouldBindJSON(&json); err != nil {
+		log.Debug().
+			Err(err).Str("path", c.FullPath()).Int("userID", user.ID).
+			Msg("Unable to validate hold request")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	hold, err := h.app.WithdrawalService.ReserveWithdrawal(
+		c.Request.Context(), json.Order, user.ID, decimal.NewFromFloat(json.Sum),
+	)
+	if err != nil {
+		respondHoldError(c, err, user.ID)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": newHoldResp(hold)})
+}
+
+// CaptureHold withdraws the held points, responding with the withdrawal
+func (h *Handler) CaptureHold(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	holdID, ok := holdIDParam(c)
+	if !ok {
+		return
+	}
+	w, err := h.app.WithdrawalService.CaptureHold(c.Request.Context(), holdID, user.ID)
+	if err != nil {
+		respondHoldError(c, err, user.ID)
+		return
+	}
+	result := WithdrawalResp{
+		ID:          w.ID,
+		Order:       w.Number,
+		Sum:         encode.DecimalToFloat(w.Sum),
+		ProcessedAt: w.ProcessedAt,
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+// ReleaseHold returns the held points back to the user
+func (h *Handler) ReleaseHold(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	holdID, ok := holdIDParam(c)
+	if !ok {
+		return
+	}
+	hold, err := h.app.WithdrawalService.ReleaseHold(c.Request.Context(), holdID, user.ID)
+	if err != nil {
+		respondHoldError(c, err, user.ID)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": newHoldResp(hold)})
+}
+
+// holdIDParam reads the hold's ID from the path. Invalid IDs are reported as not found
+func holdIDParam(c *gin.Context) (int, bool) {
+	holdID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || holdID <= 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": holds.ErrHoldNotFound.Error()})
+		return 0, false
+	}
+	return holdID, true
+}
+
+func respondHoldError(c *gin.Context, err error, userID int) {
+	log.Warn().Err(err).Str("path", c.FullPath()).Int("userID", userID).Msg("Unable to handle hold request")
+	switch {
+	case errors.Is(err, holds.ErrHoldNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, withdrawal.ErrWithdrawalAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "withdrawal with this order has already been registered"})
+	case errors.Is(err, withdrawal.ErrHoldAlreadyRegistered),
+		errors.Is(err, withdrawal.ErrHoldIsFinalized):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, withdrawal.ErrHoldExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, withdrawal.ErrWithdrawalInvalidSumSum):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, users.ErrUserHasInsufficientBalance):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
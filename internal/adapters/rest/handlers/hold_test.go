@@ -0,0 +1,176 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type holdRespSchema struct {
+	Result struct {
+		ID          int        `json:"id"`
+		Order       string     `json:"order"`
+		Sum         float64    `json:"sum"`
+		Status      string     `json:"status"`
+		ExpiresAt   time.Time  `json:"expires_at"`   // nolint: tagliatelle
+		FinalizedAt *time.Time `json:"finalized_at"` // nolint: tagliatelle
+	} `json:"result"`
+}
+
+func TestHandler_Holds_Capture(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(context.TODO(), "other", "secret_too")
+	require.NoError(t, app.UserService.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+
+	var holdJSON holdRespSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/holds",
+		testutils.JSONReader(requestWithdrawalReqSchema{Order: "1234567812345670", Sum: 7.5}),
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&holdJSON),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.True(t, holdJSON.Result.ID > 0)
+	assert.Equal(t, "1234567812345670", holdJSON.Result.Order)
+	assert.Equal(t, 7.5, holdJSON.Result.Sum)
+	assert.Equal(t, "HELD", holdJSON.Result.Status)
+	assert.True(t, holdJSON.Result.ExpiresAt.After(time.Now()))
+	assert.Nil(t, holdJSON.Result.FinalizedAt)
+
+	var balanceJSON showBalanceRespSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&balanceJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(
+		t, showBalanceRespSchema{Current: 2.5, Withdrawn: 0, Held: 7.5, Expiring: []expiringPointsSchema{}}, balanceJSON,
+	)
+
+	capturePath := "/api/user/balance/holds/" + strconv.Itoa(holdJSON.Result.ID) + "/capture"
+	// someone else's hold cannot be captured
+	resp, _ = testutils.DoTestRequest(ts, http.MethodPost, capturePath, nil, testutils.WithUser(other, app))
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	var withdrawalJSON requestWithdrawalRespSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, capturePath, nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&withdrawalJSON),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "1234567812345670", withdrawalJSON.Result.Order)
+	assert.Equal(t, 7.5, withdrawalJSON.Result.Sum)
+
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&balanceJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(
+		t, showBalanceRespSchema{Current: 2.5, Withdrawn: 7.5, Held: 0, Expiring: []expiringPointsSchema{}}, balanceJSON,
+	)
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodPost, capturePath, nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestHandler_Holds_Release(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	require.NoError(t, app.UserService.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	h, err := app.WithdrawalService.ReserveWithdrawal(
+		context.TODO(), "1234567812345670", u.ID, decimal.RequireFromString("10"),
+	)
+	require.NoError(t, err)
+
+	releasePath := "/api/user/balance/holds/" + strconv.Itoa(h.ID) + "/release"
+	var holdJSON holdRespSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, releasePath, nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&holdJSON),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, h.ID, holdJSON.Result.ID)
+	assert.Equal(t, "RELEASED", holdJSON.Result.Status)
+	assert.NotNil(t, holdJSON.Result.FinalizedAt)
+
+	balance, _ := app.UserService.GetBalance(context.TODO(), u.ID)
+	assert.Equal(t, "10", balance.Current.String())
+	assert.Equal(t, "0", balance.Held.String())
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodPost, releasePath, nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestHandler_Holds_Errors(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	require.NoError(t, app.UserService.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	_, err := app.WithdrawalService.RequestWithdrawal(
+		context.TODO(), "79927398713", u.ID, decimal.RequireFromString("1"),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		order      string
+		sum        float64
+		wantStatus int
+	}{
+		{"ok", "1234567812345670", 1, 200},
+		{"already held", "1234567812345670", 1, 409},
+		{"already withdrawn", "79927398713", 1, 409},
+		{"not enough points", "4561261212345467", 8.01, 402},
+		{"zero sum", "4561261212345467", 0, 422},
+		{"invalid order number", "4561261212345468", 1, 422},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/user/balance/holds",
+				testutils.JSONReader(requestWithdrawalReqSchema{Order: tt.order, Sum: tt.sum}),
+				testutils.WithUser(u, app),
+			)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	for _, path := range []string{
+		"/api/user/balance/holds/999999/capture",
+		"/api/user/balance/holds/foo/release",
+	} {
+		resp, _ := testutils.DoTestRequest(ts, http.MethodPost, path, nil, testutils.WithUser(u, app))
+		resp.Body.Close()
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodPost, "/api/user/balance/holds", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
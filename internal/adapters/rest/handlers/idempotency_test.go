@@ -0,0 +1,160 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestIdempotency_ReplaysResponse(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	err := app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("100"))
+	require.NoError(t, err)
+
+	var bodies []string
+	for i := 0; i < 3; i++ {
+		resp, body := testutils.DoTestRequest(
+			ts, http.MethodPost, "/api/user/balance/withdraw",
+			testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+			testutils.WithUser(u, app),
+			testutils.WithHeader("Idempotency-Key", "b5a9c4e2-retry"),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+		if i == 0 {
+			assert.Equal(t, "", resp.Header.Get("Idempotent-Replayed"))
+		} else {
+			assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		}
+		bodies = append(bodies, body)
+	}
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+
+	// the sum is withdrawn only once
+	balance, _ := app.UserService.GetBalance(ctx, u.ID)
+	assert.Equal(t, "90", balance.Current.String())
+	assert.Equal(t, "10", balance.Withdrawn.String())
+
+	// a retry without the key is not safe
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+		testutils.WithUser(u, app),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestIdempotency_ReplaysClientErrors(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", "topup"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 402, resp.StatusCode)
+
+	err := app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("100"))
+	require.NoError(t, err)
+
+	// the outcome of the first request is replayed, even though the balance is sufficient now
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", "topup"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 402, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+
+	balance, _ := app.UserService.GetBalance(ctx, u.ID)
+	assert.Equal(t, "100", balance.Current.String())
+}
+
+func TestIdempotency_KeyReusedWithDifferentRequest(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	err := app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("100"))
+	require.NoError(t, err)
+
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 10}),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", "same-key"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// different body
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/withdraw",
+		testutils.JSONReader(requestWithdrawalReqSchema{"4561261212345467", 20}),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", "same-key"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 422, resp.StatusCode)
+
+	// different endpoint
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/orders", strings.NewReader("79927398713"),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", "same-key"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 422, resp.StatusCode)
+	userOrders, _, _ := app.OrderService.GetUserOrdersPage(ctx, u.ID, orders.ListQuery{})
+	assert.Len(t, userOrders, 0)
+
+	// keys are scoped to the user
+	other, _ := app.UserService.RegisterNewUser(ctx, "other", "secret")
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/orders", strings.NewReader("79927398713"),
+		testutils.WithUser(other, app),
+		testutils.WithHeader("Idempotency-Key", "same-key"),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 202, resp.StatusCode)
+
+	balance, _ := app.UserService.GetBalance(ctx, u.ID)
+	assert.Equal(t, "90", balance.Current.String())
+}
+
+func TestIdempotency_KeyIsTooLong(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/orders", strings.NewReader("79927398713"),
+		testutils.WithUser(u, app),
+		testutils.WithHeader("Idempotency-Key", strings.Repeat("k", 256)),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+}
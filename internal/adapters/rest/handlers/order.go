@@ -11,6 +11,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
@@ -90,9 +91,38 @@ type ListOrderRespItem struct {
 	UploadedAt time.Time          `json:"uploaded_at"` // nolint: tagliatelle
 }
 
+type ListOrdersReq struct {
+	ListPageReq
+	Status []string `form:"status" binding:"dive,oneof=NEW PROCESSING INVALID PROCESSED FAILED"`
+}
+
+// ListUserOrders lists the user's orders page by page, oldest first unless sorted otherwise.
+// The orders may be filtered by their status and upload time.
+// Unless the page is the last one, the cursor pointing at the next page is returned in the headers
 func (h *Handler) ListUserOrders(c *gin.Context) {
 	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
-	orders, err := h.app.OrderService.GetUserOrders(c.Request.Context(), user.ID)
+	var req ListOrdersReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate order list request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := req.cursor()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := orders.ListQuery{
+		UploadedFrom: req.From,
+		UploadedTo:   req.To,
+		Descending:   req.Sort == "desc",
+		After:        after,
+		Limit:        req.listLimit(),
+	}
+	for _, status := range req.Status {
+		query.Statuses = append(query.Statuses, orders.OrderStatus(status))
+	}
+	page, next, err := h.app.OrderService.GetUserOrdersPage(c.Request.Context(), user.ID, query)
 	if err != nil {
 		log.Warn().
 			Err(err).Str("path", c.FullPath()).Int("userID", user.ID).
@@ -100,12 +130,12 @@ func (h *Handler) ListUserOrders(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if len(orders) == 0 {
+	if len(page) == 0 {
 		c.Status(http.StatusNoContent)
 		return
 	}
-	jsonItems := make([]ListOrderRespItem, 0, len(orders))
-	for _, o := range orders {
+	jsonItems := make([]ListOrderRespItem, 0, len(page))
+	for _, o := range page {
 		jsonItems = append(jsonItems, ListOrderRespItem{
 			o.Number,
 			o.Status,
@@ -113,5 +143,100 @@ func (h *Handler) ListUserOrders(c *gin.Context) {
 			o.UploadedAt,
 		})
 	}
+	setNextPageHeaders(c, next)
+	c.JSON(http.StatusOK, jsonItems)
+}
+
+type OrderQueueResp struct {
+	Position    int        `json:"position"`
+	NextCheckAt *time.Time `json:"next_check_at,omitempty"` // nolint: tagliatelle
+}
+
+type ShowOrderResp struct {
+	Number     string             `json:"number"`
+	Status     orders.OrderStatus `json:"status"`
+	Accrual    float64            `json:"accrual"`
+	UploadedAt time.Time          `json:"uploaded_at"`          // nolint: tagliatelle
+	CheckedAt  *time.Time         `json:"checked_at,omitempty"` // nolint: tagliatelle
+	Queue      *OrderQueueResp    `json:"queue,omitempty"`
+}
+
+// ShowOrder shows the user's order along with the time it has been last checked with the accrual system.
+// Unless the order's status is final, the order's place in the processing queue is also shown
+func (h *Handler) ShowOrder(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	orderNumber := c.Param("number")
+	details, err := h.app.OrderService.GetUserOrder(c.Request.Context(), orderNumber, user.ID)
+	if err != nil {
+		log.Warn().
+			Err(err).Str("path", c.FullPath()).Str("number", orderNumber).Int("userID", user.ID).
+			Msg("Unable to fetch order")
+		if errors.Is(err, orders.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	result := ShowOrderResp{
+		Number:     details.Number,
+		Status:     details.Status,
+		Accrual:    encode.DecimalToFloat(details.Accrual),
+		UploadedAt: details.UploadedAt,
+	}
+	if !details.CheckedAt.IsZero() {
+		result.CheckedAt = &details.CheckedAt
+	}
+	if details.Queue != nil {
+		result.Queue = &OrderQueueResp{Position: details.Queue.Ahead + 1}
+		// the order is not checked before its retry backoff has expired, even if it is picked earlier
+		nextCheckAt := details.Queue.VisibleAt
+		if details.NextCheckAt.After(nextCheckAt) {
+			nextCheckAt = details.NextCheckAt
+		}
+		if nextCheckAt.After(time.Now()) {
+			result.Queue.NextCheckAt = &nextCheckAt
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type OrderHistoryRespItem struct {
+	OldStatus orders.OrderStatus `json:"old_status"` // nolint: tagliatelle
+	NewStatus orders.OrderStatus `json:"new_status"` // nolint: tagliatelle
+	Accrual   float64            `json:"accrual"`
+	Source    orderevents.Source `json:"source"`
+	CreatedAt time.Time          `json:"created_at"` // nolint: tagliatelle
+}
+
+func (h *Handler) ShowOrderHistory(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	orderNumber := c.Param("number")
+	events, err := h.app.OrderService.GetOrderHistory(c.Request.Context(), orderNumber, user.ID)
+	if err != nil {
+		log.Warn().
+			Err(err).Str("path", c.FullPath()).Str("number", orderNumber).Int("userID", user.ID).
+			Msg("Unable to fetch order history")
+		if errors.Is(err, orders.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if len(events) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]OrderHistoryRespItem, 0, len(events))
+	for _, e := range events {
+		jsonItems = append(jsonItems, OrderHistoryRespItem{
+			e.OldStatus,
+			e.NewStatus,
+			encode.DecimalToFloat(e.Accrual),
+			e.Source,
+			e.CreatedAt,
+		})
+	}
 	c.JSON(http.StatusOK, jsonItems)
 }
@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -12,8 +13,10 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 type uploadOrderRespSchema struct {
@@ -36,6 +39,26 @@ type listOrderItemSchema struct {
 	UploadedAt time.Time `json:"uploaded_at"` // nolint: tagliatelle
 }
 
+type showOrderSchema struct {
+	Number     string     `json:"number"`
+	Status     string     `json:"status"`
+	Accrual    float64    `json:"accrual"`
+	UploadedAt time.Time  `json:"uploaded_at"` // nolint: tagliatelle
+	CheckedAt  *time.Time `json:"checked_at"`  // nolint: tagliatelle
+	Queue      *struct {
+		Position    int        `json:"position"`
+		NextCheckAt *time.Time `json:"next_check_at"` // nolint: tagliatelle
+	} `json:"queue"`
+}
+
+type orderHistoryItemSchema struct {
+	OldStatus string    `json:"old_status"` // nolint: tagliatelle
+	NewStatus string    `json:"new_status"` // nolint: tagliatelle
+	Accrual   float64   `json:"accrual"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"` // nolint: tagliatelle
+}
+
 func TestHandler_UploadOrder_OK(t *testing.T) {
 	ts, app, cancel := testutils.PrepareTestServer()
 	defer cancel()
@@ -124,7 +147,7 @@ func TestHandler_UploadOrder_Validation(t *testing.T) {
 				testutils.WithUser(u, app),
 			)
 			resp.Body.Close()
-			userOrders, _ := app.OrderService.GetUserOrders(context.TODO(), u.ID)
+			userOrders, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
 			qLen, _ := app.OrderService.ProcessingLength(context.TODO())
 			if tt.want {
 				assert.Len(t, userOrders, 1)
@@ -213,7 +236,7 @@ func TestHandler_UploadOrder_LuhnValidation(t *testing.T) {
 				testutils.WithUser(u, app),
 			)
 			resp.Body.Close()
-			userOrders, _ := app.OrderService.GetUserOrders(context.TODO(), u.ID)
+			userOrders, _, _ := app.OrderService.GetUserOrdersPage(context.TODO(), u.ID, orders.ListQuery{})
 			if tt.want {
 				assert.Equal(t, 202, resp.StatusCode)
 				assert.Len(t, userOrders, 1)
@@ -295,7 +318,7 @@ func TestHandler_ListUserOrders_OK(t *testing.T) {
 	app.OrderService.SubmitNewOrder(context.TODO(), "49927398716", u.ID)      // nolint:errcheck
 	app.OrderService.UpdateOrderStatus(                                       // nolint:errcheck
 		context.TODO(), "49927398716",
-		orders.OrderStatusProcessed, decimal.RequireFromString("10.1"),
+		orders.OrderStatusProcessed, decimal.RequireFromString("10.1"), orderevents.SourceAccrual,
 	)
 
 	jsonItems := make([]listOrderItemSchema, 0)
@@ -315,6 +338,195 @@ func TestHandler_ListUserOrders_OK(t *testing.T) {
 	assert.Equal(t, 10.1, jsonItems[1].Accrual)
 }
 
+func TestHandler_ListUserOrders_Pagination(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	numbers := []string{"4561261212345467", "49927398716", "79927398713", "1234567812345670", "100000000008"}
+	for _, number := range numbers {
+		_, err := app.OrderService.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+
+	var got []string
+	path := "/api/user/orders?limit=2"
+	for page := 1; path != ""; page++ {
+		require.LessOrEqual(t, page, 3)
+		var jsonItems []listOrderItemSchema
+		resp, _ := testutils.DoTestRequest(
+			ts, http.MethodGet, path, nil,
+			testutils.WithUser(u, app),
+			testutils.MustBindJSON(&jsonItems),
+		)
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+		for _, item := range jsonItems {
+			got = append(got, item.Number)
+		}
+		path = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			assert.NotEmpty(t, resp.Header.Get("X-Next-Cursor"))
+			assert.True(t, strings.HasSuffix(link, `>; rel="next"`))
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			assert.Contains(t, path, "limit=2")
+		}
+	}
+	assert.Equal(t, numbers, got)
+
+	var jsonItems []listOrderItemSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders?sort=desc&limit=2", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&jsonItems),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, jsonItems, 2)
+	assert.Equal(t, "100000000008", jsonItems[0].Number)
+	assert.Equal(t, "1234567812345670", jsonItems[1].Number)
+}
+
+func TestHandler_ListUserOrders_FullListUnlessPaged(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for i := 0; i < 150; i++ {
+		_, err := app.OrderService.SubmitNewOrder(context.TODO(), testutils.NewLuhnNumber(16), u.ID)
+		require.NoError(t, err)
+	}
+
+	var jsonItems []listOrderItemSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&jsonItems),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, jsonItems, 150)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+
+	// the page is 100 orders long once the client asks for paging
+	cursor := pagination.Cursor{Time: time.Now().Add(time.Hour)}
+	jsonItems = nil
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders?sort=desc&cursor="+cursor.Encode(), nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&jsonItems),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, jsonItems, 100)
+	assert.NotEmpty(t, resp.Header.Get("X-Next-Cursor"))
+}
+
+func TestHandler_ListUserOrders_Filters(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, number := range []string{"4561261212345467", "49927398716", "79927398713"} {
+		_, err := app.OrderService.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+	for _, number := range []string{"49927398716", "79927398713"} {
+		err := app.OrderService.UpdateOrderStatus(
+			context.TODO(), number, orders.OrderStatusProcessed, decimal.NewFromInt(10), orderevents.SourceAccrual,
+		)
+		require.NoError(t, err)
+	}
+	hourAgo := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	inHour := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{
+			"by status",
+			"status=PROCESSED",
+			200,
+			[]string{"49927398716", "79927398713"},
+		},
+		{
+			"by several statuses",
+			"status=NEW&status=PROCESSED&sort=desc",
+			200,
+			[]string{"79927398713", "49927398716", "4561261212345467"},
+		},
+		{
+			"by upload time",
+			"from=" + hourAgo + "&to=" + inHour + "&status=NEW",
+			200,
+			[]string{"4561261212345467"},
+		},
+		{
+			"nothing uploaded in range",
+			"to=" + hourAgo,
+			204,
+			nil,
+		},
+		{
+			"unknown status",
+			"status=DONE",
+			400,
+			nil,
+		},
+		{
+			"invalid time",
+			"from=yesterday",
+			400,
+			nil,
+		},
+		{
+			"invalid sort",
+			"sort=random",
+			400,
+			nil,
+		},
+		{
+			"zero limit falls back to default",
+			"limit=0",
+			200,
+			[]string{"4561261212345467", "49927398716", "79927398713"},
+		},
+		{
+			"limit is too large",
+			"limit=1001",
+			400,
+			nil,
+		},
+		{
+			"invalid cursor",
+			"cursor=foo",
+			400,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jsonItems []listOrderItemSchema
+			opts := []testutils.TestRequestOpt{testutils.WithUser(u, app)}
+			if tt.wantStatus == 200 {
+				opts = append(opts, testutils.MustBindJSON(&jsonItems))
+			}
+			resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/orders?"+tt.query, nil, opts...)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			var got []string
+			for _, item := range jsonItems {
+				got = append(got, item.Number)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Empty(t, resp.Header.Get("Link"))
+		})
+	}
+}
+
 func TestHandler_ListUserOrders_NoOrdersForUser(t *testing.T) {
 	ts, app, cancel := testutils.PrepareTestServer()
 	defer cancel()
@@ -339,3 +551,143 @@ func TestHandler_ListUserOrders_RequiresAuth(t *testing.T) {
 	resp.Body.Close()
 	assert.Equal(t, 401, resp.StatusCode)
 }
+
+func TestHandler_ShowOrder_OK(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, number := range []string{"79927398713", "49927398716"} {
+		_, err := app.OrderService.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+
+	var order showOrderSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders/49927398716", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&order),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "49927398716", order.Number)
+	assert.Equal(t, "NEW", order.Status)
+	assert.False(t, order.UploadedAt.IsZero())
+	assert.Nil(t, order.CheckedAt)
+	require.NotNil(t, order.Queue)
+	assert.Equal(t, 2, order.Queue.Position)
+	assert.Nil(t, order.Queue.NextCheckAt)
+
+	err := app.OrderService.UpdateOrderStatus(
+		context.TODO(), "49927398716", orders.OrderStatusProcessed, decimal.RequireFromString("10.1"),
+		orderevents.SourceAccrual,
+	)
+	require.NoError(t, err)
+
+	order = showOrderSchema{}
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders/49927398716", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&order),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "PROCESSED", order.Status)
+	assert.Equal(t, 10.1, order.Accrual)
+	// processed orders are no longer waiting in the queue
+	assert.Nil(t, order.Queue)
+}
+
+func TestHandler_ShowOrder_NotFound(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	other, _ := app.UserService.RegisterNewUser(context.TODO(), "other", "secret")
+	_, err := app.OrderService.SubmitNewOrder(context.TODO(), "79927398713", other.ID)
+	require.NoError(t, err)
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, number := range []string{"79927398713", "49927398716"} {
+		resp, _ := testutils.DoTestRequest(
+			ts, http.MethodGet, "/api/user/orders/"+number, nil,
+			testutils.WithUser(u, app),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+}
+
+func TestHandler_ShowOrder_RequiresAuth(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer()
+	defer cancel()
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/orders/79927398713", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func TestHandler_ShowOrderHistory_OK(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	_, err := app.OrderService.SubmitNewOrder(context.TODO(), "49927398716", u.ID)
+	require.NoError(t, err)
+
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders/49927398716/history", nil,
+		testutils.WithUser(u, app),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	for _, status := range []orders.OrderStatus{orders.OrderStatusProcessing, orders.OrderStatusProcessed} {
+		err = app.OrderService.UpdateOrderStatus(
+			context.TODO(), "49927398716", status, decimal.RequireFromString("10.1"), orderevents.SourceAccrual,
+		)
+		require.NoError(t, err)
+	}
+
+	jsonItems := make([]orderHistoryItemSchema, 0)
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/orders/49927398716/history", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&jsonItems),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.Len(t, jsonItems, 2)
+	assert.Equal(t, "NEW", jsonItems[0].OldStatus)
+	assert.Equal(t, "PROCESSING", jsonItems[0].NewStatus)
+	assert.Equal(t, "accrual", jsonItems[0].Source)
+	assert.Equal(t, "PROCESSING", jsonItems[1].OldStatus)
+	assert.Equal(t, "PROCESSED", jsonItems[1].NewStatus)
+	assert.Equal(t, 10.1, jsonItems[1].Accrual)
+	assert.False(t, jsonItems[1].CreatedAt.IsZero())
+}
+
+func TestHandler_ShowOrderHistory_NotFound(t *testing.T) {
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	other, _ := app.UserService.RegisterNewUser(context.TODO(), "other", "secret")
+	_, err := app.OrderService.SubmitNewOrder(context.TODO(), "79927398713", other.ID)
+	require.NoError(t, err)
+
+	u, _ := app.UserService.RegisterNewUser(context.TODO(), "shopper", "secret")
+	for _, number := range []string{"79927398713", "49927398716"} {
+		resp, _ := testutils.DoTestRequest(
+			ts, http.MethodGet, "/api/user/orders/"+number+"/history", nil,
+			testutils.WithUser(u, app),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+}
+
+func TestHandler_ShowOrderHistory_RequiresAuth(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer()
+	defer cancel()
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/orders/79927398713/history", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
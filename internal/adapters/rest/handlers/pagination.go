@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
+)
+
+const (
+	defaultListLimit = 100
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// ListPageReq is the query schema shared by the paginated user lists.
+// The time range is half-open: the items dated exactly at the upper bound are not included
+type ListPageReq struct {
+	Limit  int       `form:"limit" binding:"omitempty,gt=0,lte=1000"`
+	Cursor string    `form:"cursor"`
+	From   time.Time `form:"from"`
+	To     time.Time `form:"to"`
+	Sort   string    `form:"sort" binding:"omitempty,oneof=asc desc"`
+}
+
+// cursor decodes the cursor pointing at the last item of the previous page, if any
+func (req ListPageReq) cursor() (*pagination.Cursor, error) {
+	if req.Cursor == "" {
+		return nil, nil // nolint: nilnil
+	}
+	c, err := pagination.Decode(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (req ListPageReq) limit() int {
+	if req.Limit == 0 {
+		return defaultListLimit
+	}
+	return req.Limit
+}
+
+// listLimit is the limit of the lists that used to be returned in full before they could be paged through.
+// Unless the client asks for a page, the full list is still returned
+func (req ListPageReq) listLimit() int {
+	if req.Limit == 0 && req.Cursor == "" {
+		return 0
+	}
+	return req.limit()
+}
+
+// setNextPageHeaders lets the client know where the next page starts, unless the current page is the last one.
+// The link to the next page keeps the rest of the query intact
+func setNextPageHeaders(c *gin.Context, next *pagination.Cursor) {
+	if next == nil {
+		return
+	}
+	encoded := next.Encode()
+	query := c.Request.URL.Query()
+	query.Set("cursor", encoded)
+	c.Header(NextCursorHeader, encoded)
+	c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, c.Request.URL.Path, query.Encode()))
+}
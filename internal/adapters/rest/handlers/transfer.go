@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/transfer"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+)
+
+type TransferReq struct {
+	Recipient string  `json:"recipient" binding:"required"`
+	Amount    float64 `json:"amount" binding:"required,gt=0"`
+}
+
+type TransferResp struct {
+	ID        int       `json:"id"`
+	Recipient string    `json:"recipient"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"` // nolint: tagliatelle
+}
+
+// TransferPoints gives the user's points to another user, identified by their login
+func (h *Handler) TransferPoints(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+
+	var json TransferReq
+	if err := c.ShouldBindJSON(&json); err != nil {
+		log.Debug().
+			Err(err).Str("path", c.FullPath()).Int("userID", user.ID).
+			Msg("Unable to validate transfer request")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := h.app.TransferService.TransferPoints(
+		c.Request.Context(), user.ID, json.Recipient, decimal.NewFromFloat(json.Amount),
+	)
+	if err != nil {
+		log.Warn().
+			Err(err).Str("path", c.FullPath()).
+			Str("recipient", json.Recipient).Float64("amount", json.Amount).Int("userID", user.ID).
+			Msg("Failed to transfer points")
+		switch {
+		case errors.Is(err, transfer.ErrTransferRecipientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, transfer.ErrTransferInvalidAmount),
+			errors.Is(err, transfer.ErrTransferToSelf),
+			errors.Is(err, transfer.ErrTransferAmountLimitExceeded):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, transfer.ErrTransferDailyLimitExceeded):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, users.ErrUserHasInsufficientBalance):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	result := TransferResp{
+		ID:        t.ID,
+		Recipient: strings.ToLower(json.Recipient),
+		Amount:    encode.DecimalToFloat(t.Amount),
+		CreatedAt: t.CreatedAt,
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
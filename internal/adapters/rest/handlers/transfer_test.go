@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type transferReqSchema struct {
+	Recipient string  `json:"recipient"`
+	Amount    float64 `json:"amount"`
+}
+
+type transferRespSchema struct {
+	Result struct {
+		ID        int       `json:"id"`
+		Recipient string    `json:"recipient"`
+		Amount    float64   `json:"amount"`
+		CreatedAt time.Time `json:"created_at"` // nolint: tagliatelle
+	} `json:"result"`
+}
+
+func TestHandler_TransferPoints_OK(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret_too")
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("100")))
+
+	var respJSON transferRespSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodPost, "/api/user/balance/transfer",
+		testutils.JSONReader(transferReqSchema{Recipient: "Customer", Amount: 42.5}),
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	assert.True(t, respJSON.Result.ID > 0)
+	assert.Equal(t, "customer", respJSON.Result.Recipient)
+	assert.Equal(t, 42.5, respJSON.Result.Amount)
+	assert.False(t, respJSON.Result.CreatedAt.IsZero())
+
+	// the transfer shows up in both users' history
+	for _, tt := range []struct {
+		user        users.User
+		wantAmount  float64
+		wantBalance float64
+	}{
+		{u, -42.5, 57.5},
+		{other, 42.5, 42.5},
+	} {
+		var historyJSON []balanceHistoryItemSchema
+		resp, _ = testutils.DoTestRequest(
+			ts, http.MethodGet, "/api/user/balance/history?sort=desc", nil,
+			testutils.WithUser(tt.user, app),
+			testutils.MustBindJSON(&historyJSON),
+		)
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "TRANSFER", historyJSON[0].Kind)
+		assert.Equal(t, tt.wantAmount, historyJSON[0].Amount)
+		assert.Equal(t, tt.wantBalance, historyJSON[0].Balance)
+	}
+}
+
+func TestHandler_TransferPoints_Errors(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer(func(cfg *config.Config) {
+		cfg.TransferMaxAmount = 60
+		cfg.TransferDailyLimit = 100
+	})
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	_, _ = app.UserService.RegisterNewUser(ctx, "customer", "secret_too")
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.RequireFromString("80")))
+
+	tests := []struct {
+		name       string
+		recipient  string
+		amount     float64
+		wantStatus int
+	}{
+		{"ok", "customer", 50, 200},
+		{"unknown recipient", "nobody", 1, 404},
+		{"transfer to oneself", "Shopper", 1, 400},
+		{"more than allowed at once", "customer", 60.01, 400},
+		{"not enough points", "customer", 30.01, 402},
+		{"zero amount", "customer", 0, 422},
+		{"no recipient", "", 1, 422},
+		{"ok again", "customer", 30, 200},
+		{"more than allowed within a day", "customer", 20.01, 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/user/balance/transfer",
+				testutils.JSONReader(transferReqSchema{Recipient: tt.recipient, Amount: tt.amount}),
+				testutils.WithUser(u, app),
+			)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodPost, "/api/user/balance/transfer", nil)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
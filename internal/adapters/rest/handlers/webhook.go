@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhooks"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/webhook"
+)
+
+const defaultDeliveryListLimit = 100
+
+type RegisterWebhookReq struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Secret string   `json:"secret" binding:"required,min=16,max=255"`
+	Events []string `json:"events" binding:"dive,oneof=order balance"`
+}
+
+type WebhookResp struct {
+	ID                  int        `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`  // nolint: tagliatelle
+	CreatedAt           time.Time  `json:"created_at"`            // nolint: tagliatelle
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"` // nolint: tagliatelle
+}
+
+func newWebhookResp(w webhooks.Webhook) WebhookResp {
+	resp := WebhookResp{
+		ID:                  w.ID,
+		URL:                 w.URL,
+		Events:              w.Events,
+		Enabled:             w.Enabled,
+		ConsecutiveFailures: w.ConsecutiveFailures,
+		CreatedAt:           w.CreatedAt,
+	}
+	if !w.DisabledAt.IsZero() {
+		resp.DisabledAt = &w.DisabledAt
+	}
+	return resp
+}
+
+type ListDeliveriesReq struct {
+	Limit int `form:"limit" binding:"omitempty,gt=0,lte=1000"`
+}
+
+type WebhookDeliveryRespItem struct {
+	ID             int                      `json:"id"`
+	Event          string                   `json:"event"`
+	Status         webhookdeliveries.Status `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	LastStatusCode int                      `json:"last_status_code,omitempty"` // nolint: tagliatelle
+	LastError      string                   `json:"last_error,omitempty"`       // nolint: tagliatelle
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`  // nolint: tagliatelle
+	CreatedAt      time.Time                `json:"created_at"`                 // nolint: tagliatelle
+	DeliveredAt    *time.Time               `json:"delivered_at,omitempty"`     // nolint: tagliatelle
+}
+
+// RegisterWebhook adds a URL of the user's backend to be notified of the user's events.
+// The notifications are signed with the secret provided along with the URL
+func (h *Handler) RegisterWebhook(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	var json RegisterWebhookReq
+	if err := c.ShouldBindJSON(&json); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Int("userID", user.ID).Msg("Unable to validate webhook")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	w, err := h.app.WebhookService.Register(c.Request.Context(), user.ID, json.URL, json.Secret, json.Events)
+	if errors.Is(err, webhook.ErrURLNotAllowed) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", c.FullPath()).Int("userID", user.ID).Msg("Unable to register webhook")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"result": newWebhookResp(w)})
+}
+
+func (h *Handler) ListUserWebhooks(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	items, err := h.app.WebhookService.GetUserWebhooks(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Str("path", c.FullPath()).Int("userID", user.ID).Msg("Unable to fetch webhooks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]WebhookResp, 0, len(items))
+	for _, w := range items {
+		jsonItems = append(jsonItems, newWebhookResp(w))
+	}
+	c.JSON(http.StatusOK, jsonItems)
+}
+
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	webhookID, ok := webhookIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.app.WebhookService.Delete(c.Request.Context(), user.ID, webhookID); err != nil {
+		respondWebhookError(c, err, user.ID)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EnableWebhook turns the webhook back on after it has been disabled because of failed notifications
+func (h *Handler) EnableWebhook(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	webhookID, ok := webhookIDParam(c)
+	if !ok {
+		return
+	}
+	w, err := h.app.WebhookService.Enable(c.Request.Context(), user.ID, webhookID)
+	if err != nil {
+		respondWebhookError(c, err, user.ID)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": newWebhookResp(w)})
+}
+
+// ListWebhookDeliveries shows the delivery log of the webhook, the latest notifications first
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+	webhookID, ok := webhookIDParam(c)
+	if !ok {
+		return
+	}
+	var query ListDeliveriesReq
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultDeliveryListLimit
+	}
+	items, err := h.app.WebhookService.GetDeliveries(c.Request.Context(), user.ID, webhookID, query.Limit)
+	if err != nil {
+		respondWebhookError(c, err, user.ID)
+		return
+	}
+	if len(items) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jsonItems := make([]WebhookDeliveryRespItem, 0, len(items))
+	for _, d := range items {
+		item := WebhookDeliveryRespItem{
+			ID:             d.ID,
+			Event:          d.Event,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			CreatedAt:      d.CreatedAt,
+		}
+		if d.Status == webhookdeliveries.StatusPending {
+			nextAttemptAt := d.NextAttemptAt
+			item.NextAttemptAt = &nextAttemptAt
+		}
+		if !d.DeliveredAt.IsZero() {
+			deliveredAt := d.DeliveredAt
+			item.DeliveredAt = &deliveredAt
+		}
+		jsonItems = append(jsonItems, item)
+	}
+	c.JSON(http.StatusOK, jsonItems)
+}
+
+// webhookIDParam reads the webhook's ID from the path. Invalid IDs are reported as not found
+func webhookIDParam(c *gin.Context) (int, bool) {
+	webhookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || webhookID <= 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return 0, false
+	}
+	return webhookID, true
+}
+
+func respondWebhookError(c *gin.Context, err error, userID int) {
+	log.Warn().Err(err).Str("path", c.FullPath()).Int("userID", userID).Msg("Unable to handle webhook request")
+	if errors.Is(err, webhooks.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
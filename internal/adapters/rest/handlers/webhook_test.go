@@ -0,0 +1,287 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+type registerWebhookReqSchema struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events,omitempty"`
+}
+
+type webhookSchema struct {
+	ID                  int        `json:"id"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"secret"`
+	Events              []string   `json:"events"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"` // nolint: tagliatelle
+	CreatedAt           time.Time  `json:"created_at"`           // nolint: tagliatelle
+	DisabledAt          *time.Time `json:"disabled_at"`          // nolint: tagliatelle
+}
+
+type webhookRespSchema struct {
+	Result webhookSchema `json:"result"`
+}
+
+type webhookDeliverySchema struct {
+	ID            int        `json:"id"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"` // nolint: tagliatelle
+	DeliveredAt   *time.Time `json:"delivered_at"`    // nolint: tagliatelle
+}
+
+const webhookSecret = "0123456789abcdef"
+
+func TestHandler_RegisterWebhook_OK(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	tests := []struct {
+		events []string
+		want   []string
+	}{
+		{nil, []string{"order", "balance"}},
+		{[]string{"balance"}, []string{"balance"}},
+		{[]string{"order", "balance"}, []string{"order", "balance"}},
+	}
+	for _, tt := range tests {
+		var respJSON webhookRespSchema
+		before := time.Now()
+		resp, _ := testutils.DoTestRequest(
+			ts, http.MethodPost, "/api/user/webhooks",
+			testutils.JSONReader(registerWebhookReqSchema{"https://example.com/hook", webhookSecret, tt.events}),
+			testutils.WithUser(u, app),
+			testutils.MustBindJSON(&respJSON),
+		)
+		resp.Body.Close()
+		assert.Equal(t, 201, resp.StatusCode)
+		assert.True(t, respJSON.Result.ID > 0)
+		assert.Equal(t, "https://example.com/hook", respJSON.Result.URL)
+		assert.Equal(t, "", respJSON.Result.Secret)
+		assert.Equal(t, tt.want, respJSON.Result.Events)
+		assert.True(t, respJSON.Result.Enabled)
+		assert.True(t, respJSON.Result.CreatedAt.After(before))
+		assert.Nil(t, respJSON.Result.DisabledAt)
+	}
+
+	webhooks, err := app.WebhookService.GetUserWebhooks(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, webhooks, 3)
+	assert.Equal(t, webhookSecret, webhooks[0].Secret)
+}
+
+func TestHandler_RegisterWebhook_Errors(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	tests := []struct {
+		name string
+		body interface{}
+	}{
+		{"missing url", registerWebhookReqSchema{"", webhookSecret, nil}},
+		{"invalid url", registerWebhookReqSchema{"example", webhookSecret, nil}},
+		{"unsupported scheme", registerWebhookReqSchema{"ftp://example.com/hook", webhookSecret, nil}},
+		{"missing secret", registerWebhookReqSchema{"https://example.com/hook", "", nil}},
+		{"short secret", registerWebhookReqSchema{"https://example.com/hook", "secret", nil}},
+		{"unknown event", registerWebhookReqSchema{"https://example.com/hook", webhookSecret, []string{"withdrawal"}}},
+		{"invalid json", "https://example.com/hook"},
+		{"loopback address", registerWebhookReqSchema{"http://127.0.0.1:8080/hook", webhookSecret, nil}},
+		{"localhost", registerWebhookReqSchema{"http://localhost/hook", webhookSecret, nil}},
+		{"private address", registerWebhookReqSchema{"https://10.0.0.1/hook", webhookSecret, nil}},
+		{"link-local address", registerWebhookReqSchema{"http://169.254.169.254/latest", webhookSecret, nil}},
+		{"unspecified address", registerWebhookReqSchema{"http://[::]:80/hook", webhookSecret, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testutils.DoTestRequest(
+				ts, http.MethodPost, "/api/user/webhooks",
+				testutils.JSONReader(tt.body),
+				testutils.WithUser(u, app),
+			)
+			resp.Body.Close()
+			assert.Equal(t, 422, resp.StatusCode)
+		})
+	}
+
+	webhooks, err := app.WebhookService.GetUserWebhooks(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, webhooks, 0)
+}
+
+func TestHandler_ListUserWebhooks(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret")
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, "/api/user/webhooks", nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	_, err := app.WebhookService.Register(ctx, u.ID, "https://example.com/1", webhookSecret, []string{"order"})
+	require.NoError(t, err)
+	_, err = app.WebhookService.Register(ctx, u.ID, "https://example.com/2", webhookSecret, nil)
+	require.NoError(t, err)
+	_, err = app.WebhookService.Register(ctx, other.ID, "https://example.org/1", webhookSecret, nil)
+	require.NoError(t, err)
+
+	var respJSON []webhookSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/webhooks", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.Len(t, respJSON, 2)
+	assert.Equal(t, "https://example.com/1", respJSON[0].URL)
+	assert.Equal(t, []string{"order"}, respJSON[0].Events)
+	assert.Equal(t, "https://example.com/2", respJSON[1].URL)
+	assert.Equal(t, []string{"order", "balance"}, respJSON[1].Events)
+}
+
+func TestHandler_DeleteWebhook(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret")
+	w, _ := app.WebhookService.Register(ctx, u.ID, "https://example.com/hook", webhookSecret, nil)
+	path := fmt.Sprintf("/api/user/webhooks/%d", w.ID)
+
+	for _, p := range []string{"/api/user/webhooks/9999", "/api/user/webhooks/foo", path} {
+		resp, _ := testutils.DoTestRequest(ts, http.MethodDelete, p, nil, testutils.WithUser(other, app))
+		resp.Body.Close()
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodDelete, path, nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodDelete, path, nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	webhooks, err := app.WebhookService.GetUserWebhooks(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, webhooks, 0)
+}
+
+func TestHandler_EnableWebhook(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret")
+	w, _ := app.WebhookService.Register(ctx, u.ID, "https://example.com/hook", webhookSecret, nil)
+	path := fmt.Sprintf("/api/user/webhooks/%d/enable", w.ID)
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodPost, path, nil, testutils.WithUser(other, app))
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	var respJSON webhookRespSchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodPost, path, nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, w.ID, respJSON.Result.ID)
+	assert.True(t, respJSON.Result.Enabled)
+	assert.Equal(t, 0, respJSON.Result.ConsecutiveFailures)
+}
+
+func TestHandler_ListWebhookDeliveries(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	other, _ := app.UserService.RegisterNewUser(ctx, "customer", "secret")
+	w, _ := app.WebhookService.Register(ctx, u.ID, "https://example.com/hook", webhookSecret, []string{"balance"})
+	path := fmt.Sprintf("/api/user/webhooks/%d/deliveries", w.ID)
+
+	resp, _ := testutils.DoTestRequest(ts, http.MethodGet, path, nil, testutils.WithUser(u, app))
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	for _, points := range []int64{10, 20, 30} {
+		e := pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(points), decimal.Zero, decimal.Zero)
+		require.NoError(t, app.WebhookService.Publish(ctx, e))
+	}
+
+	var respJSON []webhookDeliverySchema
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, path+"?limit=2", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&respJSON),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.Len(t, respJSON, 2)
+	assert.True(t, respJSON[0].ID > respJSON[1].ID)
+	for _, item := range respJSON {
+		assert.Equal(t, "balance", item.Event)
+		assert.Equal(t, "PENDING", item.Status)
+		assert.Equal(t, 0, item.Attempts)
+		assert.NotNil(t, item.NextAttemptAt)
+		assert.Nil(t, item.DeliveredAt)
+	}
+
+	for _, p := range []string{path + "?limit=5000", path + "?limit=foo"} {
+		resp, _ = testutils.DoTestRequest(ts, http.MethodGet, p, nil, testutils.WithUser(u, app))
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode)
+	}
+
+	resp, _ = testutils.DoTestRequest(ts, http.MethodGet, path, nil, testutils.WithUser(other, app))
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHandler_Webhooks_RequireAuth(t *testing.T) {
+	ts, _, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/user/webhooks"},
+		{http.MethodGet, "/api/user/webhooks"},
+		{http.MethodDelete, "/api/user/webhooks/1"},
+		{http.MethodPost, "/api/user/webhooks/1/enable"},
+		{http.MethodGet, "/api/user/webhooks/1/deliveries"},
+	}
+	for _, tt := range tests {
+		resp, _ := testutils.DoTestRequest(ts, tt.method, tt.path, nil)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
 	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
 )
@@ -70,15 +71,37 @@ func (h *Handler) RequestWithdrawal(c *gin.Context) {
 }
 
 type ListWithdrawalRespItem struct {
-	Order       string    `json:"order"`
-	Sum         float64   `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"` // nolint: tagliatelle
+	Order       string                       `json:"order"`
+	Sum         float64                      `json:"sum"`
+	ProcessedAt time.Time                    `json:"processed_at"` // nolint: tagliatelle
+	Status      withdrawals.WithdrawalStatus `json:"status"`
+	Refunded    float64                      `json:"refunded,omitempty"`
 }
 
+// ListUserWithdrawals lists the user's withdrawals page by page, oldest first unless sorted otherwise.
+// The withdrawals may be filtered by their processing time.
+// Unless the page is the last one, the cursor pointing at the next page is returned in the headers
 func (h *Handler) ListUserWithdrawals(c *gin.Context) {
 	user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
-	userWithdrawals, err := h.app.WithdrawalService.GetUserWithdrawals(c.Request.Context(), user.ID)
-
+	var req ListPageReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Debug().Err(err).Str("path", c.FullPath()).Msg("Unable to validate withdrawal list request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := req.cursor()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := withdrawals.ListQuery{
+		ProcessedFrom: req.From,
+		ProcessedTo:   req.To,
+		Descending:    req.Sort == "desc",
+		After:         after,
+		Limit:         req.listLimit(),
+	}
+	userWithdrawals, next, err := h.app.WithdrawalService.GetUserWithdrawalsPage(c.Request.Context(), user.ID, query)
 	if err != nil {
 		log.Warn().
 			Err(err).Str("path", c.FullPath()).Int("userID", user.ID).
@@ -96,7 +119,10 @@ func (h *Handler) ListUserWithdrawals(c *gin.Context) {
 			w.Number,
 			encode.DecimalToFloat(w.Sum),
 			w.ProcessedAt,
+			w.Status,
+			encode.DecimalToFloat(w.Refunded),
 		})
 	}
+	setNextPageHeaders(c, next)
 	c.JSON(http.StatusOK, jsonItems)
 }
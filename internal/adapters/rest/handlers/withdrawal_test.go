@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	wrepo "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
 )
 
@@ -73,7 +74,7 @@ func TestHandler_RequestWithdrawal_OK(t *testing.T) {
 	assert.Equal(t, "44", balance.Current.String())
 	assert.Equal(t, "56", balance.Withdrawn.String())
 
-	userWithdrawals, err := app.WithdrawalService.GetUserWithdrawals(ctx, u.ID)
+	userWithdrawals, _, err := app.WithdrawalService.GetUserWithdrawalsPage(ctx, u.ID, wrepo.ListQuery{})
 	require.NoError(t, err)
 
 	assert.Len(t, userWithdrawals, 2)
@@ -165,7 +166,7 @@ func TestHandler_RequestWithdrawal_Validation(t *testing.T) {
 			)
 			resp.Body.Close()
 			balance, _ := app.UserService.GetBalance(ctx, u.ID)
-			userWithdrawals, _ := app.WithdrawalService.GetUserWithdrawals(ctx, u.ID)
+			userWithdrawals, _, _ := app.WithdrawalService.GetUserWithdrawalsPage(ctx, u.ID, wrepo.ListQuery{})
 
 			assert.Equal(t, tt.wantStatus, resp.StatusCode)
 			if tt.want {
@@ -216,7 +217,7 @@ func TestHandler_RequestWithdrawal_NotEnoughPointsRace(t *testing.T) {
 	wg.Wait()
 
 	balance, _ := app.UserService.GetBalance(ctx, u.ID)
-	userWithdrawals, _ := app.WithdrawalService.GetUserWithdrawals(ctx, u.ID)
+	userWithdrawals, _, _ := app.WithdrawalService.GetUserWithdrawalsPage(ctx, u.ID, wrepo.ListQuery{})
 	assert.Equal(t, "7", balance.Withdrawn.String())
 	assert.Equal(t, "3", balance.Current.String())
 	assert.Len(t, userWithdrawals, 2)
@@ -342,6 +343,67 @@ func TestHandler_ListUserWithdrawals_OK(t *testing.T) {
 	assert.Equal(t, 1.0, oItems[0].Sum)
 }
 
+func TestHandler_ListUserWithdrawals_Pagination(t *testing.T) {
+	ctx := context.TODO()
+	ts, app, cancel := testutils.PrepareTestServer()
+	defer cancel()
+
+	u, _ := app.UserService.RegisterNewUser(ctx, "shopper", "secret")
+	require.NoError(t, app.UserService.AccruePoints(ctx, u.ID, decimal.NewFromInt(100)))
+	numbers := []string{"1234567812345670", "4561261212345467", "2538566283278270"}
+	for _, number := range numbers {
+		_, err := app.WithdrawalService.RequestWithdrawal(ctx, number, u.ID, decimal.NewFromInt(1))
+		require.NoError(t, err)
+	}
+
+	var items []listWithdrawalItemSchema
+	resp, _ := testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/withdrawals?sort=desc&limit=2", nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&items),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, items, 2)
+	assert.Equal(t, "2538566283278270", items[0].Order)
+	assert.Equal(t, "4561261212345467", items[1].Order)
+	cursor := resp.Header.Get("X-Next-Cursor")
+	require.NotEmpty(t, cursor)
+	assert.Equal(
+		t,
+		`</api/user/balance/withdrawals?cursor=`+cursor+`&limit=2&sort=desc>; rel="next"`,
+		resp.Header.Get("Link"),
+	)
+
+	items = nil
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/withdrawals?sort=desc&limit=2&cursor="+cursor, nil,
+		testutils.WithUser(u, app),
+		testutils.MustBindJSON(&items),
+	)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, items, 1)
+	assert.Equal(t, "1234567812345670", items[0].Order)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+	assert.Empty(t, resp.Header.Get("Link"))
+
+	inHour := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/withdrawals?from="+inHour, nil,
+		testutils.WithUser(u, app),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp, _ = testutils.DoTestRequest(
+		ts, http.MethodGet, "/api/user/balance/withdrawals?cursor=foo", nil,
+		testutils.WithUser(u, app),
+	)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
 func TestHandler_ListUserWithdrawals_NoWithdrawalsForUser(t *testing.T) {
 	ts, app, cancel := testutils.PrepareTestServer()
 	defer cancel()
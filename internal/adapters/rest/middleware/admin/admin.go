@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+)
+
+const tokenPrefix = "Bearer "
+
+// RequireAdminToken restricts access to the admin API to the requests
+// bearing the token configured with the service.
+// The admin API is not available at all, unless the token is configured
+func RequireAdminToken(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.AdminToken == "" {
+			log.Debug().Str("path", c.FullPath()).Msg("Admin API is disabled")
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, tokenPrefix) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		token := strings.TrimPrefix(header, tokenPrefix)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			log.Warn().Str("path", c.FullPath()).Msg("Invalid admin token")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
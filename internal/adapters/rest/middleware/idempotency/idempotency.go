@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	idempotencyService "github.com/sergeii/practikum-go-gophermart/internal/services/idempotency"
+)
+
+const (
+	HeaderName         = "Idempotency-Key"
+	ReplayedHeaderName = "Idempotent-Replayed"
+	MaxKeyLength       = 255
+	// the response is stored even if the client has gone away in the meantime
+	storeTimeout = time.Second * 5
+)
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Replay makes retries of a request bearing the Idempotency-Key header safe.
+// The response to the first request with the key is stored,
+// and a retry with the same key is answered with the stored response instead of repeating the request.
+// Reusing the key with a different request is refused with 422.
+// Should the handler panic, the key is released, so the request can be retried with the same key.
+// Requests without the header are not affected.
+// The middleware must follow the authentication middleware, as the keys are scoped to the user
+func Replay(s idempotencyService.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderName)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > MaxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "idempotency key is too long"})
+			return
+		}
+		user := c.MustGet(auth.ContextKey).(users.User) // nolint: forcetypeassert
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// the body has been consumed, let the handler read it again
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		path := c.Request.URL.Path
+		k, err := s.Begin(c.Request.Context(), user.ID, key, c.Request.Method, path, body)
+		if err != nil {
+			switch {
+			case errors.Is(err, idempotencyService.ErrKeyReused):
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			case errors.Is(err, idempotencyService.ErrRequestInProgress):
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		if k.IsComplete() {
+			log.Debug().Str("path", path).Int("userID", user.ID).Msg("Replaying response for idempotency key")
+			c.Header(ReplayedHeaderName, "true")
+			c.Data(k.StatusCode, k.ContentType, k.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer func() {
+			if r := recover(); r != nil {
+				// the request has not been carried out to the end, so it can be retried with the same key
+				ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+				defer cancel()
+				if releaseErr := s.Release(ctx, k); releaseErr != nil {
+					log.Error().
+						Err(releaseErr).Str("path", path).Int("userID", user.ID).
+						Msg("Failed to release idempotency key")
+				}
+				panic(r)
+			}
+		}()
+		c.Next()
+
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		err = s.Finish(ctx, k, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Int("userID", user.ID).Msg("Failed to store response for idempotency key")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package signature
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/pkg/security/signature"
+)
+
+const (
+	TimestampHeader = "X-Accrual-Timestamp"
+	SignatureHeader = "X-Accrual-Signature"
+	signaturePrefix = "sha256="
+)
+
+// RequireAccrualSignature lets through only the requests signed by the accrual system.
+// The request must carry the unix time it has been sent at and the HMAC-SHA256 signature
+// of the time and the request body, calculated with the secret shared with the accrual system.
+// Requests sent outside the configured time window are rejected, so that intercepted requests cannot be replayed.
+// The callbacks are not available at all, unless the secret is configured
+func RequireAccrualSignature(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.AccrualWebhookSecret == "" {
+			log.Debug().Str("path", c.FullPath()).Msg("Accrual callbacks are disabled")
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		unix, err := strconv.ParseInt(c.GetHeader(TimestampHeader), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "request timestamp is missing"})
+			return
+		}
+		sentAt := time.Unix(unix, 0)
+		if age := time.Since(sentAt); age > cfg.AccrualWebhookTolerance || age < -cfg.AccrualWebhookTolerance {
+			log.Warn().Str("path", c.FullPath()).Time("sentAt", sentAt).Msg("Accrual callback is outside time window")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "request has expired"})
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sig := strings.TrimPrefix(c.GetHeader(SignatureHeader), signaturePrefix)
+		if !signature.Verify([]byte(cfg.AccrualWebhookSecret), sentAt, body, sig) {
+			log.Warn().Str("path", c.FullPath()).Msg("Invalid accrual callback signature")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+		// the body has been consumed, so it has to be put back for the handler
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
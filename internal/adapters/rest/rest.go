@@ -8,7 +8,10 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/handlers"
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/admin"
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/auth"
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/idempotency"
+	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/middleware/signature"
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest/validate"
 	"github.com/sergeii/practikum-go-gophermart/internal/application"
 )
@@ -30,8 +33,12 @@ func New(app *application.App) (*gin.Engine, error) {
 func registerRoutes(r *gin.Engine, app *application.App) error { // nolint: unparam
 	handler := handlers.New(app)
 	privateRoutes := r.Group("/", auth.Authentication(app.Cfg), auth.RequireAuthentication)
+	adminRoutes := r.Group("/api/admin", admin.RequireAdminToken(app.Cfg))
+	internalRoutes := r.Group("/internal", signature.RequireAccrualSignature(app.Cfg))
 	registerPublicRoutes(r, handler)
-	registerPrivateRoutes(privateRoutes, handler)
+	registerPrivateRoutes(privateRoutes, handler, idempotency.Replay(app.Idempotency))
+	registerAdminRoutes(adminRoutes, handler)
+	registerInternalRoutes(internalRoutes, handler)
 	return nil
 }
 
@@ -40,12 +47,40 @@ func registerPublicRoutes(r *gin.Engine, h *handlers.Handler) {
 	r.POST("/api/user/login", h.LoginUser)
 }
 
-func registerPrivateRoutes(r *gin.RouterGroup, h *handlers.Handler) {
-	r.POST("/api/user/orders", h.UploadOrder)
+func registerPrivateRoutes(r *gin.RouterGroup, h *handlers.Handler, replay gin.HandlerFunc) {
+	r.POST("/api/user/orders", replay, h.UploadOrder)
+	r.POST("/api/user/orders/batch", replay, h.UploadOrderBatch)
 	r.GET("/api/user/orders", h.ListUserOrders)
+	r.GET("/api/user/orders/:number", h.ShowOrder)
+	r.GET("/api/user/orders/:number/history", h.ShowOrderHistory)
 	r.GET("/api/user/balance", h.ShowUserBalance)
-	r.POST("/api/user/balance/withdraw", h.RequestWithdrawal)
+	r.POST("/api/user/balance/withdraw", replay, h.RequestWithdrawal)
 	r.GET("/api/user/balance/withdrawals", h.ListUserWithdrawals)
+	r.POST("/api/user/balance/holds", replay, h.ReserveWithdrawal)
+	r.POST("/api/user/balance/holds/:id/capture", replay, h.CaptureHold)
+	r.POST("/api/user/balance/holds/:id/release", replay, h.ReleaseHold)
+	r.POST("/api/user/balance/transfer", replay, h.TransferPoints)
+	r.GET("/api/user/balance/history", h.ListBalanceHistory)
+	r.GET("/api/user/events", h.StreamEvents)
+	r.POST("/api/user/webhooks", h.RegisterWebhook)
+	r.GET("/api/user/webhooks", h.ListUserWebhooks)
+	r.DELETE("/api/user/webhooks/:id", h.DeleteWebhook)
+	r.POST("/api/user/webhooks/:id/enable", h.EnableWebhook)
+	r.GET("/api/user/webhooks/:id/deliveries", h.ListWebhookDeliveries)
+}
+
+func registerAdminRoutes(r *gin.RouterGroup, h *handlers.Handler) {
+	r.GET("/orders/failed", h.ListFailedOrders)
+	r.POST("/orders/:number/requeue", h.RequeueFailedOrder)
+	r.GET("/accrual/status", h.ShowAccrualStatus)
+	r.GET("/adjustments/pending", h.ListPendingAdjustments)
+	r.POST("/adjustments/:id/apply", h.ApplyAdjustment)
+	r.POST("/adjustments/:id/dismiss", h.DismissAdjustment)
+	r.POST("/withdrawals/:number/refund", h.RefundWithdrawal)
+}
+
+func registerInternalRoutes(r *gin.RouterGroup, h *handlers.Handler) {
+	r.POST("/accrual/callback", h.AcceptAccrualCallback)
 }
 
 func registerMiddlewares(router *gin.Engine, app *application.App) error { // nolint: unparam
@@ -2,8 +2,16 @@ package application
 
 import (
 	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/account"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/balancecheck"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/expiry"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/idempotency"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/reconciliation"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/transfer"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/webhook"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
 )
 
@@ -11,6 +19,14 @@ type App struct {
 	UserService       account.Service
 	OrderService      order.Service
 	WithdrawalService withdrawal.Service
+	TransferService   transfer.Service
+	Reconciliation    reconciliation.Service
+	BalanceCheck      balancecheck.Service
+	PointsExpiry      expiry.Service
+	Idempotency       idempotency.Service
+	WebhookService    webhook.Service
+	AccrualBreaker    *breaker.Breaker
+	Events            pubsub.Broker
 	Cfg               config.Config
 }
 
@@ -19,11 +35,27 @@ func NewApp(
 	userService account.Service,
 	orderService order.Service,
 	withdrawalService withdrawal.Service,
+	transferService transfer.Service,
+	reconciliationService reconciliation.Service,
+	balanceCheckService balancecheck.Service,
+	pointsExpiryService expiry.Service,
+	idempotencyService idempotency.Service,
+	webhookService webhook.Service,
+	accrualBreaker *breaker.Breaker,
+	events pubsub.Broker,
 ) *App {
 	return &App{
 		Cfg:               cfg,
 		UserService:       userService,
 		OrderService:      orderService,
 		WithdrawalService: withdrawalService,
+		TransferService:   transferService,
+		Reconciliation:    reconciliationService,
+		BalanceCheck:      balanceCheckService,
+		PointsExpiry:      pointsExpiryService,
+		Idempotency:       idempotencyService,
+		WebhookService:    webhookService,
+		AccrualBreaker:    accrualBreaker,
+		Events:            events,
 	}
 }
@@ -0,0 +1,51 @@
+package adjustments
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+)
+
+type Status string
+
+const (
+	// StatusPending is for the mismatches awaiting a decision of an operator
+	StatusPending Status = "PENDING"
+	// StatusApplied is for the mismatches that have been settled with the user's balance
+	StatusApplied Status = "APPLIED"
+	// StatusDismissed is for the mismatches an operator has decided to leave as they are
+	StatusDismissed Status = "DISMISSED"
+)
+
+// Adjustment is a record of a mismatch between the accrual stored for an order
+// and the accrual currently reported for the same order by the accrual system.
+// Applied adjustments serve as the ledger entries for the changes made to the users' balance
+type Adjustment struct {
+	ID        int
+	OrderID   int
+	UserID    int
+	Recorded  decimal.Decimal
+	Actual    decimal.Decimal
+	Status    Status
+	CreatedAt time.Time
+}
+
+var Blank Adjustment // nolint: gochecknoglobals
+
+func New(o orders.Order, actual decimal.Decimal, status Status) Adjustment {
+	return Adjustment{
+		OrderID:   o.ID,
+		UserID:    o.User.ID,
+		Recorded:  o.Accrual,
+		Actual:    actual,
+		Status:    status,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Amount returns the number of points the user is owed, or owes if negative
+func (a Adjustment) Amount() decimal.Decimal {
+	return a.Actual.Sub(a.Recorded)
+}
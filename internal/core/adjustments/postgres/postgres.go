@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/adjustments"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add records an accrual mismatch found for an order.
+// An order may have only one adjustment pending review at a time,
+// another attempt to add one results in ErrAdjustmentIsPending
+func (r Repository) Add(ctx context.Context, ca adjustments.Adjustment) (adjustments.Adjustment, error) {
+	adj := ca
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO accrual_adjustments "+
+				"(order_id, user_id, recorded_accrual, actual_accrual, status, created_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) "+
+				"ON CONFLICT (order_id) WHERE status = 'PENDING' DO NOTHING "+
+				"RETURNING id, created_at",
+			ca.OrderID, ca.UserID, ca.Recorded, ca.Actual, ca.Status, ca.CreatedAt,
+		).
+		Scan(&adj.ID, &adj.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return adjustments.Blank, adjustments.ErrAdjustmentIsPending
+		}
+		log.Error().Err(err).Int("orderID", ca.OrderID).Msg("Failed to add accrual adjustment")
+		return adjustments.Blank, err
+	}
+	return adj, nil
+}
+
+// Resolve moves a pending adjustment to the given status and returns the resolved adjustment.
+// Adjustments that are not pending review are reported as not found,
+// so the same adjustment is never resolved twice
+func (r Repository) Resolve(ctx context.Context, id int, status adjustments.Status) (adjustments.Adjustment, error) {
+	var a adjustments.Adjustment
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"UPDATE accrual_adjustments SET status = $1 WHERE id = $2 AND status = 'PENDING' "+
+				"RETURNING id, order_id, user_id, recorded_accrual, actual_accrual, status, created_at",
+			status, id,
+		).
+		Scan(&a.ID, &a.OrderID, &a.UserID, &a.Recorded, &a.Actual, &a.Status, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return adjustments.Blank, adjustments.ErrAdjustmentNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Str("status", string(status)).Msg("Failed to resolve accrual adjustment")
+		return adjustments.Blank, err
+	}
+	return a, nil
+}
+
+// GetListByStatus returns the adjustments with the given status in the order they have been recorded.
+// The list starts after the adjustment with the given ID
+func (r Repository) GetListByStatus(
+	ctx context.Context, status adjustments.Status, afterID int, limit int,
+) ([]adjustments.Adjustment, error) {
+	var items []adjustments.Adjustment
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT id, order_id, user_id, recorded_accrual, actual_accrual, status, created_at "+
+			"FROM accrual_adjustments WHERE status = $1 AND id > $2 ORDER BY id ASC LIMIT $3",
+		status, afterID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("status", string(status)).Msg("Failed to query accrual adjustments")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a adjustments.Adjustment
+		err = rows.Scan(&a.ID, &a.OrderID, &a.UserID, &a.Recorded, &a.Actual, &a.Status, &a.CreatedAt)
+		if err != nil {
+			log.Error().Err(err).Str("status", string(status)).Msg("Failed to read accrual adjustments")
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Str("status", string(status)).Msg("Failed to fetch accrual adjustments")
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,68 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/adjustments"
+	adb "github.com/sergeii/practikum-go-gophermart/internal/core/adjustments/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestAdjustmentsDatabase_AddAndList(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u, _ := udb.New(db).Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	ordersRepo := odb.New(db)
+	o1, _ := ordersRepo.Add(context.TODO(), orders.New("1234567812345670", u.ID))
+	o1.Accrual = decimal.NewFromInt(100)
+	o2, _ := ordersRepo.Add(context.TODO(), orders.New("79927398713", u.ID))
+	o2.Accrual = decimal.NewFromInt(50)
+
+	repo := adb.New(db)
+	a1, err := repo.Add(context.TODO(), adjustments.New(o1, decimal.RequireFromString("120.5"), adjustments.StatusPending))
+	require.NoError(t, err)
+	assert.True(t, a1.ID > 0)
+	assert.Equal(t, "20.5", a1.Amount().String())
+
+	// the order already awaits review
+	_, err = repo.Add(context.TODO(), adjustments.New(o1, decimal.NewFromInt(130), adjustments.StatusPending))
+	assert.ErrorIs(t, err, adjustments.ErrAdjustmentIsPending)
+	// but its mismatches can still be applied
+	_, err = repo.Add(context.TODO(), adjustments.New(o1, decimal.NewFromInt(130), adjustments.StatusApplied))
+	require.NoError(t, err)
+
+	a2, err := repo.Add(context.TODO(), adjustments.New(o2, decimal.NewFromInt(40), adjustments.StatusPending))
+	require.NoError(t, err)
+	assert.Equal(t, "-10", a2.Amount().String())
+
+	items, err := repo.GetListByStatus(context.TODO(), adjustments.StatusPending, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, a1.ID, items[0].ID)
+	assert.Equal(t, o1.ID, items[0].OrderID)
+	assert.Equal(t, u.ID, items[0].UserID)
+	assert.Equal(t, "100", items[0].Recorded.String())
+	assert.Equal(t, "120.5", items[0].Actual.String())
+	assert.Equal(t, adjustments.StatusPending, items[0].Status)
+	assert.Equal(t, a2.ID, items[1].ID)
+
+	items, err = repo.GetListByStatus(context.TODO(), adjustments.StatusPending, a1.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, a2.ID, items[0].ID)
+
+	items, err = repo.GetListByStatus(context.TODO(), adjustments.StatusApplied, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "130", items[0].Actual.String())
+}
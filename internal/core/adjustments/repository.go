@@ -0,0 +1,15 @@
+package adjustments
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrAdjustmentIsPending = errors.New("order already awaits review")
+var ErrAdjustmentNotFound = errors.New("pending adjustment not found")
+
+type Repository interface {
+	Add(context.Context, Adjustment) (Adjustment, error)
+	Resolve(context.Context, int, Status) (Adjustment, error)
+	GetListByStatus(context.Context, Status, int, int) ([]Adjustment, error)
+}
@@ -0,0 +1,28 @@
+package balancerepairs
+
+import (
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+)
+
+// Repair is a record of a user's balance brought back in line with the ledger.
+// The recorded balance is the one the user had before the repair
+type Repair struct {
+	ID        int
+	UserID    int
+	Recorded  users.UserBalance
+	Expected  users.UserBalance
+	CreatedAt time.Time
+}
+
+var Blank Repair // nolint: gochecknoglobals
+
+func New(userID int, recorded, expected users.UserBalance) Repair {
+	return Repair{
+		UserID:    userID,
+		Recorded:  recorded,
+		Expected:  expected,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add records a repair of a user's balance.
+// The repair is written using the connection from the context,
+// so it is committed or rolled back along with the balance itself
+func (r Repository) Add(ctx context.Context, cr balancerepairs.Repair) (balancerepairs.Repair, error) {
+	repair := cr
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO balance_repairs "+
+				"(user_id, recorded_current, recorded_withdrawn, recorded_held, "+
+				"expected_current, expected_withdrawn, expected_held, created_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+			cr.UserID, cr.Recorded.Current, cr.Recorded.Withdrawn, cr.Recorded.Held,
+			cr.Expected.Current, cr.Expected.Withdrawn, cr.Expected.Held, cr.CreatedAt,
+		).
+		Scan(&repair.ID)
+	if err != nil {
+		log.Error().Err(err).Int("userID", cr.UserID).Msg("Failed to add balance repair")
+		return balancerepairs.Blank, err
+	}
+	return repair, nil
+}
+
+// GetListForUser returns the repairs of the user's balance in the order they have been made
+func (r Repository) GetListForUser(ctx context.Context, userID int) ([]balancerepairs.Repair, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT id, user_id, recorded_current, recorded_withdrawn, recorded_held, "+
+			"expected_current, expected_withdrawn, expected_held, created_at "+
+			"FROM balance_repairs WHERE user_id = $1 ORDER BY id ASC",
+		userID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query balance repairs for user")
+		return nil, err
+	}
+	defer rows.Close()
+	var items []balancerepairs.Repair
+	for rows.Next() {
+		var rp balancerepairs.Repair
+		err = rows.Scan(
+			&rp.ID, &rp.UserID, &rp.Recorded.Current, &rp.Recorded.Withdrawn, &rp.Recorded.Held,
+			&rp.Expected.Current, &rp.Expected.Withdrawn, &rp.Expected.Held, &rp.CreatedAt,
+		)
+		if err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Failed to read balance repairs for user")
+			return nil, err
+		}
+		items = append(items, rp)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch balance repairs for user")
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,65 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs"
+	rdb "github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestBalanceRepairsDatabase_Add_OK(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u1, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	u2, _ := udb.New(db).Create(ctx, urepo.New("shopper", "secr3t"))
+	repo := rdb.New(db)
+
+	r1, err := repo.Add(ctx, balancerepairs.New(
+		u1.ID,
+		urepo.UserBalance{Current: decimal.RequireFromString("15"), Withdrawn: decimal.Zero},
+		urepo.UserBalance{Current: decimal.RequireFromString("10"), Withdrawn: decimal.Zero},
+	))
+	require.NoError(t, err)
+	assert.True(t, r1.ID > 0)
+	r2, err := repo.Add(ctx, balancerepairs.New(
+		u1.ID,
+		urepo.UserBalance{Current: decimal.RequireFromString("7.5"), Withdrawn: decimal.RequireFromString("2.5")},
+		urepo.UserBalance{Current: decimal.RequireFromString("10"), Withdrawn: decimal.Zero},
+	))
+	require.NoError(t, err)
+	assert.True(t, r2.ID > r1.ID)
+
+	items, err := repo.GetListForUser(ctx, u1.ID)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, r1.ID, items[0].ID)
+	assert.Equal(t, "15", items[0].Recorded.Current.String())
+	assert.Equal(t, "10", items[0].Expected.Current.String())
+	assert.Equal(t, r2.ID, items[1].ID)
+	assert.Equal(t, "7.5", items[1].Recorded.Current.String())
+	assert.Equal(t, "2.5", items[1].Recorded.Withdrawn.String())
+	assert.Equal(t, "0", items[1].Expected.Withdrawn.String())
+	assert.Equal(t, u1.ID, items[1].UserID)
+
+	items, err = repo.GetListForUser(ctx, u2.ID)
+	require.NoError(t, err)
+	assert.Len(t, items, 0)
+}
+
+func TestBalanceRepairsDatabase_Add_UnknownUser(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	_, err := rdb.New(db).Add(context.TODO(), balancerepairs.New(999999, urepo.UserBalance{}, urepo.UserBalance{}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,10 @@
+package balancerepairs
+
+import (
+	"context"
+)
+
+type Repository interface {
+	Add(context.Context, Repair) (Repair, error)
+	GetListForUser(context.Context, int) ([]Repair, error)
+}
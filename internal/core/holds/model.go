@@ -0,0 +1,57 @@
+package holds
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type HoldStatus string
+
+const (
+	// HoldStatusHeld is for the points reserved for an order until the hold is captured or released
+	HoldStatusHeld     HoldStatus = "HELD"
+	HoldStatusCaptured HoldStatus = "CAPTURED"
+	HoldStatusReleased HoldStatus = "RELEASED"
+	// HoldStatusExpired is for the holds released automatically, as nobody has claimed them in time
+	HoldStatusExpired HoldStatus = "EXPIRED"
+)
+
+// Hold is the points reserved for a withdrawal while the order it pays for is being checked out.
+// Once the hold is captured, the points are withdrawn, otherwise they are returned to the user
+type Hold struct {
+	ID          int
+	UserID      int
+	Number      string
+	Sum         decimal.Decimal
+	Status      HoldStatus
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	FinalizedAt time.Time
+}
+
+var Blank Hold // nolint: gochecknoglobals
+
+func New(number string, userID int, sum decimal.Decimal, ttl time.Duration) Hold {
+	now := time.Now()
+	return Hold{
+		UserID:    userID,
+		Number:    number,
+		Sum:       sum,
+		Status:    HoldStatusHeld,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// IsExpired tells whether the hold has not been claimed in time, even if it is yet to be released
+func (h Hold) IsExpired(now time.Time) bool {
+	return !now.Before(h.ExpiresAt)
+}
+
+// Finalize returns the hold that has been captured or released with the status
+func (h Hold) Finalize(status HoldStatus, finalizedAt time.Time) Hold {
+	h.Status = status
+	h.FinalizedAt = finalizedAt
+	return h
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+const holdColumns = "id, user_id, number, sum, status, created_at, expires_at, finalized_at"
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add reserves the points for an order.
+// The hold is written using the connection from the context,
+// so it is committed or rolled back along with the change of the user's balance
+func (r Repository) Add(ctx context.Context, ch holds.Hold) (holds.Hold, error) {
+	h := ch
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO holds (user_id, number, sum, status, created_at, expires_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			ch.UserID, ch.Number, ch.Sum, ch.Status, ch.CreatedAt, ch.ExpiresAt,
+		).
+		Scan(&h.ID)
+	if err != nil {
+		log.Error().Err(err).Int("userID", ch.UserID).Str("number", ch.Number).Msg("Failed to add hold")
+		return holds.Blank, err
+	}
+	log.Debug().Int("ID", h.ID).Str("number", h.Number).Msg("Added new hold")
+	return h, nil
+}
+
+// GetByIDForUpdate retrieves a hold by its ID, locking it until the end of the transaction
+func (r Repository) GetByIDForUpdate(ctx context.Context, id int) (holds.Hold, error) {
+	row := r.db.Conn(ctx).QueryRow(ctx, "SELECT "+holdColumns+" FROM holds WHERE id = $1 FOR UPDATE", id)
+	h, err := scanHold(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return holds.Blank, holds.ErrHoldNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Msg("Failed to lock hold by ID")
+		return holds.Blank, err
+	}
+	return h, nil
+}
+
+// GetHeldByNumber looks for the hold on the points reserved for the order, unless the hold is finalized
+func (r Repository) GetHeldByNumber(ctx context.Context, number string) (holds.Hold, error) {
+	row := r.db.Conn(ctx).QueryRow(
+		ctx,
+		"SELECT "+holdColumns+" FROM holds WHERE number = $1 AND status = $2",
+		number, holds.HoldStatusHeld,
+	)
+	h, err := scanHold(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return holds.Blank, holds.ErrHoldNotFound
+		}
+		log.Error().Err(err).Str("number", number).Msg("Failed to query hold by number")
+		return holds.Blank, err
+	}
+	return h, nil
+}
+
+// GetExpiredIDs returns the IDs of the holds that have not been claimed before the specified time.
+// The holds expiring first come first
+func (r Repository) GetExpiredIDs(ctx context.Context, now time.Time, limit int) ([]int, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT id FROM holds WHERE status = $1 AND expires_at <= $2 ORDER BY expires_at ASC, id ASC LIMIT $3",
+		holds.HoldStatusHeld, now, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to query expired holds")
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			log.Error().Err(err).Msg("Failed to read expired holds")
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to fetch expired holds")
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Update saves the status of the hold once it is captured or released
+func (r Repository) Update(ctx context.Context, holdID int, h holds.Hold) error {
+	var finalizedAt *time.Time
+	if !h.FinalizedAt.IsZero() {
+		finalizedAt = &h.FinalizedAt
+	}
+	res, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE holds SET status = $1, finalized_at = $2 WHERE id = $3",
+		h.Status, finalizedAt, holdID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("holdID", holdID).Msg("Failed to update hold")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return holds.ErrHoldNotFound
+	}
+	return nil
+}
+
+func scanHold(row pgx.Row) (holds.Hold, error) {
+	var h holds.Hold
+	var finalizedAt *time.Time
+	err := row.Scan(
+		&h.ID, &h.UserID, &h.Number, &h.Sum, &h.Status, &h.CreatedAt, &h.ExpiresAt, &finalizedAt,
+	)
+	if err != nil {
+		return holds.Blank, err
+	}
+	if finalizedAt != nil {
+		h.FinalizedAt = *finalizedAt
+	}
+	return h, nil
+}
@@ -0,0 +1,120 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	hdb "github.com/sergeii/practikum-go-gophermart/internal/core/holds/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestHoldsDatabase_Add_OK(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := hdb.New(db)
+
+	before := time.Now()
+	h, err := repo.Add(ctx, holds.New("1234567812345670", u.ID, decimal.RequireFromString("9.99"), time.Minute))
+	require.NoError(t, err)
+	assert.True(t, h.ID > 0)
+	assert.Equal(t, holds.HoldStatusHeld, h.Status)
+
+	locked, err := repo.GetByIDForUpdate(ctx, h.ID)
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, locked.UserID)
+	assert.Equal(t, "1234567812345670", locked.Number)
+	assert.Equal(t, "9.99", locked.Sum.String())
+	assert.Equal(t, holds.HoldStatusHeld, locked.Status)
+	assert.True(t, !locked.CreatedAt.Before(before.Truncate(time.Microsecond)))
+	assert.Equal(t, locked.CreatedAt.Add(time.Minute), locked.ExpiresAt)
+	assert.True(t, locked.FinalizedAt.IsZero())
+
+	// the points are held for an order only once
+	_, err = repo.Add(ctx, holds.New("1234567812345670", u.ID, decimal.RequireFromString("1"), time.Minute))
+	assert.Error(t, err)
+	// as long as the hold is not finalized
+	err = repo.Update(ctx, h.ID, h.Finalize(holds.HoldStatusReleased, time.Now()))
+	require.NoError(t, err)
+	_, err = repo.Add(ctx, holds.New("1234567812345670", u.ID, decimal.RequireFromString("1"), time.Minute))
+	assert.NoError(t, err)
+
+	// the sum must be positive
+	_, err = repo.Add(ctx, holds.New("79927398713", u.ID, decimal.Zero, time.Minute))
+	assert.Error(t, err)
+	_, err = repo.Add(ctx, holds.New("79927398713", 999999, decimal.RequireFromString("1"), time.Minute))
+	assert.Error(t, err)
+}
+
+func TestHoldsDatabase_GetHeldByNumber(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := hdb.New(db)
+
+	h, err := repo.Add(ctx, holds.New("1234567812345670", u.ID, decimal.RequireFromString("9.99"), time.Minute))
+	require.NoError(t, err)
+
+	found, err := repo.GetHeldByNumber(ctx, "1234567812345670")
+	require.NoError(t, err)
+	assert.Equal(t, h.ID, found.ID)
+
+	err = repo.Update(ctx, h.ID, h.Finalize(holds.HoldStatusCaptured, time.Now()))
+	require.NoError(t, err)
+	_, err = repo.GetHeldByNumber(ctx, "1234567812345670")
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+
+	captured, err := repo.GetByIDForUpdate(ctx, h.ID)
+	require.NoError(t, err)
+	assert.Equal(t, holds.HoldStatusCaptured, captured.Status)
+	assert.False(t, captured.FinalizedAt.IsZero())
+
+	_, err = repo.GetByIDForUpdate(ctx, 999999)
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+	err = repo.Update(ctx, 999999, h)
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+}
+
+func TestHoldsDatabase_GetExpiredIDs(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := hdb.New(db)
+
+	ids := make([]int, 0, 4)
+	for i, ttl := range []time.Duration{time.Minute * 5, time.Minute, time.Minute * 3, time.Hour} {
+		number := testutils.NewLuhnNumber(10 + i)
+		h, err := repo.Add(ctx, holds.New(number, u.ID, decimal.RequireFromString("1"), ttl))
+		require.NoError(t, err)
+		ids = append(ids, h.ID)
+	}
+	// finalized holds never expire
+	h, _ := repo.GetByIDForUpdate(ctx, ids[2])
+	require.NoError(t, repo.Update(ctx, h.ID, h.Finalize(holds.HoldStatusReleased, time.Now())))
+
+	expired, err := repo.GetExpiredIDs(ctx, time.Now().Add(time.Minute*10), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{ids[1], ids[0]}, expired)
+
+	expired, err = repo.GetExpiredIDs(ctx, time.Now().Add(time.Minute*10), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{ids[1]}, expired)
+
+	expired, err = repo.GetExpiredIDs(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Len(t, expired, 0)
+}
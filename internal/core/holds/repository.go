@@ -0,0 +1,17 @@
+package holds
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrHoldNotFound = errors.New("hold not found")
+
+type Repository interface {
+	Add(context.Context, Hold) (Hold, error)
+	GetByIDForUpdate(context.Context, int) (Hold, error)
+	GetHeldByNumber(context.Context, string) (Hold, error)
+	GetExpiredIDs(context.Context, time.Time, int) ([]int, error)
+	Update(context.Context, int, Hold) error
+}
@@ -0,0 +1,46 @@
+package idempotencykeys
+
+import (
+	"time"
+)
+
+// Key is a client supplied key that makes retries of a request safe.
+// The key remembers the request it has been first used with and, once the request is complete,
+// the response to the request, so that the response is replayed instead of repeating the request
+type Key struct {
+	ID     int
+	Key    string
+	UserID int
+	Method string
+	Path   string
+	// Fingerprint is a digest of the request the key has been first used with
+	Fingerprint string
+	// StatusCode is zero until the response to the request is stored
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	// CreatedAt is the time the key has been reserved for the request at.
+	// Along with the ID, it tells the current reservation of the key from the one taken over
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+var Blank Key // nolint: gochecknoglobals
+
+func New(key string, userID int, method, path, fingerprint string, ttl time.Duration) Key {
+	now := time.Now()
+	return Key{
+		Key:         key,
+		UserID:      userID,
+		Method:      method,
+		Path:        path,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+}
+
+// IsComplete tells whether the response to the request has been stored along with the key
+func (k Key) IsComplete() bool {
+	return k.StatusCode != 0
+}
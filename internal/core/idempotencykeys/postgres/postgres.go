@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/idempotencykeys"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Reserve stores a new key for the user.
+// An expired key of the same user is replaced with the new one,
+// and so is a key reserved for the same request before staleBefore that still has no response stored,
+// as the request it has been reserved for has most likely been abandoned.
+// An attempt to reserve a key that is still in use results in ErrKeyExists
+func (r Repository) Reserve(
+	ctx context.Context, k idempotencykeys.Key, staleBefore time.Time,
+) (idempotencykeys.Key, error) {
+	reserved := k
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO idempotency_keys "+
+				"(key, user_id, method, path, fingerprint, created_at, expires_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7) "+
+				"ON CONFLICT (user_id, key) DO UPDATE SET "+
+				"method = EXCLUDED.method, path = EXCLUDED.path, fingerprint = EXCLUDED.fingerprint, "+
+				"status_code = NULL, content_type = '', body = NULL, "+
+				"created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at "+
+				"WHERE idempotency_keys.expires_at <= EXCLUDED.created_at OR ("+
+				"idempotency_keys.status_code IS NULL AND idempotency_keys.created_at <= $8 "+
+				"AND idempotency_keys.fingerprint = EXCLUDED.fingerprint"+
+				") RETURNING id, created_at",
+			k.Key, k.UserID, k.Method, k.Path, k.Fingerprint, k.CreatedAt, k.ExpiresAt, staleBefore,
+		).
+		Scan(&reserved.ID, &reserved.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return idempotencykeys.Blank, idempotencykeys.ErrKeyExists
+		}
+		log.Error().Err(err).Int("userID", k.UserID).Msg("Failed to reserve idempotency key")
+		return idempotencykeys.Blank, err
+	}
+	return reserved, nil
+}
+
+// Get returns the user's key that has not expired yet
+func (r Repository) Get(ctx context.Context, userID int, key string) (idempotencykeys.Key, error) {
+	var k idempotencykeys.Key
+	var statusCode *int
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"SELECT id, key, user_id, method, path, fingerprint, status_code, content_type, body, "+
+				"created_at, expires_at "+
+				"FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expires_at > now()",
+			userID, key,
+		).
+		Scan(
+			&k.ID, &k.Key, &k.UserID, &k.Method, &k.Path, &k.Fingerprint, &statusCode, &k.ContentType, &k.Body,
+			&k.CreatedAt, &k.ExpiresAt,
+		)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return idempotencykeys.Blank, idempotencykeys.ErrKeyNotFound
+		}
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch idempotency key")
+		return idempotencykeys.Blank, err
+	}
+	if statusCode != nil {
+		k.StatusCode = *statusCode
+	}
+	return k, nil
+}
+
+// Complete stores the response to the request the key has been reserved for.
+// A key whose reservation has been taken over in the meantime is reported as not found
+func (r Repository) Complete(
+	ctx context.Context, k idempotencykeys.Key, statusCode int, contentType string, body []byte,
+) error {
+	res, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE idempotency_keys SET status_code = $1, content_type = $2, body = $3 "+
+			"WHERE id = $4 AND created_at = $5",
+		statusCode, contentType, body, k.ID, k.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("id", k.ID).Msg("Failed to store response for idempotency key")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return idempotencykeys.ErrKeyNotFound
+	}
+	return nil
+}
+
+// Delete removes the key, so that it can be used again right away.
+// Same as with Complete, a key whose reservation has been taken over is left intact
+func (r Repository) Delete(ctx context.Context, k idempotencykeys.Key) error {
+	res, err := r.db.Conn(ctx).Exec(
+		ctx, "DELETE FROM idempotency_keys WHERE id = $1 AND created_at = $2", k.ID, k.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("id", k.ID).Msg("Failed to delete idempotency key")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return idempotencykeys.ErrKeyNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes the keys that have expired by the given time.
+// The method returns the number of removed keys
+func (r Repository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := r.db.Conn(ctx).Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete expired idempotency keys")
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
@@ -0,0 +1,153 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/idempotencykeys"
+	kdb "github.com/sergeii/practikum-go-gophermart/internal/core/idempotencykeys/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestIdempotencyKeysDatabase_ReserveAndComplete(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(ctx, urepo.New("othercustomer", "str0ng"))
+
+	repo := kdb.New(db)
+	k, err := repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour), time.Time{},
+	)
+	require.NoError(t, err)
+	assert.True(t, k.ID > 0)
+	assert.False(t, k.IsComplete())
+
+	// the key is in use
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "def", time.Hour), time.Time{},
+	)
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyExists)
+	// but not by other users
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("foo", other.ID, "POST", "/api/user/orders", "def", time.Hour), time.Time{},
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Complete(ctx, k, 202, "application/json", []byte(`{"ok":true}`)))
+	stored, err := repo.Get(ctx, u.ID, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, stored.ID)
+	assert.Equal(t, "abc", stored.Fingerprint)
+	assert.Equal(t, "/api/user/orders", stored.Path)
+	assert.True(t, stored.IsComplete())
+	assert.Equal(t, 202, stored.StatusCode)
+	assert.Equal(t, "application/json", stored.ContentType)
+	assert.Equal(t, `{"ok":true}`, string(stored.Body))
+
+	_, err = repo.Get(ctx, u.ID, "bar")
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyNotFound)
+	assert.ErrorIs(t, repo.Complete(ctx, idempotencykeys.Key{ID: 9999}, 200, "", nil), idempotencykeys.ErrKeyNotFound)
+
+	require.NoError(t, repo.Delete(ctx, k))
+	_, err = repo.Get(ctx, u.ID, "foo")
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, k), idempotencykeys.ErrKeyNotFound)
+}
+
+func TestIdempotencyKeysDatabase_Expiry(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := kdb.New(db)
+
+	expired := idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour)
+	expired.CreatedAt = time.Now().Add(-time.Hour * 2)
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+	old, err := repo.Reserve(ctx, expired, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, repo.Complete(ctx, old, 200, "text/plain", []byte("ok")))
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("bar", u.ID, "POST", "/api/user/orders", "abc", time.Hour), time.Time{},
+	)
+	require.NoError(t, err)
+
+	// expired keys are not found
+	_, err = repo.Get(ctx, u.ID, "foo")
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyNotFound)
+
+	// and are replaced once reserved again
+	k, err := repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "def", time.Hour), time.Time{},
+	)
+	require.NoError(t, err)
+	fresh, err := repo.Get(ctx, u.ID, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, fresh.ID)
+	assert.Equal(t, "def", fresh.Fingerprint)
+	assert.False(t, fresh.IsComplete())
+	assert.Nil(t, fresh.Body)
+
+	purged, err := repo.DeleteExpired(ctx, time.Now().Add(time.Hour*2))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	purged, err = repo.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestIdempotencyKeysDatabase_TakeOverStaleReservation(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := kdb.New(db)
+
+	stale := idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour)
+	stale.CreatedAt = time.Now().Add(-time.Minute * 2)
+	abandoned, err := repo.Reserve(ctx, stale, time.Time{})
+	require.NoError(t, err)
+
+	// the reservation is not stale yet
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour), time.Now().Add(-time.Hour),
+	)
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyExists)
+	// a different request cannot take over the key
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "def", time.Hour), time.Now().Add(-time.Minute),
+	)
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyExists)
+
+	k, err := repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour), time.Now().Add(-time.Minute),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, abandoned.ID, k.ID)
+
+	// the abandoned request can neither complete nor release the key anymore
+	assert.ErrorIs(t, repo.Complete(ctx, abandoned, 200, "text/plain", []byte("stale")), idempotencykeys.ErrKeyNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, abandoned), idempotencykeys.ErrKeyNotFound)
+	require.NoError(t, repo.Complete(ctx, k, 202, "text/plain", []byte("fresh")))
+	stored, err := repo.Get(ctx, u.ID, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", string(stored.Body))
+
+	// complete keys are never taken over
+	_, err = repo.Reserve(
+		ctx, idempotencykeys.New("foo", u.ID, "POST", "/api/user/orders", "abc", time.Hour), time.Now().Add(time.Hour),
+	)
+	assert.ErrorIs(t, err, idempotencykeys.ErrKeyExists)
+}
@@ -0,0 +1,18 @@
+package idempotencykeys
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("idempotency key not found")
+var ErrKeyExists = errors.New("idempotency key has already been used")
+
+type Repository interface {
+	Reserve(context.Context, Key, time.Time) (Key, error)
+	Get(context.Context, int, string) (Key, error)
+	Complete(context.Context, Key, int, string, []byte) error
+	Delete(context.Context, Key) error
+	DeleteExpired(context.Context, time.Time) (int, error)
+}
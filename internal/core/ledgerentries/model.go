@@ -0,0 +1,155 @@
+package ledgerentries
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Kind tells what has caused the points to move between the accounts
+type Kind string
+
+const (
+	// KindOpening is for the balances carried over from before the ledger was introduced
+	KindOpening Kind = "OPENING"
+	// KindAccrual is for the points accrued for a processed order
+	KindAccrual Kind = "ACCRUAL"
+	// KindWithdrawal is for the points spent by the user
+	KindWithdrawal Kind = "WITHDRAWAL"
+	// KindAdjustment is for the corrections of the user's balance, e.g. after reconciling an order's accrual
+	KindAdjustment Kind = "ADJUSTMENT"
+	// KindReversal is for the withdrawn points returned to the user
+	KindReversal Kind = "REVERSAL"
+	// KindHold is for the points reserved for a withdrawal
+	KindHold Kind = "HOLD"
+	// KindRelease is for the reserved points returned to the user instead of being withdrawn
+	KindRelease Kind = "RELEASE"
+	// KindExpiration is for the points taken away from the user after they have expired
+	KindExpiration Kind = "EXPIRATION"
+	// KindTransfer is for the points given by one user to another
+	KindTransfer Kind = "TRANSFER"
+)
+
+// Account is one of the places the points are kept in
+type Account string
+
+const (
+	// AccountAccrual is the system's account the accrued points come from
+	AccountAccrual Account = "accrual"
+	// AccountCurrent holds the points the user owns
+	AccountCurrent Account = "current"
+	// AccountWithdrawn holds the points the user has spent
+	AccountWithdrawn Account = "withdrawn"
+	// AccountHeld holds the points reserved for the withdrawals that are yet to be captured or released
+	AccountHeld Account = "held"
+)
+
+// Entry is an immutable record of the points moved from one account to another.
+// Every entry takes the amount from the debit account and puts it into the credit one,
+// so the user's balances are the sums of the entries that concern the user's accounts
+type Entry struct {
+	ID          int
+	UserID      int
+	Kind        Kind
+	Debit       Account
+	Credit      Account
+	Amount      decimal.Decimal
+	OrderNumber string
+	// CounterpartyID is the other user the points have been passed to or received from, if any
+	CounterpartyID int
+	CreatedAt      time.Time
+	// Balance is the user's current balance right after the entry, as long as it is known
+	Balance decimal.Decimal
+}
+
+var Blank Entry // nolint: gochecknoglobals
+
+func New(userID int, kind Kind, debit, credit Account, amount decimal.Decimal, orderNumber string) Entry {
+	return Entry{
+		UserID:      userID,
+		Kind:        kind,
+		Debit:       debit,
+		Credit:      credit,
+		Amount:      amount,
+		OrderNumber: orderNumber,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// NewAccrual records the points accrued for the user's order
+func NewAccrual(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindAccrual, AccountAccrual, AccountCurrent, amount, orderNumber)
+}
+
+// NewWithdrawal records the points the user has spent on the order
+func NewWithdrawal(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindWithdrawal, AccountCurrent, AccountWithdrawn, amount, orderNumber)
+}
+
+// NewAdjustment records a correction of the user's current balance.
+// A negative amount takes the points back from the user
+func NewAdjustment(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	if amount.IsNegative() {
+		return New(userID, KindAdjustment, AccountCurrent, AccountAccrual, amount.Neg(), orderNumber)
+	}
+	return New(userID, KindAdjustment, AccountAccrual, AccountCurrent, amount, orderNumber)
+}
+
+// NewCorrection records a repair of the user's balance kept in the account.
+// A negative amount takes the points out of the account
+func NewCorrection(userID int, account Account, amount decimal.Decimal) Entry {
+	if amount.IsNegative() {
+		return New(userID, KindAdjustment, account, AccountAccrual, amount.Neg(), "")
+	}
+	return New(userID, KindAdjustment, AccountAccrual, account, amount, "")
+}
+
+// NewReversal records the withdrawn points returned to the user
+func NewReversal(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindReversal, AccountWithdrawn, AccountCurrent, amount, orderNumber)
+}
+
+// NewHold records the points reserved for a withdrawal
+func NewHold(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindHold, AccountCurrent, AccountHeld, amount, orderNumber)
+}
+
+// NewCapture records the reserved points the user has spent on the order
+func NewCapture(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindWithdrawal, AccountHeld, AccountWithdrawn, amount, orderNumber)
+}
+
+// NewRelease records the reserved points returned to the user
+func NewRelease(userID int, orderNumber string, amount decimal.Decimal) Entry {
+	return New(userID, KindRelease, AccountHeld, AccountCurrent, amount, orderNumber)
+}
+
+// NewExpiration records the user's points that have expired
+func NewExpiration(userID int, amount decimal.Decimal) Entry {
+	return New(userID, KindExpiration, AccountCurrent, AccountAccrual, amount, "")
+}
+
+// NewTransfer records the points the user has received from the counterparty.
+// A negative amount is for the points the user has given away to the counterparty.
+// The points pass between the users through the system's account, as every entry concerns a single user
+func NewTransfer(userID int, counterpartyID int, amount decimal.Decimal) Entry {
+	var e Entry
+	if amount.IsNegative() {
+		e = New(userID, KindTransfer, AccountCurrent, AccountAccrual, amount.Neg(), "")
+	} else {
+		e = New(userID, KindTransfer, AccountAccrual, AccountCurrent, amount, "")
+	}
+	e.CounterpartyID = counterpartyID
+	return e
+}
+
+// Change returns the number of points the entry has added to the account, negative if taken from it
+func (e Entry) Change(account Account) decimal.Decimal {
+	switch account {
+	case e.Credit:
+		return e.Amount
+	case e.Debit:
+		return e.Amount.Neg()
+	}
+	return decimal.Zero
+}
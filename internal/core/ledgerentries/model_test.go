@@ -0,0 +1,47 @@
+package ledgerentries_test
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+)
+
+func TestEntry_Change(t *testing.T) {
+	amount := decimal.RequireFromString("12.5")
+	tests := []struct {
+		name          string
+		entry         ledgerentries.Entry
+		wantCurrent   string
+		wantWithdrawn string
+		wantAccrual   string
+	}{
+		{"accrual", ledgerentries.NewAccrual(1, "79927398713", amount), "12.5", "0", "-12.5"},
+		{"withdrawal", ledgerentries.NewWithdrawal(1, "79927398713", amount), "-12.5", "12.5", "0"},
+		{"positive adjustment", ledgerentries.NewAdjustment(1, "", amount), "12.5", "0", "-12.5"},
+		{"negative adjustment", ledgerentries.NewAdjustment(1, "", amount.Neg()), "-12.5", "0", "12.5"},
+		{"reversal", ledgerentries.NewReversal(1, "79927398713", amount), "12.5", "-12.5", "0"},
+		{"transfer received", ledgerentries.NewTransfer(1, 2, amount), "12.5", "0", "-12.5"},
+		{"transfer sent", ledgerentries.NewTransfer(1, 2, amount.Neg()), "-12.5", "0", "12.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.entry.Amount.IsPositive())
+			assert.Equal(t, tt.wantCurrent, tt.entry.Change(ledgerentries.AccountCurrent).String())
+			assert.Equal(t, tt.wantWithdrawn, tt.entry.Change(ledgerentries.AccountWithdrawn).String())
+			assert.Equal(t, tt.wantAccrual, tt.entry.Change(ledgerentries.AccountAccrual).String())
+		})
+	}
+}
+
+func TestNewTransfer_Counterparty(t *testing.T) {
+	received := ledgerentries.NewTransfer(1, 2, decimal.RequireFromString("12.5"))
+	assert.Equal(t, 1, received.UserID)
+	assert.Equal(t, 2, received.CounterpartyID)
+	sent := ledgerentries.NewTransfer(2, 1, decimal.RequireFromString("-12.5"))
+	assert.Equal(t, 2, sent.UserID)
+	assert.Equal(t, 1, sent.CounterpartyID)
+	assert.Equal(t, 0, ledgerentries.NewAccrual(1, "79927398713", decimal.RequireFromString("12.5")).CounterpartyID)
+}
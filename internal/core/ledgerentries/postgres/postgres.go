@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+const (
+	// currentChange is the change of the user's current balance made by an entry
+	currentChange = "CASE WHEN credit_account = 'current' THEN amount " +
+		"WHEN debit_account = 'current' THEN -amount ELSE 0 END"
+	// withdrawnChange is the change of the user's withdrawn balance made by an entry
+	withdrawnChange = "CASE WHEN credit_account = 'withdrawn' THEN amount " +
+		"WHEN debit_account = 'withdrawn' THEN -amount ELSE 0 END"
+	// heldChange is the change of the user's held balance made by an entry
+	heldChange = "CASE WHEN credit_account = 'held' THEN amount " +
+		"WHEN debit_account = 'held' THEN -amount ELSE 0 END"
+	// runningBalance sums up the changes of the user's current balance made by the entries up to the row
+	runningBalance = "sum(" + currentChange + ") OVER (ORDER BY created_at, id)"
+	// userBalance sums up the changes of the user's balance made by all of the user's entries
+	userBalance = "coalesce(sum(" + currentChange + "), 0) AS current, " +
+		"coalesce(sum(" + withdrawnChange + "), 0) AS withdrawn, " +
+		"coalesce(sum(" + heldChange + "), 0) AS held"
+)
+
+// expectedBalance sums up the balance of the user identified by the SQL expression
+// over the records the balance is made of, independently of the balance cached along with the user
+// and the ledger entries. The expired points are the exception, as they are recorded in the ledger only
+func expectedBalance(user string) string {
+	return "SELECT s.accrued - s.withdrawn - s.held - s.expired + s.received - s.sent AS current, " +
+		"s.withdrawn, s.held FROM (SELECT " +
+		"(SELECT coalesce(sum(accrual), 0) FROM orders " +
+		"WHERE user_id = " + user + " AND status = 'PROCESSED') AS accrued, " +
+		"(SELECT coalesce(sum(\"sum\" - refunded), 0) FROM withdrawals WHERE user_id = " + user + ") AS withdrawn, " +
+		"(SELECT coalesce(sum(\"sum\"), 0) FROM holds WHERE user_id = " + user + " AND status = 'HELD') AS held, " +
+		"(SELECT coalesce(sum(amount), 0) FROM ledger_entries " +
+		"WHERE user_id = " + user + " AND kind = 'EXPIRATION') AS expired, " +
+		"(SELECT coalesce(sum(amount), 0) FROM transfers WHERE recipient_id = " + user + ") AS received, " +
+		"(SELECT coalesce(sum(amount), 0) FROM transfers WHERE sender_id = " + user + ") AS sent" +
+		") AS s"
+}
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add records the points moved between the user's accounts.
+// The entry is written using the connection from the context,
+// so it is committed or rolled back along with the change of the user's balance.
+// The creation time is assigned by the database at the moment of writing,
+// so that the entries of a user, whose balance is locked for the change, follow each other in time
+func (r Repository) Add(ctx context.Context, ce ledgerentries.Entry) (ledgerentries.Entry, error) {
+	entry := ce
+	var counterpartyID *int
+	if ce.CounterpartyID != 0 {
+		counterpartyID = &ce.CounterpartyID
+	}
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO ledger_entries "+
+				"(user_id, kind, debit_account, credit_account, amount, order_number, counterparty_id) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+			ce.UserID, ce.Kind, ce.Debit, ce.Credit, ce.Amount, ce.OrderNumber, counterpartyID,
+		).
+		Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		log.Error().Err(err).Int("userID", ce.UserID).Str("kind", string(ce.Kind)).Msg("Failed to add ledger entry")
+		return ledgerentries.Blank, err
+	}
+	log.Debug().
+		Int("ID", entry.ID).Int("userID", ce.UserID).Str("kind", string(ce.Kind)).Stringer("amount", ce.Amount).
+		Msg("Added ledger entry")
+	return entry, nil
+}
+
+// GetPageForUser returns a page of the user's ledger entries matching the query.
+// Every entry comes with the user's current balance right after the entry,
+// which is summed up over all of the user's preceding entries, including those outside the page
+func (r Repository) GetPageForUser(
+	ctx context.Context, userID int, q ledgerentries.ListQuery,
+) ([]ledgerentries.Entry, error) {
+	var conds postgres.Conditions
+	inner := "SELECT id, user_id, kind, debit_account, credit_account, amount, order_number, counterparty_id, " +
+		"created_at, " +
+		runningBalance + " AS balance FROM ledger_entries WHERE user_id = " + conds.Arg(userID)
+	if !q.CreatedFrom.IsZero() {
+		conds.Where("created_at >= " + conds.Arg(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		conds.Where("created_at < " + conds.Arg(q.CreatedTo))
+	}
+	direction, cmp := "ASC", ">"
+	if q.Descending {
+		direction, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		conds.Where("(created_at, id) " + cmp + " (" + conds.Arg(q.After.Time) + ", " + conds.Arg(q.After.ID) + ")")
+	}
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT id, user_id, kind, debit_account, credit_account, amount, order_number, counterparty_id, "+
+			"created_at, balance "+
+			"FROM ("+inner+") AS e"+conds.SQL()+
+			" ORDER BY created_at "+direction+", id "+direction+" LIMIT "+conds.Arg(q.Limit),
+		conds.Args()...,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query page of ledger entries for user")
+		return nil, err
+	}
+	items, err := scanEntryRows(rows)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch page of ledger entries for user")
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetBalanceForUser sums up the user's balance over the user's ledger entries
+func (r Repository) GetBalanceForUser(ctx context.Context, userID int) (users.UserBalance, error) {
+	var balance users.UserBalance
+	err := r.db.Conn(ctx).
+		QueryRow(ctx, "SELECT "+userBalance+" FROM ledger_entries WHERE user_id = $1", userID).
+		Scan(&balance.Current, &balance.Withdrawn, &balance.Held)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to sum up ledger balance for user")
+		return users.Blank.Balance, err
+	}
+	return balance, nil
+}
+
+// GetExpectedBalanceForUser sums up the user's balance over the user's processed orders,
+// withdrawals, holds and transfers, less the expired points
+func (r Repository) GetExpectedBalanceForUser(ctx context.Context, userID int) (users.UserBalance, error) {
+	var balance users.UserBalance
+	err := r.db.Conn(ctx).
+		QueryRow(ctx, expectedBalance("$1"), userID).
+		Scan(&balance.Current, &balance.Withdrawn, &balance.Held)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to sum up expected balance for user")
+		return users.Blank.Balance, err
+	}
+	return balance, nil
+}
+
+// GetDiscrepancies looks for the users whose balance does not match the balance
+// summed up over the user's processed orders, withdrawals, holds and transfers.
+// The users are checked in the order of their IDs, starting right after the user with afterID.
+// The search stops as soon as limit discrepancies are found
+func (r Repository) GetDiscrepancies(
+	ctx context.Context, afterID int, limit int,
+) ([]ledgerentries.Discrepancy, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT u.id, u.balance_current, u.balance_withdrawn, u.balance_held, e.current, e.withdrawn, e.held "+
+			"FROM users AS u "+
+			"CROSS JOIN LATERAL ("+expectedBalance("u.id")+") AS e "+
+			"WHERE u.id > $1 AND (u.balance_current <> e.current OR u.balance_withdrawn <> e.withdrawn "+
+			"OR u.balance_held <> e.held) "+
+			"ORDER BY u.id ASC LIMIT $2",
+		afterID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to query balance discrepancies")
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ledgerentries.Discrepancy
+	for rows.Next() {
+		var d ledgerentries.Discrepancy
+		err = rows.Scan(
+			&d.UserID, &d.Recorded.Current, &d.Recorded.Withdrawn, &d.Recorded.Held,
+			&d.Expected.Current, &d.Expected.Withdrawn, &d.Expected.Held,
+		)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read balance discrepancies")
+			return nil, err
+		}
+		items = append(items, d)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to fetch balance discrepancies")
+		return nil, err
+	}
+	return items, nil
+}
+
+func scanEntryRows(rows pgx.Rows) ([]ledgerentries.Entry, error) {
+	var items []ledgerentries.Entry
+	defer rows.Close()
+	for rows.Next() {
+		var e ledgerentries.Entry
+		var counterpartyID *int
+		err := rows.Scan(
+			&e.ID, &e.UserID, &e.Kind, &e.Debit, &e.Credit, &e.Amount, &e.OrderNumber, &counterpartyID,
+			&e.CreatedAt, &e.Balance,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if counterpartyID != nil {
+			e.CounterpartyID = *counterpartyID
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,326 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	hdb "github.com/sergeii/practikum-go-gophermart/internal/core/holds/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/transfers"
+	tdb "github.com/sergeii/practikum-go-gophermart/internal/core/transfers/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
+)
+
+func TestLedgerEntriesDatabase_Add_OK(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := ldb.New(db)
+
+	before := time.Now()
+	e1, err := repo.Add(ctx, ledgerentries.NewAccrual(u.ID, "79927398713", decimal.RequireFromString("100.5")))
+	require.NoError(t, err)
+	assert.True(t, e1.ID > 0)
+	assert.True(t, !e1.CreatedAt.Before(before))
+	assert.Equal(t, ledgerentries.KindAccrual, e1.Kind)
+
+	e2, err := repo.Add(ctx, ledgerentries.NewAdjustment(u.ID, "79927398713", decimal.RequireFromString("-0.5")))
+	require.NoError(t, err)
+	assert.True(t, e2.ID > e1.ID)
+	assert.True(t, e2.CreatedAt.After(e1.CreatedAt))
+	assert.Equal(t, ledgerentries.AccountCurrent, e2.Debit)
+	assert.Equal(t, ledgerentries.AccountAccrual, e2.Credit)
+	assert.Equal(t, "0.5", e2.Amount.String())
+
+	// the entries move positive amounts only
+	_, err = repo.Add(ctx, ledgerentries.NewWithdrawal(u.ID, "49927398716", decimal.Zero))
+	assert.Error(t, err)
+	// between two different accounts
+	_, err = repo.Add(
+		ctx,
+		ledgerentries.New(
+			u.ID, ledgerentries.KindAdjustment, ledgerentries.AccountCurrent, ledgerentries.AccountCurrent,
+			decimal.NewFromInt(1), "",
+		),
+	)
+	assert.Error(t, err)
+	// of existing users
+	_, err = repo.Add(ctx, ledgerentries.NewAccrual(9999, "79927398713", decimal.NewFromInt(1)))
+	assert.Error(t, err)
+}
+
+func TestLedgerEntriesDatabase_GetPageForUser(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(ctx, urepo.New("othercustomer", "str0ng"))
+	repo := ldb.New(db)
+
+	entries := []ledgerentries.Entry{
+		ledgerentries.NewAccrual(u.ID, "79927398713", decimal.NewFromInt(100)),
+		ledgerentries.NewAccrual(other.ID, "1234567812345670", decimal.NewFromInt(500)),
+		ledgerentries.NewWithdrawal(u.ID, "49927398716", decimal.RequireFromString("30.5")),
+		ledgerentries.NewAdjustment(u.ID, "79927398713", decimal.NewFromInt(-20)),
+		ledgerentries.NewReversal(u.ID, "49927398716", decimal.RequireFromString("30.5")),
+		ledgerentries.NewAdjustment(u.ID, "", decimal.NewFromInt(5)),
+	}
+	var added []ledgerentries.Entry
+	for _, e := range entries {
+		e, err := repo.Add(ctx, e)
+		require.NoError(t, err)
+		added = append(added, e)
+	}
+
+	tests := []struct {
+		name        string
+		query       ledgerentries.ListQuery
+		wantKinds   []ledgerentries.Kind
+		wantBalance []string
+	}{
+		{
+			"all entries",
+			ledgerentries.ListQuery{Limit: 10},
+			[]ledgerentries.Kind{"ACCRUAL", "WITHDRAWAL", "ADJUSTMENT", "REVERSAL", "ADJUSTMENT"},
+			[]string{"100", "69.5", "49.5", "80", "85"},
+		},
+		{
+			"latest first",
+			ledgerentries.ListQuery{Limit: 2, Descending: true},
+			[]ledgerentries.Kind{"ADJUSTMENT", "REVERSAL"},
+			[]string{"85", "80"},
+		},
+		{
+			"running balance includes earlier entries",
+			ledgerentries.ListQuery{Limit: 10, CreatedFrom: added[3].CreatedAt},
+			[]ledgerentries.Kind{"ADJUSTMENT", "REVERSAL", "ADJUSTMENT"},
+			[]string{"49.5", "80", "85"},
+		},
+		{
+			"time range",
+			ledgerentries.ListQuery{Limit: 10, CreatedFrom: added[2].CreatedAt, CreatedTo: added[4].CreatedAt},
+			[]ledgerentries.Kind{"WITHDRAWAL", "ADJUSTMENT"},
+			[]string{"69.5", "49.5"},
+		},
+		{
+			"after cursor",
+			ledgerentries.ListQuery{
+				Limit: 2, After: &pagination.Cursor{Time: added[2].CreatedAt, ID: added[2].ID},
+			},
+			[]ledgerentries.Kind{"ADJUSTMENT", "REVERSAL"},
+			[]string{"49.5", "80"},
+		},
+		{
+			"before cursor",
+			ledgerentries.ListQuery{
+				Limit: 10, Descending: true, After: &pagination.Cursor{Time: added[2].CreatedAt, ID: added[2].ID},
+			},
+			[]ledgerentries.Kind{"ACCRUAL"},
+			[]string{"100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := repo.GetPageForUser(ctx, u.ID, tt.query)
+			require.NoError(t, err)
+			var kinds []ledgerentries.Kind
+			var balances []string
+			for _, e := range page {
+				assert.Equal(t, u.ID, e.UserID)
+				kinds = append(kinds, e.Kind)
+				balances = append(balances, e.Balance.String())
+			}
+			assert.Equal(t, tt.wantKinds, kinds)
+			assert.Equal(t, tt.wantBalance, balances)
+		})
+	}
+
+	page, err := repo.GetPageForUser(ctx, other.ID, ledgerentries.ListQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "1234567812345670", page[0].OrderNumber)
+	assert.Equal(t, "500", page[0].Balance.String())
+}
+
+func TestLedgerEntriesDatabase_GetBalanceForUser(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u1, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	u2, _ := udb.New(db).Create(ctx, urepo.New("shopper", "secr3t"))
+	repo := ldb.New(db)
+
+	for _, e := range []ledgerentries.Entry{
+		ledgerentries.NewAccrual(u1.ID, "79927398713", decimal.RequireFromString("100.5")),
+		ledgerentries.NewWithdrawal(u1.ID, "1234567812345670", decimal.RequireFromString("40")),
+		ledgerentries.NewAdjustment(u1.ID, "79927398713", decimal.RequireFromString("-0.5")),
+		ledgerentries.NewHold(u1.ID, "4561261212345467", decimal.RequireFromString("15")),
+		ledgerentries.NewCapture(u1.ID, "4561261212345467", decimal.RequireFromString("15")),
+		ledgerentries.NewHold(u1.ID, "2538566283278270", decimal.RequireFromString("5")),
+		ledgerentries.NewAccrual(u2.ID, "49927398716", decimal.RequireFromString("1")),
+	} {
+		_, err := repo.Add(ctx, e)
+		require.NoError(t, err)
+	}
+
+	b1, err := repo.GetBalanceForUser(ctx, u1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "40", b1.Current.String())
+	assert.Equal(t, "55", b1.Withdrawn.String())
+	assert.Equal(t, "5", b1.Held.String())
+
+	b2, err := repo.GetBalanceForUser(ctx, u2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1", b2.Current.String())
+	assert.Equal(t, "0", b2.Withdrawn.String())
+	assert.Equal(t, "0", b2.Held.String())
+
+	// no entries - no balance
+	b3, err := repo.GetBalanceForUser(ctx, 999999)
+	require.NoError(t, err)
+	assert.True(t, b3.Current.IsZero())
+	assert.True(t, b3.Withdrawn.IsZero())
+}
+
+func TestLedgerEntriesDatabase_GetExpectedBalanceForUser(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u1, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	u2, _ := udb.New(db).Create(ctx, urepo.New("shopper", "secr3t"))
+	repo := ldb.New(db)
+
+	addOrder(t, db, u1.ID, "79927398713", orders.OrderStatusProcessed, "100.5")
+	addOrder(t, db, u1.ID, "49927398716", orders.OrderStatusProcessed, "20")
+	// orders yet to be processed are not accounted for
+	addOrder(t, db, u1.ID, "1234567812345670", orders.OrderStatusProcessing, "0")
+	addOrder(t, db, u2.ID, "4561261212345467", orders.OrderStatusProcessed, "1")
+
+	w, err := wdb.New(db).Add(ctx, withdrawals.New("2377225624", u1.ID, decimal.RequireFromString("40")))
+	require.NoError(t, err)
+	w.Status = withdrawals.WithdrawalStatusPartiallyRefunded
+	w.Refunded = decimal.RequireFromString("10")
+	w.RefundedAt = time.Now()
+	require.NoError(t, wdb.New(db).Update(ctx, w.ID, w))
+
+	holdsRepo := hdb.New(db)
+	_, err = holdsRepo.Add(ctx, holds.New("2538566283278270", u1.ID, decimal.RequireFromString("5"), time.Hour))
+	require.NoError(t, err)
+	released, err := holdsRepo.Add(ctx, holds.New("5062821234567892", u1.ID, decimal.RequireFromString("7"), time.Hour))
+	require.NoError(t, err)
+	released.Status = holds.HoldStatusReleased
+	released.FinalizedAt = time.Now()
+	require.NoError(t, holdsRepo.Update(ctx, released.ID, released))
+
+	_, err = tdb.New(db).Add(ctx, transfers.New(u1.ID, u2.ID, decimal.RequireFromString("12")))
+	require.NoError(t, err)
+	_, err = repo.Add(ctx, ledgerentries.NewExpiration(u1.ID, decimal.RequireFromString("3.5")))
+	require.NoError(t, err)
+	// the rest of the ledger entries are not accounted for
+	_, err = repo.Add(ctx, ledgerentries.NewAccrual(u1.ID, "79927398713", decimal.RequireFromString("1000")))
+	require.NoError(t, err)
+
+	b1, err := repo.GetExpectedBalanceForUser(ctx, u1.ID)
+	require.NoError(t, err)
+	// 120.5 accrued - 30 withdrawn - 5 held - 12 sent - 3.5 expired
+	assert.Equal(t, "70", b1.Current.String())
+	assert.Equal(t, "30", b1.Withdrawn.String())
+	assert.Equal(t, "5", b1.Held.String())
+
+	b2, err := repo.GetExpectedBalanceForUser(ctx, u2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "13", b2.Current.String())
+	assert.Equal(t, "0", b2.Withdrawn.String())
+	assert.Equal(t, "0", b2.Held.String())
+
+	// no records - no balance
+	b3, err := repo.GetExpectedBalanceForUser(ctx, 999999)
+	require.NoError(t, err)
+	assert.True(t, b3.Current.IsZero())
+	assert.True(t, b3.Withdrawn.IsZero())
+}
+
+func TestLedgerEntriesDatabase_GetDiscrepancies(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	users := udb.New(db)
+	repo := ldb.New(db)
+	ids := make([]int, 0, 5)
+	for i, login := range []string{"happycustomer", "shopper", "customer", "buyer", "client"} {
+		u, _ := users.Create(ctx, urepo.New(login, "str0ng"))
+		ids = append(ids, u.ID)
+		// balance and orders are in line
+		addOrder(t, db, u.ID, testutils.NewLuhnNumber(10+i), orders.OrderStatusProcessed, "10")
+		require.NoError(t, users.AccruePoints(ctx, u.ID, decimal.RequireFromString("10")))
+	}
+	// the balance is changed past the orders
+	require.NoError(t, users.AccruePoints(ctx, ids[0], decimal.RequireFromString("5")))
+	require.NoError(t, users.WithdrawPoints(ctx, ids[2], "", decimal.RequireFromString("2.5")))
+	// the withdrawal is registered past the balance
+	_, err := wdb.New(db).Add(ctx, withdrawals.New("1234567812345670", ids[3], decimal.RequireFromString("1")))
+	require.NoError(t, err)
+	// the order is processed past the balance
+	addOrder(t, db, ids[4], "79927398713", orders.OrderStatusProcessed, "7")
+
+	items, err := repo.GetDiscrepancies(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 4)
+	assert.Equal(t, ids[0], items[0].UserID)
+	assert.Equal(t, "15", items[0].Recorded.Current.String())
+	assert.Equal(t, "10", items[0].Expected.Current.String())
+	assert.Equal(t, ids[2], items[1].UserID)
+	assert.Equal(t, "7.5", items[1].Recorded.Current.String())
+	assert.Equal(t, "2.5", items[1].Recorded.Withdrawn.String())
+	assert.Equal(t, "10", items[1].Expected.Current.String())
+	assert.Equal(t, "0", items[1].Expected.Withdrawn.String())
+	assert.Equal(t, ids[3], items[2].UserID)
+	assert.Equal(t, "10", items[2].Recorded.Current.String())
+	assert.Equal(t, "9", items[2].Expected.Current.String())
+	assert.Equal(t, "1", items[2].Expected.Withdrawn.String())
+	assert.Equal(t, ids[4], items[3].UserID)
+	assert.Equal(t, "10", items[3].Recorded.Current.String())
+	assert.Equal(t, "17", items[3].Expected.Current.String())
+
+	items, err = repo.GetDiscrepancies(ctx, ids[0], 1)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, ids[2], items[0].UserID)
+
+	items, err = repo.GetDiscrepancies(ctx, ids[4], 10)
+	require.NoError(t, err)
+	assert.Len(t, items, 0)
+}
+
+func addOrder(
+	t *testing.T, db *postgres.Database, userID int, number string, status orders.OrderStatus, accrual string,
+) {
+	repo := odb.New(db)
+	o, err := repo.Add(context.TODO(), orders.New(number, userID))
+	require.NoError(t, err)
+	o.Status = status
+	o.Accrual = decimal.RequireFromString(accrual)
+	require.NoError(t, repo.Update(context.TODO(), o.ID, o))
+}
@@ -0,0 +1,36 @@
+package ledgerentries
+
+import (
+	"context"
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
+)
+
+// ListQuery narrows down a user's ledger entries and pages through them.
+// Zero values of the filters are ignored.
+// The entries are sorted by their creation time, oldest first unless Descending is set
+type ListQuery struct {
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Descending  bool
+	After       *pagination.Cursor
+	Limit       int
+}
+
+// Discrepancy is a user whose balance cached along with the user does not match
+// the balance summed up over the user's processed orders, withdrawals, holds and transfers
+type Discrepancy struct {
+	UserID   int
+	Recorded users.UserBalance
+	Expected users.UserBalance
+}
+
+type Repository interface {
+	Add(context.Context, Entry) (Entry, error)
+	GetPageForUser(context.Context, int, ListQuery) ([]Entry, error)
+	GetBalanceForUser(context.Context, int) (users.UserBalance, error)
+	GetExpectedBalanceForUser(context.Context, int) (users.UserBalance, error)
+	GetDiscrepancies(context.Context, int, int) ([]Discrepancy, error)
+}
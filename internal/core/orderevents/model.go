@@ -0,0 +1,45 @@
+package orderevents
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+)
+
+// Source tells what has caused an order to change its status
+type Source string
+
+const (
+	// SourceAccrual is for the changes caused by polling the accrual system
+	SourceAccrual Source = "accrual"
+	// SourceAdmin is for the changes made by an operator through the admin API
+	SourceAdmin Source = "admin"
+	// SourceWebhook is for the changes pushed by the accrual system
+	SourceWebhook Source = "webhook"
+)
+
+// Event is a record of an order's status transition
+type Event struct {
+	ID        int
+	OrderID   int
+	OldStatus orders.OrderStatus
+	NewStatus orders.OrderStatus
+	Accrual   decimal.Decimal
+	Source    Source
+	CreatedAt time.Time
+}
+
+var Blank Event // nolint: gochecknoglobals
+
+func New(o orders.Order, oldStatus orders.OrderStatus, source Source) Event {
+	return Event{
+		OrderID:   o.ID,
+		OldStatus: oldStatus,
+		NewStatus: o.Status,
+		Accrual:   o.Accrual,
+		Source:    source,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add records an order's status transition.
+// The event is written using the connection from the context,
+// so it is committed or rolled back along with the transition itself
+func (r Repository) Add(ctx context.Context, ce orderevents.Event) (orderevents.Event, error) {
+	event := ce
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO order_events (order_id, old_status, new_status, accrual, source, created_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+			ce.OrderID, ce.OldStatus, ce.NewStatus, ce.Accrual, ce.Source, ce.CreatedAt,
+		).
+		Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		log.Error().Err(err).Int("orderID", ce.OrderID).Msg("Failed to add order event")
+		return orderevents.Blank, err
+	}
+	return event, nil
+}
+
+// GetListForOrder returns the status transitions of an order in the order they have happened
+func (r Repository) GetListForOrder(ctx context.Context, orderID int) ([]orderevents.Event, error) {
+	var items []orderevents.Event
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT id, order_id, old_status, new_status, accrual, source, created_at FROM order_events "+
+			"WHERE order_id = $1 ORDER BY id ASC",
+		orderID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("orderID", orderID).Msg("Failed to query events for order")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e orderevents.Event
+		err = rows.Scan(&e.ID, &e.OrderID, &e.OldStatus, &e.NewStatus, &e.Accrual, &e.Source, &e.CreatedAt)
+		if err != nil {
+			log.Error().Err(err).Int("orderID", orderID).Msg("Failed to read events for order")
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Int("orderID", orderID).Msg("Failed to fetch events for order")
+		return nil, err
+	}
+	return items, nil
+}
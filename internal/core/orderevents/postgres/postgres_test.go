@@ -0,0 +1,76 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
+	edb "github.com/sergeii/practikum-go-gophermart/internal/core/orderevents/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestOrderEventsDatabase_AddAndList(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u, _ := udb.New(db).Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	ordersRepo := odb.New(db)
+	o1, _ := ordersRepo.Add(context.TODO(), orders.New("1234567812345670", u.ID))
+	o2, _ := ordersRepo.Add(context.TODO(), orders.New("79927398713", u.ID))
+
+	before := time.Now()
+	repo := edb.New(db)
+	o1.Status = orders.OrderStatusProcessing
+	e1, err := repo.Add(context.TODO(), orderevents.New(o1, orders.OrderStatusNew, orderevents.SourceAccrual))
+	require.NoError(t, err)
+	assert.True(t, e1.ID > 0)
+	assert.True(t, !e1.CreatedAt.Before(before))
+
+	o1.Status = orders.OrderStatusProcessed
+	o1.Accrual = decimal.RequireFromString("100.5")
+	_, err = repo.Add(context.TODO(), orderevents.New(o1, orders.OrderStatusProcessing, orderevents.SourceWebhook))
+	require.NoError(t, err)
+
+	o2.Status = orders.OrderStatusInvalid
+	_, err = repo.Add(context.TODO(), orderevents.New(o2, orders.OrderStatusNew, orderevents.SourceAdmin))
+	require.NoError(t, err)
+
+	items, err := repo.GetListForOrder(context.TODO(), o1.ID)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, e1.ID, items[0].ID)
+	assert.Equal(t, o1.ID, items[0].OrderID)
+	assert.Equal(t, orders.OrderStatusNew, items[0].OldStatus)
+	assert.Equal(t, orders.OrderStatusProcessing, items[0].NewStatus)
+	assert.True(t, items[0].Accrual.IsZero())
+	assert.Equal(t, orderevents.SourceAccrual, items[0].Source)
+	assert.Equal(t, orders.OrderStatusProcessing, items[1].OldStatus)
+	assert.Equal(t, orders.OrderStatusProcessed, items[1].NewStatus)
+	assert.Equal(t, "100.5", items[1].Accrual.String())
+	assert.Equal(t, orderevents.SourceWebhook, items[1].Source)
+
+	items, err = repo.GetListForOrder(context.TODO(), 9999999)
+	require.NoError(t, err)
+	assert.Len(t, items, 0)
+}
+
+func TestOrderEventsDatabase_Add_ErrorOnInvalidSource(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u, _ := udb.New(db).Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	o, _ := odb.New(db).Add(context.TODO(), orders.New("1234567812345670", u.ID))
+
+	repo := edb.New(db)
+	_, err := repo.Add(context.TODO(), orderevents.New(o, orders.OrderStatusNew, orderevents.Source("foo")))
+	assert.Error(t, err)
+}
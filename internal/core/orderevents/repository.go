@@ -0,0 +1,10 @@
+package orderevents
+
+import (
+	"context"
+)
+
+type Repository interface {
+	Add(context.Context, Event) (Event, error)
+	GetListForOrder(context.Context, int) ([]Event, error)
+}
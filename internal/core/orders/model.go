@@ -11,11 +11,49 @@ import (
 type OrderStatus string
 
 const (
-	OrderStatusNew       OrderStatus = "NEW"
-	OrderStatusInvalid   OrderStatus = "INVALID"
-	OrderStatusProcessed OrderStatus = "PROCESSED"
+	OrderStatusNew        OrderStatus = "NEW"
+	OrderStatusProcessing OrderStatus = "PROCESSING"
+	OrderStatusInvalid    OrderStatus = "INVALID"
+	OrderStatusProcessed  OrderStatus = "PROCESSED"
+	// OrderStatusFailed is a dead-letter status for orders that have run out of processing attempts
+	OrderStatusFailed OrderStatus = "FAILED"
 )
 
+// transitions lists the statuses an order is allowed to move to from its current status.
+// Orders that are processed or invalid never change their status again.
+// Failed orders may only be given another chance by an operator
+var transitions = map[OrderStatus][]OrderStatus{ // nolint: gochecknoglobals
+	OrderStatusNew: {
+		OrderStatusProcessing, OrderStatusProcessed, OrderStatusInvalid, OrderStatusFailed,
+	},
+	OrderStatusProcessing: {
+		OrderStatusProcessing, OrderStatusProcessed, OrderStatusInvalid, OrderStatusFailed,
+	},
+	OrderStatusFailed: {
+		OrderStatusNew,
+	},
+}
+
+// CanTransitionTo tells whether an order with this status is allowed to move to the next status
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal tells whether an order with this status is never checked with the accrual system again
+func (s OrderStatus) IsFinal() bool {
+	switch s {
+	case OrderStatusProcessed, OrderStatusInvalid, OrderStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
 type Order struct {
 	ID         int
 	User       users.User
@@ -23,6 +61,12 @@ type Order struct {
 	Status     OrderStatus
 	Accrual    decimal.Decimal
 	UploadedAt time.Time
+	// Attempts is the number of failed attempts to check the order with the accrual system
+	Attempts int
+	// NextCheckAt is the earliest time the order is eligible to be checked again after a failed attempt
+	NextCheckAt time.Time
+	// CheckedAt is the last time the order has been checked with the accrual system
+	CheckedAt time.Time
 }
 
 var Blank Order // nolint: gochecknoglobals
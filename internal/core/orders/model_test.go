@@ -0,0 +1,43 @@
+package orders_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+)
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from orders.OrderStatus
+		to   orders.OrderStatus
+		want bool
+	}{
+		{orders.OrderStatusNew, orders.OrderStatusProcessing, true},
+		{orders.OrderStatusNew, orders.OrderStatusProcessed, true},
+		{orders.OrderStatusNew, orders.OrderStatusInvalid, true},
+		{orders.OrderStatusNew, orders.OrderStatusFailed, true},
+		{orders.OrderStatusNew, orders.OrderStatusNew, false},
+		{orders.OrderStatusProcessing, orders.OrderStatusProcessing, true},
+		{orders.OrderStatusProcessing, orders.OrderStatusProcessed, true},
+		{orders.OrderStatusProcessing, orders.OrderStatusInvalid, true},
+		{orders.OrderStatusProcessing, orders.OrderStatusFailed, true},
+		{orders.OrderStatusProcessing, orders.OrderStatusNew, false},
+		{orders.OrderStatusProcessed, orders.OrderStatusNew, false},
+		{orders.OrderStatusProcessed, orders.OrderStatusProcessing, false},
+		{orders.OrderStatusProcessed, orders.OrderStatusProcessed, false},
+		{orders.OrderStatusProcessed, orders.OrderStatusInvalid, false},
+		{orders.OrderStatusInvalid, orders.OrderStatusProcessed, false},
+		{orders.OrderStatusInvalid, orders.OrderStatusNew, false},
+		{orders.OrderStatusFailed, orders.OrderStatusNew, true},
+		{orders.OrderStatusFailed, orders.OrderStatusProcessed, false},
+		{orders.OrderStatusNew, orders.OrderStatus("foo"), false},
+		{orders.OrderStatus("foo"), orders.OrderStatusNew, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
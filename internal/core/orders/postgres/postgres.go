@@ -13,13 +13,31 @@ import (
 	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
 )
 
+// orderColumns lists the columns scanned into orderRow by scanOrderRow
+const orderColumns = "id, uploaded_at, status, accrual, number, user_id, attempts, next_check_at, checked_at"
+
 type orderRow struct {
-	ID         int
-	UserID     int
-	Number     string
-	Status     orders.OrderStatus
-	Accrual    decimal.Decimal
-	UploadedAt time.Time
+	ID          int
+	UserID      int
+	Number      string
+	Status      orders.OrderStatus
+	Accrual     decimal.Decimal
+	UploadedAt  time.Time
+	Attempts    int
+	NextCheckAt *time.Time
+	CheckedAt   *time.Time
+}
+
+func (row orderRow) toModel() orders.Order {
+	o := orders.NewFromRepo(row.ID, row.Number, row.UserID, row.Status, row.Accrual, row.UploadedAt)
+	o.Attempts = row.Attempts
+	if row.NextCheckAt != nil {
+		o.NextCheckAt = *row.NextCheckAt
+	}
+	if row.CheckedAt != nil {
+		o.CheckedAt = *row.CheckedAt
+	}
+	return o
 }
 
 type Repository struct {
@@ -59,15 +77,34 @@ func (r Repository) Add(ctx context.Context, co orders.Order) (orders.Order, err
 	return order, nil
 }
 
+// GetByID attempts to find and return an order by its ID
+func (r Repository) GetByID(ctx context.Context, id int) (orders.Order, error) {
+	result := r.db.Conn(ctx).QueryRow(
+		ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1",
+		id,
+	)
+	row, err := scanOrderRow(result)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Int("ID", id).Msg("Order not found in database")
+			return orders.Blank, orders.ErrOrderNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Msg("Failed to retrieve order from database by ID")
+		return orders.Blank, err
+	}
+	return row.toModel(), nil
+}
+
 // GetByNumber attempts to find and return an order by its external number
 func (r Repository) GetByNumber(ctx context.Context, number string) (orders.Order, error) {
-	var row orderRow
 	result := r.db.Conn(ctx).QueryRow(
 		ctx,
-		"SELECT id, user_id, uploaded_at, status, accrual FROM orders WHERE number = $1",
+		"SELECT "+orderColumns+" FROM orders WHERE number = $1",
 		number,
 	)
-	if err := result.Scan(&row.ID, &row.UserID, &row.UploadedAt, &row.Status, &row.Accrual); err != nil {
+	row, err := scanOrderRow(result)
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Str("number", number).Msg("Order not found in database")
 			return orders.Blank, orders.ErrOrderNotFound
@@ -75,43 +112,122 @@ func (r Repository) GetByNumber(ctx context.Context, number string) (orders.Orde
 		log.Error().Err(err).Str("number", number).Msg("Failed to retrieve order from database by ID")
 		return orders.Blank, err
 	}
-	return orders.NewFromRepo(row.ID, number, row.UserID, row.Status, row.Accrual, row.UploadedAt), nil
+	return row.toModel(), nil
 }
 
-// GetListForUser returns a list of orders uploaded by specified user.
-// The orders are sorted from the oldest to the newest
-func (r Repository) GetListForUser(ctx context.Context, userID int) ([]orders.Order, error) {
-	var items []orders.Order
-	rows, err := r.db.Conn(ctx).Query(
+// GetByNumberForUpdate retrieves an order just like GetByNumber does, locking the order's row for an update.
+// The lock is held until the end of the transaction passed in the context,
+// so concurrent status updates of the same order are applied one after another
+func (r Repository) GetByNumberForUpdate(ctx context.Context, number string) (orders.Order, error) {
+	result := r.db.Conn(ctx).QueryRow(
 		ctx,
-		"SELECT id, uploaded_at, status, accrual, number, user_id FROM orders "+
-			"WHERE user_id = $1 ORDER BY uploaded_at ASC",
-		userID,
+		"SELECT "+orderColumns+" FROM orders WHERE number = $1 FOR UPDATE",
+		number,
 	)
+	row, err := scanOrderRow(result)
 	if err != nil {
-		log.Error().Err(err).Int("userID", userID).Msg("Failed to query orders for user")
-		return nil, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Str("number", number).Msg("Order not found in database")
+			return orders.Blank, orders.ErrOrderNotFound
+		}
+		log.Error().Err(err).Str("number", number).Msg("Failed to lock order by number")
+		return orders.Blank, err
 	}
-	defer rows.Close()
+	return row.toModel(), nil
+}
 
-	for rows.Next() {
-		row := orderRow{}
-		err = rows.Scan(&row.ID, &row.UploadedAt, &row.Status, &row.Accrual, &row.Number, &row.UserID)
-		if err != nil {
-			log.Error().Err(err).Int("userID", userID).Msg("Failed to scan order row")
-			return nil, err
+// GetPageForUser returns a page of the user's orders matching the query.
+// The orders are sorted by their upload time and then by their IDs,
+// so the page following the one ending with an order starts right after its cursor
+func (r Repository) GetPageForUser(ctx context.Context, userID int, q orders.ListQuery) ([]orders.Order, error) {
+	var conds postgres.Conditions
+	conds.Where("user_id = " + conds.Arg(userID))
+	if len(q.Statuses) > 0 {
+		statusNames := make([]string, 0, len(q.Statuses))
+		for _, status := range q.Statuses {
+			statusNames = append(statusNames, string(status))
 		}
-		items = append(
-			items,
-			orders.NewFromRepo(row.ID, row.Number, row.UserID, row.Status, row.Accrual, row.UploadedAt),
-		)
+		conds.Where("status::text = ANY(" + conds.Arg(statusNames) + ")")
+	}
+	if !q.UploadedFrom.IsZero() {
+		conds.Where("uploaded_at >= " + conds.Arg(q.UploadedFrom))
+	}
+	if !q.UploadedTo.IsZero() {
+		conds.Where("uploaded_at < " + conds.Arg(q.UploadedTo))
+	}
+	direction, cmp := "ASC", ">"
+	if q.Descending {
+		direction, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		conds.Where("(uploaded_at, id) " + cmp + " (" + conds.Arg(q.After.Time) + ", " + conds.Arg(q.After.ID) + ")")
+	}
+	sql := "SELECT " + orderColumns + " FROM orders" + conds.SQL() +
+		" ORDER BY uploaded_at " + direction + ", id " + direction
+	if q.Limit > 0 {
+		sql += " LIMIT " + conds.Arg(q.Limit)
+	}
+	rows, err := r.db.Conn(ctx).Query(ctx, sql, conds.Args()...)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query page of orders for user")
+		return nil, err
+	}
+	items, err := scanOrderRows(rows)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch page of orders for user")
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetListByStatus returns a batch of orders having any of the specified statuses.
+// The orders are sorted by their IDs, so that the next batch can be requested
+// by passing the ID of the last order in the batch as afterID
+func (r Repository) GetListByStatus(
+	ctx context.Context, statuses []orders.OrderStatus, afterID int, limit int,
+) ([]orders.Order, error) {
+	statusNames := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		statusNames = append(statusNames, string(status))
+	}
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT "+orderColumns+" FROM orders "+
+			"WHERE status::text = ANY($1) AND id > $2 ORDER BY id ASC LIMIT $3",
+		statusNames, afterID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Strs("statuses", statusNames).Msg("Failed to query orders by status")
+		return nil, err
 	}
-	err = rows.Err()
+	items, err := scanOrderRows(rows)
 	if err != nil {
-		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch orders for user")
+		log.Error().Err(err).Strs("statuses", statusNames).Msg("Failed to fetch orders by status")
 		return nil, err
 	}
+	return items, nil
+}
 
+// GetListByStatusSince returns a batch of orders having the specified status and uploaded no earlier than since.
+// Same as GetListByStatus, the next batch is requested by passing the ID of the last order in the batch
+func (r Repository) GetListByStatusSince(
+	ctx context.Context, status orders.OrderStatus, since time.Time, afterID int, limit int,
+) ([]orders.Order, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT "+orderColumns+" FROM orders "+
+			"WHERE status = $1 AND uploaded_at >= $2 AND id > $3 ORDER BY id ASC LIMIT $4",
+		status, since, afterID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("status", string(status)).Time("since", since).Msg("Failed to query recent orders")
+		return nil, err
+	}
+	items, err := scanOrderRows(rows)
+	if err != nil {
+		log.Error().Err(err).Str("status", string(status)).Time("since", since).Msg("Failed to fetch recent orders")
+		return nil, err
+	}
 	return items, nil
 }
 
@@ -123,10 +239,14 @@ func (r Repository) Update(ctx context.Context, orderID int, o orders.Order) err
 			log.Error().Err(err).Int("orderID", orderID).Msg("Unable to acquire row lock for order")
 			return err
 		}
+		var nextCheckAt *time.Time
+		if !o.NextCheckAt.IsZero() {
+			nextCheckAt = &o.NextCheckAt
+		}
 		_, err := tx.Exec(
 			txCtx,
-			"UPDATE orders SET status = $1, accrual = $2 WHERE id = $3",
-			o.Status, o.Accrual, orderID,
+			"UPDATE orders SET status = $1, accrual = $2, attempts = $3, next_check_at = $4 WHERE id = $5",
+			o.Status, o.Accrual, o.Attempts, nextCheckAt, orderID,
 		)
 		if err != nil {
 			return err
@@ -135,3 +255,105 @@ func (r Repository) Update(ctx context.Context, orderID int, o orders.Order) err
 		return nil
 	})
 }
+
+// ChangeStatus moves the order to the new status, provided the order still has the old status.
+// Otherwise orders.ErrOrderStatusChanged is returned and the order is left intact,
+// so a transition based on a stale status never overwrites the one made in the meantime
+func (r Repository) ChangeStatus(
+	ctx context.Context, orderID int, oldStatus orders.OrderStatus, newStatus orders.OrderStatus,
+) error {
+	tag, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE orders SET status = $1 WHERE id = $2 AND status = $3",
+		newStatus, orderID, oldStatus,
+	)
+	if err != nil {
+		log.Error().
+			Err(err).Int("orderID", orderID).Str("from", string(oldStatus)).Str("to", string(newStatus)).
+			Msg("Failed to change order status")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orders.ErrOrderStatusChanged
+	}
+	return nil
+}
+
+// ChangeAccrual updates the accrual of a processed order, provided the order's accrual is still the old one.
+// Otherwise orders.ErrOrderAccrualChanged is returned and the order is left intact
+func (r Repository) ChangeAccrual(
+	ctx context.Context, orderID int, oldAccrual decimal.Decimal, newAccrual decimal.Decimal,
+) error {
+	tag, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE orders SET accrual = $1 WHERE id = $2 AND status = 'PROCESSED' AND accrual = $3",
+		newAccrual, orderID, oldAccrual,
+	)
+	if err != nil {
+		log.Error().
+			Err(err).Int("orderID", orderID).Stringer("from", oldAccrual).Stringer("to", newAccrual).
+			Msg("Failed to change order accrual")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orders.ErrOrderAccrualChanged
+	}
+	return nil
+}
+
+// SetAttempts records the number of failed attempts to check the order
+// and the earliest time the order is eligible to be checked again.
+// A zero nextCheckAt makes the order eligible right away.
+// Same as MarkChecked, the rest of the order is never overwritten
+func (r Repository) SetAttempts(ctx context.Context, number string, attempts int, nextCheckAt time.Time) error {
+	var nextCheckAtOrNull *time.Time
+	if !nextCheckAt.IsZero() {
+		nextCheckAtOrNull = &nextCheckAt
+	}
+	_, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE orders SET attempts = $1, next_check_at = $2 WHERE number = $3",
+		attempts, nextCheckAtOrNull, number,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("order", number).Msg("Failed to record order attempts")
+		return err
+	}
+	return nil
+}
+
+// MarkChecked records the time the order has been checked with the accrual system.
+// Only the check time is written, so the rest of the order is never overwritten with stale values
+func (r Repository) MarkChecked(ctx context.Context, number string, checkedAt time.Time) error {
+	_, err := r.db.Conn(ctx).Exec(ctx, "UPDATE orders SET checked_at = $1 WHERE number = $2", checkedAt, number)
+	if err != nil {
+		log.Error().Err(err).Str("order", number).Msg("Failed to record order check time")
+		return err
+	}
+	return nil
+}
+
+func scanOrderRows(rows pgx.Rows) ([]orders.Order, error) {
+	var items []orders.Order
+	defer rows.Close()
+	for rows.Next() {
+		row, err := scanOrderRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, row.toModel())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func scanOrderRow(result pgx.Row) (orderRow, error) {
+	var row orderRow
+	err := result.Scan(
+		&row.ID, &row.UploadedAt, &row.Status, &row.Accrual, &row.Number, &row.UserID,
+		&row.Attempts, &row.NextCheckAt, &row.CheckedAt,
+	)
+	return row, err
+}
@@ -14,6 +14,7 @@ import (
 	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 func TestOrdersDatabase_Add_OK(t *testing.T) {
@@ -80,7 +81,7 @@ func TestOrdersDatabase_Add_ErrorOnInvalidStatus(t *testing.T) {
 	assert.Equal(t, 0, o.ID)
 }
 
-func TestOrdersDatabase_GetListForUser_OK(t *testing.T) {
+func TestOrdersDatabase_GetPageForUser_Unlimited(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
 
@@ -96,7 +97,7 @@ func TestOrdersDatabase_GetListForUser_OK(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	userOrders, err := repo.GetListForUser(context.TODO(), u.ID)
+	userOrders, err := repo.GetPageForUser(context.TODO(), u.ID, orders.ListQuery{})
 	require.NoError(t, err)
 	assert.Len(t, userOrders, 3)
 	for _, o := range userOrders {
@@ -109,12 +110,12 @@ func TestOrdersDatabase_GetListForUser_OK(t *testing.T) {
 	assert.Equal(t, "49927398716", userOrders[2].Number)
 }
 
-func TestOrdersDatabase_GetListForUser_NoErrorForUnknownUser(t *testing.T) {
+func TestOrdersDatabase_GetPageForUser_NoErrorForUnknownUser(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
 
 	repo := odb.New(db)
-	userOrders, err := repo.GetListForUser(context.TODO(), 9999999)
+	userOrders, err := repo.GetPageForUser(context.TODO(), 9999999, orders.ListQuery{})
 	require.NoError(t, err)
 	assert.Len(t, userOrders, 0)
 }
@@ -150,6 +151,80 @@ func TestOrdersDatabase_UpdateStatus_OK(t *testing.T) {
 	assert.Equal(t, decimal.NewFromInt(0), other2.Accrual)
 }
 
+func TestOrdersDatabase_MarkChecked(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+
+	repo := odb.New(db)
+	o, _ := repo.Add(context.TODO(), orders.New("1234567812345670", u.ID))
+	assert.True(t, o.CheckedAt.IsZero())
+	_, _ = repo.Add(context.TODO(), orders.New("4561261212345467", u.ID))
+
+	checkedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, repo.MarkChecked(context.TODO(), "1234567812345670", checkedAt))
+
+	o2, _ := repo.GetByNumber(context.TODO(), "1234567812345670")
+	assert.WithinDuration(t, checkedAt, o2.CheckedAt, time.Millisecond)
+	assert.Equal(t, orders.OrderStatusNew, o2.Status) // does not change
+	// other orders are not affected
+	other, _ := repo.GetByNumber(context.TODO(), "4561261212345467")
+	assert.True(t, other.CheckedAt.IsZero())
+}
+
+func TestOrdersDatabase_ChangeStatus(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+
+	repo := odb.New(db)
+	o, _ := repo.Add(context.TODO(), orders.New("1234567812345670", u.ID))
+
+	err = repo.ChangeStatus(context.TODO(), o.ID, orders.OrderStatusNew, orders.OrderStatusFailed)
+	require.NoError(t, err)
+	o2, _ := repo.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, orders.OrderStatusFailed, o2.Status)
+
+	// the order is no longer new
+	err = repo.ChangeStatus(context.TODO(), o.ID, orders.OrderStatusNew, orders.OrderStatusProcessed)
+	assert.ErrorIs(t, err, orders.ErrOrderStatusChanged)
+	o3, _ := repo.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, orders.OrderStatusFailed, o3.Status)
+}
+
+func TestOrdersDatabase_SetAttempts(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+
+	repo := odb.New(db)
+	o, _ := repo.Add(context.TODO(), orders.New("1234567812345670", u.ID))
+	require.NoError(t, repo.Update(context.TODO(), o.ID, orders.Order{
+		Status: orders.OrderStatusProcessing, Accrual: decimal.NewFromInt(0),
+	}))
+
+	nextCheckAt := time.Now().Add(time.Minute)
+	require.NoError(t, repo.SetAttempts(context.TODO(), "1234567812345670", 3, nextCheckAt))
+	o2, _ := repo.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, 3, o2.Attempts)
+	assert.WithinDuration(t, nextCheckAt, o2.NextCheckAt, time.Millisecond)
+	assert.Equal(t, orders.OrderStatusProcessing, o2.Status) // does not change
+
+	require.NoError(t, repo.SetAttempts(context.TODO(), "1234567812345670", 0, time.Time{}))
+	o3, _ := repo.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, 0, o3.Attempts)
+	assert.True(t, o3.NextCheckAt.IsZero())
+}
+
 func TestOrdersDatabase_Update_Errors(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -205,3 +280,143 @@ func TestOrdersDatabase_Update_Errors(t *testing.T) {
 		})
 	}
 }
+
+func TestOrdersDatabase_GetListByStatus_Batches(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+
+	repo := odb.New(db)
+	numbers := []string{"1234567812345670", "4561261212345467", "49927398716", "79927398713", "100000000008"}
+	for _, number := range numbers {
+		_, err = repo.Add(context.TODO(), orders.New(number, u.ID))
+		require.NoError(t, err)
+	}
+	processed, _ := repo.GetByNumber(context.TODO(), "4561261212345467")
+	processed.Status = orders.OrderStatusProcessed
+	require.NoError(t, repo.Update(context.TODO(), processed.ID, processed))
+
+	statuses := []orders.OrderStatus{orders.OrderStatusNew}
+	batch, err := repo.GetListByStatus(context.TODO(), statuses, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "1234567812345670", batch[0].Number)
+	assert.Equal(t, "49927398716", batch[1].Number)
+
+	batch, err = repo.GetListByStatus(context.TODO(), statuses, batch[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "79927398713", batch[0].Number)
+	assert.Equal(t, "100000000008", batch[1].Number)
+
+	batch, err = repo.GetListByStatus(context.TODO(), statuses, batch[1].ID, 2)
+	require.NoError(t, err)
+	assert.Len(t, batch, 0)
+
+	batch, err = repo.GetListByStatus(
+		context.TODO(), []orders.OrderStatus{orders.OrderStatusProcessed, orders.OrderStatusInvalid}, 0, 10,
+	)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, "4561261212345467", batch[0].Number)
+	assert.Equal(t, orders.OrderStatusProcessed, batch[0].Status)
+}
+
+func TestOrdersDatabase_GetListByStatusSince(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+
+	repo := odb.New(db)
+	for i, number := range []string{"1234567812345670", "4561261212345467", "49927398716", "79927398713"} {
+		o := orders.New(number, u.ID)
+		o.UploadedAt = time.Now().Add(-time.Hour * time.Duration(i*24))
+		o, err = repo.Add(context.TODO(), o)
+		require.NoError(t, err)
+		if number != "4561261212345467" {
+			o.Status = orders.OrderStatusProcessed
+			require.NoError(t, repo.Update(context.TODO(), o.ID, o))
+		}
+	}
+
+	since := time.Now().Add(-time.Hour * 36)
+	batch, err := repo.GetListByStatusSince(context.TODO(), orders.OrderStatusProcessed, since, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, "1234567812345670", batch[0].Number)
+
+	since = time.Now().Add(-time.Hour * 24 * 7)
+	batch, err = repo.GetListByStatusSince(context.TODO(), orders.OrderStatusProcessed, since, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "1234567812345670", batch[0].Number)
+	assert.Equal(t, "49927398716", batch[1].Number)
+	batch, err = repo.GetListByStatusSince(context.TODO(), orders.OrderStatusProcessed, since, batch[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, "79927398713", batch[0].Number)
+}
+
+func TestOrdersDatabase_GetPageForUser(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(context.TODO(), urepo.New("othercustomer", "secr3t"))
+
+	repo := odb.New(db)
+	// the orders uploaded at the same time are sorted by their IDs
+	uploadedAt := time.Now().Add(-time.Hour)
+	for i, number := range []string{"1234567812345670", "4561261212345467", "49927398716", "79927398713"} {
+		o := orders.New(number, u.ID)
+		o.UploadedAt = uploadedAt.Add(time.Minute * time.Duration(i/2))
+		if i%2 == 1 {
+			o.Status = orders.OrderStatusProcessed
+		}
+		_, err := repo.Add(context.TODO(), o)
+		require.NoError(t, err)
+	}
+	_, err := repo.Add(context.TODO(), orders.New("100000000008", other.ID))
+	require.NoError(t, err)
+
+	page, err := repo.GetPageForUser(context.TODO(), u.ID, orders.ListQuery{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	assert.Equal(t, "1234567812345670", page[0].Number)
+	assert.Equal(t, "4561261212345467", page[1].Number)
+	assert.Equal(t, "49927398716", page[2].Number)
+
+	after := &pagination.Cursor{Time: page[1].UploadedAt, ID: page[1].ID}
+	page, err = repo.GetPageForUser(context.TODO(), u.ID, orders.ListQuery{After: after, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "49927398716", page[0].Number)
+	assert.Equal(t, "79927398713", page[1].Number)
+
+	page, err = repo.GetPageForUser(
+		context.TODO(), u.ID, orders.ListQuery{After: after, Descending: true, Limit: 10},
+	)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "1234567812345670", page[0].Number)
+
+	page, err = repo.GetPageForUser(context.TODO(), u.ID, orders.ListQuery{
+		Statuses:     []orders.OrderStatus{orders.OrderStatusProcessed},
+		UploadedFrom: uploadedAt.Add(time.Second),
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "79927398713", page[0].Number)
+
+	page, err = repo.GetPageForUser(context.TODO(), u.ID, orders.ListQuery{UploadedTo: uploadedAt, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page, 0)
+}
@@ -3,13 +3,40 @@ package orders
 import (
 	"context"
 	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 var ErrOrderNotFound = errors.New("order not found")
+var ErrOrderStatusChanged = errors.New("order status has changed")
+var ErrOrderAccrualChanged = errors.New("order accrual has changed")
+
+// ListQuery narrows down a user's orders and pages through them.
+// Zero values of the filters are ignored, zero limit returns every matching order.
+// The orders are sorted by their upload time, oldest first unless Descending is set
+type ListQuery struct {
+	Statuses     []OrderStatus
+	UploadedFrom time.Time
+	UploadedTo   time.Time
+	Descending   bool
+	After        *pagination.Cursor
+	Limit        int
+}
 
 type Repository interface {
 	Add(context.Context, Order) (Order, error)
 	Update(context.Context, int, Order) error
+	ChangeStatus(context.Context, int, OrderStatus, OrderStatus) error
+	ChangeAccrual(context.Context, int, decimal.Decimal, decimal.Decimal) error
+	SetAttempts(context.Context, string, int, time.Time) error
+	MarkChecked(context.Context, string, time.Time) error
+	GetByID(context.Context, int) (Order, error)
 	GetByNumber(context.Context, string) (Order, error)
-	GetListForUser(context.Context, int) ([]Order, error)
+	GetByNumberForUpdate(context.Context, string) (Order, error)
+	GetPageForUser(context.Context, int, ListQuery) ([]Order, error)
+	GetListByStatus(context.Context, []OrderStatus, int, int) ([]Order, error)
+	GetListByStatusSince(context.Context, OrderStatus, time.Time, int, int) ([]Order, error)
 }
@@ -0,0 +1,27 @@
+package transfers
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Transfer is the points one user has given to another
+type Transfer struct {
+	ID          int
+	SenderID    int
+	RecipientID int
+	Amount      decimal.Decimal
+	CreatedAt   time.Time
+}
+
+var Blank Transfer // nolint: gochecknoglobals
+
+func New(senderID, recipientID int, amount decimal.Decimal) Transfer {
+	return Transfer{
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		CreatedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/transfers"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+// Add records the points given by one user to another.
+// The transfer is written using the connection from the context,
+// so it is committed or rolled back along with the change of the users' balances
+func (r Repository) Add(ctx context.Context, ct transfers.Transfer) (transfers.Transfer, error) {
+	t := ct
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO transfers (sender_id, recipient_id, amount, created_at) VALUES ($1, $2, $3, $4) RETURNING id",
+			ct.SenderID, ct.RecipientID, ct.Amount, ct.CreatedAt,
+		).
+		Scan(&t.ID)
+	if err != nil {
+		log.Error().
+			Err(err).Int("senderID", ct.SenderID).Int("recipientID", ct.RecipientID).
+			Msg("Failed to add transfer")
+		return transfers.Blank, err
+	}
+	log.Debug().Int("ID", t.ID).Msg("Added new transfer")
+	return t, nil
+}
+
+// GetSentSumSince sums up the points the user has given to other users since the specified time
+func (r Repository) GetSentSumSince(ctx context.Context, senderID int, since time.Time) (decimal.Decimal, error) {
+	var sum decimal.Decimal
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"SELECT coalesce(sum(amount), 0) FROM transfers WHERE sender_id = $1 AND created_at >= $2",
+			senderID, since,
+		).
+		Scan(&sum)
+	if err != nil {
+		log.Error().Err(err).Int("senderID", senderID).Msg("Failed to sum up transfers sent by user")
+		return decimal.Zero, err
+	}
+	return sum, nil
+}
@@ -0,0 +1,74 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/transfers"
+	tdb "github.com/sergeii/practikum-go-gophermart/internal/core/transfers/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestTransfersDatabase_Add_OK(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	sender, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	recipient, _ := udb.New(db).Create(ctx, urepo.New("shopper", "str0ng"))
+	repo := tdb.New(db)
+
+	tr, err := repo.Add(ctx, transfers.New(sender.ID, recipient.ID, decimal.RequireFromString("9.99")))
+	require.NoError(t, err)
+	assert.True(t, tr.ID > 0)
+	assert.Equal(t, sender.ID, tr.SenderID)
+	assert.Equal(t, recipient.ID, tr.RecipientID)
+
+	// the points cannot be given to oneself
+	_, err = repo.Add(ctx, transfers.New(sender.ID, sender.ID, decimal.RequireFromString("1")))
+	assert.Error(t, err)
+	// nor can nothing be given
+	_, err = repo.Add(ctx, transfers.New(sender.ID, recipient.ID, decimal.Zero))
+	assert.Error(t, err)
+}
+
+func TestTransfersDatabase_GetSentSumSince(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	sender, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	recipient, _ := udb.New(db).Create(ctx, urepo.New("shopper", "str0ng"))
+	repo := tdb.New(db)
+
+	sum, err := repo.GetSentSumSince(ctx, sender.ID, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "0", sum.String())
+
+	old := transfers.New(sender.ID, recipient.ID, decimal.RequireFromString("100"))
+	old.CreatedAt = time.Now().Add(-time.Hour * 2)
+	for _, tr := range []transfers.Transfer{
+		old,
+		transfers.New(sender.ID, recipient.ID, decimal.RequireFromString("10.5")),
+		transfers.New(sender.ID, recipient.ID, decimal.RequireFromString("2")),
+		// received rather than sent
+		transfers.New(recipient.ID, sender.ID, decimal.RequireFromString("50")),
+	} {
+		_, err = repo.Add(ctx, tr)
+		require.NoError(t, err)
+	}
+
+	sum, err = repo.GetSentSumSince(ctx, sender.ID, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", sum.String())
+	sum, err = repo.GetSentSumSince(ctx, sender.ID, time.Now().Add(-time.Hour*3))
+	require.NoError(t, err)
+	assert.Equal(t, "112.5", sum.String())
+}
@@ -0,0 +1,13 @@
+package transfers
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type Repository interface {
+	Add(context.Context, Transfer) (Transfer, error)
+	GetSentSumSince(ctx context.Context, senderID int, since time.Time) (decimal.Decimal, error)
+}
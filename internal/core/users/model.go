@@ -1,10 +1,27 @@
 package users
 
-import "github.com/shopspring/decimal"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type UserBalance struct {
 	Current   decimal.Decimal
 	Withdrawn decimal.Decimal
+	// Held is the points reserved for a withdrawal that is yet to be captured or released
+	Held decimal.Decimal
+}
+
+// Equal tells whether the balances are the same
+func (b UserBalance) Equal(other UserBalance) bool {
+	return b.Current.Equal(other.Current) && b.Withdrawn.Equal(other.Withdrawn) && b.Held.Equal(other.Held)
+}
+
+// Expiration is the number of the user's points that expire at the same time
+type Expiration struct {
+	Amount    decimal.Decimal
+	ExpiresAt time.Time
 }
 
 type User struct {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/rs/zerolog/log"
@@ -13,12 +14,58 @@ import (
 	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
 )
 
+// spentLots takes the points ($2) from the user's ($1) lots, oldest first.
+// Unless null, only the lots that have expired by the time ($3) are spent.
+// Every lot gives away what is left after the lots preceding it, until the points are fully taken
+const spentLots = "UPDATE point_lots AS p SET remaining = p.remaining - least(p.remaining, $2 - l.preceding) " +
+	"FROM (" +
+	"SELECT id, remaining, sum(remaining) OVER (ORDER BY id ASC) - remaining AS preceding FROM point_lots " +
+	"WHERE user_id = $1 AND remaining > 0 AND ($3::timestamptz IS NULL OR expires_at <= $3)" +
+	") AS l " +
+	"WHERE p.id = l.id AND l.preceding < $2"
+
+// restoredLots returns the points ($3) to the lots the user's ($1) withdrawal ($2) has taken them from,
+// in the reverse order the lots have been spent in. Returns the number of the points restored
+const restoredLots = "WITH r AS (" +
+	"SELECT lot_id, least(amount, $3 - preceding) AS amount FROM (" +
+	"SELECT w.lot_id, w.amount, sum(w.amount) OVER (ORDER BY w.lot_id DESC) - w.amount AS preceding " +
+	"FROM point_lot_withdrawals AS w JOIN point_lots AS l ON l.id = w.lot_id " +
+	"WHERE w.number = $2 AND l.user_id = $1 AND w.amount > 0" +
+	") AS t WHERE preceding < $3" +
+	"), taken AS (" +
+	"UPDATE point_lot_withdrawals AS w SET amount = w.amount - r.amount FROM r " +
+	"WHERE w.number = $2 AND w.lot_id = r.lot_id" +
+	"), restored AS (" +
+	"UPDATE point_lots AS p SET remaining = p.remaining + r.amount FROM r WHERE p.id = r.lot_id RETURNING r.amount" +
+	") SELECT coalesce(sum(amount), 0) FROM restored"
+
+// Repository keeps the users along with their balances.
+// The points the user owns, either current or held, are also kept as lots, one for each accrual.
+// The lots are spent oldest first, and the points left in a lot past its expiry are taken away from the user.
+// The lots are only changed while the user's row is locked, so they do not need locks of their own
 type Repository struct {
-	db *postgres.Database
+	db        *postgres.Database
+	pointsTTL time.Duration
+}
+
+type Option func(*Repository)
+
+// WithPointsTTL configures the time after which the accrued points expire.
+// The points never expire unless configured otherwise
+func WithPointsTTL(ttl time.Duration) Option {
+	return func(r *Repository) {
+		if ttl > 0 {
+			r.pointsTTL = ttl
+		}
+	}
 }
 
-func New(db *postgres.Database) Repository {
-	return Repository{db}
+func New(db *postgres.Database, opts ...Option) Repository {
+	r := Repository{db: db}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
 }
 
 // Create attempts to insert a new user into the users table.
@@ -50,10 +97,10 @@ func (r Repository) GetByID(ctx context.Context, id int) (users.User, error) {
 	var u users.User
 	row := r.db.Conn(ctx).QueryRow(
 		ctx,
-		"SELECT id, login, password, balance_current, balance_withdrawn FROM users WHERE id = $1",
+		"SELECT id, login, password, balance_current, balance_withdrawn, balance_held FROM users WHERE id = $1",
 		id,
 	)
-	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Balance.Current, &u.Balance.Withdrawn); err != nil {
+	if err := scanUser(row, &u); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Int("ID", id).Msg("User not found")
 			return users.Blank, users.ErrUserNotFound
@@ -65,16 +112,37 @@ func (r Repository) GetByID(ctx context.Context, id int) (users.User, error) {
 	return u, nil
 }
 
+// GetByIDForUpdate retrieves a user just like GetByID does, locking the user's row for an update.
+// The lock is held until the end of the transaction passed in the context,
+// so the user's balance cannot be changed by anyone else meanwhile
+func (r Repository) GetByIDForUpdate(ctx context.Context, id int) (users.User, error) {
+	var u users.User
+	row := r.db.Conn(ctx).QueryRow(
+		ctx,
+		"SELECT id, login, password, balance_current, balance_withdrawn, balance_held FROM users WHERE id = $1 FOR UPDATE",
+		id,
+	)
+	if err := scanUser(row, &u); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Int("ID", id).Msg("User not found")
+			return users.Blank, users.ErrUserNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Msg("Failed to lock user by ID")
+		return users.Blank, err
+	}
+	return u, nil
+}
+
 // GetByLogin attempts to retrieve a user by their unique login username
 // Just like its neighbour GetByID returns a users.User instance for the found user
 func (r Repository) GetByLogin(ctx context.Context, login string) (users.User, error) {
 	var u users.User
 	row := r.db.Conn(ctx).QueryRow(
 		ctx,
-		"SELECT id, login, password, balance_current, balance_withdrawn FROM users WHERE lower(login) = $1",
+		"SELECT id, login, password, balance_current, balance_withdrawn, balance_held FROM users WHERE lower(login) = $1",
 		strings.ToLower(login),
 	)
-	if err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Balance.Current, &u.Balance.Withdrawn); err != nil {
+	if err := scanUser(row, &u); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Str("login", login).Msg("User not found")
 			return users.Blank, users.ErrUserNotFound
@@ -85,7 +153,8 @@ func (r Repository) GetByLogin(ctx context.Context, login string) (users.User, e
 	return u, nil
 }
 
-// AccruePoints accrues specified amount of points for specified user
+// AccruePoints accrues specified amount of points for specified user.
+// Negative amount takes the points back, as long as the user has enough points
 func (r Repository) AccruePoints(ctx context.Context, userID int, points decimal.Decimal) error {
 	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
 		var oldCurrent, newCurrent decimal.Decimal
@@ -96,6 +165,9 @@ func (r Repository) AccruePoints(ctx context.Context, userID int, points decimal
 			log.Error().Err(err).Int("userID", userID).Msg("Unable to acquire row lock for user")
 			return err
 		}
+		if oldCurrent.Add(points).IsNegative() {
+			return users.ErrUserHasInsufficientBalance
+		}
 		if err := tx.QueryRow(
 			txCtx,
 			"UPDATE users SET balance_current = balance_current + $1 WHERE id = $2 RETURNING balance_current",
@@ -103,6 +175,9 @@ func (r Repository) AccruePoints(ctx context.Context, userID int, points decimal
 		).Scan(&newCurrent); err != nil {
 			return err
 		}
+		if err := r.changeLots(txCtx, userID, points); err != nil {
+			return err
+		}
 		log.Info().
 			Int("userID", userID).
 			Stringer("points", points).
@@ -113,7 +188,9 @@ func (r Repository) AccruePoints(ctx context.Context, userID int, points decimal
 	})
 }
 
-func (r Repository) WithdrawPoints(ctx context.Context, userID int, points decimal.Decimal) error {
+// WithdrawPoints withdraws the points from the user's current balance for the order with the specified number.
+// The lots the points are taken from are recorded along with the order, unless the number is empty
+func (r Repository) WithdrawPoints(ctx context.Context, userID int, number string, points decimal.Decimal) error {
 	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
 		var oldCurrent, newCurrent, oldWithdrawn, newWithdrawn decimal.Decimal
 		tx := r.db.Conn(txCtx)
@@ -138,6 +215,9 @@ func (r Repository) WithdrawPoints(ctx context.Context, userID int, points decim
 		).Scan(&newCurrent, &newWithdrawn); err != nil {
 			return err
 		}
+		if err := r.withdrawLots(txCtx, userID, number, points); err != nil {
+			return err
+		}
 		log.Info().
 			Int("userID", userID).
 			Stringer("points", points).
@@ -149,3 +229,412 @@ func (r Repository) WithdrawPoints(ctx context.Context, userID int, points decim
 		return nil
 	})
 }
+
+// RefundPoints returns the points withdrawn for the order with the specified number back to the user's current balance.
+// The points are returned to the lots they have been taken from, so they expire at the same time they would have.
+// The points which lots are unknown, e.g. the ones withdrawn before the lots were recorded, are accrued anew
+func (r Repository) RefundPoints(ctx context.Context, userID int, number string, points decimal.Decimal) error {
+	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var oldCurrent, newCurrent, oldWithdrawn, newWithdrawn decimal.Decimal
+		tx := r.db.Conn(txCtx)
+		if err := tx.QueryRow(
+			txCtx,
+			"SELECT balance_current, balance_withdrawn FROM users WHERE id = $1 FOR UPDATE",
+			userID,
+		).Scan(&oldCurrent, &oldWithdrawn); err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Unable to acquire row lock for user")
+			return err
+		}
+		// it's impossible to refund more points than the user has withdrawn
+		if oldWithdrawn.LessThan(points) {
+			return users.ErrUserHasInsufficientWithdrawn
+		}
+		if err := tx.QueryRow(
+			txCtx,
+			"UPDATE users SET "+
+				"balance_current = balance_current + $1, balance_withdrawn = balance_withdrawn - $1 "+
+				"WHERE id = $2 RETURNING balance_current, balance_withdrawn",
+			points, userID,
+		).Scan(&newCurrent, &newWithdrawn); err != nil {
+			return err
+		}
+		restored, err := r.restoreLots(txCtx, userID, number, points)
+		if err != nil {
+			return err
+		}
+		if rest := points.Sub(restored); rest.IsPositive() {
+			if err = r.addLot(txCtx, userID, rest); err != nil {
+				return err
+			}
+		}
+		log.Info().
+			Int("userID", userID).
+			Stringer("points", points).
+			Stringer("withdrawnBefore", oldWithdrawn).
+			Stringer("withdrawnAfter", newWithdrawn).
+			Stringer("currentBefore", oldCurrent).
+			Stringer("currentAfter", newCurrent).
+			Msg("Points refunded for user")
+		return nil
+	})
+}
+
+// TransferPoints gives the sender's current points to the recipient.
+// The lots the points are taken from are passed over to the recipient along with their expiration time,
+// so that the points do not outlive the time they would have expired at with the sender
+func (r Repository) TransferPoints(ctx context.Context, senderID, recipientID int, points decimal.Decimal) error {
+	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var oldCurrent decimal.Decimal
+		tx := r.db.Conn(txCtx)
+		if err := tx.QueryRow(
+			txCtx, "SELECT balance_current FROM users WHERE id = $1 FOR UPDATE", senderID,
+		).Scan(&oldCurrent); err != nil {
+			log.Error().Err(err).Int("userID", senderID).Msg("Unable to acquire row lock for user")
+			return err
+		}
+		// it's impossible to give away more points than the sender owns
+		if oldCurrent.LessThan(points) {
+			return users.ErrUserHasInsufficientBalance
+		}
+		if _, err := tx.Exec(
+			txCtx, "UPDATE users SET balance_current = balance_current - $1 WHERE id = $2", points, senderID,
+		); err != nil {
+			log.Error().Err(err).Int("userID", senderID).Msg("Failed to take transferred points from user")
+			return err
+		}
+		res, err := tx.Exec(
+			txCtx, "UPDATE users SET balance_current = balance_current + $1 WHERE id = $2", points, recipientID,
+		)
+		if err != nil {
+			log.Error().Err(err).Int("userID", recipientID).Msg("Failed to give transferred points to user")
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return users.ErrUserNotFound
+		}
+		if err = r.moveLots(txCtx, senderID, recipientID, points); err != nil {
+			return err
+		}
+		log.Info().
+			Int("senderID", senderID).
+			Int("recipientID", recipientID).
+			Stringer("points", points).
+			Stringer("senderBefore", oldCurrent).
+			Stringer("senderAfter", oldCurrent.Sub(points)).
+			Msg("Points transferred between users")
+		return nil
+	})
+}
+
+// HoldPoints reserves the points for a withdrawal, moving them from the user's current balance to the held one
+func (r Repository) HoldPoints(ctx context.Context, userID int, points decimal.Decimal) error {
+	return r.movePoints(ctx, userID, points, "balance_current", "balance_held", users.ErrUserHasInsufficientBalance)
+}
+
+// CaptureHeldPoints withdraws the points reserved for a withdrawal.
+// Since the held points are still kept in the lots, the lots are only spent once the points are captured
+func (r Repository) CaptureHeldPoints(
+	ctx context.Context, userID int, number string, points decimal.Decimal,
+) error {
+	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
+		err := r.movePoints(
+			txCtx, userID, points, "balance_held", "balance_withdrawn", users.ErrUserHasInsufficientHeld,
+		)
+		if err != nil {
+			return err
+		}
+		return r.withdrawLots(txCtx, userID, number, points)
+	})
+}
+
+// ReleaseHeldPoints returns the points reserved for a withdrawal back to the user's current balance
+func (r Repository) ReleaseHeldPoints(ctx context.Context, userID int, points decimal.Decimal) error {
+	return r.movePoints(ctx, userID, points, "balance_held", "balance_current", users.ErrUserHasInsufficientHeld)
+}
+
+// movePoints moves the points between the user's balances in the same manner as WithdrawPoints does,
+// failing with the provided error in case the source balance has not enough points.
+// The balances are column names, and they are never meant to come from the outside
+func (r Repository) movePoints(
+	ctx context.Context, userID int, points decimal.Decimal, from, to string, errInsufficient error,
+) error {
+	return r.db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var oldFrom, newFrom, oldTo, newTo decimal.Decimal
+		tx := r.db.Conn(txCtx)
+		if err := tx.QueryRow(
+			txCtx, "SELECT "+from+", "+to+" FROM users WHERE id = $1 FOR UPDATE", userID,
+		).Scan(&oldFrom, &oldTo); err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Unable to acquire row lock for user")
+			return err
+		}
+		if oldFrom.LessThan(points) {
+			return errInsufficient
+		}
+		if err := tx.QueryRow(
+			txCtx,
+			"UPDATE users SET "+from+" = "+from+" - $1, "+to+" = "+to+" + $1 "+
+				"WHERE id = $2 RETURNING "+from+", "+to,
+			points, userID,
+		).Scan(&newFrom, &newTo); err != nil {
+			return err
+		}
+		log.Info().
+			Int("userID", userID).
+			Stringer("points", points).
+			Str("from", from).
+			Str("to", to).
+			Stringer("fromBefore", oldFrom).
+			Stringer("fromAfter", newFrom).
+			Stringer("toBefore", oldTo).
+			Stringer("toAfter", newTo).
+			Msg("Points moved for user")
+		return nil
+	})
+}
+
+// SetBalance overwrites the user's balance with the specified one.
+// It is meant for repairing the balance, so the caller is expected to hold the lock on the user's row
+func (r Repository) SetBalance(ctx context.Context, userID int, balance users.UserBalance) error {
+	res, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE users SET balance_current = $1, balance_withdrawn = $2, balance_held = $3 WHERE id = $4",
+		balance.Current, balance.Withdrawn, balance.Held, userID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to set balance for user")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return users.ErrUserNotFound
+	}
+	if err = r.syncLots(ctx, userID, balance.Current.Add(balance.Held)); err != nil {
+		return err
+	}
+	log.Info().
+		Int("userID", userID).
+		Stringer("current", balance.Current).
+		Stringer("withdrawn", balance.Withdrawn).
+		Stringer("held", balance.Held).
+		Msg("Balance set for user")
+	return nil
+}
+
+// ExpirePoints takes away the user's current points left in the lots that have expired by the specified time.
+// The expired points that are held for a withdrawal are left to the user until the hold is released.
+// Returns the number of points taken away
+func (r Repository) ExpirePoints(ctx context.Context, userID int, now time.Time) (decimal.Decimal, error) {
+	var expired decimal.Decimal
+	err := r.db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var current, remaining decimal.Decimal
+		tx := r.db.Conn(txCtx)
+		if err := tx.QueryRow(
+			txCtx, "SELECT balance_current FROM users WHERE id = $1 FOR UPDATE", userID,
+		).Scan(&current); err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Unable to acquire row lock for user")
+			return err
+		}
+		if err := tx.QueryRow(
+			txCtx,
+			"SELECT coalesce(sum(remaining), 0) FROM point_lots "+
+				"WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2",
+			userID, now,
+		).Scan(&remaining); err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Failed to sum up expired points for user")
+			return err
+		}
+		expired = decimal.Min(current, remaining)
+		if !expired.IsPositive() {
+			return nil
+		}
+		if _, err := tx.Exec(
+			txCtx, "UPDATE users SET balance_current = balance_current - $1 WHERE id = $2", expired, userID,
+		); err != nil {
+			return err
+		}
+		if err := r.spendLots(txCtx, userID, expired, &now); err != nil {
+			return err
+		}
+		log.Info().
+			Int("userID", userID).
+			Stringer("points", expired).
+			Stringer("currentBefore", current).
+			Stringer("currentAfter", current.Sub(expired)).
+			Msg("Points expired for user")
+		return nil
+	})
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return expired, nil
+}
+
+// GetIDsWithExpiredPoints returns the IDs of the users having points left in the lots
+// that have expired by the specified time, in ascending order, starting after the specified ID
+func (r Repository) GetIDsWithExpiredPoints(
+	ctx context.Context, now time.Time, afterID, limit int,
+) ([]int, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT DISTINCT user_id FROM point_lots "+
+			"WHERE remaining > 0 AND expires_at <= $1 AND user_id > $2 "+
+			"ORDER BY user_id ASC LIMIT $3",
+		now, afterID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to query users with expired points")
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			log.Error().Err(err).Msg("Failed to scan user ID")
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetUpcomingExpirations returns the user's points that are yet to expire, soonest first
+func (r Repository) GetUpcomingExpirations(
+	ctx context.Context, userID int, now time.Time, limit int,
+) ([]users.Expiration, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT expires_at, sum(remaining) FROM point_lots "+
+			"WHERE user_id = $1 AND remaining > 0 AND expires_at > $2 "+
+			"GROUP BY expires_at ORDER BY expires_at ASC LIMIT $3",
+		userID, now, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query upcoming expirations for user")
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]users.Expiration, 0)
+	for rows.Next() {
+		var item users.Expiration
+		if err = rows.Scan(&item.ExpiresAt, &item.Amount); err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Failed to scan upcoming expiration")
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// addLot records the points accrued for the user, to expire after the configured time
+func (r Repository) addLot(ctx context.Context, userID int, points decimal.Decimal) error {
+	var expiresAt *time.Time
+	if r.pointsTTL > 0 {
+		t := time.Now().Add(r.pointsTTL)
+		expiresAt = &t
+	}
+	if _, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"INSERT INTO point_lots (user_id, amount, remaining, expires_at) VALUES ($1, $2, $2, $3)",
+		userID, points, expiresAt,
+	); err != nil {
+		log.Error().Err(err).Int("userID", userID).Stringer("points", points).Msg("Failed to add points lot")
+		return err
+	}
+	return nil
+}
+
+// spendLots takes the points from the user's lots, oldest first.
+// Unless nil, only the lots that have expired by the specified time are spent
+func (r Repository) spendLots(ctx context.Context, userID int, points decimal.Decimal, expiredAt *time.Time) error {
+	if _, err := r.db.Conn(ctx).Exec(ctx, spentLots, userID, points, expiredAt); err != nil {
+		log.Error().Err(err).Int("userID", userID).Stringer("points", points).Msg("Failed to spend points lots")
+		return err
+	}
+	return nil
+}
+
+// withdrawLots spends the user's lots in the same manner as spendLots does,
+// recording the points taken from every lot along with the number of the order they have been withdrawn for.
+// The withdrawals that are not made for an order are not recorded
+func (r Repository) withdrawLots(ctx context.Context, userID int, number string, points decimal.Decimal) error {
+	if number == "" {
+		return r.spendLots(ctx, userID, points, nil)
+	}
+	if _, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"WITH spent AS ("+spentLots+" RETURNING p.id, l.remaining - p.remaining AS amount) "+
+			"INSERT INTO point_lot_withdrawals (lot_id, number, amount) "+
+			"SELECT id, $4, amount FROM spent WHERE amount > 0",
+		userID, points, nil, number,
+	); err != nil {
+		log.Error().
+			Err(err).Int("userID", userID).Str("order", number).Stringer("points", points).
+			Msg("Failed to withdraw points lots")
+		return err
+	}
+	return nil
+}
+
+// restoreLots returns the points to the lots the withdrawal for the order has taken them from.
+// Returns the number of the points restored, which falls short of the refunded ones
+// in case the withdrawal has not been recorded
+func (r Repository) restoreLots(
+	ctx context.Context, userID int, number string, points decimal.Decimal,
+) (decimal.Decimal, error) {
+	var restored decimal.Decimal
+	if number == "" {
+		return restored, nil
+	}
+	if err := r.db.Conn(ctx).QueryRow(ctx, restoredLots, userID, number, points).Scan(&restored); err != nil {
+		log.Error().
+			Err(err).Int("userID", userID).Str("order", number).Stringer("points", points).
+			Msg("Failed to restore points lots")
+		return restored, err
+	}
+	return restored, nil
+}
+
+// moveLots takes the points from the sender's lots, oldest first,
+// and adds a lot to the recipient for every part of a lot taken, expiring at the same time
+func (r Repository) moveLots(ctx context.Context, senderID, recipientID int, points decimal.Decimal) error {
+	if _, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"WITH spent AS ("+spentLots+" RETURNING p.id, l.remaining - p.remaining AS amount, p.expires_at) "+
+			"INSERT INTO point_lots (user_id, amount, remaining, expires_at) "+
+			"SELECT $4, amount, amount, expires_at FROM spent WHERE amount > 0 ORDER BY id ASC",
+		senderID, points, nil, recipientID,
+	); err != nil {
+		log.Error().
+			Err(err).Int("senderID", senderID).Int("recipientID", recipientID).Stringer("points", points).
+			Msg("Failed to move points lots")
+		return err
+	}
+	return nil
+}
+
+// changeLots adds a lot for the points given to the user, or spends the lots for the points taken back
+func (r Repository) changeLots(ctx context.Context, userID int, points decimal.Decimal) error {
+	switch {
+	case points.IsPositive():
+		return r.addLot(ctx, userID, points)
+	case points.IsNegative():
+		return r.spendLots(ctx, userID, points.Neg(), nil)
+	}
+	return nil
+}
+
+// syncLots brings the user's lots in line with the specified number of points owned by the user
+func (r Repository) syncLots(ctx context.Context, userID int, owned decimal.Decimal) error {
+	var remaining decimal.Decimal
+	if err := r.db.Conn(ctx).QueryRow(
+		ctx, "SELECT coalesce(sum(remaining), 0) FROM point_lots WHERE user_id = $1 AND remaining > 0", userID,
+	).Scan(&remaining); err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to sum up points lots for user")
+		return err
+	}
+	return r.changeLots(ctx, userID, owned.Sub(remaining))
+}
+
+func scanUser(row pgx.Row, u *users.User) error {
+	return row.Scan(&u.ID, &u.Login, &u.Password, &u.Balance.Current, &u.Balance.Withdrawn, &u.Balance.Held)
+}
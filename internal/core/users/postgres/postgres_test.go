@@ -5,6 +5,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -196,6 +197,24 @@ func TestUsersDatabase_AccruePoints_OK(t *testing.T) {
 	assert.Equal(t, "20", u.Balance.Current.String())
 }
 
+func TestUsersDatabase_AccruePoints_Negative(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	repo := udb.New(db)
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+	require.NoError(t, repo.AccruePoints(context.TODO(), u.ID, decimal.NewFromInt(20)))
+
+	err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("-5.5"))
+	assert.NoError(t, err)
+	err = repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("-15"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientBalance)
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "14.5", u.Balance.Current.String())
+	assert.True(t, u.Balance.Withdrawn.IsZero())
+}
+
 func TestUsersDatabase_AccruePoints_Race(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
@@ -244,9 +263,9 @@ func TestUsersDatabase_WithdrawPoints_OK(t *testing.T) {
 
 	err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20.01"))
 	assert.NoError(t, err)
-	err = repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("10.01"))
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("10.01"))
 	assert.NoError(t, err)
-	err = repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("9.99"))
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("9.99"))
 	assert.NoError(t, err)
 
 	u, _ = repo.GetByID(context.TODO(), u.ID)
@@ -262,11 +281,11 @@ func TestUsersDatabase_WithdrawPoints_CannotWithdrawMoreThanHave(t *testing.T) {
 
 	err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20.01"))
 	assert.NoError(t, err)
-	err = repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("10.01"))
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("10.01"))
 	assert.NoError(t, err)
-	err = repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("9.99"))
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("9.99"))
 	assert.NoError(t, err)
-	err = repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("0.02"))
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("0.02"))
 	assert.ErrorIs(t, err, users.ErrUserHasInsufficientBalance)
 
 	u, _ = repo.GetByID(context.TODO(), u.ID)
@@ -288,7 +307,7 @@ func TestUsersDatabase_WithdrawPoints_CannotWithdrawMoreThanHave_Race(t *testing
 	for i := 0; i < 10; i++ {
 		wg.Add(1)
 		go func() {
-			err := repo.WithdrawPoints(context.TODO(), u.ID, decimal.RequireFromString("1.5"))
+			err := repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("1.5"))
 			if err != nil {
 				assert.ErrorIs(t, err, users.ErrUserHasInsufficientBalance)
 				atomic.AddInt64(&errCount, 1)
@@ -302,3 +321,303 @@ func TestUsersDatabase_WithdrawPoints_CannotWithdrawMoreThanHave_Race(t *testing
 	assert.Equal(t, "0.5", u.Balance.Current.String())
 	assert.Equal(t, 7, int(errCount))
 }
+
+func TestUsersDatabase_RefundPoints(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	repo := udb.New(db)
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+
+	err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20.01"))
+	assert.NoError(t, err)
+	err = repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("10.01"))
+	assert.NoError(t, err)
+	err = repo.RefundPoints(context.TODO(), u.ID, "", decimal.RequireFromString("4"))
+	assert.NoError(t, err)
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "14", u.Balance.Current.String())
+	assert.Equal(t, "6.01", u.Balance.Withdrawn.String())
+
+	// cannot refund more than has been withdrawn
+	err = repo.RefundPoints(context.TODO(), u.ID, "", decimal.RequireFromString("6.02"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientWithdrawn)
+	err = repo.RefundPoints(context.TODO(), u.ID, "", decimal.RequireFromString("6.01"))
+	assert.NoError(t, err)
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "20.01", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+}
+
+func TestUsersDatabase_RefundPoints_KeepsExpiry(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	now := time.Now()
+	repo := udb.New(db, udb.WithPointsTTL(time.Hour))
+	later := udb.New(db, udb.WithPointsTTL(time.Hour*3))
+	// the refunded points are never given the expiry of a fresh accrual, unless their lots are unknown
+	fresh := udb.New(db, udb.WithPointsTTL(time.Hour*5))
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+
+	require.NoError(t, repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	require.NoError(t, later.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20")))
+	require.NoError(t, repo.WithdrawPoints(context.TODO(), u.ID, "1234567812345670", decimal.RequireFromString("15")))
+	require.NoError(t, repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("1")))
+
+	// the lots spent last are restored first
+	require.NoError(t, fresh.RefundPoints(context.TODO(), u.ID, "1234567812345670", decimal.RequireFromString("12")))
+	expiring, err := repo.GetUpcomingExpirations(context.TODO(), u.ID, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expiring, 2)
+	assert.Equal(t, "7", expiring[0].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour), expiring[0].ExpiresAt, time.Second*5)
+	assert.Equal(t, "19", expiring[1].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour*3), expiring[1].ExpiresAt, time.Second*5)
+
+	require.NoError(t, fresh.RefundPoints(context.TODO(), u.ID, "1234567812345670", decimal.RequireFromString("3")))
+	require.NoError(t, fresh.RefundPoints(context.TODO(), u.ID, "", decimal.RequireFromString("1")))
+	expiring, err = repo.GetUpcomingExpirations(context.TODO(), u.ID, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expiring, 3)
+	assert.Equal(t, "10", expiring[0].Amount.String())
+	assert.Equal(t, "19", expiring[1].Amount.String())
+	assert.Equal(t, "1", expiring[2].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour*5), expiring[2].ExpiresAt, time.Second*5)
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "30", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+}
+
+func TestUsersDatabase_HoldPoints(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	repo := udb.New(db)
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+
+	err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20"))
+	assert.NoError(t, err)
+	err = repo.HoldPoints(context.TODO(), u.ID, decimal.RequireFromString("10.5"))
+	assert.NoError(t, err)
+	err = repo.HoldPoints(context.TODO(), u.ID, decimal.RequireFromString("4.5"))
+	assert.NoError(t, err)
+	// cannot hold more points than the user owns
+	err = repo.HoldPoints(context.TODO(), u.ID, decimal.RequireFromString("5.01"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientBalance)
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "5", u.Balance.Current.String())
+	assert.Equal(t, "15", u.Balance.Held.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+
+	err = repo.CaptureHeldPoints(context.TODO(), u.ID, "", decimal.RequireFromString("10.5"))
+	assert.NoError(t, err)
+	err = repo.ReleaseHeldPoints(context.TODO(), u.ID, decimal.RequireFromString("4.5"))
+	assert.NoError(t, err)
+	// cannot capture or release more points than held
+	err = repo.CaptureHeldPoints(context.TODO(), u.ID, "", decimal.RequireFromString("0.01"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientHeld)
+	err = repo.ReleaseHeldPoints(context.TODO(), u.ID, decimal.RequireFromString("0.01"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientHeld)
+
+	u, _ = repo.GetByLogin(context.TODO(), "happycustomer")
+	assert.Equal(t, "9.5", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Held.String())
+	assert.Equal(t, "10.5", u.Balance.Withdrawn.String())
+}
+
+func TestUsersDatabase_TransferPoints_KeepsExpiry(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	now := time.Now()
+	repo := udb.New(db, udb.WithPointsTTL(time.Hour))
+	later := udb.New(db, udb.WithPointsTTL(time.Hour*3))
+	sender, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+	recipient, _ := repo.Create(context.TODO(), users.New("shopper", "str0ng"))
+
+	require.NoError(t, repo.AccruePoints(context.TODO(), sender.ID, decimal.RequireFromString("10")))
+	require.NoError(t, later.AccruePoints(context.TODO(), sender.ID, decimal.RequireFromString("20")))
+	// the recipient's own points never expire
+	require.NoError(t, udb.New(db).AccruePoints(context.TODO(), recipient.ID, decimal.RequireFromString("5")))
+
+	err := repo.TransferPoints(context.TODO(), sender.ID, recipient.ID, decimal.RequireFromString("31"))
+	assert.ErrorIs(t, err, users.ErrUserHasInsufficientBalance)
+	// the oldest lots are passed over first
+	require.NoError(t, repo.TransferPoints(context.TODO(), sender.ID, recipient.ID, decimal.RequireFromString("15")))
+
+	sender, _ = repo.GetByID(context.TODO(), sender.ID)
+	assert.Equal(t, "15", sender.Balance.Current.String())
+	assert.Equal(t, "0", sender.Balance.Withdrawn.String())
+	recipient, _ = repo.GetByID(context.TODO(), recipient.ID)
+	assert.Equal(t, "20", recipient.Balance.Current.String())
+
+	expiring, err := repo.GetUpcomingExpirations(context.TODO(), sender.ID, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expiring, 1)
+	assert.Equal(t, "15", expiring[0].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour*3), expiring[0].ExpiresAt, time.Second*5)
+
+	// the transferred points expire when they would have expired with the sender
+	expiring, err = repo.GetUpcomingExpirations(context.TODO(), recipient.ID, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expiring, 2)
+	assert.Equal(t, "10", expiring[0].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour), expiring[0].ExpiresAt, time.Second*5)
+	assert.Equal(t, "5", expiring[1].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour*3), expiring[1].ExpiresAt, time.Second*5)
+
+	expired, err := repo.ExpirePoints(context.TODO(), recipient.ID, now.Add(time.Hour*2))
+	require.NoError(t, err)
+	assert.Equal(t, "10", expired.String())
+
+	err = repo.TransferPoints(context.TODO(), sender.ID, 999999, decimal.RequireFromString("1"))
+	assert.ErrorIs(t, err, users.ErrUserNotFound)
+}
+
+func TestUsersDatabase_GetByIDForUpdate(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	repo := udb.New(db)
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+
+	accrued := make(chan struct{})
+	err := db.WithTransaction(context.TODO(), func(txCtx context.Context) error {
+		locked, err := repo.GetByIDForUpdate(txCtx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "happycustomer", locked.Login)
+		go func() {
+			// blocks until the lock is released
+			err := repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10"))
+			assert.NoError(t, err)
+			close(accrued)
+		}()
+		select {
+		case <-accrued:
+			t.Error("balance must not change while the user is locked")
+		case <-time.After(time.Millisecond * 100):
+		}
+		return repo.SetBalance(txCtx, u.ID, users.UserBalance{
+			Current: decimal.RequireFromString("5"), Withdrawn: decimal.RequireFromString("1.5"),
+		})
+	})
+	require.NoError(t, err)
+	<-accrued
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "15", u.Balance.Current.String())
+	assert.Equal(t, "1.5", u.Balance.Withdrawn.String())
+
+	_, err = repo.GetByIDForUpdate(context.TODO(), 999999)
+	assert.ErrorIs(t, err, users.ErrUserNotFound)
+}
+
+func TestUsersDatabase_SetBalance(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	repo := udb.New(db)
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+	require.NoError(t, repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("100")))
+
+	err := repo.SetBalance(context.TODO(), u.ID, users.UserBalance{
+		Current: decimal.RequireFromString("42.5"), Withdrawn: decimal.Zero,
+	})
+	require.NoError(t, err)
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "42.5", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+
+	// the balance cannot go negative
+	err = repo.SetBalance(context.TODO(), u.ID, users.UserBalance{
+		Current: decimal.RequireFromString("-1"), Withdrawn: decimal.Zero,
+	})
+	assert.Error(t, err)
+
+	err = repo.SetBalance(context.TODO(), 999999, users.UserBalance{})
+	assert.ErrorIs(t, err, users.ErrUserNotFound)
+}
+
+func TestUsersDatabase_ExpirePoints_OldestFirst(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	now := time.Now()
+	repo := udb.New(db, udb.WithPointsTTL(time.Hour))
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+	other, _ := repo.Create(context.TODO(), users.New("shopper", "str0ng"))
+
+	require.NoError(t, repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	require.NoError(t, repo.AccruePoints(context.TODO(), other.ID, decimal.RequireFromString("10")))
+	// accrued later with longer expiry
+	later := udb.New(db, udb.WithPointsTTL(time.Hour*3))
+	require.NoError(t, later.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("20")))
+	// the oldest lot is spent first
+	require.NoError(t, repo.WithdrawPoints(context.TODO(), u.ID, "", decimal.RequireFromString("15")))
+
+	expiring, err := repo.GetUpcomingExpirations(context.TODO(), u.ID, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expiring, 1)
+	assert.Equal(t, "15", expiring[0].Amount.String())
+	assert.WithinDuration(t, now.Add(time.Hour*3), expiring[0].ExpiresAt, time.Second*5)
+
+	ids, err := repo.GetIDsWithExpiredPoints(context.TODO(), now.Add(time.Hour*2), 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{other.ID}, ids)
+
+	// nothing is left in the expired lot
+	expired, err := repo.ExpirePoints(context.TODO(), u.ID, now.Add(time.Hour*2))
+	require.NoError(t, err)
+	assert.Equal(t, "0", expired.String())
+	expired, err = repo.ExpirePoints(context.TODO(), u.ID, now.Add(time.Hour*4))
+	require.NoError(t, err)
+	assert.Equal(t, "15", expired.String())
+
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "0", u.Balance.Current.String())
+	assert.Equal(t, "15", u.Balance.Withdrawn.String())
+	expiring, _ = repo.GetUpcomingExpirations(context.TODO(), u.ID, now, 10)
+	assert.Len(t, expiring, 0)
+	other, _ = repo.GetByID(context.TODO(), other.ID)
+	assert.Equal(t, "10", other.Balance.Current.String())
+}
+
+func TestUsersDatabase_ExpirePoints_Held(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	expiresAt := time.Now().Add(time.Hour * 2)
+	repo := udb.New(db, udb.WithPointsTTL(time.Hour))
+	u, _ := repo.Create(context.TODO(), users.New("happycustomer", "str0ng"))
+	require.NoError(t, repo.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	require.NoError(t, repo.HoldPoints(context.TODO(), u.ID, decimal.RequireFromString("6")))
+
+	// the held points are left to the user
+	expired, err := repo.ExpirePoints(context.TODO(), u.ID, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, "4", expired.String())
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "0", u.Balance.Current.String())
+	assert.Equal(t, "6", u.Balance.Held.String())
+
+	// until the hold is released
+	require.NoError(t, repo.ReleaseHeldPoints(context.TODO(), u.ID, decimal.RequireFromString("6")))
+	expired, err = repo.ExpirePoints(context.TODO(), u.ID, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, "6", expired.String())
+	u, _ = repo.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "0", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Held.String())
+
+	// the points without expiry never expire
+	noExpiry := udb.New(db)
+	require.NoError(t, noExpiry.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("5")))
+	expired, err = repo.ExpirePoints(context.TODO(), u.ID, expiresAt.Add(time.Hour*24*365))
+	require.NoError(t, err)
+	assert.Equal(t, "0", expired.String())
+}
@@ -3,17 +3,30 @@ package users
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
 
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserHasInsufficientBalance = errors.New("user has no enough points to withdraw")
+var ErrUserHasInsufficientWithdrawn = errors.New("user has not withdrawn enough points to refund")
+var ErrUserHasInsufficientHeld = errors.New("user has no enough held points")
 
 type Repository interface {
 	Create(context.Context, User) (User, error)
 	GetByID(context.Context, int) (User, error)
+	GetByIDForUpdate(context.Context, int) (User, error)
 	GetByLogin(context.Context, string) (User, error)
 	AccruePoints(context.Context, int, decimal.Decimal) error
-	WithdrawPoints(context.Context, int, decimal.Decimal) error
+	WithdrawPoints(context.Context, int, string, decimal.Decimal) error
+	RefundPoints(context.Context, int, string, decimal.Decimal) error
+	TransferPoints(context.Context, int, int, decimal.Decimal) error
+	HoldPoints(context.Context, int, decimal.Decimal) error
+	CaptureHeldPoints(context.Context, int, string, decimal.Decimal) error
+	ReleaseHeldPoints(context.Context, int, decimal.Decimal) error
+	SetBalance(context.Context, int, UserBalance) error
+	ExpirePoints(context.Context, int, time.Time) (decimal.Decimal, error)
+	GetIDsWithExpiredPoints(ctx context.Context, now time.Time, afterID, limit int) ([]int, error)
+	GetUpcomingExpirations(ctx context.Context, userID int, now time.Time, limit int) ([]Expiration, error)
 }
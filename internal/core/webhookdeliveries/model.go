@@ -0,0 +1,47 @@
+package webhookdeliveries
+
+import (
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusPending is for the deliveries that are yet to be attempted or retried
+	StatusPending Status = "PENDING"
+	// StatusDelivered is for the deliveries accepted by the webhook
+	StatusDelivered Status = "DELIVERED"
+	// StatusFailed is for the deliveries that have run out of attempts
+	StatusFailed Status = "FAILED"
+)
+
+// Delivery is a notification of a single event sent to a webhook.
+// The deliveries make up the webhook's delivery log
+type Delivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       []byte
+	Status        Status
+	Attempts      int
+	NextAttemptAt time.Time
+	// LastStatusCode is the HTTP status of the last attempt, zero if no response was received
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    time.Time
+}
+
+var Blank Delivery // nolint: gochecknoglobals
+
+func New(webhookID int, event string, payload []byte) Delivery {
+	now := time.Now()
+	return Delivery{
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt_at, " +
+	"last_status_code, last_error, created_at, delivered_at"
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+func (r Repository) Add(ctx context.Context, d webhookdeliveries.Delivery) (webhookdeliveries.Delivery, error) {
+	added := d
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			d.WebhookID, d.Event, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt,
+		).
+		Scan(&added.ID)
+	if err != nil {
+		log.Error().Err(err).Int("webhookID", d.WebhookID).Msg("Failed to add webhook delivery")
+		return webhookdeliveries.Blank, err
+	}
+	return added, nil
+}
+
+// LeaseDue picks a batch of pending deliveries whose attempt is due, the oldest first.
+// The picked deliveries are hidden from other callers for the duration of the lease,
+// so that a delivery is attempted again if the caller fails to update it before the lease expires
+func (r Repository) LeaseDue(
+	ctx context.Context, limit int, lease time.Duration,
+) ([]webhookdeliveries.Delivery, error) {
+	now := time.Now()
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"UPDATE webhook_deliveries SET next_attempt_at = $1 "+
+			"WHERE id IN ("+
+			"SELECT id FROM webhook_deliveries WHERE status = 'PENDING' AND next_attempt_at <= $2 "+
+			"ORDER BY next_attempt_at ASC, id ASC LIMIT $3 FOR UPDATE SKIP LOCKED"+
+			") RETURNING "+deliveryColumns,
+		now.Add(lease), now, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to lease webhook deliveries")
+		return nil, err
+	}
+	return scanDeliveryRows(rows)
+}
+
+// Update stores the outcome of a delivery attempt
+func (r Repository) Update(ctx context.Context, d webhookdeliveries.Delivery) error {
+	var lastStatusCode *int
+	if d.LastStatusCode != 0 {
+		lastStatusCode = &d.LastStatusCode
+	}
+	var deliveredAt *time.Time
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = &d.DeliveredAt
+	}
+	res, err := r.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE webhook_deliveries SET "+
+			"status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4, last_error = $5, "+
+			"delivered_at = $6 "+
+			"WHERE id = $7",
+		d.Status, d.Attempts, d.NextAttemptAt, lastStatusCode, d.LastError, deliveredAt, d.ID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("ID", d.ID).Msg("Failed to update webhook delivery")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return webhookdeliveries.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// GetListForWebhook returns the latest deliveries to the webhook, the newest first
+func (r Repository) GetListForWebhook(
+	ctx context.Context, webhookID int, limit int,
+) ([]webhookdeliveries.Delivery, error) {
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2",
+		webhookID, limit,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("webhookID", webhookID).Msg("Failed to query webhook deliveries")
+		return nil, err
+	}
+	return scanDeliveryRows(rows)
+}
+
+func scanDeliveryRows(rows pgx.Rows) ([]webhookdeliveries.Delivery, error) {
+	var items []webhookdeliveries.Delivery
+	defer rows.Close()
+	for rows.Next() {
+		var d webhookdeliveries.Delivery
+		var lastStatusCode *int
+		var deliveredAt *time.Time
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&lastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt,
+		)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read webhook deliveries")
+			return nil, err
+		}
+		if lastStatusCode != nil {
+			d.LastStatusCode = *lastStatusCode
+		}
+		if deliveredAt != nil {
+			d.DeliveredAt = *deliveredAt
+		}
+		items = append(items, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to fetch webhook deliveries")
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,91 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries"
+	ddb "github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhooks"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/webhooks/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestWebhookDeliveriesDatabase_LeaseAndUpdate(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	w, _ := wdb.New(db).Add(ctx, webhooks.New(u.ID, "https://example.com/hook", "s3cr3t", []string{"order"}))
+
+	repo := ddb.New(db)
+	first, err := repo.Add(ctx, webhookdeliveries.New(w.ID, "order", []byte(`{"event": "order"}`)))
+	require.NoError(t, err)
+	assert.True(t, first.ID > 0)
+	second, err := repo.Add(ctx, webhookdeliveries.New(w.ID, "balance", []byte(`{"event": "balance"}`)))
+	require.NoError(t, err)
+	delayed := webhookdeliveries.New(w.ID, "balance", []byte(`{}`))
+	delayed.NextAttemptAt = time.Now().Add(time.Hour)
+	_, err = repo.Add(ctx, delayed)
+	require.NoError(t, err)
+
+	batch, err := repo.LeaseDue(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, first.ID, batch[0].ID)
+	assert.JSONEq(t, `{"event": "order"}`, string(batch[0].Payload))
+	assert.Equal(t, webhookdeliveries.StatusPending, batch[0].Status)
+
+	// leased deliveries are hidden
+	batch, err = repo.LeaseDue(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, second.ID, batch[0].ID)
+	batch, err = repo.LeaseDue(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, batch, 0)
+
+	first.Status = webhookdeliveries.StatusDelivered
+	first.Attempts = 1
+	first.LastStatusCode = 204
+	first.DeliveredAt = time.Now()
+	require.NoError(t, repo.Update(ctx, first))
+	second.Attempts = 1
+	second.LastStatusCode = 500
+	second.LastError = "internal server error"
+	second.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, repo.Update(ctx, second))
+
+	// the failed delivery is due again
+	batch, err = repo.LeaseDue(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, second.ID, batch[0].ID)
+	assert.Equal(t, 1, batch[0].Attempts)
+	assert.Equal(t, 500, batch[0].LastStatusCode)
+	assert.Equal(t, "internal server error", batch[0].LastError)
+
+	log, err := repo.GetListForWebhook(ctx, w.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, log, 2)
+	assert.Equal(t, second.ID, log[1].ID)
+	assert.True(t, log[1].DeliveredAt.IsZero())
+	all, err := repo.GetListForWebhook(ctx, w.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, first.ID, all[2].ID)
+	assert.Equal(t, webhookdeliveries.StatusDelivered, all[2].Status)
+	assert.Equal(t, 204, all[2].LastStatusCode)
+	assert.False(t, all[2].DeliveredAt.IsZero())
+
+	unknown := webhookdeliveries.New(w.ID, "order", []byte(`{}`))
+	unknown.ID = 9999
+	assert.ErrorIs(t, repo.Update(ctx, unknown), webhookdeliveries.ErrDeliveryNotFound)
+}
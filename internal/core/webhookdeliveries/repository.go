@@ -0,0 +1,16 @@
+package webhookdeliveries
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+type Repository interface {
+	Add(context.Context, Delivery) (Delivery, error)
+	LeaseDue(context.Context, int, time.Duration) ([]Delivery, error)
+	Update(context.Context, Delivery) error
+	GetListForWebhook(context.Context, int, int) ([]Delivery, error)
+}
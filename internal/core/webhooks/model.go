@@ -0,0 +1,52 @@
+package webhooks
+
+import (
+	"time"
+)
+
+const (
+	// EventOrder is for the orders that have reached their final status
+	EventOrder = "order"
+	// EventBalance is for the changes of the user's balance
+	EventBalance = "balance"
+)
+
+// Webhook is a URL of a user's backend that is notified of the user's events.
+// The notifications are signed with the webhook's secret
+type Webhook struct {
+	ID     int
+	UserID int
+	URL    string
+	Secret string
+	// Events lists the events the webhook is notified of
+	Events  []string
+	Enabled bool
+	// ConsecutiveFailures is the number of failed deliveries since the last successful one.
+	// The webhook is disabled once the failures pile up
+	ConsecutiveFailures int
+	CreatedAt           time.Time
+	DisabledAt          time.Time
+}
+
+var Blank Webhook // nolint: gochecknoglobals
+
+func New(userID int, url, secret string, events []string) Webhook {
+	return Webhook{
+		UserID:    userID,
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Subscribes tells whether the webhook is to be notified of the event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
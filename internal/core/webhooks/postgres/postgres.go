@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhooks"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+const webhookColumns = "id, user_id, url, secret, events, enabled, consecutive_failures, created_at, disabled_at"
+
+type Repository struct {
+	db *postgres.Database
+}
+
+func New(db *postgres.Database) Repository {
+	return Repository{db}
+}
+
+func (r Repository) Add(ctx context.Context, w webhooks.Webhook) (webhooks.Webhook, error) {
+	added := w
+	err := r.db.Conn(ctx).
+		QueryRow(
+			ctx,
+			"INSERT INTO webhooks (user_id, url, secret, events, enabled, created_at) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			w.UserID, w.URL, w.Secret, w.Events, w.Enabled, w.CreatedAt,
+		).
+		Scan(&added.ID)
+	if err != nil {
+		log.Error().Err(err).Int("userID", w.UserID).Msg("Failed to add webhook")
+		return webhooks.Blank, err
+	}
+	return added, nil
+}
+
+func (r Repository) GetByID(ctx context.Context, id int) (webhooks.Webhook, error) {
+	row := r.db.Conn(ctx).QueryRow(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id)
+	w, err := scanWebhook(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return webhooks.Blank, webhooks.ErrWebhookNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Msg("Failed to fetch webhook")
+		return webhooks.Blank, err
+	}
+	return w, nil
+}
+
+// GetListForUser returns the user's webhooks in the order they have been added
+func (r Repository) GetListForUser(ctx context.Context, userID int) ([]webhooks.Webhook, error) {
+	var items []webhooks.Webhook
+	rows, err := r.db.Conn(ctx).Query(
+		ctx,
+		"SELECT "+webhookColumns+" FROM webhooks WHERE user_id = $1 ORDER BY id ASC",
+		userID,
+	)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query webhooks")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			log.Error().Err(err).Int("userID", userID).Msg("Failed to read webhooks")
+			return nil, err
+		}
+		items = append(items, w)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch webhooks")
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete removes the webhook along with its delivery log
+func (r Repository) Delete(ctx context.Context, id int) error {
+	return r.exec(ctx, id, "DELETE FROM webhooks WHERE id = $1", id)
+}
+
+// Enable turns on a disabled webhook and gives it a clean slate
+func (r Repository) Enable(ctx context.Context, id int) error {
+	return r.exec(
+		ctx, id,
+		"UPDATE webhooks SET enabled = true, consecutive_failures = 0, disabled_at = NULL WHERE id = $1",
+		id,
+	)
+}
+
+// RecordSuccess resets the failures of the webhook after a successful delivery
+func (r Repository) RecordSuccess(ctx context.Context, id int) error {
+	return r.exec(ctx, id, "UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1", id)
+}
+
+// RecordFailure counts a failed delivery against the webhook.
+// The webhook is disabled once it has failed the given number of deliveries in a row
+func (r Repository) RecordFailure(ctx context.Context, id int, disableAfter int) (webhooks.Webhook, error) {
+	row := r.db.Conn(ctx).QueryRow(
+		ctx,
+		"UPDATE webhooks SET consecutive_failures = consecutive_failures + 1, "+
+			"enabled = enabled AND consecutive_failures + 1 < $2, "+
+			"disabled_at = CASE WHEN enabled AND consecutive_failures + 1 >= $2 THEN $3 ELSE disabled_at END "+
+			"WHERE id = $1 RETURNING "+webhookColumns,
+		id, disableAfter, time.Now(),
+	)
+	w, err := scanWebhook(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return webhooks.Blank, webhooks.ErrWebhookNotFound
+		}
+		log.Error().Err(err).Int("ID", id).Msg("Failed to record webhook failure")
+		return webhooks.Blank, err
+	}
+	return w, nil
+}
+
+func (r Repository) exec(ctx context.Context, id int, sql string, args ...interface{}) error {
+	res, err := r.db.Conn(ctx).Exec(ctx, sql, args...)
+	if err != nil {
+		log.Error().Err(err).Int("ID", id).Msg("Failed to update webhook")
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return webhooks.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func scanWebhook(row pgx.Row) (webhooks.Webhook, error) {
+	var w webhooks.Webhook
+	var disabledAt *time.Time
+	err := row.Scan(
+		&w.ID, &w.UserID, &w.URL, &w.Secret, &w.Events, &w.Enabled, &w.ConsecutiveFailures,
+		&w.CreatedAt, &disabledAt,
+	)
+	if err != nil {
+		return webhooks.Blank, err
+	}
+	if disabledAt != nil {
+		w.DisabledAt = *disabledAt
+	}
+	return w, nil
+}
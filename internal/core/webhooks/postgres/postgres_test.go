@@ -0,0 +1,96 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhooks"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/webhooks/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestWebhooksDatabase_AddAndList(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(ctx, urepo.New("othercustomer", "str0ng"))
+
+	repo := wdb.New(db)
+	w1, err := repo.Add(ctx, webhooks.New(u.ID, "https://example.com/hook", "s3cr3t", []string{"order"}))
+	require.NoError(t, err)
+	assert.True(t, w1.ID > 0)
+	w2, err := repo.Add(ctx, webhooks.New(u.ID, "https://example.com/other", "s3cr3t", []string{"order", "balance"}))
+	require.NoError(t, err)
+	_, err = repo.Add(ctx, webhooks.New(other.ID, "https://example.org/hook", "s3cr3t", []string{"balance"}))
+	require.NoError(t, err)
+
+	items, err := repo.GetListForUser(ctx, u.ID)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, w1.ID, items[0].ID)
+	assert.Equal(t, "https://example.com/hook", items[0].URL)
+	assert.Equal(t, "s3cr3t", items[0].Secret)
+	assert.Equal(t, []string{"order"}, items[0].Events)
+	assert.True(t, items[0].Enabled)
+	assert.True(t, items[0].DisabledAt.IsZero())
+	assert.Equal(t, w2.ID, items[1].ID)
+	assert.True(t, items[1].Subscribes("balance"))
+	assert.False(t, items[0].Subscribes("balance"))
+
+	require.NoError(t, repo.Delete(ctx, w1.ID))
+	_, err = repo.GetByID(ctx, w1.ID)
+	assert.ErrorIs(t, err, webhooks.ErrWebhookNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, w1.ID), webhooks.ErrWebhookNotFound)
+}
+
+func TestWebhooksDatabase_Failures(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	repo := wdb.New(db)
+	w, _ := repo.Add(ctx, webhooks.New(u.ID, "https://example.com/hook", "s3cr3t", []string{"order"}))
+
+	for i := 1; i <= 2; i++ {
+		failed, err := repo.RecordFailure(ctx, w.ID, 3)
+		require.NoError(t, err)
+		assert.Equal(t, i, failed.ConsecutiveFailures)
+		assert.True(t, failed.Enabled)
+	}
+	// a successful delivery gives the webhook a clean slate
+	require.NoError(t, repo.RecordSuccess(ctx, w.ID))
+	for i := 1; i <= 3; i++ {
+		_, err := repo.RecordFailure(ctx, w.ID, 3)
+		require.NoError(t, err)
+	}
+	disabled, err := repo.GetByID(ctx, w.ID)
+	require.NoError(t, err)
+	assert.False(t, disabled.Enabled)
+	assert.Equal(t, 3, disabled.ConsecutiveFailures)
+	assert.False(t, disabled.DisabledAt.IsZero())
+
+	// further failures do not move the time the webhook has been disabled at
+	failed, err := repo.RecordFailure(ctx, w.ID, 3)
+	require.NoError(t, err)
+	assert.False(t, failed.Enabled)
+	assert.True(t, failed.DisabledAt.Equal(disabled.DisabledAt))
+
+	require.NoError(t, repo.Enable(ctx, w.ID))
+	enabled, _ := repo.GetByID(ctx, w.ID)
+	assert.True(t, enabled.Enabled)
+	assert.Equal(t, 0, enabled.ConsecutiveFailures)
+	assert.True(t, enabled.DisabledAt.IsZero())
+
+	_, err = repo.RecordFailure(ctx, 9999, 3)
+	assert.ErrorIs(t, err, webhooks.ErrWebhookNotFound)
+	assert.ErrorIs(t, repo.Enable(ctx, 9999), webhooks.ErrWebhookNotFound)
+}
@@ -0,0 +1,18 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type Repository interface {
+	Add(context.Context, Webhook) (Webhook, error)
+	GetByID(context.Context, int) (Webhook, error)
+	GetListForUser(context.Context, int) ([]Webhook, error)
+	Delete(context.Context, int) error
+	Enable(context.Context, int) error
+	RecordSuccess(context.Context, int) error
+	RecordFailure(context.Context, int, int) (Webhook, error)
+}
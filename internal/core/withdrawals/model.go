@@ -8,12 +8,23 @@ import (
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
 )
 
+type WithdrawalStatus string
+
+const (
+	WithdrawalStatusProcessed         WithdrawalStatus = "PROCESSED"
+	WithdrawalStatusPartiallyRefunded WithdrawalStatus = "PARTIALLY_REFUNDED"
+	WithdrawalStatusRefunded          WithdrawalStatus = "REFUNDED"
+)
+
 type Withdrawal struct {
 	ID          int
 	User        users.User
 	Number      string
 	Sum         decimal.Decimal
 	ProcessedAt time.Time
+	Status      WithdrawalStatus
+	Refunded    decimal.Decimal
+	RefundedAt  time.Time
 }
 
 var Blank Withdrawal // nolint: gochecknoglobals
@@ -24,6 +35,7 @@ func New(number string, userID int, sum decimal.Decimal) Withdrawal {
 		Number:      number,
 		Sum:         sum,
 		ProcessedAt: time.Now(),
+		Status:      WithdrawalStatusProcessed,
 	}
 }
 
@@ -34,5 +46,19 @@ func NewFromRepo(id int, number string, userID int, sum decimal.Decimal, process
 		Number:      number,
 		Sum:         sum,
 		ProcessedAt: processedAt,
+		Status:      WithdrawalStatusProcessed,
+	}
+}
+
+// Refund returns the withdrawal refunded for the specified amount.
+// The withdrawal is considered refunded in full once the whole sum is returned to the user
+func (w Withdrawal) Refund(amount decimal.Decimal, refundedAt time.Time) Withdrawal {
+	w.Refunded = amount
+	w.RefundedAt = refundedAt
+	if amount.Equal(w.Sum) {
+		w.Status = WithdrawalStatusRefunded
+	} else {
+		w.Status = WithdrawalStatusPartiallyRefunded
 	}
+	return w
 }
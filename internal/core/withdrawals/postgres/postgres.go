@@ -13,12 +13,33 @@ import (
 	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
 )
 
+const withdrawalColumns = "id, processed_at, sum, number, user_id, status, refunded, refunded_at"
+
 type withdrawalRow struct {
 	ID          int
 	UserID      int
 	Number      string
 	Sum         decimal.Decimal
 	ProcessedAt time.Time
+	Status      withdrawals.WithdrawalStatus
+	Refunded    decimal.Decimal
+	RefundedAt  *time.Time
+}
+
+func (row *withdrawalRow) scan(r pgx.Row) error {
+	return r.Scan(
+		&row.ID, &row.ProcessedAt, &row.Sum, &row.Number, &row.UserID, &row.Status, &row.Refunded, &row.RefundedAt,
+	)
+}
+
+func (row withdrawalRow) withdrawal() withdrawals.Withdrawal {
+	w := withdrawals.NewFromRepo(row.ID, row.Number, row.UserID, row.Sum, row.ProcessedAt)
+	w.Status = row.Status
+	w.Refunded = row.Refunded
+	if row.RefundedAt != nil {
+		w.RefundedAt = *row.RefundedAt
+	}
+	return w
 }
 
 type Repository struct {
@@ -57,13 +78,17 @@ func (r Repository) Add(ctx context.Context, cw withdrawals.Withdrawal) (withdra
 
 // GetByNumber attempts to find a withdrawal by an order number associated with it
 func (r Repository) GetByNumber(ctx context.Context, number string) (withdrawals.Withdrawal, error) {
+	return r.getByNumber(ctx, number, "SELECT "+withdrawalColumns+" FROM withdrawals WHERE number = $1")
+}
+
+// GetByNumberForUpdate attempts to find a withdrawal by its order number and lock it until the end of the transaction
+func (r Repository) GetByNumberForUpdate(ctx context.Context, number string) (withdrawals.Withdrawal, error) {
+	return r.getByNumber(ctx, number, "SELECT "+withdrawalColumns+" FROM withdrawals WHERE number = $1 FOR UPDATE")
+}
+
+func (r Repository) getByNumber(ctx context.Context, number string, query string) (withdrawals.Withdrawal, error) {
 	var row withdrawalRow
-	result := r.db.Conn(ctx).QueryRow(
-		ctx,
-		"SELECT id, user_id, sum, processed_at FROM withdrawals WHERE number = $1",
-		number,
-	)
-	if err := result.Scan(&row.ID, &row.UserID, &row.Sum, &row.ProcessedAt); err != nil {
+	if err := row.scan(r.db.Conn(ctx).QueryRow(ctx, query, number)); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Str("number", number).Msg("Withdrawal not found in database")
 			return withdrawals.Blank, withdrawals.ErrWithdrawalNotFound
@@ -71,40 +96,82 @@ func (r Repository) GetByNumber(ctx context.Context, number string) (withdrawals
 		log.Error().Err(err).Str("number", number).Msg("Failed to to retrieve withdrawal by ID")
 		return withdrawals.Blank, err
 	}
-	return withdrawals.NewFromRepo(row.ID, number, row.UserID, row.Sum, row.ProcessedAt), nil
+	return row.withdrawal(), nil
 }
 
-func (r Repository) GetListForUser(ctx context.Context, userID int) ([]withdrawals.Withdrawal, error) {
-	var items []withdrawals.Withdrawal
-	rows, err := r.db.Conn(ctx).Query(
+// GetPageForUser returns a page of the user's withdrawals matching the query.
+// The withdrawals are sorted by their processing time and then by their IDs,
+// so the page following the one ending with a withdrawal starts right after its cursor
+func (r Repository) GetPageForUser(
+	ctx context.Context, userID int, q withdrawals.ListQuery,
+) ([]withdrawals.Withdrawal, error) {
+	var conds postgres.Conditions
+	conds.Where("user_id = " + conds.Arg(userID))
+	if !q.ProcessedFrom.IsZero() {
+		conds.Where("processed_at >= " + conds.Arg(q.ProcessedFrom))
+	}
+	if !q.ProcessedTo.IsZero() {
+		conds.Where("processed_at < " + conds.Arg(q.ProcessedTo))
+	}
+	direction, cmp := "ASC", ">"
+	if q.Descending {
+		direction, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		conds.Where("(processed_at, id) " + cmp + " (" + conds.Arg(q.After.Time) + ", " + conds.Arg(q.After.ID) + ")")
+	}
+	sql := "SELECT " + withdrawalColumns + " FROM withdrawals" + conds.SQL() +
+		" ORDER BY processed_at " + direction + ", id " + direction
+	if q.Limit > 0 {
+		sql += " LIMIT " + conds.Arg(q.Limit)
+	}
+	rows, err := r.db.Conn(ctx).Query(ctx, sql, conds.Args()...)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to query page of withdrawals for user")
+		return nil, err
+	}
+	items, err := scanWithdrawalRows(rows)
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch page of withdrawals for user")
+		return nil, err
+	}
+	return items, nil
+}
+
+// Update saves the refund of the withdrawal.
+// The rest of the withdrawal never changes once it has been registered
+func (r Repository) Update(ctx context.Context, withdrawalID int, w withdrawals.Withdrawal) error {
+	var refundedAt *time.Time
+	if !w.RefundedAt.IsZero() {
+		refundedAt = &w.RefundedAt
+	}
+	res, err := r.db.Conn(ctx).Exec(
 		ctx,
-		"SELECT id, processed_at, sum, number, user_id FROM withdrawals "+
-			"WHERE user_id = $1 ORDER BY processed_at ASC",
-		userID,
+		"UPDATE withdrawals SET status = $1, refunded = $2, refunded_at = $3 WHERE id = $4",
+		w.Status, w.Refunded, refundedAt, withdrawalID,
 	)
 	if err != nil {
-		log.Error().Err(err).Int("userID", userID).Msg("Failed to query withdrawals for user")
-		return nil, err
+		log.Error().Err(err).Int("withdrawalID", withdrawalID).Msg("Failed to update withdrawal")
+		return err
 	}
-	defer rows.Close()
+	if res.RowsAffected() == 0 {
+		return withdrawals.ErrWithdrawalNotFound
+	}
+	return nil
+}
 
+func scanWithdrawalRows(rows pgx.Rows) ([]withdrawals.Withdrawal, error) {
+	var items []withdrawals.Withdrawal
+	defer rows.Close()
 	for rows.Next() {
 		row := withdrawalRow{}
-		err = rows.Scan(&row.ID, &row.ProcessedAt, &row.Sum, &row.Number, &row.UserID)
-		if err != nil {
-			log.Error().Err(err).Int("userID", userID).Msg("Failed to read withdrawals for user")
+		if err := row.scan(rows); err != nil {
 			return nil, err
 		}
-		items = append(
-			items,
-			withdrawals.NewFromRepo(row.ID, row.Number, row.UserID, row.Sum, row.ProcessedAt),
-		)
+		items = append(items, row.withdrawal())
 	}
-	err = rows.Err()
-	if err != nil {
-		log.Error().Err(err).Int("userID", userID).Msg("Failed to fetch withdrawals for user")
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-
 	return items, nil
 }
@@ -113,7 +113,7 @@ func TestWithdrawalsDatabase_Add_ErrorOnNegativeSum(t *testing.T) {
 	}
 }
 
-func TestWithdrawalsDatabase_GetListForUser_OK(t *testing.T) {
+func TestWithdrawalsDatabase_GetPageForUser_Unlimited(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
 
@@ -131,7 +131,7 @@ func TestWithdrawalsDatabase_GetListForUser_OK(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	userWithdrawals, err := repo.GetListForUser(context.TODO(), u.ID)
+	userWithdrawals, err := repo.GetPageForUser(context.TODO(), u.ID, withdrawals.ListQuery{})
 	require.NoError(t, err)
 	assert.Len(t, userWithdrawals, 3)
 	for _, o := range userWithdrawals {
@@ -143,11 +143,57 @@ func TestWithdrawalsDatabase_GetListForUser_OK(t *testing.T) {
 	assert.Equal(t, "49927398716", userWithdrawals[2].Number)
 }
 
-func TestWithdrawalsDatabase_GetListForUser_NoErrorForUnknownUser(t *testing.T) {
+func TestWithdrawalsDatabase_GetPageForUser_NoErrorForUnknownUser(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
 	repo := wdb.New(db)
-	userWithdrawals, err := repo.GetListForUser(context.TODO(), 9999999)
+	userWithdrawals, err := repo.GetPageForUser(context.TODO(), 9999999, withdrawals.ListQuery{})
 	require.NoError(t, err)
 	assert.Len(t, userWithdrawals, 0)
 }
+
+func TestWithdrawalsDatabase_Update_Refund(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	repo := wdb.New(db)
+	w, err := repo.Add(context.TODO(), withdrawals.New("1234567812345670", u.ID, decimal.RequireFromString("9.99")))
+	require.NoError(t, err)
+	assert.Equal(t, withdrawals.WithdrawalStatusProcessed, w.Status)
+	assert.True(t, w.Refunded.IsZero())
+	assert.True(t, w.RefundedAt.IsZero())
+
+	err = db.WithTransaction(context.TODO(), func(txCtx context.Context) error {
+		locked, err := repo.GetByNumberForUpdate(txCtx, "1234567812345670")
+		require.NoError(t, err)
+		assert.Equal(t, w.ID, locked.ID)
+		return repo.Update(txCtx, locked.ID, locked.Refund(decimal.RequireFromString("5"), time.Now()))
+	})
+	require.NoError(t, err)
+
+	w, err = repo.GetByNumber(context.TODO(), "1234567812345670")
+	require.NoError(t, err)
+	assert.Equal(t, withdrawals.WithdrawalStatusPartiallyRefunded, w.Status)
+	assert.Equal(t, "5", w.Refunded.String())
+	assert.Equal(t, "9.99", w.Sum.String())
+	assert.False(t, w.RefundedAt.IsZero())
+
+	err = repo.Update(context.TODO(), w.ID, w.Refund(decimal.RequireFromString("9.99"), time.Now()))
+	require.NoError(t, err)
+	items, _ := repo.GetPageForUser(context.TODO(), u.ID, withdrawals.ListQuery{})
+	require.Len(t, items, 1)
+	assert.Equal(t, withdrawals.WithdrawalStatusRefunded, items[0].Status)
+	assert.Equal(t, "9.99", items[0].Refunded.String())
+
+	// cannot refund more than has been withdrawn
+	err = repo.Update(context.TODO(), w.ID, w.Refund(decimal.RequireFromString("10"), time.Now()))
+	assert.Error(t, err)
+
+	err = repo.Update(context.TODO(), 999999, w)
+	assert.ErrorIs(t, err, withdrawals.ErrWithdrawalNotFound)
+	_, err = repo.GetByNumberForUpdate(context.TODO(), "4561261212345467")
+	assert.ErrorIs(t, err, withdrawals.ErrWithdrawalNotFound)
+}
@@ -3,12 +3,28 @@ package withdrawals
 import (
 	"context"
 	"errors"
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 var ErrWithdrawalNotFound = errors.New("withdrawal not found")
 
+// ListQuery narrows down a user's withdrawals and pages through them.
+// Zero values of the filters are ignored, zero limit returns every matching withdrawal.
+// The withdrawals are sorted by their processing time, oldest first unless Descending is set
+type ListQuery struct {
+	ProcessedFrom time.Time
+	ProcessedTo   time.Time
+	Descending    bool
+	After         *pagination.Cursor
+	Limit         int
+}
+
 type Repository interface {
 	Add(context.Context, Withdrawal) (Withdrawal, error)
 	GetByNumber(context.Context, string) (Withdrawal, error)
-	GetListForUser(context.Context, int) ([]Withdrawal, error)
+	GetByNumberForUpdate(context.Context, string) (Withdrawal, error)
+	GetPageForUser(context.Context, int, ListQuery) ([]Withdrawal, error)
+	Update(context.Context, int, Withdrawal) error
 }
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Conditions builds the WHERE clause of a query out of the optional filters.
+// Every argument passed to the query gets the next positional placeholder
+type Conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+// Arg adds an argument to the query and returns its placeholder
+func (c *Conditions) Arg(value interface{}) string {
+	c.args = append(c.args, value)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+// Where adds a condition that every selected row must satisfy
+func (c *Conditions) Where(clause string) {
+	c.clauses = append(c.clauses, clause)
+}
+
+func (c *Conditions) SQL() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+func (c *Conditions) Args() []interface{} {
+	return c.args
+}
@@ -0,0 +1,21 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+)
+
+func TestConditions(t *testing.T) {
+	var empty postgres.Conditions
+	assert.Equal(t, "", empty.SQL())
+	assert.Len(t, empty.Args(), 0)
+
+	var conds postgres.Conditions
+	conds.Where("user_id = " + conds.Arg(42))
+	conds.Where("(uploaded_at, id) > (" + conds.Arg("2022-03-14") + ", " + conds.Arg(7) + ")")
+	assert.Equal(t, " WHERE user_id = $1 AND (uploaded_at, id) > ($2, $3)", conds.SQL())
+	assert.Equal(t, []interface{}{42, "2022-03-14", 7}, conds.Args())
+}
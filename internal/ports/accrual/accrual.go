@@ -1,20 +1,59 @@
 package accrual
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 )
 
+const (
+	DefaultTimeout        = time.Second * 10
+	DefaultConnectTimeout = time.Second * 3
+)
+
+// Client checks the status of orders with the accrual system
+type Client interface {
+	CheckOrder(context.Context, string) (OrderStatus, error)
+	// Backoff returns the time the caller should wait before sending another request
+	Backoff() time.Duration
+}
+
 type Service struct {
-	url    url.URL
-	client *resty.Client
+	url            url.URL
+	client         *resty.Client
+	timeout        time.Duration
+	connectTimeout time.Duration
+}
+
+type Option func(*Service)
+
+// WithTimeout limits the time a single request to the accrual system may take,
+// including connecting to the system and reading the response
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.timeout = timeout
+		}
+	}
+}
+
+// WithConnectTimeout limits the time spent on establishing a connection to the accrual system
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.connectTimeout = timeout
+		}
+	}
 }
 
 type OrderStatus struct {
@@ -23,7 +62,7 @@ type OrderStatus struct {
 	Accrual decimal.Decimal `json:"accrual"`
 }
 
-func New(address string) (Service, error) {
+func New(address string, opts ...Option) (Service, error) {
 	if address == "" {
 		return Service{}, ErrConfigInvalidAddress
 	}
@@ -31,28 +70,46 @@ func New(address string) (Service, error) {
 	if err != nil {
 		return Service{}, err
 	}
-	return Service{
-		url:    *u,
-		client: resty.New(),
-	}, nil
+	s := Service{
+		url:            *u,
+		timeout:        DefaultTimeout,
+		connectTimeout: DefaultConnectTimeout,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone() // nolint: forcetypeassert
+	transport.DialContext = (&net.Dialer{Timeout: s.connectTimeout}).DialContext
+	s.client = resty.New().SetTransport(transport).SetTimeout(s.timeout)
+	return s, nil
 }
 
-func (s Service) CheckOrder(number string) (OrderStatus, error) {
-	req, endpoint := s.prepareRequest("/api/orders/%s", number)
+// CheckOrder asks the accrual system for the status of the order.
+// The request is aborted once the context is cancelled.
+// In case the accrual system fails to respond in time, TimeoutError is returned
+func (s Service) CheckOrder(ctx context.Context, number string) (OrderStatus, error) {
+	req, endpoint := s.prepareRequest(ctx, "/api/orders/%s", number)
 	resp, err := req.Get(endpoint)
 	if err != nil {
+		// the caller has given up on the request, it's not the accrual system's fault
+		if ctx.Err() != nil {
+			return OrderStatus{}, ctx.Err()
+		}
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return OrderStatus{}, NewErrTimeout(err)
+		}
 		return OrderStatus{}, err
 	}
 	switch resp.StatusCode() {
 	case http.StatusNoContent:
 		return OrderStatus{}, ErrOrderNotFound
 	case http.StatusTooManyRequests:
-		retryAfterVal := resp.Header().Get("Retry-After")
-		retryAfter, convErr := strconv.Atoi(retryAfterVal)
-		if convErr != nil || retryAfter < 0 {
-			return OrderStatus{}, ErrRespInvalidWaitTime
+		retryAfter, parseErr := parseRetryAfter(resp.Header().Get("Retry-After"))
+		if parseErr != nil {
+			return OrderStatus{}, parseErr
 		}
-		return OrderStatus{}, NewErrTooManyRequests(uint(retryAfter))
+		return OrderStatus{}, NewErrTooManyRequests(retryAfter)
 	case http.StatusOK:
 		var os OrderStatus
 		if jsonErr := json.Unmarshal(resp.Body(), &os); jsonErr != nil {
@@ -65,10 +122,38 @@ func (s Service) CheckOrder(number string) (OrderStatus, error) {
 	}
 }
 
-func (s Service) prepareRequest(uri string, args ...interface{}) (*resty.Request, string) {
+// Backoff always lets the requests through, the plain client has no reasons to hold them off
+func (s Service) Backoff() time.Duration {
+	return 0
+}
+
+// parseRetryAfter converts the value of the Retry-After header into the number of seconds to wait.
+// The header may contain either the number of seconds or the date after which the request can be retried.
+// A date in the past means that there is no need to wait
+func parseRetryAfter(value string) (uint, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, ErrRespInvalidWaitTime
+		}
+		return uint(seconds), nil
+	}
+	retryAt, err := http.ParseTime(value)
+	if err != nil {
+		return 0, ErrRespInvalidWaitTime
+	}
+	wait := time.Until(retryAt)
+	if wait <= 0 {
+		return 0, nil
+	}
+	// round up, so that the request is not retried too early
+	return uint((wait + time.Second - 1) / time.Second), nil
+}
+
+func (s Service) prepareRequest(ctx context.Context, uri string, args ...interface{}) (*resty.Request, string) {
 	endpoint := s.url
 	endpoint.Path = fmt.Sprintf(uri, args...)
 	req := s.client.R().
+		SetContext(ctx).
 		SetHeader("Accept", "application/json").
 		SetHeader("Content-Type", "application/json")
 	return req, endpoint.String()
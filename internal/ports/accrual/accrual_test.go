@@ -1,8 +1,12 @@
 package accrual_test
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
@@ -77,7 +81,7 @@ func TestService_CheckOrder(t *testing.T) {
 			ts := httptest.NewServer(r)
 			service, err := accrual.New(ts.URL)
 			require.NoError(t, err)
-			os, err := service.CheckOrder("79927398713")
+			os, err := service.CheckOrder(context.TODO(), "79927398713")
 			if tt.wantErr != nil {
 				assert.Error(t, err, tt.wantErr)
 			} else {
@@ -132,7 +136,7 @@ func TestService_CheckOrder_RetryAfter(t *testing.T) {
 			ts := httptest.NewServer(r)
 			service, err := accrual.New(ts.URL)
 			require.NoError(t, err)
-			_, err = service.CheckOrder("79927398713")
+			_, err = service.CheckOrder(context.TODO(), "79927398713")
 			require.Error(t, err)
 			if tt.want {
 				tooManyReqs, ok := err.(*accrual.TooManyRequestError) // nolint: errorlint
@@ -145,6 +149,42 @@ func TestService_CheckOrder_RetryAfter(t *testing.T) {
 	}
 }
 
+func TestService_CheckOrder_RetryAfterDate(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryAt   time.Time
+		wantRetry float64
+	}{
+		{
+			"date in the future",
+			time.Now().Add(time.Minute * 2),
+			120,
+		},
+		{
+			"date in the past",
+			time.Now().Add(-time.Minute),
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/api/orders/:order", func(c *gin.Context) {
+				c.Header("Retry-After", tt.retryAt.UTC().Format(http.TimeFormat))
+				c.Status(429)
+			})
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			service, err := accrual.New(ts.URL)
+			require.NoError(t, err)
+			_, err = service.CheckOrder(context.TODO(), "79927398713")
+			var tooManyReqs *accrual.TooManyRequestError
+			require.ErrorAs(t, err, &tooManyReqs)
+			assert.InDelta(t, tt.wantRetry, float64(tooManyReqs.RetryAfter), 1)
+		})
+	}
+}
+
 func TestService_New_Validation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -178,3 +218,50 @@ func TestService_New_Validation(t *testing.T) {
 		})
 	}
 }
+
+func TestService_CheckOrder_Timeout(t *testing.T) {
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(time.Second):
+		}
+		c.Status(204)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	service, err := accrual.New(ts.URL, accrual.WithTimeout(time.Millisecond*50))
+	require.NoError(t, err)
+	before := time.Now()
+	_, err = service.CheckOrder(context.TODO(), "79927398713")
+	require.Error(t, err)
+	assert.Less(t, time.Since(before), time.Second)
+	var timeout *accrual.TimeoutError
+	assert.ErrorAs(t, err, &timeout)
+}
+
+func TestService_CheckOrder_Cancelled(t *testing.T) {
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(time.Second):
+		}
+		c.Status(204)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	service, err := accrual.New(ts.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*50)
+	defer cancel()
+	before := time.Now()
+	_, err = service.CheckOrder(ctx, "79927398713")
+	assert.Less(t, time.Since(before), time.Second)
+	// the caller has given up on the request, so it's not reported as the accrual system's timeout
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var timeout *accrual.TimeoutError
+	assert.False(t, errors.As(err, &timeout))
+}
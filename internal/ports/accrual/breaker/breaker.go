@@ -0,0 +1,215 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+)
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultCoolDown         = time.Second * 30
+	// probeBackoff is the time other callers hold off while a single probe request is in flight
+	probeBackoff = time.Millisecond * 100
+)
+
+type State string
+
+const (
+	// StateClosed lets every request through
+	StateClosed State = "closed"
+	// StateOpen rejects every request until the cool-down has passed
+	StateOpen State = "open"
+	// StateHalfOpen lets a single probe request through to decide whether the accrual system has recovered
+	StateHalfOpen State = "half-open"
+)
+
+// Stats is a snapshot of the breaker's state
+type Stats struct {
+	State    State
+	Failures int
+	OpenedAt time.Time
+	RetryIn  time.Duration
+}
+
+type Breaker struct {
+	client    accrual.Client
+	threshold int
+	coolDown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	mu        sync.Mutex
+}
+
+type Option func(*Breaker)
+
+// WithFailureThreshold configures the number of consecutive failures that open the breaker
+func WithFailureThreshold(threshold int) Option {
+	return func(b *Breaker) {
+		if threshold > 0 {
+			b.threshold = threshold
+		}
+	}
+}
+
+// WithCoolDown configures the time the breaker stays open before letting a probe request through
+func WithCoolDown(coolDown time.Duration) Option {
+	return func(b *Breaker) {
+		if coolDown > 0 {
+			b.coolDown = coolDown
+		}
+	}
+}
+
+// New wraps the accrual client with a circuit breaker.
+// Once the accrual system fails the configured number of times in a row,
+// the breaker opens and rejects the requests with accrual.ErrCircuitOpen without calling the system,
+// until the cool-down has passed. Then a single probe request is let through.
+// The breaker closes if the probe succeeds, otherwise it opens again
+func New(client accrual.Client, opts ...Option) *Breaker {
+	b := &Breaker{
+		client:    client,
+		threshold: DefaultFailureThreshold,
+		coolDown:  DefaultCoolDown,
+		state:     StateClosed,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *Breaker) CheckOrder(ctx context.Context, number string) (accrual.OrderStatus, error) {
+	allowed, probe := b.allow()
+	if !allowed {
+		return accrual.OrderStatus{}, accrual.ErrCircuitOpen
+	}
+	os, err := b.client.CheckOrder(ctx, number)
+	b.record(ctx, err, probe)
+	return os, err
+}
+
+// Backoff returns the time left until the breaker lets requests through again
+func (b *Breaker) Backoff() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := b.client.Backoff(); wait > 0 {
+		return wait
+	}
+	switch b.state {
+	case StateOpen:
+		if wait := time.Until(b.openedAt.Add(b.coolDown)); wait > 0 {
+			return wait
+		}
+	case StateHalfOpen:
+		if b.probing {
+			return probeBackoff
+		}
+	case StateClosed:
+	}
+	return 0
+}
+
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := Stats{
+		State:    b.state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+	if b.state == StateOpen {
+		if retryIn := time.Until(b.openedAt.Add(b.coolDown)); retryIn > 0 {
+			stats.RetryIn = retryIn
+		}
+	}
+	return stats
+}
+
+// allow tells whether a request may be sent to the accrual system.
+// An open breaker whose cool-down has passed turns half-open and lets the calling request through as a probe
+func (b *Breaker) allow() (allowed bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if time.Now().Before(b.openedAt.Add(b.coolDown)) {
+			return false, false
+		}
+		b.transition(StateHalfOpen)
+		b.probing = true
+		return true, true
+	case StateHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	case StateClosed:
+	}
+	return true, false
+}
+
+// record updates the breaker's state with the outcome of a request
+func (b *Breaker) record(ctx context.Context, err error, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		// the probe has been abandoned by the caller, let the next request probe again
+		if ctx.Err() != nil {
+			return
+		}
+	} else if b.state != StateClosed {
+		// the outcome of a request sent before the breaker has opened is of no interest anymore
+		return
+	}
+	if !isFailure(ctx, err) {
+		b.failures = 0
+		b.transition(StateClosed)
+		return
+	}
+	b.failures++
+	if probe || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.transition(StateOpen)
+	}
+}
+
+func (b *Breaker) transition(state State) {
+	if b.state == state {
+		return
+	}
+	logEvent := log.Info()
+	if state == StateOpen {
+		logEvent = log.Warn().Dur("coolDown", b.coolDown)
+	}
+	logEvent.
+		Str("from", string(b.state)).Str("to", string(state)).Int("failures", b.failures).
+		Msg("Accrual circuit breaker state changed")
+	b.state = state
+}
+
+// isFailure tells whether the error is caused by the accrual system being unhealthy.
+// Answers that the system gives on purpose, such as an unknown order or a request to slow down,
+// as well as the requests abandoned by the caller, do not count
+func isFailure(ctx context.Context, err error) bool {
+	var tooManyReqs *accrual.TooManyRequestError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, accrual.ErrOrderNotFound), errors.As(err, &tooManyReqs):
+		return false
+	case ctx.Err() != nil:
+		return false
+	default:
+		return true
+	}
+}
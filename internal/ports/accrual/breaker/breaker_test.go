@@ -0,0 +1,175 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+type fakeClient struct {
+	errs  []error
+	calls int
+	mu    sync.Mutex
+}
+
+func (c *fakeClient) CheckOrder(ctx context.Context, number string) (accrual.OrderStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if len(c.errs) == 0 {
+		return accrual.OrderStatus{Number: number, Status: "PROCESSED"}, nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return accrual.OrderStatus{}, err
+}
+
+func (c *fakeClient) Backoff() time.Duration {
+	return 0
+}
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	client := &fakeClient{errs: []error{errUnavailable, errUnavailable, errUnavailable}}
+	b := breaker.New(client, breaker.WithFailureThreshold(3), breaker.WithCoolDown(time.Minute))
+
+	for i := 1; i <= 2; i++ {
+		_, err := b.CheckOrder(context.TODO(), "79927398713")
+		assert.ErrorIs(t, err, errUnavailable)
+		assert.Equal(t, breaker.StateClosed, b.Stats().State)
+		assert.Equal(t, i, b.Stats().Failures)
+		assert.Equal(t, time.Duration(0), b.Backoff())
+	}
+
+	_, err := b.CheckOrder(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, errUnavailable)
+	stats := b.Stats()
+	assert.Equal(t, breaker.StateOpen, stats.State)
+	assert.Equal(t, 3, stats.Failures)
+	assert.False(t, stats.OpenedAt.IsZero())
+	assert.True(t, stats.RetryIn > time.Second*59)
+	assert.True(t, b.Backoff() > time.Second*59)
+
+	// the accrual system is not called while the breaker is open
+	_, err = b.CheckOrder(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, accrual.ErrCircuitOpen)
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	client := &fakeClient{errs: []error{errUnavailable, errUnavailable, nil, errUnavailable, errUnavailable}}
+	b := breaker.New(client, breaker.WithFailureThreshold(3))
+	for i := 0; i < 5; i++ {
+		b.CheckOrder(context.TODO(), "79927398713") // nolint: errcheck
+	}
+	assert.Equal(t, breaker.StateClosed, b.Stats().State)
+	assert.Equal(t, 2, b.Stats().Failures)
+}
+
+func TestBreaker_IgnoresExpectedErrors(t *testing.T) {
+	client := &fakeClient{errs: []error{
+		accrual.ErrOrderNotFound,
+		accrual.NewErrTooManyRequests(60),
+		context.Canceled,
+	}}
+	b := breaker.New(client, breaker.WithFailureThreshold(1))
+
+	_, err := b.CheckOrder(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, accrual.ErrOrderNotFound)
+	_, err = b.CheckOrder(context.TODO(), "79927398713")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err = b.CheckOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, breaker.StateClosed, b.Stats().State)
+	assert.Equal(t, 0, b.Stats().Failures)
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probeErr  error
+		wantState breaker.State
+	}{
+		{
+			"probe succeeds",
+			nil,
+			breaker.StateClosed,
+		},
+		{
+			"probe fails",
+			accrual.NewErrTimeout(errUnavailable),
+			breaker.StateOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{errs: []error{errUnavailable, tt.probeErr}}
+			b := breaker.New(client, breaker.WithFailureThreshold(1), breaker.WithCoolDown(time.Millisecond*50))
+			b.CheckOrder(context.TODO(), "79927398713") // nolint: errcheck
+			require.Equal(t, breaker.StateOpen, b.Stats().State)
+
+			<-time.After(time.Millisecond * 100)
+			assert.Equal(t, time.Duration(0), b.Backoff())
+			b.CheckOrder(context.TODO(), "79927398713") // nolint: errcheck
+			assert.Equal(t, 2, client.calls)
+			assert.Equal(t, tt.wantState, b.Stats().State)
+		})
+	}
+}
+
+// blockingClient fails the first request and then blocks every request until released
+type blockingClient struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (c *blockingClient) CheckOrder(ctx context.Context, number string) (accrual.OrderStatus, error) {
+	if atomic.AddInt32(&c.calls, 1) == 1 {
+		return accrual.OrderStatus{}, errUnavailable
+	}
+	<-c.release
+	return accrual.OrderStatus{Number: number, Status: "PROCESSED"}, nil
+}
+
+func (c *blockingClient) Backoff() time.Duration {
+	return 0
+}
+
+func TestBreaker_HalfOpen_SingleProbe(t *testing.T) {
+	client := &blockingClient{release: make(chan struct{})}
+	b := breaker.New(client, breaker.WithFailureThreshold(1), breaker.WithCoolDown(time.Millisecond*50))
+	b.CheckOrder(context.TODO(), "79927398713") // nolint: errcheck
+	<-time.After(time.Millisecond * 100)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.CheckOrder(context.TODO(), "79927398713") // nolint: errcheck
+	}()
+	<-time.After(time.Millisecond * 50)
+	assert.Equal(t, breaker.StateHalfOpen, b.Stats().State)
+	assert.True(t, b.Backoff() > 0)
+	// only one probe is let through at a time
+	_, err := b.CheckOrder(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, accrual.ErrCircuitOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&client.calls))
+
+	close(client.release)
+	<-done
+	assert.Equal(t, breaker.StateClosed, b.Stats().State)
+	assert.Equal(t, time.Duration(0), b.Backoff())
+}
@@ -10,6 +10,7 @@ var ErrRespInvalidWaitTime = errors.New("Retry-After header is missing or has in
 var ErrRespInvalidStatus = errors.New("invalid response from accrual system")
 var ErrRespInvalidData = errors.New("unexpected data from accrual system")
 var ErrOrderNotFound = errors.New("order not found in accrual system")
+var ErrCircuitOpen = errors.New("accrual system is unavailable, circuit breaker is open")
 
 type TooManyRequestError struct {
 	RetryAfter uint
@@ -22,3 +23,20 @@ func NewErrTooManyRequests(retryAfter uint) error {
 func (err TooManyRequestError) Error() string {
 	return fmt.Sprintf("retry after: %d", err.RetryAfter)
 }
+
+// TimeoutError is returned when the accrual system fails to respond in time
+type TimeoutError struct {
+	Err error
+}
+
+func NewErrTimeout(err error) error {
+	return &TimeoutError{err}
+}
+
+func (err TimeoutError) Error() string {
+	return fmt.Sprintf("accrual system has timed out: %s", err.Err)
+}
+
+func (err TimeoutError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,147 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+)
+
+type Limiter struct {
+	client accrual.Client
+	// rate is the number of requests per second, zero means no limit
+	rate        float64
+	burst       int
+	tokens      float64
+	refilledAt  time.Time
+	pausedUntil time.Time
+	mu          sync.Mutex
+}
+
+type Option func(*Limiter)
+
+// WithRate limits the number of requests sent to the accrual system per second
+func WithRate(rps float64) Option {
+	return func(l *Limiter) {
+		if rps > 0 {
+			l.rate = rps
+		}
+	}
+}
+
+// WithBurst configures the number of requests that may be sent at once after a period of inactivity.
+// Unless configured, the burst matches the rate, but is never less than a single request
+func WithBurst(burst int) Option {
+	return func(l *Limiter) {
+		if burst > 0 {
+			l.burst = burst
+		}
+	}
+}
+
+// New wraps the accrual client with a token bucket rate limiter shared by every caller in the process.
+// The bucket holds up to the burst number of tokens and is refilled at the configured rate,
+// every request to the accrual system takes a token or waits until one is available.
+// Once the accrual system asks to slow down, the bucket is emptied and stays paused
+// for the time specified in the system's response, so that no caller sends requests in the meantime
+func New(client accrual.Client, opts ...Option) *Limiter {
+	l := &Limiter{client: client}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.burst == 0 {
+		l.burst = int(math.Max(1, math.Ceil(l.rate)))
+	}
+	l.tokens = float64(l.burst)
+	l.refilledAt = time.Now()
+	return l
+}
+
+// CheckOrder waits for the limiter to let the request through and then sends it to the accrual system.
+// The wait is aborted once the context is cancelled
+func (l *Limiter) CheckOrder(ctx context.Context, number string) (accrual.OrderStatus, error) {
+	if err := l.wait(ctx); err != nil {
+		return accrual.OrderStatus{}, err
+	}
+	os, err := l.client.CheckOrder(ctx, number)
+	var tooManyReqs *accrual.TooManyRequestError
+	if errors.As(err, &tooManyReqs) {
+		l.Pause(time.Second * time.Duration(tooManyReqs.RetryAfter))
+	}
+	return os, err
+}
+
+// Backoff returns the time left until the limiter lets the next request through
+func (l *Limiter) Backoff() time.Duration {
+	wait := l.client.Backoff()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if own := l.delay(time.Now()); own > wait {
+		return own
+	}
+	return wait
+}
+
+// Pause holds off every request for the specified time.
+// The pause never shortens the one that is already in effect
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if !until.After(l.pausedUntil) {
+		return
+	}
+	log.Info().Dur("wait", d).Msg("Requests to accrual system are paused")
+	l.pausedUntil = until
+	// do not let the accumulated requests rush in at once after the pause
+	l.tokens = 0
+	l.refilledAt = until
+}
+
+// wait blocks until a token is available and takes it
+func (l *Limiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		delay := l.delay(now)
+		if delay == 0 {
+			if l.rate > 0 {
+				l.tokens--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay refills the bucket and returns the time left until a token is available.
+// Must be called with the mutex held
+func (l *Limiter) delay(now time.Time) time.Duration {
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	if now.After(l.refilledAt) {
+		l.tokens = math.Min(float64(l.burst), l.tokens+now.Sub(l.refilledAt).Seconds()*l.rate)
+		l.refilledAt = now
+	}
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+package limiter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/limiter"
+)
+
+type fakeClient struct {
+	errs    []error
+	calls   int
+	backoff time.Duration
+	mu      sync.Mutex
+}
+
+func (c *fakeClient) CheckOrder(ctx context.Context, number string) (accrual.OrderStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if len(c.errs) == 0 {
+		return accrual.OrderStatus{Number: number, Status: "PROCESSED"}, nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return accrual.OrderStatus{}, err
+}
+
+func (c *fakeClient) Backoff() time.Duration {
+	return c.backoff
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	client := &fakeClient{}
+	l := limiter.New(client)
+	for i := 0; i < 100; i++ {
+		_, err := l.CheckOrder(context.TODO(), "79927398713")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 100, client.calls)
+	assert.Equal(t, time.Duration(0), l.Backoff())
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	client := &fakeClient{}
+	l := limiter.New(client, limiter.WithRate(10), limiter.WithBurst(3))
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := l.CheckOrder(context.TODO(), "79927398713")
+		require.NoError(t, err)
+	}
+	assert.True(t, time.Since(started) < time.Millisecond*50)
+	// the bucket is empty, the next token is available in 1/10 of a second
+	backoff := l.Backoff()
+	assert.True(t, backoff > time.Millisecond*50 && backoff <= time.Millisecond*100, backoff)
+
+	_, err := l.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.True(t, time.Since(started) >= time.Millisecond*50)
+	assert.Equal(t, 4, client.calls)
+}
+
+func TestLimiter_Cancelled(t *testing.T) {
+	client := &fakeClient{}
+	l := limiter.New(client, limiter.WithRate(0.1))
+	_, err := l.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = l.CheckOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, client.calls)
+}
+
+func TestLimiter_RetryAfterPausesEveryone(t *testing.T) {
+	client := &fakeClient{errs: []error{accrual.NewErrTooManyRequests(60)}}
+	l := limiter.New(client, limiter.WithRate(100))
+
+	_, err := l.CheckOrder(context.TODO(), "79927398713")
+	var tooManyReqs *accrual.TooManyRequestError
+	require.ErrorAs(t, err, &tooManyReqs)
+	assert.True(t, l.Backoff() > time.Second*59)
+
+	// a shorter pause does not override the longer one
+	l.Pause(time.Second)
+	assert.True(t, l.Backoff() > time.Second*59)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = l.CheckOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, client.calls)
+}
+
+func TestLimiter_PauseExpires(t *testing.T) {
+	client := &fakeClient{}
+	l := limiter.New(client)
+	l.Pause(time.Millisecond * 50)
+	assert.True(t, l.Backoff() > 0)
+
+	started := time.Now()
+	_, err := l.CheckOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.True(t, time.Since(started) >= time.Millisecond*40)
+	assert.Equal(t, time.Duration(0), l.Backoff())
+}
+
+func TestLimiter_Backoff_Inner(t *testing.T) {
+	client := &fakeClient{backoff: time.Minute}
+	l := limiter.New(client, limiter.WithRate(10))
+	assert.Equal(t, time.Minute, l.Backoff())
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+)
+
+const DefaultBufferSize = 16
+
+// Broker fans out events to the subscribers within the same process.
+// Every subscriber has a buffer of its own, so a slow subscriber never holds off the publishers
+// nor the other subscribers. Once the buffer is full, the events are dropped for that subscriber
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[int]map[*subscription]struct{}
+	bufferSize  int
+}
+
+type subscription struct {
+	broker *Broker
+	userID int
+	events chan pubsub.Event
+	once   sync.Once
+}
+
+func New(bufferSize int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{
+		subscribers: make(map[int]map[*subscription]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, e pubsub.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[e.UserID] {
+		select {
+		case sub.events <- e:
+		default:
+			log.Warn().Int("userID", e.UserID).Str("type", string(e.Type)).Msg("Dropping event for slow subscriber")
+		}
+	}
+	return nil
+}
+
+// Subscribe starts receiving the user's events.
+// The subscription must be closed once it is no longer needed
+func (b *Broker) Subscribe(ctx context.Context, userID int) (pubsub.Subscription, error) {
+	sub := &subscription{
+		broker: b,
+		userID: userID,
+		events: make(chan pubsub.Event, b.bufferSize),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*subscription]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+	return sub, nil
+}
+
+// Subscribers returns the number of the user's current subscriptions
+func (b *Broker) Subscribers(userID int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[userID])
+}
+
+func (b *Broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers[sub.userID], sub)
+	if len(b.subscribers[sub.userID]) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+func (s *subscription) Events() <-chan pubsub.Event {
+	return s.events
+}
+
+// Close stops the subscription and closes its channel. It is safe to close a subscription more than once
+func (s *subscription) Close() {
+	s.once.Do(func() {
+		s.broker.unsubscribe(s)
+	})
+}
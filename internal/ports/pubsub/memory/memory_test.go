@@ -0,0 +1,69 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub/memory"
+)
+
+func TestBroker_FanOut(t *testing.T) {
+	ctx := context.TODO()
+	b := memory.New(4)
+	first, err := b.Subscribe(ctx, 1)
+	require.NoError(t, err)
+	second, err := b.Subscribe(ctx, 1)
+	require.NoError(t, err)
+	other, err := b.Subscribe(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, b.Subscribers(1))
+
+	e := pubsub.NewOrderEvent(1, "79927398713", "PROCESSED", decimal.NewFromInt(100))
+	require.NoError(t, b.Publish(ctx, e))
+	for _, sub := range []pubsub.Subscription{first, second} {
+		got := <-sub.Events()
+		assert.Equal(t, pubsub.EventOrderStatus, got.Type)
+		assert.Equal(t, "79927398713", got.Order.Number)
+		assert.Equal(t, "100", got.Order.Accrual.String())
+	}
+	// other users are not notified
+	assert.Len(t, other.Events(), 0)
+
+	// events of users without subscribers are dropped
+	require.NoError(t, b.Publish(ctx, pubsub.NewBalanceEvent(3, decimal.Zero, decimal.Zero, decimal.Zero)))
+}
+
+func TestBroker_Close(t *testing.T) {
+	ctx := context.TODO()
+	b := memory.New(4)
+	sub, _ := b.Subscribe(ctx, 1)
+	sub.Close()
+	sub.Close()
+	assert.Equal(t, 0, b.Subscribers(1))
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	require.NoError(t, b.Publish(ctx, pubsub.NewBalanceEvent(1, decimal.Zero, decimal.Zero, decimal.Zero)))
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	ctx := context.TODO()
+	b := memory.New(2)
+	slow, _ := b.Subscribe(ctx, 1)
+	for i := 0; i < 5; i++ {
+		e := pubsub.NewBalanceEvent(1, decimal.NewFromInt(int64(i)), decimal.Zero, decimal.Zero)
+		require.NoError(t, b.Publish(ctx, e))
+	}
+	// the events that do not fit into the buffer are dropped
+	assert.Len(t, slow.Events(), 2)
+	assert.Equal(t, "0", (<-slow.Events()).Balance.Current.String())
+	assert.Equal(t, "1", (<-slow.Events()).Balance.Current.String())
+
+	fast, _ := b.Subscribe(ctx, 1)
+	require.NoError(t, b.Publish(ctx, pubsub.NewBalanceEvent(1, decimal.NewFromInt(10), decimal.Zero, decimal.Zero)))
+	assert.Equal(t, "10", (<-fast.Events()).Balance.Current.String())
+}
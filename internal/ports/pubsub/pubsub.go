@@ -0,0 +1,102 @@
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type EventType string
+
+const (
+	// EventOrderStatus is published once an order has moved to another status
+	EventOrderStatus EventType = "order"
+	// EventBalance is published once a user's balance has changed
+	EventBalance EventType = "balance"
+)
+
+type OrderUpdate struct {
+	Number  string          `json:"number"`
+	Status  string          `json:"status"`
+	Accrual decimal.Decimal `json:"accrual"`
+}
+
+type BalanceUpdate struct {
+	Current   decimal.Decimal `json:"current"`
+	Withdrawn decimal.Decimal `json:"withdrawn"`
+	Held      decimal.Decimal `json:"held"`
+}
+
+// Event is a change that concerns a single user.
+// The event is serializable, so it may be passed between the instances of the service
+type Event struct {
+	Type      EventType      `json:"type"`
+	UserID    int            `json:"user_id"` // nolint: tagliatelle
+	Order     *OrderUpdate   `json:"order,omitempty"`
+	Balance   *BalanceUpdate `json:"balance,omitempty"`
+	CreatedAt time.Time      `json:"created_at"` // nolint: tagliatelle
+}
+
+func NewOrderEvent(userID int, number, status string, accrual decimal.Decimal) Event {
+	return Event{
+		Type:      EventOrderStatus,
+		UserID:    userID,
+		Order:     &OrderUpdate{number, status, accrual},
+		CreatedAt: time.Now(),
+	}
+}
+
+func NewBalanceEvent(userID int, current, withdrawn, held decimal.Decimal) Event {
+	return Event{
+		Type:      EventBalance,
+		UserID:    userID,
+		Balance:   &BalanceUpdate{current, withdrawn, held},
+		CreatedAt: time.Now(),
+	}
+}
+
+type Publisher interface {
+	// Publish delivers the event to the user's current subscribers.
+	// The events are delivered at most once, the users that are not subscribed miss the event
+	Publish(context.Context, Event) error
+}
+
+// Subscription receives the events of a single user until it is closed
+type Subscription interface {
+	Events() <-chan Event
+	Close()
+}
+
+type Broker interface {
+	Publisher
+	Subscribe(context.Context, int) (Subscription, error)
+}
+
+type discard struct{}
+
+func (discard) Publish(context.Context, Event) error {
+	return nil
+}
+
+// Discard is a publisher that drops all events.
+// The services use it unless they are given a publisher
+var Discard Publisher = discard{} // nolint: gochecknoglobals
+
+type fanout []Publisher
+
+// Fanout is a publisher that passes events to all the given publishers.
+// An event is passed to every publisher even if some of them fail, the first error is returned
+func Fanout(publishers ...Publisher) Publisher {
+	return fanout(publishers)
+}
+
+func (f fanout) Publish(ctx context.Context, e Event) error {
+	var firstErr error
+	for _, p := range f {
+		if err := p.Publish(ctx, e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
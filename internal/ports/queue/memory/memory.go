@@ -3,63 +3,181 @@ package memory
 import (
 	"context"
 	"errors"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
 )
 
+type item struct {
+	orderNumber string
+	visibleAt   time.Time
+	leaseID     string
+}
+
 type Queue struct {
-	queue   []string
+	items   []*item
 	maxSize int
-	size    int
-	head    int
-	tail    int
+	leases  uint64
 	mu      sync.Mutex
 }
 
 var ErrSizeIsInvalid = errors.New("queue cannot be of this size")
 
-// New initializes a fixed size queue based on the ring buffer algorithm.
-// The queue holds order numbers that await processing in the accrual system
+// DefaultSize is the size of the queue unless configured otherwise
+const DefaultSize = 100
+
+// New initializes a fixed size queue.
+// The queue holds order numbers that await processing in the accrual system.
+// Leased and delayed order numbers still occupy the space in the queue
 func New(size int) (*Queue, error) {
 	if size <= 0 {
 		return nil, ErrSizeIsInvalid
 	}
 	q := Queue{
-		queue:   make([]string, size),
+		items:   make([]*item, 0, size),
 		maxSize: size,
-		head:    0,
-		tail:    0,
-		size:    0,
 	}
 	return &q, nil
 }
 
+// Push appends an order number to the tail of the queue.
+// Pushing an order number that is already queued is a no-op, even if the queue is full
 func (q *Queue) Push(ctx context.Context, orderNumber string) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	if q.size >= q.maxSize {
+	if q.find(orderNumber) >= 0 {
+		return nil
+	}
+	if len(q.items) >= q.maxSize {
 		return queue.ErrQueueIsFull
 	}
-	q.queue[q.tail] = orderNumber
-	q.size++
-	q.tail = (q.tail + 1) % q.maxSize
+	q.items = append(q.items, &item{orderNumber: orderNumber})
 	return nil
 }
 
 func (q *Queue) Pop(ctx context.Context) (string, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	if q.size == 0 {
+	idx := q.nextVisible(time.Now())
+	if idx < 0 {
 		return "", queue.ErrQueueIsEmpty
 	}
-	orderNumber := q.queue[q.head]
-	q.queue[q.head] = ""
-	q.head = (q.head + 1) % q.maxSize
-	q.size--
+	orderNumber := q.items[idx].orderNumber
+	q.remove(idx)
 	return orderNumber, nil
 }
 
+func (q *Queue) Lease(ctx context.Context, visibility time.Duration) (queue.Lease, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	idx := q.nextVisible(now)
+	if idx < 0 {
+		return queue.Lease{}, queue.ErrQueueIsEmpty
+	}
+	q.leases++
+	it := q.items[idx]
+	it.leaseID = strconv.FormatUint(q.leases, 10)
+	it.visibleAt = now.Add(visibility)
+	return queue.Lease{ID: it.leaseID, OrderNumber: it.orderNumber}, nil
+}
+
+func (q *Queue) Ack(ctx context.Context, lease queue.Lease) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	idx := q.findLease(lease)
+	if idx < 0 {
+		return queue.ErrLeaseNotFound
+	}
+	q.remove(idx)
+	return nil
+}
+
+// Nack returns the leased order number to the tail of the queue
+func (q *Queue) Nack(ctx context.Context, lease queue.Lease, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	idx := q.findLease(lease)
+	if idx < 0 {
+		return queue.ErrLeaseNotFound
+	}
+	it := q.items[idx]
+	q.remove(idx)
+	it.leaseID = ""
+	it.visibleAt = time.Now().Add(delay)
+	q.items = append(q.items, it)
+	return nil
+}
+
+// Position counts the order numbers delivered before the given one.
+// An order number is delivered earlier if it becomes visible earlier,
+// or if it becomes visible at the same time but has been queued earlier
+func (q *Queue) Position(ctx context.Context, orderNumber string) (queue.Position, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	idx := q.find(orderNumber)
+	if idx < 0 {
+		return queue.Position{}, queue.ErrNotQueued
+	}
+	visibleAt := effectiveVisibility(q.items[idx], now)
+	pos := queue.Position{VisibleAt: q.items[idx].visibleAt}
+	for i, it := range q.items {
+		other := effectiveVisibility(it, now)
+		if other.Before(visibleAt) || (i < idx && other.Equal(visibleAt)) {
+			pos.Ahead++
+		}
+	}
+	return pos, nil
+}
+
 func (q *Queue) Len(ctx context.Context) (int, error) {
-	return q.size, nil
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items), nil
+}
+
+// nextVisible returns the index of the oldest item that is neither leased nor delayed.
+// Items with expired leases are visible again
+func (q *Queue) nextVisible(now time.Time) int {
+	for i, it := range q.items {
+		if !it.visibleAt.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// effectiveVisibility treats every visible item as the one that has become visible right now
+func effectiveVisibility(it *item, now time.Time) time.Time {
+	if it.visibleAt.After(now) {
+		return it.visibleAt
+	}
+	return now
+}
+
+func (q *Queue) find(orderNumber string) int {
+	for i, it := range q.items {
+		if it.orderNumber == orderNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *Queue) findLease(lease queue.Lease) int {
+	for i, it := range q.items {
+		if it.leaseID != "" && it.leaseID == lease.ID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *Queue) remove(idx int) {
+	copy(q.items[idx:], q.items[idx+1:])
+	q.items[len(q.items)-1] = nil
+	q.items = q.items[:len(q.items)-1]
 }
@@ -0,0 +1,137 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue/memory"
+)
+
+func TestQueue_New_Validation(t *testing.T) {
+	for _, size := range []int{-1, 0} {
+		_, err := memory.New(size)
+		assert.ErrorIs(t, err, memory.ErrSizeIsInvalid)
+	}
+	q, err := memory.New(1)
+	require.NoError(t, err)
+	assert.NotNil(t, q)
+}
+
+func TestQueue_PushPop_FIFO(t *testing.T) {
+	q, _ := memory.New(3)
+	ctx := context.TODO()
+
+	for _, number := range []string{"1234567812345670", "4561261212345467", "79927398713"} {
+		require.NoError(t, q.Push(ctx, number))
+	}
+	assert.ErrorIs(t, q.Push(ctx, "49927398716"), queue.ErrQueueIsFull)
+
+	for _, want := range []string{"1234567812345670", "4561261212345467", "79927398713"} {
+		number, err := q.Pop(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, number)
+	}
+	_, err := q.Pop(ctx)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+}
+
+func TestQueue_Lease_AckNack(t *testing.T) {
+	q, _ := memory.New(2)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+	require.NoError(t, q.Push(ctx, "79927398713"))
+
+	first, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", first.OrderNumber)
+	second, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", second.OrderNumber)
+	assert.NotEqual(t, first.ID, second.ID)
+	_, err = q.Lease(ctx, time.Minute)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+	// leased orders still occupy the queue
+	assert.ErrorIs(t, q.Push(ctx, "49927398716"), queue.ErrQueueIsFull)
+
+	require.NoError(t, q.Ack(ctx, first))
+	assert.ErrorIs(t, q.Ack(ctx, first), queue.ErrLeaseNotFound)
+	require.NoError(t, q.Nack(ctx, second, 0))
+	assert.ErrorIs(t, q.Nack(ctx, second, 0), queue.ErrLeaseNotFound)
+	qLen, _ := q.Len(ctx)
+	assert.Equal(t, 1, qLen)
+
+	again, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", again.OrderNumber)
+	assert.NotEqual(t, second.ID, again.ID)
+}
+
+func TestQueue_Lease_Expired(t *testing.T) {
+	q, _ := memory.New(10)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+
+	expired, err := q.Lease(ctx, time.Millisecond*50)
+	require.NoError(t, err)
+	_, err = q.Lease(ctx, time.Minute)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+
+	time.Sleep(time.Millisecond * 100)
+	// the order is delivered again, and the expired lease cannot be used anymore
+	lease, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", lease.OrderNumber)
+	assert.ErrorIs(t, q.Ack(ctx, expired), queue.ErrLeaseNotFound)
+	require.NoError(t, q.Ack(ctx, lease))
+}
+
+func TestQueue_Nack_Delay(t *testing.T) {
+	q, _ := memory.New(10)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+	require.NoError(t, q.Push(ctx, "79927398713"))
+
+	lease, _ := q.Lease(ctx, time.Minute)
+	require.NoError(t, q.Nack(ctx, lease, time.Hour))
+
+	// the delayed order is skipped
+	next, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", next.OrderNumber)
+	require.NoError(t, q.Ack(ctx, next))
+	_, err = q.Pop(ctx)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+	qLen, _ := q.Len(ctx)
+	assert.Equal(t, 1, qLen)
+}
+
+func TestQueue_Position(t *testing.T) {
+	q, _ := memory.New(10)
+	ctx := context.TODO()
+	for _, number := range []string{"1234567812345670", "79927398713", "4561261212345467"} {
+		require.NoError(t, q.Push(ctx, number))
+	}
+
+	pos, err := q.Position(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, 1, pos.Ahead)
+
+	// the delayed order is moved behind the visible ones
+	lease, _ := q.Lease(ctx, time.Minute)
+	require.NoError(t, q.Nack(ctx, lease, time.Hour))
+	pos, err = q.Position(ctx, "1234567812345670")
+	require.NoError(t, err)
+	assert.Equal(t, 2, pos.Ahead)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), pos.VisibleAt, time.Second)
+	pos, err = q.Position(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, 0, pos.Ahead)
+
+	_, err = q.Position(ctx, "49927398716")
+	assert.ErrorIs(t, err, queue.ErrNotQueued)
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+)
+
+type Queue struct {
+	db      *postgres.Database
+	maxSize int
+}
+
+var ErrSizeIsInvalid = errors.New("queue cannot be of this size")
+
+// DefaultSize is the size of the queue unless configured otherwise.
+// Since the queued order numbers are kept in the database, the queue may hold many more of them than in memory
+const DefaultSize = 100000
+
+// New initializes a durable queue backed by the accrual_queue table.
+// Unlike the in-memory queue, the queued order numbers survive restarts
+// and the same queue can be shared by multiple instances of the service.
+// Since the queue uses the database connection from the context (if any),
+// pushes and pops made within a transaction are committed or rolled back along with it
+func New(db *postgres.Database, size int) (*Queue, error) {
+	if size <= 0 {
+		return nil, ErrSizeIsInvalid
+	}
+	return &Queue{db: db, maxSize: size}, nil
+}
+
+// Push appends an order number to the tail of the queue.
+// Pushing an order number that is already queued is a no-op, even if the queue is full.
+// The size of the queue is a soft limit: the pushes are not serialized, so that the uploads do not wait
+// for each other, and concurrent pushes may grow the queue slightly beyond its size.
+// Only as many queued order numbers as the size of the queue are counted at most
+func (q *Queue) Push(ctx context.Context, orderNumber string) error {
+	conn := q.db.Conn(ctx)
+	tag, err := conn.Exec(
+		ctx,
+		"INSERT INTO accrual_queue (order_number) "+
+			"SELECT $1 WHERE (SELECT count(*) FROM (SELECT 1 FROM accrual_queue LIMIT $2) AS q) < $2 "+
+			"ON CONFLICT (order_number) DO NOTHING",
+		orderNumber, q.maxSize,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("order", orderNumber).Msg("Failed to push order to queue")
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	// nothing was inserted, either because the queue is full or because the order is already queued
+	var queued bool
+	if err = conn.QueryRow(
+		ctx, "SELECT EXISTS (SELECT 1 FROM accrual_queue WHERE order_number = $1)", orderNumber,
+	).Scan(&queued); err != nil {
+		log.Error().Err(err).Str("order", orderNumber).Msg("Failed to check whether order is queued")
+		return err
+	}
+	if !queued {
+		return queue.ErrQueueIsFull
+	}
+	log.Debug().Str("order", orderNumber).Msg("Order is already queued")
+	return nil
+}
+
+// Pop removes an order number from the head of the queue and returns it.
+// Rows locked by concurrent consumers are skipped,
+// so several instances of the service never receive the same order number
+func (q *Queue) Pop(ctx context.Context) (string, error) {
+	var orderNumber string
+	err := q.db.Conn(ctx).QueryRow(
+		ctx,
+		"DELETE FROM accrual_queue WHERE id = ("+
+			"SELECT id FROM accrual_queue WHERE visible_at <= now() "+
+			"ORDER BY visible_at ASC, id ASC LIMIT 1 FOR UPDATE SKIP LOCKED"+
+			") RETURNING order_number",
+	).Scan(&orderNumber)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", queue.ErrQueueIsEmpty
+		}
+		log.Error().Err(err).Msg("Failed to pop order from queue")
+		return "", err
+	}
+	return orderNumber, nil
+}
+
+// Lease hides the order number at the head of the queue from other consumers for the visibility timeout.
+// Order numbers with expired leases are at the head of the queue again
+func (q *Queue) Lease(ctx context.Context, visibility time.Duration) (queue.Lease, error) {
+	var lease queue.Lease
+	err := q.db.Conn(ctx).QueryRow(
+		ctx,
+		"UPDATE accrual_queue SET "+
+			"lease_id = gen_random_uuid()::text, visible_at = now() + $1::double precision * interval '1 second' "+
+			"WHERE id = ("+
+			"SELECT id FROM accrual_queue WHERE visible_at <= now() "+
+			"ORDER BY visible_at ASC, id ASC LIMIT 1 FOR UPDATE SKIP LOCKED"+
+			") RETURNING lease_id, order_number",
+		visibility.Seconds(),
+	).Scan(&lease.ID, &lease.OrderNumber)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return queue.Lease{}, queue.ErrQueueIsEmpty
+		}
+		log.Error().Err(err).Msg("Failed to lease order from queue")
+		return queue.Lease{}, err
+	}
+	return lease, nil
+}
+
+func (q *Queue) Ack(ctx context.Context, lease queue.Lease) error {
+	tag, err := q.db.Conn(ctx).Exec(ctx, "DELETE FROM accrual_queue WHERE lease_id = $1", lease.ID)
+	if err != nil {
+		log.Error().Err(err).Str("order", lease.OrderNumber).Msg("Failed to acknowledge leased order")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return queue.ErrLeaseNotFound
+	}
+	return nil
+}
+
+func (q *Queue) Nack(ctx context.Context, lease queue.Lease, delay time.Duration) error {
+	tag, err := q.db.Conn(ctx).Exec(
+		ctx,
+		"UPDATE accrual_queue SET "+
+			"lease_id = NULL, visible_at = now() + $1::double precision * interval '1 second' "+
+			"WHERE lease_id = $2",
+		delay.Seconds(), lease.ID,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("order", lease.OrderNumber).Msg("Failed to return leased order to queue")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return queue.ErrLeaseNotFound
+	}
+	return nil
+}
+
+// Position counts the order numbers delivered before the given one,
+// following the same order the order numbers are leased in
+func (q *Queue) Position(ctx context.Context, orderNumber string) (queue.Position, error) {
+	var pos queue.Position
+	err := q.db.Conn(ctx).QueryRow(
+		ctx,
+		"SELECT q.visible_at, ("+
+			"SELECT count(*) FROM accrual_queue o "+
+			"WHERE (o.visible_at, o.id) < (q.visible_at, q.id)"+
+			") FROM accrual_queue q WHERE q.order_number = $1",
+		orderNumber,
+	).Scan(&pos.VisibleAt, &pos.Ahead)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return queue.Position{}, queue.ErrNotQueued
+		}
+		log.Error().Err(err).Str("order", orderNumber).Msg("Failed to find order in queue")
+		return queue.Position{}, err
+	}
+	return pos, nil
+}
+
+func (q *Queue) Len(ctx context.Context) (int, error) {
+	var size int
+	if err := q.db.Conn(ctx).QueryRow(ctx, "SELECT count(*) FROM accrual_queue").Scan(&size); err != nil {
+		log.Error().Err(err).Msg("Failed to count queued orders")
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,252 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+	qdb "github.com/sergeii/practikum-go-gophermart/internal/ports/queue/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue/queuetest"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+var errRollback = errors.New("rollback")
+
+func TestQueue_New_Validation(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	for _, size := range []int{-1, 0} {
+		_, err := qdb.New(db, size)
+		assert.ErrorIs(t, err, qdb.ErrSizeIsInvalid)
+	}
+	q, err := qdb.New(db, 1)
+	require.NoError(t, err)
+	assert.NotNil(t, q)
+}
+
+func TestQueue_PushPop_FIFO(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 3)
+	ctx := context.TODO()
+
+	for _, number := range []string{"1234567812345670", "4561261212345467", "79927398713"} {
+		require.NoError(t, q.Push(ctx, number))
+	}
+	qLen, err := q.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, qLen)
+
+	err = q.Push(ctx, "49927398716")
+	assert.ErrorIs(t, err, queue.ErrQueueIsFull)
+
+	for _, want := range []string{"1234567812345670", "4561261212345467", "79927398713"} {
+		number, popErr := q.Pop(ctx)
+		require.NoError(t, popErr)
+		assert.Equal(t, want, number)
+	}
+	_, err = q.Pop(ctx)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+
+	qLen, _ = q.Len(ctx)
+	assert.Equal(t, 0, qLen)
+}
+
+func TestQueue_Push(t *testing.T) {
+	queuetest.TestPush(t, func(t *testing.T, size int) queue.Repository {
+		_, db, cancel := testutils.PrepareTestDatabase()
+		t.Cleanup(cancel)
+		q, err := qdb.New(db, size)
+		require.NoError(t, err)
+		return q
+	})
+}
+
+func TestQueue_Push_ConcurrentSoftLimit(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 5)
+	ctx := context.TODO()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := q.Push(ctx, fmt.Sprintf("order-%d", i))
+			if !errors.Is(err, queue.ErrQueueIsFull) {
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// concurrent pushes may overshoot the size, but the queue does not grow once it is full
+	qLen, _ := q.Len(ctx)
+	assert.GreaterOrEqual(t, qLen, 5)
+	assert.ErrorIs(t, q.Push(ctx, "49927398716"), queue.ErrQueueIsFull)
+	again, _ := q.Len(ctx)
+	assert.Equal(t, qLen, again)
+}
+
+func TestQueue_Push_RollbackWithTransaction(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	err := db.WithTransaction(context.TODO(), func(txCtx context.Context) error {
+		require.NoError(t, q.Push(txCtx, "1234567812345670"))
+		qLen, _ := q.Len(txCtx)
+		assert.Equal(t, 1, qLen)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	qLen, _ := q.Len(context.TODO())
+	assert.Equal(t, 0, qLen)
+}
+
+func TestQueue_Pop_SkipsLocked(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	require.NoError(t, q.Push(context.TODO(), "1234567812345670"))
+	require.NoError(t, q.Push(context.TODO(), "79927398713"))
+
+	err := db.WithTransaction(context.TODO(), func(txCtx context.Context) error {
+		first, err := q.Pop(txCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "1234567812345670", first)
+		// another consumer skips the order locked by the open transaction
+		second, err := q.Pop(context.TODO())
+		require.NoError(t, err)
+		assert.Equal(t, "79927398713", second)
+		_, err = q.Pop(context.TODO())
+		assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	// the order popped within the rolled back transaction is back in the queue
+	number, err := q.Pop(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", number)
+}
+
+func TestQueue_Lease_AckNack(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+	require.NoError(t, q.Push(ctx, "79927398713"))
+
+	first, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", first.OrderNumber)
+	assert.NotEmpty(t, first.ID)
+	// leased orders are hidden from other consumers, but still occupy the queue
+	second, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", second.OrderNumber)
+	_, err = q.Lease(ctx, time.Minute)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+	qLen, _ := q.Len(ctx)
+	assert.Equal(t, 2, qLen)
+
+	require.NoError(t, q.Ack(ctx, first))
+	assert.ErrorIs(t, q.Ack(ctx, first), queue.ErrLeaseNotFound)
+	require.NoError(t, q.Nack(ctx, second, 0))
+	assert.ErrorIs(t, q.Nack(ctx, second, 0), queue.ErrLeaseNotFound)
+	qLen, _ = q.Len(ctx)
+	assert.Equal(t, 1, qLen)
+
+	again, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", again.OrderNumber)
+	assert.NotEqual(t, second.ID, again.ID)
+}
+
+func TestQueue_Lease_Expired(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+
+	expired, err := q.Lease(ctx, time.Millisecond*50)
+	require.NoError(t, err)
+	_, err = q.Lease(ctx, time.Minute)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+
+	time.Sleep(time.Millisecond * 100)
+	// the order is delivered again, and the expired lease cannot be used anymore
+	lease, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", lease.OrderNumber)
+	assert.ErrorIs(t, q.Ack(ctx, expired), queue.ErrLeaseNotFound)
+	require.NoError(t, q.Ack(ctx, lease))
+}
+
+func TestQueue_Nack_Delay(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	ctx := context.TODO()
+	require.NoError(t, q.Push(ctx, "1234567812345670"))
+	require.NoError(t, q.Push(ctx, "79927398713"))
+
+	lease, _ := q.Lease(ctx, time.Minute)
+	require.NoError(t, q.Nack(ctx, lease, time.Hour))
+
+	// the delayed order is skipped
+	next, err := q.Lease(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", next.OrderNumber)
+	require.NoError(t, q.Ack(ctx, next))
+	_, err = q.Pop(ctx)
+	assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+}
+
+func TestQueue_Position(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	q, _ := qdb.New(db, 10)
+	ctx := context.TODO()
+	for _, number := range []string{"1234567812345670", "79927398713", "4561261212345467"} {
+		require.NoError(t, q.Push(ctx, number))
+	}
+
+	pos, err := q.Position(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, 1, pos.Ahead)
+
+	// the delayed order is moved behind the visible ones
+	lease, _ := q.Lease(ctx, time.Minute)
+	require.NoError(t, q.Nack(ctx, lease, time.Hour))
+	pos, err = q.Position(ctx, "1234567812345670")
+	require.NoError(t, err)
+	assert.Equal(t, 2, pos.Ahead)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), pos.VisibleAt, time.Second)
+	pos, err = q.Position(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, 0, pos.Ahead)
+
+	_, err = q.Position(ctx, "49927398716")
+	assert.ErrorIs(t, err, queue.ErrNotQueued)
+}
@@ -0,0 +1,64 @@
+// Package queuetest checks that the queue backends behave the same way
+package queuetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
+)
+
+// TestPush runs the checks of pushing order numbers to the queues of the specified size made by newQueue
+func TestPush(t *testing.T, newQueue func(t *testing.T, size int) queue.Repository) {
+	t.Run("duplicate", func(t *testing.T) {
+		q := newQueue(t, 2)
+		ctx := context.TODO()
+
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		qLen, _ := q.Len(ctx)
+		assert.Equal(t, 1, qLen)
+
+		require.NoError(t, q.Push(ctx, "79927398713"))
+		assert.ErrorIs(t, q.Push(ctx, "49927398716"), queue.ErrQueueIsFull)
+		// full queue still accepts already queued orders
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		qLen, _ = q.Len(ctx)
+		assert.Equal(t, 2, qLen)
+
+		// the order is delivered once
+		first, err := q.Pop(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "1234567812345670", first)
+		second, err := q.Pop(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "79927398713", second)
+		_, err = q.Pop(ctx)
+		assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+	})
+
+	t.Run("duplicate of leased order", func(t *testing.T) {
+		q := newQueue(t, 2)
+		ctx := context.TODO()
+
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		lease, err := q.Lease(ctx, time.Minute)
+		require.NoError(t, err)
+		// the leased order is still queued, so it is not queued twice
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		qLen, _ := q.Len(ctx)
+		assert.Equal(t, 1, qLen)
+		_, err = q.Lease(ctx, time.Minute)
+		assert.ErrorIs(t, err, queue.ErrQueueIsEmpty)
+
+		require.NoError(t, q.Ack(ctx, lease))
+		// once acknowledged, the order may be queued again
+		require.NoError(t, q.Push(ctx, "1234567812345670"))
+		qLen, _ = q.Len(ctx)
+		assert.Equal(t, 1, qLen)
+	})
+}
@@ -3,13 +3,42 @@ package queue
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var ErrQueueIsFull = errors.New("accrual queue is full")
 var ErrQueueIsEmpty = errors.New("accrual queue is empty")
+var ErrLeaseNotFound = errors.New("accrual queue lease is not found")
+var ErrNotQueued = errors.New("order is not queued")
+
+// Lease is a temporary claim on a queued order number.
+// While the lease is held, the order number stays in the queue, but it is hidden from other consumers.
+// The holder of the lease must either acknowledge the order number, so it is removed from the queue,
+// or return it to the queue. Otherwise, the order number is delivered again once the lease has expired
+type Lease struct {
+	ID          string
+	OrderNumber string
+}
+
+// Position is the place of a queued order number in the queue
+type Position struct {
+	// Ahead is the number of order numbers to be delivered before this one
+	Ahead int
+	// VisibleAt is the time the order number is available to consumers,
+	// it is in the future for the leased and delayed order numbers
+	VisibleAt time.Time
+}
 
 type Repository interface {
 	Push(context.Context, string) error
 	Pop(context.Context) (string, error)
+	// Lease claims the next available order number for the specified visibility timeout
+	Lease(context.Context, time.Duration) (Lease, error)
+	// Ack removes the leased order number from the queue
+	Ack(context.Context, Lease) error
+	// Nack returns the leased order number to the queue, so it is available again after the specified delay
+	Nack(context.Context, Lease, time.Duration) error
+	// Position finds the order number in the queue
+	Position(context.Context, string) (Position, error)
 	Len(ctx context.Context) (int, error)
 }
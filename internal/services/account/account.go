@@ -3,11 +3,15 @@ package account
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 	"github.com/sergeii/practikum-go-gophermart/pkg/security/hasher"
 )
 
@@ -19,15 +23,27 @@ var ErrAuthenticateInvalidCredentials = errors.New("unable to authenticate user
 
 var ErrWithdrawInvalidSum = errors.New("user can withdraw positive sum only")
 
+// MaxUpcomingExpirations is the number of the nearest expirations shown to the user
+const MaxUpcomingExpirations = 10
+
 type Service struct {
-	users  users.Repository
-	hasher hasher.PasswordHasher
+	users      users.Repository
+	ledger     ledgerentries.Repository
+	transactor transactor.Transactor
+	hasher     hasher.PasswordHasher
 }
 
-func New(repo users.Repository, hasher hasher.PasswordHasher) Service {
+func New(
+	repo users.Repository,
+	ledger ledgerentries.Repository,
+	transactor transactor.Transactor,
+	hasher hasher.PasswordHasher,
+) Service {
 	return Service{
-		users:  repo,
-		hasher: hasher,
+		users:      repo,
+		ledger:     ledger,
+		transactor: transactor,
+		hasher:     hasher,
 	}
 }
 
@@ -83,8 +99,19 @@ func (s Service) Authenticate(ctx context.Context, login, password string) (user
 	return user, nil
 }
 
+// AccruePoints adjusts the user's current balance by specified amount of points, not related to any order.
+// Negative amount takes the points back, as long as the user has enough points
 func (s Service) AccruePoints(ctx context.Context, userID int, points decimal.Decimal) error {
-	return s.users.AccruePoints(ctx, userID, points)
+	if points.IsZero() {
+		return nil
+	}
+	return s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := s.users.AccruePoints(txCtx, userID, points); err != nil {
+			return err
+		}
+		_, err := s.ledger.Add(txCtx, ledgerentries.NewAdjustment(userID, "", points))
+		return err
+	})
 }
 
 // WithdrawPoints attempts to withdraw specified amount of points from the user's current balance
@@ -95,7 +122,13 @@ func (s Service) WithdrawPoints(ctx context.Context, userID int, points decimal.
 	if points.LessThanOrEqual(decimal.Zero) {
 		return ErrWithdrawInvalidSum
 	}
-	return s.users.WithdrawPoints(ctx, userID, points)
+	return s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := s.users.WithdrawPoints(txCtx, userID, "", points); err != nil {
+			return err
+		}
+		_, err := s.ledger.Add(txCtx, ledgerentries.NewWithdrawal(userID, "", points))
+		return err
+	})
 }
 
 // GetBalance returns specified user's balance
@@ -106,3 +139,29 @@ func (s Service) GetBalance(ctx context.Context, userID int) (users.UserBalance,
 	}
 	return u.Balance, nil
 }
+
+// GetUpcomingExpirations returns the nearest dates the user's points expire at, along with the expiring points
+func (s Service) GetUpcomingExpirations(ctx context.Context, userID int) ([]users.Expiration, error) {
+	return s.users.GetUpcomingExpirations(ctx, userID, time.Now(), MaxUpcomingExpirations)
+}
+
+// GetBalanceHistoryPage returns a page of the ledger entries that have changed the user's balance,
+// each along with the user's current balance right after the entry.
+// Unless the page is the last one, the cursor pointing at the next page is returned along with the page
+func (s Service) GetBalanceHistoryPage(
+	ctx context.Context, userID int, q ledgerentries.ListQuery,
+) ([]ledgerentries.Entry, *pagination.Cursor, error) {
+	// fetch an extra entry to tell whether there is another page
+	limit := q.Limit
+	q.Limit++
+	items, err := s.ledger.GetPageForUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+	items = items[:limit]
+	last := items[limit-1]
+	return items, &pagination.Cursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 	xbcrypt "golang.org/x/crypto/bcrypt"
 
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
 	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/account"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
@@ -19,7 +20,7 @@ func TestAccountService_RegisterNewUser_OK(t *testing.T) {
 	defer cancel()
 
 	repo := udb.New(db)
-	svc := account.New(repo, bcrypt.New())
+	svc := account.New(repo, ldb.New(db), db, bcrypt.New())
 
 	u, err := svc.RegisterNewUser(context.TODO(), "happy_customer", "sup3rS3cr3t")
 	require.NoError(t, err)
@@ -73,7 +74,7 @@ func TestAccountService_RegisterNewUser_Errors(t *testing.T) {
 			defer cancel()
 
 			repo := udb.New(db)
-			svc := account.New(repo, bcrypt.New())
+			svc := account.New(repo, ldb.New(db), db, bcrypt.New())
 
 			_, err := svc.RegisterNewUser(context.TODO(), "happy_customer", "sup3rS3cr3t")
 			require.NoError(t, err)
@@ -100,7 +101,7 @@ func TestAccountService_Authenticate_OK(t *testing.T) {
 	defer cancel()
 
 	repo := udb.New(db)
-	svc := account.New(repo, bcrypt.New())
+	svc := account.New(repo, ldb.New(db), db, bcrypt.New())
 
 	u1, err := svc.RegisterNewUser(context.TODO(), "happy_customer", "sup3rS3cr3t")
 	require.NoError(t, err)
@@ -152,7 +153,7 @@ func TestAccountService_Authenticate_Errors(t *testing.T) {
 			defer cancel()
 
 			repo := udb.New(db)
-			svc := account.New(repo, bcrypt.New())
+			svc := account.New(repo, ldb.New(db), db, bcrypt.New())
 			r, err := svc.RegisterNewUser(context.TODO(), "shopper", "sup3rS3cr3t")
 			require.NoError(t, err)
 
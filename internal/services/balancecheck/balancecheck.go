@@ -0,0 +1,152 @@
+package balancecheck
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+)
+
+// Discrepancy is a user whose balance does not match the user's orders, withdrawals, holds and transfers
+type Discrepancy struct {
+	ledgerentries.Discrepancy
+	Repaired bool
+}
+
+// Report sums up a balance check
+type Report struct {
+	Discrepancies []Discrepancy
+	Repaired      int
+}
+
+type Service struct {
+	users      users.Repository
+	ledger     ledgerentries.Repository
+	repairs    balancerepairs.Repository
+	transactor transactor.Transactor
+	batchSize  int
+}
+
+func New(
+	users users.Repository,
+	ledger ledgerentries.Repository,
+	repairs balancerepairs.Repository,
+	transactor transactor.Transactor,
+	opts ...Option,
+) Service {
+	s := Service{
+		users:      users,
+		ledger:     ledger,
+		repairs:    repairs,
+		transactor: transactor,
+		batchSize:  DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// Check looks for the users whose balance does not match the sum of their processed orders' accrual
+// less their withdrawals, taking into account the held, transferred and expired points.
+// The balance is summed up over the records it is made of, rather than over the ledger entries,
+// so that a change of the balance that has never been recorded, e.g. an order processed but never credited,
+// is also noticed. Unless asked to repair the discrepancies, they are only reported.
+// A failure to repair a user's balance does not stop the check, the discrepancy is reported as not repaired
+func (s Service) Check(ctx context.Context, repair bool) (Report, error) {
+	var report Report
+	afterID := 0
+	for {
+		batch, err := s.ledger.GetDiscrepancies(ctx, afterID, s.batchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, d := range batch {
+			log.Warn().
+				Int("userID", d.UserID).
+				Stringer("current", d.Recorded.Current).
+				Stringer("withdrawn", d.Recorded.Withdrawn).
+				Stringer("held", d.Recorded.Held).
+				Stringer("expectedCurrent", d.Expected.Current).
+				Stringer("expectedWithdrawn", d.Expected.Withdrawn).
+				Stringer("expectedHeld", d.Expected.Held).
+				Msg("User balance does not match orders and withdrawals")
+			item := Discrepancy{Discrepancy: d}
+			if repair {
+				item.Repaired = s.repair(ctx, d.UserID) == nil
+			}
+			if item.Repaired {
+				report.Repaired++
+			}
+			report.Discrepancies = append(report.Discrepancies, item)
+		}
+		if len(batch) < s.batchSize {
+			return report, nil
+		}
+		afterID = batch[len(batch)-1].UserID
+	}
+}
+
+// repair brings the user's balance back in line with the user's orders and withdrawals, recording the repair.
+// The ledger is corrected as well, so that the user's history adds up to the repaired balance.
+// The balance is summed up anew while the user is locked, so that it is not changed in the middle of the repair
+func (s Service) repair(ctx context.Context, userID int) error {
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		u, err := s.users.GetByIDForUpdate(txCtx, userID)
+		if err != nil {
+			return err
+		}
+		expected, err := s.ledger.GetExpectedBalanceForUser(txCtx, userID)
+		if err != nil {
+			return err
+		}
+		if u.Balance.Equal(expected) {
+			log.Info().Int("userID", userID).Msg("User balance already matches orders and withdrawals")
+			return nil
+		}
+		if err = s.users.SetBalance(txCtx, userID, expected); err != nil {
+			return err
+		}
+		if err = s.correctLedger(txCtx, userID, expected); err != nil {
+			return err
+		}
+		_, err = s.repairs.Add(txCtx, balancerepairs.New(userID, u.Balance, expected))
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to repair user balance")
+		return err
+	}
+	log.Info().Int("userID", userID).Msg("Repaired user balance")
+	return nil
+}
+
+// correctLedger records the difference between the user's balance summed up in the ledger
+// and the expected balance with a correction entry per account
+func (s Service) correctLedger(ctx context.Context, userID int, expected users.UserBalance) error {
+	recorded, err := s.ledger.GetBalanceForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		account ledgerentries.Account
+		diff    decimal.Decimal
+	}{
+		{ledgerentries.AccountCurrent, expected.Current.Sub(recorded.Current)},
+		{ledgerentries.AccountWithdrawn, expected.Withdrawn.Sub(recorded.Withdrawn)},
+		{ledgerentries.AccountHeld, expected.Held.Sub(recorded.Held)},
+	} {
+		if c.diff.IsZero() {
+			continue
+		}
+		if _, err = s.ledger.Add(ctx, ledgerentries.NewCorrection(userID, c.account, c.diff)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package balancecheck_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rdb "github.com/sergeii/practikum-go-gophermart/internal/core/balancerepairs/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/balancecheck"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+// prepareUsers creates users whose balance is in line with their processed orders and withdrawals,
+// then changes the balance of the first two users past the orders
+func prepareUsers(t *testing.T, db *postgres.Database) []int {
+	users := udb.New(db)
+	ledger := ldb.New(db)
+	ids := make([]int, 0, 3)
+	for _, login := range []string{"happycustomer", "shopper", "customer"} {
+		u, err := users.Create(context.TODO(), urepo.New(login, "str0ng"))
+		require.NoError(t, err)
+		ids = append(ids, u.ID)
+		number := testutils.NewLuhnNumber(12)
+		addProcessedOrder(t, db, u.ID, number, "10")
+		require.NoError(t, users.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+		_, err = ledger.Add(context.TODO(), ledgerentries.NewAccrual(u.ID, number, decimal.RequireFromString("10")))
+		require.NoError(t, err)
+	}
+	// the withdrawal is recorded properly
+	number := testutils.NewLuhnNumber(12)
+	_, err := wdb.New(db).Add(context.TODO(), withdrawals.New(number, ids[2], decimal.RequireFromString("4")))
+	require.NoError(t, err)
+	require.NoError(t, users.WithdrawPoints(context.TODO(), ids[2], "", decimal.RequireFromString("4")))
+	_, err = ledger.Add(context.TODO(), ledgerentries.NewWithdrawal(ids[2], number, decimal.RequireFromString("4")))
+	require.NoError(t, err)
+
+	require.NoError(t, users.AccruePoints(context.TODO(), ids[0], decimal.RequireFromString("5")))
+	require.NoError(t, users.WithdrawPoints(context.TODO(), ids[1], "", decimal.RequireFromString("2.5")))
+	return ids
+}
+
+func addProcessedOrder(t *testing.T, db *postgres.Database, userID int, number string, accrual string) {
+	repo := odb.New(db)
+	o, err := repo.Add(context.TODO(), orders.New(number, userID))
+	require.NoError(t, err)
+	o.Status = orders.OrderStatusProcessed
+	o.Accrual = decimal.RequireFromString(accrual)
+	require.NoError(t, repo.Update(context.TODO(), o.ID, o))
+}
+
+func TestBalanceCheck_Check_ReportOnly(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	ids := prepareUsers(t, db)
+	users := udb.New(db)
+	repairs := rdb.New(db)
+	svc := balancecheck.New(users, ldb.New(db), repairs, db)
+
+	report, err := svc.Check(context.TODO(), false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Repaired)
+	require.Len(t, report.Discrepancies, 2)
+	assert.Equal(t, ids[0], report.Discrepancies[0].UserID)
+	assert.Equal(t, "15", report.Discrepancies[0].Recorded.Current.String())
+	assert.Equal(t, "10", report.Discrepancies[0].Expected.Current.String())
+	assert.False(t, report.Discrepancies[0].Repaired)
+	assert.Equal(t, ids[1], report.Discrepancies[1].UserID)
+	assert.False(t, report.Discrepancies[1].Repaired)
+
+	// nothing is changed
+	u, _ := users.GetByID(context.TODO(), ids[0])
+	assert.Equal(t, "15", u.Balance.Current.String())
+	items, _ := repairs.GetListForUser(context.TODO(), ids[0])
+	assert.Len(t, items, 0)
+}
+
+func TestBalanceCheck_Check_Repair(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	ids := prepareUsers(t, db)
+	users := udb.New(db)
+	repairs := rdb.New(db)
+	svc := balancecheck.New(users, ldb.New(db), repairs, db, balancecheck.WithBatchSize(1))
+
+	report, err := svc.Check(context.TODO(), true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Repaired)
+	require.Len(t, report.Discrepancies, 2)
+	for i, d := range report.Discrepancies {
+		assert.Equal(t, ids[i], d.UserID)
+		assert.True(t, d.Repaired)
+	}
+
+	for _, id := range ids[:2] {
+		u, _ := users.GetByID(context.TODO(), id)
+		assert.Equal(t, "10", u.Balance.Current.String())
+		assert.Equal(t, "0", u.Balance.Withdrawn.String())
+	}
+	items, _ := repairs.GetListForUser(context.TODO(), ids[1])
+	require.Len(t, items, 1)
+	assert.Equal(t, "7.5", items[0].Recorded.Current.String())
+	assert.Equal(t, "2.5", items[0].Recorded.Withdrawn.String())
+	assert.Equal(t, "10", items[0].Expected.Current.String())
+	assert.Equal(t, "0", items[0].Expected.Withdrawn.String())
+	items, _ = repairs.GetListForUser(context.TODO(), ids[2])
+	assert.Len(t, items, 0)
+
+	// the ledger is in line with the repaired balance, as it has never seen the changes
+	for _, id := range ids[:2] {
+		u, _ := users.GetByID(context.TODO(), id)
+		balance, _ := ldb.New(db).GetBalanceForUser(context.TODO(), id)
+		assert.True(t, u.Balance.Equal(balance))
+	}
+
+	// once repaired, the balances are in line with the orders and withdrawals
+	report, err = svc.Check(context.TODO(), true)
+	require.NoError(t, err)
+	assert.Len(t, report.Discrepancies, 0)
+	assert.Equal(t, 0, report.Repaired)
+}
+
+func TestBalanceCheck_Check_ProcessedOrderNeverCredited(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	ledger := ldb.New(db)
+	repairs := rdb.New(db)
+	svc := balancecheck.New(users, ledger, repairs, db)
+
+	u, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+	// the order is processed, but neither the balance nor the ledger have been changed
+	addProcessedOrder(t, db, u.ID, "79927398713", "42.5")
+	// orders in other statuses are not accounted for
+	_, err = odb.New(db).Add(context.TODO(), orders.New("1234567812345670", u.ID))
+	require.NoError(t, err)
+
+	report, err := svc.Check(context.TODO(), true)
+	require.NoError(t, err)
+	require.Len(t, report.Discrepancies, 1)
+	assert.Equal(t, u.ID, report.Discrepancies[0].UserID)
+	assert.Equal(t, "0", report.Discrepancies[0].Recorded.Current.String())
+	assert.Equal(t, "42.5", report.Discrepancies[0].Expected.Current.String())
+	assert.True(t, report.Discrepancies[0].Repaired)
+
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "42.5", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+	balance, _ := ledger.GetBalanceForUser(context.TODO(), u.ID)
+	assert.Equal(t, "42.5", balance.Current.String())
+	entries, _ := ledger.GetPageForUser(context.TODO(), u.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 1)
+	assert.Equal(t, ledgerentries.KindAdjustment, entries[0].Kind)
+	items, _ := repairs.GetListForUser(context.TODO(), u.ID)
+	require.Len(t, items, 1)
+	assert.Equal(t, "0", items[0].Recorded.Current.String())
+	assert.Equal(t, "42.5", items[0].Expected.Current.String())
+
+	report, err = svc.Check(context.TODO(), false)
+	require.NoError(t, err)
+	assert.Len(t, report.Discrepancies, 0)
+}
@@ -0,0 +1,14 @@
+package balancecheck
+
+const DefaultBatchSize = 1000
+
+type Option func(*Service)
+
+// WithBatchSize configures the number of discrepancies fetched from the database at once
+func WithBatchSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+)
+
+// Report sums up an expiry run
+type Report struct {
+	Users  int
+	Points decimal.Decimal
+	Failed int
+}
+
+type Service struct {
+	users      users.Repository
+	ledger     ledgerentries.Repository
+	transactor transactor.Transactor
+	batchSize  int
+}
+
+func New(
+	users users.Repository,
+	ledger ledgerentries.Repository,
+	transactor transactor.Transactor,
+	opts ...Option,
+) Service {
+	s := Service{
+		users:      users,
+		ledger:     ledger,
+		transactor: transactor,
+		batchSize:  DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// Expire takes away the points that have expired from their owners, recording the expiry in the ledger.
+// A failure to expire a user's points does not stop the run, the user is counted as failed instead
+func (s Service) Expire(ctx context.Context) (Report, error) {
+	report := Report{Points: decimal.Zero}
+	now := time.Now()
+	afterID := 0
+	for {
+		batch, err := s.users.GetIDsWithExpiredPoints(ctx, now, afterID, s.batchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, userID := range batch {
+			points, err := s.expire(ctx, userID, now)
+			switch {
+			case err != nil:
+				report.Failed++
+			case points.IsPositive():
+				report.Users++
+				report.Points = report.Points.Add(points)
+			}
+		}
+		if len(batch) < s.batchSize {
+			return report, nil
+		}
+		afterID = batch[len(batch)-1]
+	}
+}
+
+func (s Service) expire(ctx context.Context, userID int, now time.Time) (decimal.Decimal, error) {
+	var expired decimal.Decimal
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		points, err := s.users.ExpirePoints(txCtx, userID, now)
+		if err != nil {
+			return err
+		}
+		// the expired points may all be held for a withdrawal
+		if !points.IsPositive() {
+			return nil
+		}
+		if _, err = s.ledger.Add(txCtx, ledgerentries.NewExpiration(userID, points)); err != nil {
+			return err
+		}
+		expired = points
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Int("userID", userID).Msg("Failed to expire points for user")
+		return decimal.Zero, err
+	}
+	return expired, nil
+}
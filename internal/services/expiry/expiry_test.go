@@ -0,0 +1,62 @@
+package expiry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/expiry"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func TestExpiry_Expire(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	// the points have expired by the time they are accrued
+	expiring := udb.New(db, udb.WithPointsTTL(time.Nanosecond))
+	lasting := udb.New(db, udb.WithPointsTTL(time.Hour))
+	ledger := ldb.New(db)
+	ids := make([]int, 0, 3)
+	for _, login := range []string{"happycustomer", "shopper", "customer"} {
+		u, err := lasting.Create(context.TODO(), urepo.New(login, "str0ng"))
+		require.NoError(t, err)
+		ids = append(ids, u.ID)
+		require.NoError(t, lasting.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	}
+	require.NoError(t, expiring.AccruePoints(context.TODO(), ids[0], decimal.RequireFromString("5")))
+	require.NoError(t, expiring.AccruePoints(context.TODO(), ids[2], decimal.RequireFromString("2.5")))
+	time.Sleep(time.Millisecond)
+
+	svc := expiry.New(lasting, ledger, db, expiry.WithBatchSize(1))
+	report, err := svc.Expire(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Users)
+	assert.Equal(t, "7.5", report.Points.String())
+	assert.Equal(t, 0, report.Failed)
+
+	for i, want := range []string{"10", "10", "10"} {
+		u, _ := lasting.GetByID(context.TODO(), ids[i])
+		assert.Equal(t, want, u.Balance.Current.String())
+	}
+	entries, _ := ledger.GetPageForUser(context.TODO(), ids[2], ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 1)
+	assert.Equal(t, ledgerentries.KindExpiration, entries[0].Kind)
+	assert.Equal(t, "-2.5", entries[0].Change(ledgerentries.AccountCurrent).String())
+	entries, _ = ledger.GetPageForUser(context.TODO(), ids[1], ledgerentries.ListQuery{Limit: 10})
+	assert.Len(t, entries, 0)
+
+	// once expired, the points are gone
+	report, err = svc.Expire(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Users)
+	assert.Equal(t, "0", report.Points.String())
+}
@@ -0,0 +1,14 @@
+package expiry
+
+const DefaultBatchSize = 100
+
+type Option func(*Service)
+
+// WithBatchSize configures the number of users with expired points fetched from the database at once
+func WithBatchSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/idempotencykeys"
+)
+
+var ErrRequestInProgress = errors.New("request with this idempotency key is still in progress")
+var ErrKeyReused = errors.New("idempotency key has already been used with a different request")
+
+type Service struct {
+	keys               idempotencykeys.Repository
+	ttl                time.Duration
+	reservationTimeout time.Duration
+}
+
+func New(keys idempotencykeys.Repository, opts ...Option) Service {
+	s := Service{
+		keys:               keys,
+		ttl:                DefaultTTL,
+		reservationTimeout: DefaultReservationTimeout,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// Begin reserves the user's key for the request.
+// Unless the key has been used before, the reserved key is returned and the request is to be carried out.
+// If the key has been used with the same request, the key is returned along with the stored response,
+// which is to be replayed instead of carrying out the request again.
+// Reusing the key with a different request results in ErrKeyReused,
+// and ErrRequestInProgress is returned until the original request is complete.
+// Once the reservation timeout has passed, a retry of a request that is still in progress takes over the key
+func (s Service) Begin(
+	ctx context.Context, userID int, key, method, path string, body []byte,
+) (idempotencykeys.Key, error) {
+	fingerprint := Fingerprint(method, path, body)
+	staleBefore := time.Now().Add(-s.reservationTimeout)
+	k, err := s.keys.Reserve(ctx, idempotencykeys.New(key, userID, method, path, fingerprint, s.ttl), staleBefore)
+	if err == nil {
+		return k, nil
+	}
+	if !errors.Is(err, idempotencykeys.ErrKeyExists) {
+		return idempotencykeys.Blank, err
+	}
+	k, err = s.keys.Get(ctx, userID, key)
+	if err != nil {
+		// the key has expired in the meantime
+		if errors.Is(err, idempotencykeys.ErrKeyNotFound) {
+			return idempotencykeys.Blank, ErrRequestInProgress
+		}
+		return idempotencykeys.Blank, err
+	}
+	if k.Fingerprint != fingerprint {
+		log.Warn().Int("userID", userID).Str("path", path).Msg("Idempotency key is reused with different request")
+		return idempotencykeys.Blank, ErrKeyReused
+	}
+	if !k.IsComplete() {
+		return idempotencykeys.Blank, ErrRequestInProgress
+	}
+	return k, nil
+}
+
+// Finish stores the response to the request carried out with the key.
+// Server errors are not stored, so the request can be retried with the same key
+func (s Service) Finish(
+	ctx context.Context, k idempotencykeys.Key, statusCode int, contentType string, body []byte,
+) error {
+	if statusCode >= http.StatusInternalServerError {
+		return s.Release(ctx, k)
+	}
+	return s.keys.Complete(ctx, k, statusCode, contentType, body)
+}
+
+// Release gives up the key reserved for a request that has not been carried out,
+// so that the request can be retried with the same key right away
+func (s Service) Release(ctx context.Context, k idempotencykeys.Key) error {
+	return s.keys.Delete(ctx, k)
+}
+
+// PurgeExpired removes the keys that have outlived their TTL.
+// The method returns the number of removed keys
+func (s Service) PurgeExpired(ctx context.Context) (int, error) {
+	return s.keys.DeleteExpired(ctx, time.Now())
+}
+
+// Fingerprint returns a digest of the request, which tells a retry from a different request
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,30 @@
+package idempotency
+
+import "time"
+
+const DefaultTTL = time.Hour * 24
+
+// DefaultReservationTimeout is long enough for any request to complete,
+// so a key still in progress by then has been abandoned
+const DefaultReservationTimeout = time.Minute
+
+type Option func(*Service)
+
+// WithTTL configures the time for which a key and the stored response are kept
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithReservationTimeout configures the time after which a key reserved for a request
+// that is still in progress may be taken over by a retry of the same request
+func WithReservationTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.reservationTimeout = timeout
+		}
+	}
+}
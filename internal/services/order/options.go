@@ -0,0 +1,56 @@
+package order
+
+import (
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+)
+
+const DefaultLeaseTimeout = time.Minute
+
+type Option func(*Service)
+
+// WithRetryPolicy configures the retry policy for failing orders.
+// Non-positive values of the policy are replaced with the defaults
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *Service) {
+		if policy.MaxAttempts > 0 {
+			s.retryPolicy.MaxAttempts = policy.MaxAttempts
+		}
+		if policy.BaseDelay > 0 {
+			s.retryPolicy.BaseDelay = policy.BaseDelay
+		}
+		if policy.MaxDelay > 0 {
+			s.retryPolicy.MaxDelay = policy.MaxDelay
+		}
+	}
+}
+
+// WithLeaseTimeout configures how long a picked order stays hidden from other consumers of the queue.
+// The timeout must be long enough for the order to be checked and handled
+func WithLeaseTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.leaseTimeout = timeout
+		}
+	}
+}
+
+// WithPublisher configures where the changes of the users' orders and balance are published to
+func WithPublisher(publisher pubsub.Publisher) Option {
+	return func(s *Service) {
+		if publisher != nil {
+			s.publisher = publisher
+		}
+	}
+}
+
+// WithOutbox configures where the changes of the users' orders and balance are recorded to
+// within the transaction that makes them, so that the records are kept if and only if the change is
+func WithOutbox(outbox pubsub.Publisher) Option {
+	return func(s *Service) {
+		if outbox != nil {
+			s.outbox = outbox
+		}
+	}
+}
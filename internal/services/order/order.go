@@ -8,46 +8,72 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 var ErrOrderAlreadyUploaded = errors.New("order has already been uploaded by the same user")
 var ErrOrderUploadedByAnotherUser = errors.New("order has already been uploaded by another user")
 var ErrOrderIsNotProcessedYet = errors.New("order is not processed yet")
 var ErrOrderProcessingErrorIsHandled = errors.New("failed order is handled successfully")
+var ErrOrderIsNotFailed = errors.New("order has not failed processing")
+var ErrOrderStatusTransitionNotAllowed = errors.New("order cannot move to this status")
 
 const (
 	PostProcessWaitOnFinishedRun = time.Millisecond * 50
 	PostProcessWaitOnError       = time.Millisecond * 100
 	PostProcessWaitOnEmptyQueue  = time.Second
+	PostProcessWaitOnTimeout     = time.Second * 5
 )
 
 type Service struct {
 	orders         orders.Repository
+	events         orderevents.Repository
 	users          users.Repository
+	ledger         ledgerentries.Repository
 	processing     queue.Repository
 	transactor     transactor.Transactor
-	AccrualService accrual.Service
+	retryPolicy    RetryPolicy
+	leaseTimeout   time.Duration
+	publisher      pubsub.Publisher
+	outbox         pubsub.Publisher
+	AccrualService accrual.Client
 }
 
 func New(
 	orders orders.Repository,
+	events orderevents.Repository,
 	users users.Repository,
+	ledger ledgerentries.Repository,
 	transactor transactor.Transactor,
 	processing queue.Repository,
-	accrual accrual.Service,
+	accrual accrual.Client,
+	opts ...Option,
 ) Service {
-	return Service{
+	s := Service{
 		orders:         orders,
+		events:         events,
 		users:          users,
+		ledger:         ledger,
 		transactor:     transactor,
 		processing:     processing,
+		retryPolicy:    defaultRetryPolicy(),
+		leaseTimeout:   DefaultLeaseTimeout,
+		publisher:      pubsub.Discard,
+		outbox:         pubsub.Discard,
 		AccrualService: accrual,
 	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
 }
 
 // SubmitNewOrder creates a new order and attempts to add the new order to the processing queue.
@@ -85,36 +111,260 @@ func (s Service) SubmitNewOrder(ctx context.Context, number string, userID int)
 	return order, nil
 }
 
+// UpdateOrderStatus moves the order to the new status and records the transition in the order's history.
+// Both the order and its history are updated atomically.
+// Updating an unfinished order with the same status and accrual is a no-op
 func (s Service) UpdateOrderStatus(
-	ctx context.Context, orderNumber string, newStatus orders.OrderStatus, accrual decimal.Decimal,
+	ctx context.Context,
+	orderNumber string,
+	newStatus orders.OrderStatus,
+	accrual decimal.Decimal,
+	source orderevents.Source,
 ) error {
-	order, err := s.orders.GetByNumber(ctx, orderNumber)
-	if err != nil {
-		if errors.Is(err, orders.ErrOrderNotFound) {
-			log.Error().Str("order", orderNumber).Msg("Unable to update non-existent order")
+	_, _, err := s.updateOrderStatus(ctx, orderNumber, newStatus, accrual, source)
+	return err
+}
+
+// updateOrderStatus does the job of UpdateOrderStatus.
+// Along with the updated order, it tells whether the order has changed at all
+func (s Service) updateOrderStatus(
+	ctx context.Context,
+	orderNumber string,
+	newStatus orders.OrderStatus,
+	accrual decimal.Decimal,
+	source orderevents.Source,
+) (orders.Order, bool, error) {
+	var updated orders.Order
+	var changed bool
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		// the order is locked until the end of the transaction, so that concurrent updates,
+		// e.g. the ones pushed by the accrual system and the ones obtained by polling, never finalize it twice
+		order, err := s.orders.GetByNumberForUpdate(txCtx, orderNumber)
+		if err != nil {
+			if errors.Is(err, orders.ErrOrderNotFound) {
+				log.Error().Str("order", orderNumber).Msg("Unable to update non-existent order")
+				return err
+			}
+			log.Error().Err(err).Str("order", orderNumber).Msg("Failed to obtain order")
 			return err
 		}
-		log.Error().Err(err).Str("order", orderNumber).Msg("Failed to obtain order")
-		return err
+		updated = order
+		// orders in final statuses are not updated again, so the points are never accrued twice
+		if order.Status == newStatus && order.Accrual.Equal(accrual) && !order.Status.IsFinal() {
+			return nil
+		}
+		oldStatus := order.Status
+		if err = changeStatus(&order, newStatus); err != nil {
+			return err
+		}
+		order.Accrual = accrual
+		if err = s.orders.Update(txCtx, order.ID, order); err != nil {
+			log.Error().
+				Err(err).
+				Int("ID", order.ID).
+				Str("number", orderNumber).
+				Str("status", string(newStatus)).
+				Stringer("accrual", accrual).
+				Msg("Failed to update order status")
+			return err
+		}
+		if err = s.recordEvent(txCtx, order, oldStatus, source); err != nil {
+			return err
+		}
+		if err = s.outbox.Publish(txCtx, orderStatusEvent(order)); err != nil {
+			return err
+		}
+		updated, changed = order, true
+		return nil
+	})
+	if err != nil {
+		return orders.Blank, false, err
 	}
-	order.Status = newStatus
-	order.Accrual = accrual
-	if err = s.orders.Update(ctx, order.ID, order); err != nil {
+	return updated, changed, nil
+}
+
+// recordEvent adds the order's latest status transition to the order's history
+func (s Service) recordEvent(
+	ctx context.Context, o orders.Order, oldStatus orders.OrderStatus, source orderevents.Source,
+) error {
+	if _, err := s.events.Add(ctx, orderevents.New(o, oldStatus, source)); err != nil {
 		log.Error().
-			Err(err).
-			Int("ID", order.ID).
-			Str("number", orderNumber).
-			Str("status", string(newStatus)).
-			Stringer("accrual", accrual).
-			Msg("Failed to update order status")
+			Err(err).Str("order", o.Number).Str("status", string(o.Status)).
+			Msg("Failed to record order status transition")
 		return err
 	}
 	return nil
 }
 
-// GetUserOrders returns all orders submitted by the specified user
-func (s Service) GetUserOrders(ctx context.Context, userID int) ([]orders.Order, error) {
-	return s.orders.GetListForUser(ctx, userID)
+// GetOrderHistory returns the status transitions of the user's order in chronological order.
+// Orders uploaded by other users are reported as not found
+func (s Service) GetOrderHistory(ctx context.Context, number string, userID int) ([]orderevents.Event, error) {
+	o, err := s.orders.GetByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if o.User.ID != userID {
+		return nil, orders.ErrOrderNotFound
+	}
+	return s.events.GetListForOrder(ctx, o.ID)
+}
+
+// OrderDetails is an order along with its place in the processing queue.
+// Queue is nil unless the order is waiting to be checked with the accrual system
+type OrderDetails struct {
+	orders.Order
+	Queue *queue.Position
+}
+
+// GetUserOrder returns the user's order along with its place in the processing queue.
+// Orders uploaded by other users are reported as not found
+func (s Service) GetUserOrder(ctx context.Context, number string, userID int) (OrderDetails, error) {
+	o, err := s.orders.GetByNumber(ctx, number)
+	if err != nil {
+		return OrderDetails{}, err
+	}
+	if o.User.ID != userID {
+		return OrderDetails{}, orders.ErrOrderNotFound
+	}
+	details := OrderDetails{Order: o}
+	if o.Status.IsFinal() {
+		return details, nil
+	}
+	pos, err := s.processing.Position(ctx, number)
+	switch {
+	case err == nil:
+		details.Queue = &pos
+	case !errors.Is(err, queue.ErrNotQueued):
+		return OrderDetails{}, err
+	}
+	return details, nil
+}
+
+// ApplyAccrualResult applies the order status pushed by the accrual system.
+// The result is handled the same way as the status obtained by polling the accrual system,
+// so the points are credited to the user once the order is processed.
+// The order stays in the processing queue and is removed from it once picked, as its status is final by then
+func (s Service) ApplyAccrualResult(ctx context.Context, result accrual.OrderStatus) error {
+	log.Info().Str("order", result.Number).Str("status", result.Status).Msg("Received order result from accrual system")
+	return s.handleProcessingResult(ctx, result.Number, result, orderevents.SourceWebhook)
+}
+
+// changeStatus moves the order to the new status, unless the transition is not allowed
+func changeStatus(o *orders.Order, newStatus orders.OrderStatus) error {
+	if !o.Status.CanTransitionTo(newStatus) {
+		log.Warn().
+			Str("order", o.Number).Str("from", string(o.Status)).Str("to", string(newStatus)).
+			Msg("Refusing illegal order status transition")
+		return ErrOrderStatusTransitionNotAllowed
+	}
+	o.Status = newStatus
+	return nil
+}
+
+// GetUserOrdersPage returns a page of the orders submitted by the specified user.
+// Unless the page is the last one, the cursor pointing at the next page is returned along with the page.
+// Zero limit returns every matching order at once
+func (s Service) GetUserOrdersPage(
+	ctx context.Context, userID int, q orders.ListQuery,
+) ([]orders.Order, *pagination.Cursor, error) {
+	if q.Limit == 0 {
+		items, err := s.orders.GetPageForUser(ctx, userID, q)
+		return items, nil, err
+	}
+	// fetch an extra order to tell whether there is another page
+	limit := q.Limit
+	q.Limit++
+	items, err := s.orders.GetPageForUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+	items = items[:limit]
+	last := items[limit-1]
+	return items, &pagination.Cursor{Time: last.UploadedAt, ID: last.ID}, nil
+}
+
+// RequeueUnfinishedOrders scans the repository for orders whose status is not final yet
+// and pushes them into the processing queue, so that their status is eventually checked
+// with the accrual system even if the queue has lost them, e.g. because of a restart.
+// Orders are scanned in batches of specified size.
+// The method returns the number of orders pushed into the queue.
+// Once the queue is full, the scan stops and queue.ErrQueueIsFull is returned
+func (s Service) RequeueUnfinishedOrders(ctx context.Context, batchSize int) (int, error) {
+	var requeued, afterID int
+	unfinished := []orders.OrderStatus{orders.OrderStatusNew, orders.OrderStatusProcessing}
+	for {
+		batch, err := s.orders.GetListByStatus(ctx, unfinished, afterID, batchSize)
+		if err != nil {
+			return requeued, err
+		}
+		for _, o := range batch {
+			if err := s.processing.Push(ctx, o.Number); err != nil {
+				if !errors.Is(err, queue.ErrQueueIsFull) {
+					log.Error().Err(err).Str("order", o.Number).Msg("Failed to requeue unfinished order")
+				}
+				return requeued, err
+			}
+			requeued++
+			afterID = o.ID
+		}
+		if len(batch) == 0 || len(batch) < batchSize {
+			return requeued, nil
+		}
+	}
+}
+
+// GetFailedOrders returns a batch of orders that have run out of processing attempts.
+// The next batch starts after the order with the ID specified in afterID
+func (s Service) GetFailedOrders(ctx context.Context, afterID int, limit int) ([]orders.Order, error) {
+	return s.orders.GetListByStatus(ctx, []orders.OrderStatus{orders.OrderStatusFailed}, afterID, limit)
+}
+
+// RequeueFailedOrder gives an order that has run out of processing attempts another chance.
+// The order's attempts are reset and the order is put back into the processing queue.
+// The operation is atomic, so the order remains failed unless it is successfully queued
+func (s Service) RequeueFailedOrder(ctx context.Context, number string) (orders.Order, error) {
+	var order orders.Order
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		o, err := s.orders.GetByNumber(txCtx, number)
+		if err != nil {
+			return err
+		}
+		if o.Status != orders.OrderStatusFailed {
+			return ErrOrderIsNotFailed
+		}
+		if err = changeStatus(&o, orders.OrderStatusNew); err != nil {
+			return err
+		}
+		// the order may have been given another chance in the meantime
+		if err = s.orders.ChangeStatus(txCtx, o.ID, orders.OrderStatusFailed, o.Status); err != nil {
+			if errors.Is(err, orders.ErrOrderStatusChanged) {
+				return ErrOrderIsNotFailed
+			}
+			return err
+		}
+		o.Attempts = 0
+		o.NextCheckAt = time.Time{}
+		if err = s.orders.SetAttempts(txCtx, o.Number, o.Attempts, o.NextCheckAt); err != nil {
+			return err
+		}
+		if err = s.recordEvent(txCtx, o, orders.OrderStatusFailed, orderevents.SourceAdmin); err != nil {
+			return err
+		}
+		if err = s.processing.Push(txCtx, o.Number); err != nil {
+			log.Error().Err(err).Str("order", o.Number).Msg("Failed to return failed order to queue")
+			return err
+		}
+		order = o
+		return nil
+	})
+	if err != nil {
+		return orders.Blank, err
+	}
+	log.Info().Str("order", number).Msg("Failed order is returned to queue")
+	return order, nil
 }
 
 // ProcessingLength returns the current length of the processing queue,
@@ -127,49 +377,135 @@ func (s *Service) ProcessingLength(ctx context.Context) (int, error) {
 // and then checks the order's status in the accrual system.
 // Depending on the result of the check, the order may be marked as processed or invalid,
 // or put back into the queue for further processing, until the order's status is finalized.
+// The order is leased rather than removed from the queue, so that it is delivered again
+// in case the service fails to handle the order before the lease expires.
 // The method returns a channel that the caller is recommended to wait on
 // before starting to process the next order.
 // The returned channel contains a timer with varying duration.
-// In its turn, the varying duration depends on the busyness of the accrual system
+// In its turn, the varying duration depends on the busyness of the accrual system.
+// The method is safe to be called concurrently. Once the accrual system asks to wait,
+// no order is picked from the queue by any caller until the requested time has passed
 func (s *Service) ProcessNextOrder(ctx context.Context) <-chan time.Time {
-	orderNumber, err := s.processing.Pop(ctx)
+	// the accrual system is known to be unavailable or has asked to slow down, don't bother picking orders
+	if wait := s.AccrualService.Backoff(); wait > 0 {
+		log.Debug().Dur("wait", wait).Msg("Accrual system is unavailable")
+		return time.After(wait)
+	}
+	lease, err := s.processing.Lease(ctx, s.leaseTimeout)
 	if err != nil {
 		// queue is currently empty, wait a bit
 		if errors.Is(err, queue.ErrQueueIsEmpty) {
 			log.Debug().Msg("Accrual order queue is empty")
 			return time.After(PostProcessWaitOnEmptyQueue)
 		}
-		log.Error().Err(err).Str("order", orderNumber).Msg("Unable to retrieve order from queue")
+		log.Error().Err(err).Msg("Unable to retrieve order from queue")
 		return time.After(PostProcessWaitOnError)
 	}
+	orderNumber := lease.OrderNumber
+
+	if !s.isDueForCheck(ctx, lease) {
+		return time.After(PostProcessWaitOnFinishedRun)
+	}
 
 	log.Info().Str("order", orderNumber).Msg("Checking order in accrual system")
-	orderStatus, err := s.AccrualService.CheckOrder(orderNumber)
+	orderStatus, err := s.AccrualService.CheckOrder(ctx, orderNumber)
+	s.markChecked(ctx, orderNumber, err)
 
 	if err != nil {
-		// try to put back order to the queue, unless the error was successfully handled
-		customWait, handleErr := s.handleProcessingError(ctx, err, orderNumber)
-		if handleErr != nil && !errors.Is(handleErr, ErrOrderProcessingErrorIsHandled) {
-			s.maybeResubmitOrder(ctx, orderNumber)
-		}
-		// unless the accrual system wants us to wait for specific duration,
-		// use the standard timer
-		if customWait != nil {
-			return customWait
-		}
-		return time.After(PostProcessWaitOnError)
+		return s.settleFailedCheck(ctx, lease, err)
+	}
+	s.settleCheckedOrder(ctx, lease, orderStatus)
+	return time.After(PostProcessWaitOnFinishedRun)
+}
+
+// markChecked records the time the order has been checked with the accrual system.
+// The checks that have never reached the accrual system are not recorded
+func (s *Service) markChecked(ctx context.Context, orderNumber string, checkErr error) {
+	if ctx.Err() != nil || errors.Is(checkErr, accrual.ErrCircuitOpen) {
+		return
+	}
+	if err := s.orders.MarkChecked(ctx, orderNumber, time.Now()); err != nil {
+		log.Warn().Err(err).Str("order", orderNumber).Msg("Failed to record order check time")
 	}
+}
+
+// settleFailedCheck decides the fate of a leased order whose check with the accrual system has failed.
+// The returned channel is to be waited on before processing the next order
+func (s *Service) settleFailedCheck(ctx context.Context, lease queue.Lease, err error) <-chan time.Time {
+	// try to put back order to the queue, unless the error was successfully handled
+	var tooManyReqs *accrual.TooManyRequestError
+	var timeout *accrual.TimeoutError
+	customWait, handleErr := s.handleProcessingError(ctx, err, lease.OrderNumber)
+	switch {
+	case handleErr == nil,
+		errors.Is(handleErr, ErrOrderProcessingErrorIsHandled),
+		errors.Is(handleErr, ErrOrderStatusTransitionNotAllowed):
+		s.acknowledgeOrder(ctx, lease)
+	case errors.As(handleErr, &tooManyReqs),
+		errors.As(handleErr, &timeout),
+		errors.Is(handleErr, accrual.ErrCircuitOpen):
+		// the order is not to blame for the busy accrual system
+		s.maybeResubmitOrder(ctx, lease, 0)
+	case ctx.Err() != nil:
+		// the service is shutting down, the order is delivered again once its lease has expired
+		log.Info().Str("order", lease.OrderNumber).Msg("Order check is interrupted")
+	default:
+		s.retryFailedOrder(ctx, lease)
+	}
+	// unless the accrual system wants us to wait for specific duration,
+	// use the standard timer
+	if customWait != nil {
+		return customWait
+	}
+	return time.After(PostProcessWaitOnError)
+}
 
-	if handleErr := s.handleProcessingResult(ctx, orderNumber, orderStatus); handleErr != nil {
+// settleCheckedOrder applies the status reported by the accrual system to a leased order.
+// The order is removed from the queue once its status is final
+func (s *Service) settleCheckedOrder(ctx context.Context, lease queue.Lease, orderStatus accrual.OrderStatus) {
+	handleErr := s.handleProcessingResult(ctx, lease.OrderNumber, orderStatus, orderevents.SourceAccrual)
+	switch {
+	case handleErr == nil:
+		s.acknowledgeOrder(ctx, lease)
+	case errors.Is(handleErr, ErrOrderIsNotProcessedYet):
+		// return the order to the queue, so it will be checked later
+		s.maybeResubmitOrder(ctx, lease, 0)
+	case errors.Is(handleErr, ErrOrderStatusTransitionNotAllowed):
+		// the order's status has been finalized elsewhere
+		s.acknowledgeOrder(ctx, lease)
+	default:
 		log.Warn().
-			Err(handleErr).Str("order", orderNumber).Str("status", orderStatus.Status).
+			Err(handleErr).Str("order", lease.OrderNumber).Str("status", orderStatus.Status).
 			Msg("Failed to handle checked order")
-		// return the order to the queue, so it will be checked later
 		// better luck next time
-		s.maybeResubmitOrder(ctx, orderNumber)
+		s.retryFailedOrder(ctx, lease)
 	}
+}
 
-	return time.After(PostProcessWaitOnFinishedRun)
+// isDueForCheck tells whether a leased order should be checked with the accrual system right now.
+// The order is removed from the queue if it is either unknown or its status is already final,
+// e.g. when the order's lease has expired right before it was finalized.
+// The order is also returned to the queue if it has failed recently and its backoff has not expired yet
+func (s *Service) isDueForCheck(ctx context.Context, lease queue.Lease) bool {
+	o, err := s.orders.GetByNumber(ctx, lease.OrderNumber)
+	switch {
+	case errors.Is(err, orders.ErrOrderNotFound):
+		log.Warn().Str("order", lease.OrderNumber).Msg("Removing unknown order from queue")
+		s.acknowledgeOrder(ctx, lease)
+		return false
+	case err != nil:
+		// let the accrual system decide
+		return true
+	case o.Status.IsFinal():
+		log.Info().Str("order", lease.OrderNumber).Str("status", string(o.Status)).Msg("Order is already finalized")
+		s.acknowledgeOrder(ctx, lease)
+		return false
+	case o.NextCheckAt.After(time.Now()):
+		log.Debug().Str("order", lease.OrderNumber).Time("nextCheckAt", o.NextCheckAt).Msg("Order is not due for check yet")
+		s.maybeResubmitOrder(ctx, lease, time.Until(o.NextCheckAt))
+		return false
+	}
+	return true
 }
 
 func (s *Service) handleProcessingError(ctx context.Context, err error, orderNumber string) (<-chan time.Time, error) {
@@ -178,7 +514,9 @@ func (s *Service) handleProcessingError(ctx context.Context, err error, orderNum
 	if errors.Is(err, accrual.ErrOrderNotFound) {
 		log.Warn().Str("order", orderNumber).Msg("Order could not be found in accrual system")
 		// We mark it invalid and never return to this order again, unless there is a problem saving the status
-		updErr := s.UpdateOrderStatus(ctx, orderNumber, orders.OrderStatusInvalid, decimal.NewFromInt(0))
+		updErr := s.UpdateOrderStatus(
+			ctx, orderNumber, orders.OrderStatusInvalid, decimal.NewFromInt(0), orderevents.SourceAccrual,
+		)
 		if updErr != nil {
 			log.Error().
 				Err(updErr).Str("order", orderNumber).
@@ -194,38 +532,84 @@ func (s *Service) handleProcessingError(ctx context.Context, err error, orderNum
 			Msg("Accrual system is busy")
 		return time.After(time.Second * time.Duration(tooManyReqs.RetryAfter)), tooManyReqs
 	}
+	// the check has been aborted by the caller
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	// the circuit breaker has opened while the order was being picked
+	if errors.Is(err, accrual.ErrCircuitOpen) {
+		log.Debug().Str("order", orderNumber).Msg("Accrual system is unavailable")
+		return nil, err
+	}
+	// accrual system is struggling, give it some time to recover
+	var timeout *accrual.TimeoutError
+	if errors.As(err, &timeout) {
+		log.Warn().Err(err).Str("order", orderNumber).Msg("Accrual system has timed out")
+		return time.After(PostProcessWaitOnTimeout), timeout
+	}
 	log.Error().Err(err).Str("order", orderNumber).Msg("Failed to check order status at accrual system")
 	return nil, err
 }
 
-func (s *Service) handleProcessingResult(ctx context.Context, orderNumber string, os accrual.OrderStatus) error {
+func (s *Service) handleProcessingResult(
+	ctx context.Context, orderNumber string, os accrual.OrderStatus, source orderevents.Source,
+) error {
 	logOrderStatus := log.Info().Str("order", orderNumber).Str("status", os.Status)
 	switch os.Status {
 	case "INVALID":
 		logOrderStatus.Msg("Order is not eligible for accrual")
-		err := s.UpdateOrderStatus(ctx, orderNumber, orders.OrderStatusInvalid, decimal.NewFromInt(0))
+		o, changed, err := s.updateOrderStatus(
+			ctx, orderNumber, orders.OrderStatusInvalid, decimal.NewFromInt(0), source,
+		)
 		if err != nil {
 			return err
 		}
+		if changed {
+			s.publishOrderStatus(ctx, o)
+		}
 	case "PROCESSED":
 		logOrderStatus.Stringer("points", os.Accrual).Msg("Points accrued for order")
+		var processed orders.Order
 		txErr := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
-			if err := s.UpdateOrderStatus(txCtx, orderNumber, orders.OrderStatusProcessed, os.Accrual); err != nil {
-				return err
-			}
-			o, err := s.orders.GetByNumber(txCtx, orderNumber)
+			o, _, err := s.updateOrderStatus(
+				txCtx, orderNumber, orders.OrderStatusProcessed, os.Accrual, source,
+			)
 			if err != nil {
 				return err
 			}
 			if err := s.users.AccruePoints(txCtx, o.User.ID, os.Accrual); err != nil {
 				return err
 			}
+			// orders that earn nothing are not worth a ledger entry
+			if os.Accrual.IsPositive() {
+				if _, err := s.ledger.Add(txCtx, ledgerentries.NewAccrual(o.User.ID, o.Number, os.Accrual)); err != nil {
+					return err
+				}
+			}
+			if err := s.recordBalance(txCtx, o.User.ID); err != nil {
+				return err
+			}
+			processed = o
 			return nil
 		})
 		if txErr != nil {
 			log.Error().Err(txErr).Str("order", orderNumber).Msg("Failed to accrue points for order")
 			return txErr
 		}
+		s.publishOrderStatus(ctx, processed)
+		s.publishBalance(ctx, processed.User.ID)
+	case "PROCESSING":
+		// let the user know that the accrual system has started processing the order
+		logOrderStatus.Msg("Order is being processed")
+		o, changed, err := s.updateOrderStatus(
+			ctx, orderNumber, orders.OrderStatusProcessing, decimal.NewFromInt(0), source,
+		)
+		if err != nil {
+			log.Warn().Err(err).Str("order", orderNumber).Msg("Failed to mark order as processing")
+		} else if changed {
+			s.publishOrderStatus(ctx, o)
+		}
+		return ErrOrderIsNotProcessedYet
 	default:
 		// other statuses are not finial, so we put back the order into the queue
 		logOrderStatus.Msg("Order is not processed yet")
@@ -234,12 +618,113 @@ func (s *Service) handleProcessingResult(ctx context.Context, orderNumber string
 	return nil
 }
 
-func (s *Service) maybeResubmitOrder(ctx context.Context, orderNumber string) {
-	log.Info().Str("order", orderNumber).Msg("Returning order to queue")
-	if err := s.processing.Push(ctx, orderNumber); err != nil {
+// publishOrderStatus lets the order's owner know that the order has moved to another status.
+// The event is published once the change has been committed, a failure to publish it is only logged
+func (s *Service) publishOrderStatus(ctx context.Context, o orders.Order) {
+	if err := s.publisher.Publish(ctx, orderStatusEvent(o)); err != nil {
+		log.Warn().Err(err).Str("order", o.Number).Msg("Failed to publish order status")
+	}
+}
+
+// publishBalance lets the user know about the user's balance as it is after a change.
+// The balance is obtained anew once the change has been committed, a failure to publish it is only logged
+func (s *Service) publishBalance(ctx context.Context, userID int) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to obtain balance to publish")
+		return
+	}
+	e := pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held)
+	if err = s.publisher.Publish(ctx, e); err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to publish balance")
+	}
+}
+
+func (s *Service) acknowledgeOrder(ctx context.Context, lease queue.Lease) {
+	if err := s.processing.Ack(ctx, lease); err != nil {
+		log.Error().
+			Err(err).
+			Str("order", lease.OrderNumber).
+			Msg("Unable to remove order from queue")
+	}
+}
+
+func (s *Service) maybeResubmitOrder(ctx context.Context, lease queue.Lease, delay time.Duration) {
+	log.Info().Str("order", lease.OrderNumber).Dur("delay", delay).Msg("Returning order to queue")
+	if err := s.processing.Nack(ctx, lease, delay); err != nil {
 		log.Error().
 			Err(err).
-			Str("order", orderNumber).
+			Str("order", lease.OrderNumber).
 			Msg("Unable to return order to queue")
 	}
 }
+
+// retryFailedOrder records a failed attempt to process the order
+// and returns the order to the queue, so that it is checked again once its backoff has expired.
+// Once the order has run out of attempts, it is moved to the dead-letter status
+// and removed from the queue instead
+func (s *Service) retryFailedOrder(ctx context.Context, lease queue.Lease) {
+	orderNumber := lease.OrderNumber
+	o, err := s.orders.GetByNumber(ctx, orderNumber)
+	if err != nil {
+		log.Error().Err(err).Str("order", orderNumber).Msg("Unable to record failed attempt for order")
+		s.maybeResubmitOrder(ctx, lease, s.retryPolicy.Backoff(1))
+		return
+	}
+	o.Attempts++
+	if s.retryPolicy.Exhausted(o.Attempts) {
+		oldStatus := o.Status
+		if err = changeStatus(&o, orders.OrderStatusFailed); err != nil {
+			// the order has been finalized in the meantime
+			s.acknowledgeOrder(ctx, lease)
+			return
+		}
+		o.NextCheckAt = time.Time{}
+		err = s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+			if updErr := s.orders.ChangeStatus(txCtx, o.ID, oldStatus, o.Status); updErr != nil {
+				return updErr
+			}
+			if updErr := s.orders.SetAttempts(txCtx, o.Number, o.Attempts, o.NextCheckAt); updErr != nil {
+				return updErr
+			}
+			return s.recordEvent(txCtx, o, oldStatus, orderevents.SourceAccrual)
+		})
+		if err != nil {
+			if errors.Is(err, orders.ErrOrderStatusChanged) {
+				// the order has moved on in the meantime, it's skipped once leased again if it's final by then
+				log.Info().Str("order", orderNumber).Msg("Order status has changed before it could be failed")
+			} else {
+				log.Error().Err(err).Str("order", orderNumber).Msg("Failed to move order to failed status")
+			}
+			s.maybeResubmitOrder(ctx, lease, s.retryPolicy.Backoff(o.Attempts))
+			return
+		}
+		log.Warn().Str("order", orderNumber).Int("attempts", o.Attempts).Msg("Order has run out of processing attempts")
+		s.acknowledgeOrder(ctx, lease)
+		return
+	}
+	backoff := s.retryPolicy.Backoff(o.Attempts)
+	o.NextCheckAt = time.Now().Add(backoff)
+	if err = s.orders.SetAttempts(ctx, o.Number, o.Attempts, o.NextCheckAt); err != nil {
+		log.Error().Err(err).Str("order", orderNumber).Msg("Failed to record failed attempt for order")
+	} else {
+		log.Info().
+			Str("order", orderNumber).Int("attempts", o.Attempts).Dur("backoff", backoff).
+			Msg("Order is scheduled for another attempt")
+	}
+	s.maybeResubmitOrder(ctx, lease, time.Until(o.NextCheckAt))
+}
+
+// recordBalance passes the user's balance as it is within the transaction of a change to the outbox.
+// Unlike publishing, a failure to record the balance fails the change
+func (s *Service) recordBalance(ctx context.Context, userID int) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Publish(ctx, pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held))
+}
+
+func orderStatusEvent(o orders.Order) pubsub.Event {
+	return pubsub.NewOrderEvent(o.User.ID, o.Number, string(o.Status), o.Accrual)
+}
@@ -3,6 +3,8 @@ package order_test
 import (
 	"context"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,14 +13,21 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orderevents"
+	edb "github.com/sergeii/practikum-go-gophermart/internal/core/orderevents/postgres"
 	orepo "github.com/sergeii/practikum-go-gophermart/internal/core/orders"
 	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
 	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/breaker"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual/limiter"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/queue/memory"
-	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+	qdb "github.com/sergeii/practikum-go-gophermart/internal/ports/queue/postgres"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
 	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
@@ -27,7 +36,7 @@ import (
 func newService(
 	orders orepo.Repository,
 	users urepo.Repository,
-	trans transactor.Transactor,
+	db *postgres.Database,
 	queueSize int,
 	accrualURL string,
 ) order.Service {
@@ -42,7 +51,7 @@ func newService(
 	if err != nil {
 		panic(err)
 	}
-	return order.New(orders, users, trans, q, acc)
+	return order.New(orders, edb.New(db), users, ldb.New(db), db, q, acc)
 }
 
 func TestOrderService_SubmitNewOrder_OK(t *testing.T) {
@@ -102,6 +111,108 @@ func TestOrderService_SubmitNewOrder_Duplicate(t *testing.T) {
 	assert.Equal(t, 1, qLen)
 }
 
+func TestOrderService_SubmitNewOrder_DurableQueue(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, err := qdb.New(db, 10)
+	require.NoError(t, err)
+	acc, _ := accrual.New("http://localhost:8081")
+	svc := order.New(orders, edb.New(db), users, ldb.New(db), db, q, acc)
+
+	_, err = svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	// the order is inserted, but the transaction fails to commit due to the deferred foreign key,
+	// so the order must not remain in the queue either
+	_, err = svc.SubmitNewOrder(context.TODO(), "79927398713", 9999999)
+	require.Error(t, err)
+	_, err = orders.GetByNumber(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
+	qLen, _ = svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	number, err := q.Pop(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "1234567812345670", number)
+}
+
+func TestOrderService_RequeueUnfinishedOrders(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueSize int
+		batchSize int
+		want      int
+		wantErr   error
+	}{
+		{
+			"all orders fit in one batch",
+			10,
+			10,
+			3,
+			nil,
+		},
+		{
+			"orders are scanned in several batches",
+			10,
+			2,
+			3,
+			nil,
+		},
+		{
+			"batch of a single order",
+			10,
+			1,
+			3,
+			nil,
+		},
+		{
+			"queue is not large enough",
+			2,
+			1,
+			2,
+			queue.ErrQueueIsFull,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, db, cancel := testutils.PrepareTestDatabase()
+			defer cancel()
+
+			users := udb.New(db)
+			u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+			orders := odb.New(db)
+			numbers := []string{"1234567812345670", "4561261212345467", "49927398716", "79927398713"}
+			for _, number := range numbers {
+				_, err := orders.Add(context.TODO(), orepo.New(number, u.ID))
+				require.NoError(t, err)
+			}
+			svc := newService(orders, users, db, tt.queueSize, "")
+			err := svc.UpdateOrderStatus(
+				context.TODO(), "4561261212345467", orepo.OrderStatusInvalid, decimal.Zero, orderevents.SourceAccrual,
+			)
+			require.NoError(t, err)
+
+			requeued, err := svc.RequeueUnfinishedOrders(context.TODO(), tt.batchSize)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, requeued)
+			qLen, _ := svc.ProcessingLength(context.TODO())
+			assert.Equal(t, tt.want, qLen)
+		})
+	}
+}
+
 func TestOrderService_UpdateOrderStatus_OK(t *testing.T) {
 	_, db, cancel := testutils.PrepareTestDatabase()
 	defer cancel()
@@ -119,7 +230,7 @@ func TestOrderService_UpdateOrderStatus_OK(t *testing.T) {
 
 	err = svc.UpdateOrderStatus(
 		context.TODO(), "1234567812345670",
-		orepo.OrderStatusProcessed, decimal.RequireFromString("100.5"),
+		orepo.OrderStatusProcessed, decimal.RequireFromString("100.5"), orderevents.SourceAccrual,
 	)
 	require.NoError(t, err)
 
@@ -141,11 +252,50 @@ func TestOrderService_UpdateOrderStatus_NotFound(t *testing.T) {
 	svc := newService(orders, users, db, 10, "")
 	err := svc.UpdateOrderStatus(
 		context.TODO(), "1234567812345670",
-		orepo.OrderStatusProcessed, decimal.RequireFromString("100.5"),
+		orepo.OrderStatusProcessed, decimal.RequireFromString("100.5"), orderevents.SourceAccrual,
 	)
 	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
 }
 
+func TestOrderService_UpdateOrderStatus_IllegalTransition(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, "")
+	_, err := svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusProcessing, decimal.Zero, orderevents.SourceAccrual,
+	)
+	require.NoError(t, err)
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusNew, decimal.Zero, orderevents.SourceAccrual,
+	)
+	assert.ErrorIs(t, err, order.ErrOrderStatusTransitionNotAllowed)
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670",
+		orepo.OrderStatusProcessed, decimal.RequireFromString("100.5"), orderevents.SourceAccrual,
+	)
+	require.NoError(t, err)
+
+	for _, status := range []orepo.OrderStatus{
+		orepo.OrderStatusNew, orepo.OrderStatusProcessing, orepo.OrderStatusProcessed, orepo.OrderStatusInvalid,
+	} {
+		err = svc.UpdateOrderStatus(
+			context.TODO(), "1234567812345670", status, decimal.NewFromInt(1), orderevents.SourceAccrual,
+		)
+		assert.ErrorIs(t, err, order.ErrOrderStatusTransitionNotAllowed, status)
+	}
+	upd, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, orepo.OrderStatusProcessed, upd.Status)
+	assert.Equal(t, "100.5", upd.Accrual.String())
+}
+
 func TestOrderService_UpdateOrderStatus_ConstraintErrors(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -186,7 +336,9 @@ func TestOrderService_UpdateOrderStatus_ConstraintErrors(t *testing.T) {
 			o, err := svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
 			require.NoError(t, err)
 
-			err = svc.UpdateOrderStatus(context.TODO(), "1234567812345670", tt.status, tt.accrual)
+			err = svc.UpdateOrderStatus(
+				context.TODO(), "1234567812345670", tt.status, tt.accrual, orderevents.SourceAccrual,
+			)
 			upd, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
 			require.Equal(t, o.ID, upd.ID)
 			if tt.wantErr {
@@ -373,3 +525,622 @@ func TestOrderService_ProcessNextOrder_Retry(t *testing.T) {
 	qLen, _ = os.ProcessingLength(context.TODO())
 	assert.Equal(t, 0, qLen)
 }
+
+func TestOrderService_ProcessNextOrder_PauseIsShared(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Header("Retry-After", "60")
+		c.Status(429)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL)
+	// the pause requested by the accrual system is kept by the limiter shared by all copies of the service
+	lim := limiter.New(acc)
+	svc := order.New(odb.New(db), edb.New(db), users, ldb.New(db), db, q, breaker.New(lim))
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+	_, err = svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.True(t, lim.Backoff() > time.Second*59)
+
+	// another copy of the service shares the pause, so no order is picked from the queue
+	other := svc
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			other.ProcessNextOrder(context.TODO())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 2, qLen)
+}
+
+func TestOrderService_ProcessNextOrder_Concurrent(t *testing.T) {
+	numbers := []string{
+		"1234567812345670", "4561261212345467", "79927398713", "49927398716", "100000000008",
+	}
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.NewFromInt(10),
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, ts.URL)
+	for _, number := range numbers {
+		_, err := svc.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+
+	ctx, stop := context.WithTimeout(context.TODO(), time.Millisecond*300)
+	defer stop()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait := svc.ProcessNextOrder(ctx)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-wait:
+					wait = svc.ProcessNextOrder(ctx)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, number := range numbers {
+		o, _ := orders.GetByNumber(context.TODO(), number)
+		assert.Equal(t, orepo.OrderStatusProcessed, o.Status, number)
+		assert.Equal(t, "10", o.Accrual.String())
+	}
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "50", u.Balance.Current.String())
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+}
+
+func TestOrderService_ProcessNextOrder_DeadLetter(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Status(500)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL)
+	svc := order.New(
+		orders, edb.New(db), users, ldb.New(db), db, q, acc,
+		order.WithRetryPolicy(order.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond * 100}),
+	)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	// first attempt fails, the order is postponed
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusNew, o.Status)
+	assert.Equal(t, 1, o.Attempts)
+	assert.True(t, o.NextCheckAt.After(time.Now()))
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	// the order is not checked until its backoff expires
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	qLen, _ = svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	// second attempt fails, the order has run out of attempts
+	<-time.After(time.Until(o.NextCheckAt) + time.Millisecond*50)
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	o, _ = orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusFailed, o.Status)
+	assert.Equal(t, 2, o.Attempts)
+	qLen, _ = svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+
+	failed, err := svc.GetFailedOrders(context.TODO(), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "79927398713", failed[0].Number)
+
+	// operator gives the order another chance
+	requeued, err := svc.RequeueFailedOrder(context.TODO(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, orepo.OrderStatusNew, requeued.Status)
+	o, _ = orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusNew, o.Status)
+	assert.Equal(t, 0, o.Attempts)
+	assert.True(t, o.NextCheckAt.IsZero())
+	qLen, _ = svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	_, err = svc.RequeueFailedOrder(context.TODO(), "79927398713")
+	assert.ErrorIs(t, err, order.ErrOrderIsNotFailed)
+	_, err = svc.RequeueFailedOrder(context.TODO(), "1234567812345670")
+	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
+}
+
+func TestOrderService_ProcessNextOrder_LeaseRedelivery(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.NewFromInt(10),
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL)
+	svc := order.New(orders, edb.New(db), users, ldb.New(db), db, q, acc, order.WithLeaseTimeout(time.Minute))
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	// another worker leases the order and never comes back
+	_, err = q.Lease(context.TODO(), time.Millisecond*50)
+	require.NoError(t, err)
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	// once the lease has expired, the order is delivered again
+	<-time.After(time.Millisecond * 100)
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusProcessed, o.Status)
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+
+	// an already finalized order is removed from the queue without being checked again
+	require.NoError(t, q.Push(context.TODO(), "79927398713"))
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	qLen, _ = svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "10", u.Balance.Current.String())
+}
+
+func TestOrderService_ProcessNextOrder_RedeliveredResult(t *testing.T) {
+	var calls int32
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		// the first check is answered only after the order has been processed by another worker
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(checking)
+			<-release
+		}
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.NewFromInt(10),
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL)
+	svc := order.New(orders, edb.New(db), users, ldb.New(db), db, q, acc)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+	// the order is delivered twice, e.g. after its lease has expired
+	require.NoError(t, q.Push(context.TODO(), "79927398713"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.ProcessNextOrder(context.TODO())
+	}()
+	<-checking
+	svc.ProcessNextOrder(context.TODO())
+	close(release)
+	<-done
+
+	// the result is applied only once, however many times it is delivered
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusProcessed, o.Status)
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "10", u.Balance.Current.String())
+	history, _ := svc.GetOrderHistory(context.TODO(), "79927398713", u.ID)
+	assert.Len(t, history, 1)
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+}
+
+func TestOrderService_ProcessNextOrder_Processing(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		status := "REGISTERED"
+		switch atomic.AddInt32(&calls, 1) {
+		case 2:
+			status = "PROCESSING"
+		case 3:
+			status = "PROCESSED"
+		}
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: status, Accrual: decimal.NewFromInt(10),
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, ts.URL)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	wantStatuses := []orepo.OrderStatus{
+		orepo.OrderStatusNew, orepo.OrderStatusProcessing, orepo.OrderStatusProcessed,
+	}
+	for i, want := range wantStatuses {
+		svc.ProcessNextOrder(context.TODO())
+		assert.Equal(t, int32(i+1), atomic.LoadInt32(&calls))
+		o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+		assert.Equal(t, want, o.Status)
+	}
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "10", u.Balance.Current.String())
+}
+
+func TestOrderService_GetOrderHistory(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(context.TODO(), urepo.New("othercustomer", "secr3t"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, "")
+	_, err := svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+
+	history, err := svc.GetOrderHistory(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 0)
+
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusProcessing, decimal.Zero, orderevents.SourceAccrual,
+	)
+	require.NoError(t, err)
+	// the same status is not recorded twice
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusProcessing, decimal.Zero, orderevents.SourceAccrual,
+	)
+	require.NoError(t, err)
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusProcessed, decimal.NewFromInt(42), orderevents.SourceWebhook,
+	)
+	require.NoError(t, err)
+	// illegal transitions are not recorded
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusInvalid, decimal.Zero, orderevents.SourceAdmin,
+	)
+	require.ErrorIs(t, err, order.ErrOrderStatusTransitionNotAllowed)
+
+	history, err = svc.GetOrderHistory(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, orepo.OrderStatusNew, history[0].OldStatus)
+	assert.Equal(t, orepo.OrderStatusProcessing, history[0].NewStatus)
+	assert.Equal(t, orderevents.SourceAccrual, history[0].Source)
+	assert.Equal(t, orepo.OrderStatusProcessing, history[1].OldStatus)
+	assert.Equal(t, orepo.OrderStatusProcessed, history[1].NewStatus)
+	assert.Equal(t, "42", history[1].Accrual.String())
+	assert.Equal(t, orderevents.SourceWebhook, history[1].Source)
+
+	_, err = svc.GetOrderHistory(context.TODO(), "1234567812345670", other.ID)
+	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
+	_, err = svc.GetOrderHistory(context.TODO(), "79927398713", u.ID)
+	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
+}
+
+func TestOrderService_UpdateOrderStatus_HistoryIsAtomic(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, "")
+	_, err := svc.SubmitNewOrder(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+
+	// the event cannot be recorded, so the order's status is not updated either
+	err = svc.UpdateOrderStatus(
+		context.TODO(), "1234567812345670", orepo.OrderStatusInvalid, decimal.Zero, orderevents.Source("foo"),
+	)
+	require.Error(t, err)
+	o, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, orepo.OrderStatusNew, o.Status)
+	history, err := svc.GetOrderHistory(context.TODO(), "1234567812345670", u.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 0)
+}
+
+func TestOrderService_ProcessNextOrder_Timeout(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(time.Second):
+		}
+		c.Status(204)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL, accrual.WithTimeout(time.Millisecond*50))
+	cb := breaker.New(acc, breaker.WithFailureThreshold(1), breaker.WithCoolDown(time.Minute))
+	svc := order.New(orders, edb.New(db), users, ldb.New(db), db, q, cb)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	// the order is not to blame for the timeout
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusNew, o.Status)
+	assert.Equal(t, 0, o.Attempts)
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+
+	// the timeout counts towards the breaker, which pauses processing for everyone
+	assert.Equal(t, breaker.StateOpen, cb.Stats().State)
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestOrderService_ProcessNextOrder_Cancelled(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(time.Second):
+		}
+		c.Status(204)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, ts.URL)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	ctx, stop := context.WithCancel(context.TODO())
+	time.AfterFunc(time.Millisecond*50, stop)
+	before := time.Now()
+	svc.ProcessNextOrder(ctx)
+	assert.Less(t, time.Since(before), time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusNew, o.Status)
+	assert.Equal(t, 0, o.Attempts)
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 1, qLen)
+}
+
+func TestOrderService_ProcessNextOrder_CircuitBreaker(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Status(500)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	q, _ := memory.New(10)
+	acc, _ := accrual.New(ts.URL)
+	cb := breaker.New(acc, breaker.WithFailureThreshold(2), breaker.WithCoolDown(time.Minute))
+	svc := order.New(orders, edb.New(db), users, ldb.New(db), db, q, cb)
+	for _, number := range []string{"1234567812345670", "4561261212345467", "79927398713"} {
+		_, err := svc.SubmitNewOrder(context.TODO(), number, u.ID)
+		require.NoError(t, err)
+	}
+
+	svc.ProcessNextOrder(context.TODO())
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, breaker.StateOpen, cb.Stats().State)
+
+	// the processing is paused without picking orders from the queue
+	for i := 0; i < 3; i++ {
+		svc.ProcessNextOrder(context.TODO())
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, 0, o.Attempts)
+	lease, err := q.Lease(context.TODO(), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", lease.OrderNumber)
+}
+
+func TestOrderService_ApplyAccrualResult(t *testing.T) {
+	var calls int32
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.NewFromInt(10),
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, ts.URL)
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	result := accrual.OrderStatus{Number: "79927398713", Status: "PROCESSED", Accrual: decimal.NewFromInt(42)}
+	require.NoError(t, svc.ApplyAccrualResult(context.TODO(), result))
+	o, _ := orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, orepo.OrderStatusProcessed, o.Status)
+	assert.Equal(t, "42", o.Accrual.String())
+	history, _ := svc.GetOrderHistory(context.TODO(), "79927398713", u.ID)
+	require.Len(t, history, 1)
+	assert.Equal(t, orderevents.SourceWebhook, history[0].Source)
+
+	// the pushed result is final, so the points are not accrued again
+	err = svc.ApplyAccrualResult(context.TODO(), result)
+	assert.ErrorIs(t, err, order.ErrOrderStatusTransitionNotAllowed)
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "42", u.Balance.Current.String())
+	entries, _ := ldb.New(db).GetPageForUser(context.TODO(), u.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 1)
+	assert.Equal(t, ledgerentries.KindAccrual, entries[0].Kind)
+	assert.Equal(t, "79927398713", entries[0].OrderNumber)
+	assert.Equal(t, "42", entries[0].Balance.String())
+
+	// the order is dropped from the queue without checking it with the accrual system
+	svc.ProcessNextOrder(context.TODO())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+	qLen, _ := svc.ProcessingLength(context.TODO())
+	assert.Equal(t, 0, qLen)
+
+	err = svc.ApplyAccrualResult(context.TODO(), accrual.OrderStatus{Number: "1234567812345670", Status: "INVALID"})
+	assert.ErrorIs(t, err, orepo.ErrOrderNotFound)
+}
+
+func TestOrderService_ApplyAccrualResult_Concurrent(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+
+	orders := odb.New(db)
+	svc := newService(orders, users, db, 10, "http://localhost:1")
+	_, err := svc.SubmitNewOrder(context.TODO(), "79927398713", u.ID)
+	require.NoError(t, err)
+
+	result := accrual.OrderStatus{Number: "79927398713", Status: "PROCESSED", Accrual: decimal.NewFromInt(42)}
+	var wg sync.WaitGroup
+	var applied int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applyErr := svc.ApplyAccrualResult(context.TODO(), result)
+			if applyErr == nil {
+				atomic.AddInt32(&applied, 1)
+				return
+			}
+			assert.ErrorIs(t, applyErr, order.ErrOrderStatusTransitionNotAllowed)
+		}()
+	}
+	wg.Wait()
+
+	// the points are credited only once
+	assert.Equal(t, int32(1), atomic.LoadInt32(&applied))
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "42", u.Balance.Current.String())
+	history, _ := svc.GetOrderHistory(context.TODO(), "79927398713", u.ID)
+	assert.Len(t, history, 1)
+}
@@ -0,0 +1,53 @@
+package order
+
+import (
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/random"
+)
+
+const (
+	DefaultMaxAttempts    = 10
+	DefaultRetryBaseDelay = time.Second
+	DefaultRetryMaxDelay  = time.Minute * 10
+)
+
+// RetryPolicy controls how many times a failing order is checked with the accrual system
+// and how long the service waits between the attempts.
+// The wait time doubles with every failed attempt, starting from BaseDelay and up to MaxDelay
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// Backoff returns the time to wait before the next check of an order that has failed the given number of attempts.
+// The jitter spreads the retries of the orders failed at the same time,
+// so the returned duration is anywhere between the half and the full exponential delay
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(random.Int(0, int(half)))
+}
+
+// Exhausted tells whether an order that has failed the given number of attempts should not be retried anymore
+func (p RetryPolicy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
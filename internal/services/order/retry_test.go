@@ -0,0 +1,40 @@
+package order_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/services/order"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := order.RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Second * 10}
+	tests := []struct {
+		attempts int
+		wantMax  time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second * 2},
+		{3, time.Second * 4},
+		{4, time.Second * 8},
+		{5, time.Second * 10},
+		{100, time.Second * 10},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			backoff := policy.Backoff(tt.attempts)
+			assert.True(t, backoff >= tt.wantMax/2, "%d: %s", tt.attempts, backoff)
+			assert.True(t, backoff <= tt.wantMax, "%d: %s", tt.attempts, backoff)
+		}
+	}
+}
+
+func TestRetryPolicy_Exhausted(t *testing.T) {
+	policy := order.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second * 10}
+	assert.False(t, policy.Exhausted(1))
+	assert.False(t, policy.Exhausted(2))
+	assert.True(t, policy.Exhausted(3))
+	assert.True(t, policy.Exhausted(4))
+}
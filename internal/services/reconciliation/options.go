@@ -0,0 +1,37 @@
+package reconciliation
+
+import "time"
+
+const (
+	DefaultWindow    = time.Hour * 24 * 7
+	DefaultBatchSize = 100
+)
+
+type Option func(*Service)
+
+// WithPolicy configures what happens to the orders whose accrual has changed
+func WithPolicy(policy Policy) Option {
+	return func(s *Service) {
+		if policy != "" {
+			s.policy = policy
+		}
+	}
+}
+
+// WithWindow limits the reconciliation to the orders uploaded within the window
+func WithWindow(window time.Duration) Option {
+	return func(s *Service) {
+		if window > 0 {
+			s.window = window
+		}
+	}
+}
+
+// WithBatchSize configures the number of orders fetched from the database at once
+func WithBatchSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
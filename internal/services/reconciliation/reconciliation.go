@@ -0,0 +1,260 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/adjustments"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+)
+
+var ErrPolicyUnknown = errors.New("unknown reconciliation policy")
+var ErrAdjustmentIsStale = errors.New("order accrual has changed since the mismatch was found")
+
+// Policy decides what happens to the orders whose accrual has changed in the accrual system
+type Policy string
+
+const (
+	// PolicyLog only reports the mismatches in the logs
+	PolicyLog Policy = "log"
+	// PolicyReview queues the mismatches for an operator to review
+	PolicyReview Policy = "review"
+	// PolicyAdjust settles the mismatches with the users' balance right away
+	PolicyAdjust Policy = "adjust"
+)
+
+// ParsePolicy validates the policy name. An empty name stands for the default policy, which is PolicyLog
+func ParsePolicy(value string) (Policy, error) {
+	switch p := Policy(value); p {
+	case "":
+		return PolicyLog, nil
+	case PolicyLog, PolicyReview, PolicyAdjust:
+		return p, nil
+	default:
+		return "", ErrPolicyUnknown
+	}
+}
+
+// Report sums up a reconciliation run
+type Report struct {
+	Checked    int
+	Mismatched int
+	Queued     int
+	Adjusted   int
+	Skipped    int
+}
+
+type Service struct {
+	orders      orders.Repository
+	adjustments adjustments.Repository
+	users       users.Repository
+	ledger      ledgerentries.Repository
+	transactor  transactor.Transactor
+	accrual     accrual.Client
+	policy      Policy
+	window      time.Duration
+	batchSize   int
+}
+
+func New(
+	orders orders.Repository,
+	adjustments adjustments.Repository,
+	users users.Repository,
+	ledger ledgerentries.Repository,
+	transactor transactor.Transactor,
+	accrual accrual.Client,
+	opts ...Option,
+) Service {
+	s := Service{
+		orders:      orders,
+		adjustments: adjustments,
+		users:       users,
+		ledger:      ledger,
+		transactor:  transactor,
+		accrual:     accrual,
+		policy:      PolicyLog,
+		window:      DefaultWindow,
+		batchSize:   DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// Reconcile checks the processed orders uploaded within the configured window with the accrual system,
+// looking for the orders whose accrual has changed since they were processed.
+// The mismatches are handled according to the configured policy.
+// The run is aborted as soon as the accrual system fails to answer,
+// the remaining orders are checked during the next run
+func (s Service) Reconcile(ctx context.Context) (Report, error) {
+	var report Report
+	since := time.Now().Add(-s.window)
+	afterID := 0
+	for {
+		batch, err := s.orders.GetListByStatusSince(ctx, orders.OrderStatusProcessed, since, afterID, s.batchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, o := range batch {
+			if err = s.reconcileOrder(ctx, o, &report); err != nil {
+				return report, err
+			}
+		}
+		if len(batch) < s.batchSize {
+			return report, nil
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+}
+
+func (s Service) reconcileOrder(ctx context.Context, o orders.Order, report *Report) error {
+	os, err := s.accrual.CheckOrder(ctx, o.Number)
+	if err != nil {
+		if errors.Is(err, accrual.ErrOrderNotFound) {
+			log.Warn().Str("order", o.Number).Msg("Processed order is unknown to accrual system")
+			report.Skipped++
+			return nil
+		}
+		log.Warn().Err(err).Str("order", o.Number).Msg("Unable to reconcile order")
+		return err
+	}
+	report.Checked++
+	if os.Status != string(orders.OrderStatusProcessed) {
+		log.Warn().Str("order", o.Number).Str("status", os.Status).Msg("Processed order has changed its status")
+		report.Skipped++
+		return nil
+	}
+	if os.Accrual.Equal(o.Accrual) {
+		return nil
+	}
+	report.Mismatched++
+	log.Warn().
+		Str("order", o.Number).Int("userID", o.User.ID).
+		Stringer("recorded", o.Accrual).Stringer("actual", os.Accrual).
+		Msg("Order accrual mismatch")
+	switch s.policy {
+	case PolicyReview:
+		return s.queueForReview(ctx, o, os.Accrual, report)
+	case PolicyAdjust:
+		return s.adjust(ctx, o, os.Accrual, report)
+	case PolicyLog:
+	}
+	return nil
+}
+
+func (s Service) queueForReview(ctx context.Context, o orders.Order, actual decimal.Decimal, report *Report) error {
+	_, err := s.adjustments.Add(ctx, adjustments.New(o, actual, adjustments.StatusPending))
+	switch {
+	case errors.Is(err, adjustments.ErrAdjustmentIsPending):
+		log.Debug().Str("order", o.Number).Msg("Order already awaits review")
+		return nil
+	case err != nil:
+		return err
+	}
+	report.Queued++
+	return nil
+}
+
+// adjust updates the order's accrual and credits the difference to the user's balance,
+// recording the change with an applied adjustment.
+// In case the user has already spent the points that must be taken back, the mismatch is queued for review instead
+func (s Service) adjust(ctx context.Context, o orders.Order, actual decimal.Decimal, report *Report) error {
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		adj := adjustments.New(o, actual, adjustments.StatusApplied)
+		if err := s.settle(txCtx, o.Number, adj); err != nil {
+			return err
+		}
+		if _, err := s.adjustments.Add(txCtx, adj); err != nil {
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, users.ErrUserHasInsufficientBalance) {
+		log.Warn().Str("order", o.Number).Int("userID", o.User.ID).Msg("User cannot cover order accrual adjustment")
+		return s.queueForReview(ctx, o, actual, report)
+	}
+	if errors.Is(err, ErrAdjustmentIsStale) {
+		log.Warn().Str("order", o.Number).Msg("Order accrual has changed during reconciliation")
+		report.Skipped++
+		return nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("order", o.Number).Msg("Failed to adjust order accrual")
+		return err
+	}
+	report.Adjusted++
+	return nil
+}
+
+// settle moves the order's accrual to the actual one and credits the difference to the user's balance.
+// The accrual is only changed if it is still the one the adjustment has been recorded for,
+// otherwise ErrAdjustmentIsStale is returned
+func (s Service) settle(ctx context.Context, orderNumber string, adj adjustments.Adjustment) error {
+	if err := s.orders.ChangeAccrual(ctx, adj.OrderID, adj.Recorded, adj.Actual); err != nil {
+		if errors.Is(err, orders.ErrOrderAccrualChanged) {
+			return ErrAdjustmentIsStale
+		}
+		return err
+	}
+	if err := s.users.AccruePoints(ctx, adj.UserID, adj.Amount()); err != nil {
+		return err
+	}
+	if _, err := s.ledger.Add(ctx, ledgerentries.NewAdjustment(adj.UserID, orderNumber, adj.Amount())); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ApplyAdjustment settles a mismatch awaiting review with the user's balance.
+// The adjustment is not applied if the order's accrual has changed since the mismatch was found,
+// or if the user cannot cover the points that must be taken back
+func (s Service) ApplyAdjustment(ctx context.Context, id int) (adjustments.Adjustment, error) {
+	var applied adjustments.Adjustment
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		adj, err := s.adjustments.Resolve(txCtx, id, adjustments.StatusApplied)
+		if err != nil {
+			return err
+		}
+		o, err := s.orders.GetByID(txCtx, adj.OrderID)
+		if err != nil {
+			return err
+		}
+		if err = s.settle(txCtx, o.Number, adj); err != nil {
+			return err
+		}
+		applied = adj
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Int("ID", id).Msg("Failed to apply accrual adjustment")
+		return adjustments.Blank, err
+	}
+	log.Info().Int("ID", id).Int("userID", applied.UserID).Stringer("amount", applied.Amount()).Msg("Applied adjustment")
+	return applied, nil
+}
+
+// DismissAdjustment leaves the order and the user's balance as they are,
+// so that the mismatch no longer awaits review
+func (s Service) DismissAdjustment(ctx context.Context, id int) (adjustments.Adjustment, error) {
+	adj, err := s.adjustments.Resolve(ctx, id, adjustments.StatusDismissed)
+	if err != nil {
+		return adjustments.Blank, err
+	}
+	log.Info().Int("ID", id).Int("userID", adj.UserID).Msg("Dismissed adjustment")
+	return adj, nil
+}
+
+// GetPendingAdjustments returns the mismatches awaiting review.
+// The list is paginated with the ID of the last adjustment on the previous page passed as afterID
+func (s Service) GetPendingAdjustments(ctx context.Context, afterID, limit int) ([]adjustments.Adjustment, error) {
+	return s.adjustments.GetListByStatus(ctx, adjustments.StatusPending, afterID, limit)
+}
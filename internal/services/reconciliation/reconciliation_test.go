@@ -0,0 +1,278 @@
+package reconciliation_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/adjustments"
+	adb "github.com/sergeii/practikum-go-gophermart/internal/core/adjustments/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	orepo "github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/accrual"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/reconciliation"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+// accrualServer reports the current accrual for the orders known to it
+func accrualServer(current map[string]string) *httptest.Server {
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		points, ok := current[c.Param("order")]
+		if !ok {
+			c.Status(204)
+			return
+		}
+		c.JSON(200, accrual.OrderStatus{
+			Number: c.Param("order"), Status: "PROCESSED", Accrual: decimal.RequireFromString(points),
+		})
+	})
+	return httptest.NewServer(r)
+}
+
+// addProcessedOrder adds an order processed with the given accrual and credits the user with the points
+func addProcessedOrder(
+	t *testing.T, db *postgres.Database, number string, userID int, points string, uploadedAt time.Time,
+) {
+	o := orepo.New(number, userID)
+	o.UploadedAt = uploadedAt
+	o, err := odb.New(db).Add(context.TODO(), o)
+	require.NoError(t, err)
+	o.Status = orepo.OrderStatusProcessed
+	o.Accrual = decimal.RequireFromString(points)
+	require.NoError(t, odb.New(db).Update(context.TODO(), o.ID, o))
+	require.NoError(t, udb.New(db).AccruePoints(context.TODO(), userID, o.Accrual))
+}
+
+func TestReconciliation_Reconcile_Policies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      reconciliation.Policy
+		wantAccrual string
+		wantBalance string
+		wantPending int
+		wantReport  reconciliation.Report
+	}{
+		{
+			"log only",
+			reconciliation.PolicyLog,
+			"100",
+			"150",
+			0,
+			reconciliation.Report{Checked: 2, Mismatched: 1, Skipped: 1},
+		},
+		{
+			"queue for review",
+			reconciliation.PolicyReview,
+			"100",
+			"150",
+			1,
+			reconciliation.Report{Checked: 2, Mismatched: 1, Queued: 1, Skipped: 1},
+		},
+		{
+			"adjust balance",
+			reconciliation.PolicyAdjust,
+			"120.5",
+			"170.5",
+			0,
+			reconciliation.Report{Checked: 2, Mismatched: 1, Adjusted: 1, Skipped: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := accrualServer(map[string]string{
+				"1234567812345670": "120.5",
+				"79927398713":      "50",
+				"4561261212345467": "10",
+			})
+			defer ts.Close()
+			_, db, cancel := testutils.PrepareTestDatabase()
+			defer cancel()
+
+			users := udb.New(db)
+			u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+			addProcessedOrder(t, db, "1234567812345670", u.ID, "100", time.Now())
+			addProcessedOrder(t, db, "79927398713", u.ID, "50", time.Now().Add(-time.Hour))
+			// unknown to the accrual system
+			addProcessedOrder(t, db, "49927398716", u.ID, "0", time.Now())
+			// outside of the window
+			addProcessedOrder(t, db, "4561261212345467", u.ID, "0", time.Now().Add(-time.Hour*24*30))
+
+			acc, _ := accrual.New(ts.URL)
+			orders := odb.New(db)
+			adjustmentsRepo := adb.New(db)
+			svc := reconciliation.New(
+				orders, adjustmentsRepo, users, ldb.New(db), db, acc,
+				reconciliation.WithPolicy(tt.policy), reconciliation.WithBatchSize(1),
+			)
+			report, err := svc.Reconcile(context.TODO())
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReport, report)
+
+			o, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
+			assert.Equal(t, tt.wantAccrual, o.Accrual.String())
+			u, _ = users.GetByID(context.TODO(), u.ID)
+			assert.Equal(t, tt.wantBalance, u.Balance.Current.String())
+			pending, _ := svc.GetPendingAdjustments(context.TODO(), 0, 10)
+			assert.Len(t, pending, tt.wantPending)
+			applied, _ := adjustmentsRepo.GetListByStatus(context.TODO(), adjustments.StatusApplied, 0, 10)
+			assert.Len(t, applied, tt.wantReport.Adjusted)
+			entries, _ := ldb.New(db).GetPageForUser(context.TODO(), u.ID, ledgerentries.ListQuery{Limit: 10})
+			require.Len(t, entries, tt.wantReport.Adjusted)
+			for _, e := range entries {
+				assert.Equal(t, ledgerentries.KindAdjustment, e.Kind)
+				assert.Equal(t, "1234567812345670", e.OrderNumber)
+				assert.Equal(t, "20.5", e.Change(ledgerentries.AccountCurrent).String())
+			}
+
+			// once adjusted, the order matches the accrual system, otherwise the mismatch is found again
+			report, err = svc.Reconcile(context.TODO())
+			require.NoError(t, err)
+			assert.Equal(t, 1-tt.wantReport.Adjusted, report.Mismatched)
+			assert.Equal(t, 0, report.Queued)
+		})
+	}
+}
+
+func TestReconciliation_Reconcile_InsufficientBalance(t *testing.T) {
+	ts := accrualServer(map[string]string{"1234567812345670": "20"})
+	defer ts.Close()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	addProcessedOrder(t, db, "1234567812345670", u.ID, "100", time.Now())
+	// the user has spent most of the points already
+	require.NoError(t, users.WithdrawPoints(context.TODO(), u.ID, "", decimal.NewFromInt(90)))
+
+	acc, _ := accrual.New(ts.URL)
+	orders := odb.New(db)
+	svc := reconciliation.New(
+		orders, adb.New(db), users, ldb.New(db), db, acc, reconciliation.WithPolicy(reconciliation.PolicyAdjust),
+	)
+	report, err := svc.Reconcile(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, reconciliation.Report{Checked: 1, Mismatched: 1, Queued: 1}, report)
+
+	// nothing is changed, the mismatch awaits review instead
+	o, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, "100", o.Accrual.String())
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "10", u.Balance.Current.String())
+	pending, _ := svc.GetPendingAdjustments(context.TODO(), 0, 10)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "-80", pending[0].Amount().String())
+}
+
+func TestReconciliation_ResolveAdjustments(t *testing.T) {
+	ts := accrualServer(map[string]string{
+		"1234567812345670": "120.5",
+		"79927398713":      "40",
+		"4561261212345467": "10",
+	})
+	defer ts.Close()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	addProcessedOrder(t, db, "1234567812345670", u.ID, "100", time.Now())
+	addProcessedOrder(t, db, "79927398713", u.ID, "50", time.Now())
+	addProcessedOrder(t, db, "4561261212345467", u.ID, "5", time.Now())
+
+	acc, _ := accrual.New(ts.URL)
+	orders := odb.New(db)
+	svc := reconciliation.New(
+		orders, adb.New(db), users, ldb.New(db), db, acc, reconciliation.WithPolicy(reconciliation.PolicyReview),
+	)
+	report, err := svc.Reconcile(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Queued)
+	pending, _ := svc.GetPendingAdjustments(context.TODO(), 0, 10)
+	require.Len(t, pending, 3)
+
+	applied, err := svc.ApplyAdjustment(context.TODO(), pending[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, adjustments.StatusApplied, applied.Status)
+	assert.Equal(t, "20.5", applied.Amount().String())
+	o, _ := orders.GetByNumber(context.TODO(), "1234567812345670")
+	assert.Equal(t, "120.5", o.Accrual.String())
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "175.5", u.Balance.Current.String())
+	entries, _ := ldb.New(db).GetPageForUser(context.TODO(), u.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 1)
+	assert.Equal(t, ledgerentries.KindAdjustment, entries[0].Kind)
+	assert.Equal(t, "1234567812345670", entries[0].OrderNumber)
+
+	// the same adjustment is never applied twice
+	_, err = svc.ApplyAdjustment(context.TODO(), pending[0].ID)
+	assert.ErrorIs(t, err, adjustments.ErrAdjustmentNotFound)
+
+	dismissed, err := svc.DismissAdjustment(context.TODO(), pending[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, adjustments.StatusDismissed, dismissed.Status)
+	o, _ = orders.GetByNumber(context.TODO(), "79927398713")
+	assert.Equal(t, "50", o.Accrual.String())
+	_, err = svc.ApplyAdjustment(context.TODO(), pending[1].ID)
+	assert.ErrorIs(t, err, adjustments.ErrAdjustmentNotFound)
+
+	// the order's accrual has changed since the mismatch was found
+	o, _ = orders.GetByNumber(context.TODO(), "4561261212345467")
+	require.NoError(t, orders.ChangeAccrual(context.TODO(), o.ID, o.Accrual, decimal.NewFromInt(7)))
+	_, err = svc.ApplyAdjustment(context.TODO(), pending[2].ID)
+	assert.ErrorIs(t, err, reconciliation.ErrAdjustmentIsStale)
+	u, _ = users.GetByID(context.TODO(), u.ID)
+	assert.Equal(t, "175.5", u.Balance.Current.String())
+	// the adjustment still awaits review
+	pending, _ = svc.GetPendingAdjustments(context.TODO(), 0, 10)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "5", pending[0].Recorded.String())
+
+	_, err = svc.DismissAdjustment(context.TODO(), 999999)
+	assert.ErrorIs(t, err, adjustments.ErrAdjustmentNotFound)
+}
+
+func TestReconciliation_Reconcile_AccrualUnavailable(t *testing.T) {
+	r := gin.New()
+	r.GET("/api/orders/:order", func(c *gin.Context) {
+		c.Status(500)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	addProcessedOrder(t, db, "1234567812345670", u.ID, "100", time.Now())
+
+	acc, _ := accrual.New(ts.URL)
+	svc := reconciliation.New(odb.New(db), adb.New(db), users, ldb.New(db), db, acc)
+	_, err := svc.Reconcile(context.TODO())
+	assert.ErrorIs(t, err, accrual.ErrRespInvalidStatus)
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, value := range []string{"log", "review", "adjust"} {
+		policy, err := reconciliation.ParsePolicy(value)
+		require.NoError(t, err)
+		assert.Equal(t, reconciliation.Policy(value), policy)
+	}
+	policy, err := reconciliation.ParsePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, reconciliation.PolicyLog, policy)
+	_, err = reconciliation.ParsePolicy("ignore")
+	assert.ErrorIs(t, err, reconciliation.ErrPolicyUnknown)
+}
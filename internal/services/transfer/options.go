@@ -0,0 +1,48 @@
+package transfer
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+)
+
+type Option func(*Service)
+
+// WithPublisher configures where the changes of the users' balance are published to
+func WithPublisher(publisher pubsub.Publisher) Option {
+	return func(s *Service) {
+		if publisher != nil {
+			s.publisher = publisher
+		}
+	}
+}
+
+// WithOutbox configures where the changes of the users' balance are recorded to
+// within the transaction that makes them, so that the records are kept if and only if the change is
+func WithOutbox(outbox pubsub.Publisher) Option {
+	return func(s *Service) {
+		if outbox != nil {
+			s.outbox = outbox
+		}
+	}
+}
+
+// WithMaxAmount configures the maximum number of points given away with a single transfer.
+// The transfers are not limited unless configured otherwise
+func WithMaxAmount(amount decimal.Decimal) Option {
+	return func(s *Service) {
+		if amount.IsPositive() {
+			s.maxAmount = amount
+		}
+	}
+}
+
+// WithDailyLimit configures the maximum number of points a user may give away within a day.
+// The transfers are not limited unless configured otherwise
+func WithDailyLimit(limit decimal.Decimal) Option {
+	return func(s *Service) {
+		if limit.IsPositive() {
+			s.dailyLimit = limit
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/transfers"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+)
+
+var ErrTransferInvalidAmount = errors.New("can transfer positive amount only")
+var ErrTransferToSelf = errors.New("cannot transfer points to oneself")
+var ErrTransferRecipientNotFound = errors.New("recipient not found")
+var ErrTransferAmountLimitExceeded = errors.New("amount exceeds the limit for a single transfer")
+var ErrTransferDailyLimitExceeded = errors.New("amount exceeds the daily limit for transfers")
+
+type Service struct {
+	transfers  transfers.Repository
+	users      users.Repository
+	ledger     ledgerentries.Repository
+	transactor transactor.Transactor
+	publisher  pubsub.Publisher
+	outbox     pubsub.Publisher
+	maxAmount  decimal.Decimal
+	dailyLimit decimal.Decimal
+}
+
+func New(
+	transfers transfers.Repository,
+	users users.Repository,
+	ledger ledgerentries.Repository,
+	transactor transactor.Transactor,
+	opts ...Option,
+) Service {
+	s := Service{
+		transfers:  transfers,
+		users:      users,
+		ledger:     ledger,
+		transactor: transactor,
+		publisher:  pubsub.Discard,
+		outbox:     pubsub.Discard,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// TransferPoints gives the specified amount of the sender's current points to the user with the specified login.
+// The sender cannot give away more points than the sender owns,
+// nor more points than allowed for a single transfer or within a day
+func (s Service) TransferPoints(
+	ctx context.Context,
+	senderID int,
+	recipientLogin string,
+	amount decimal.Decimal,
+) (transfers.Transfer, error) {
+	if !amount.IsPositive() {
+		return transfers.Blank, ErrTransferInvalidAmount
+	}
+	if s.maxAmount.IsPositive() && amount.GreaterThan(s.maxAmount) {
+		return transfers.Blank, ErrTransferAmountLimitExceeded
+	}
+	recipient, err := s.users.GetByLogin(ctx, recipientLogin)
+	if err != nil {
+		if errors.Is(err, users.ErrUserNotFound) {
+			return transfers.Blank, ErrTransferRecipientNotFound
+		}
+		return transfers.Blank, err
+	}
+	if recipient.ID == senderID {
+		return transfers.Blank, ErrTransferToSelf
+	}
+
+	var t transfers.Transfer
+	err = s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if t, err = s.transfer(txCtx, senderID, recipient.ID, amount); err != nil {
+			return err
+		}
+		if err = s.recordBalance(txCtx, senderID); err != nil {
+			return err
+		}
+		return s.recordBalance(txCtx, recipient.ID)
+	})
+	if err != nil {
+		log.Warn().
+			Err(err).Int("senderID", senderID).Int("recipientID", recipient.ID).Stringer("amount", amount).
+			Msg("Unable to transfer points")
+		return transfers.Blank, err
+	}
+
+	s.publishBalance(ctx, senderID)
+	s.publishBalance(ctx, recipient.ID)
+	return t, nil
+}
+
+// transfer moves the points from one user to another while both users are locked,
+// recording the transfer in both users' ledgers along with the other user
+func (s Service) transfer(
+	ctx context.Context, senderID, recipientID int, amount decimal.Decimal,
+) (transfers.Transfer, error) {
+	if err := s.lockUsers(ctx, senderID, recipientID); err != nil {
+		return transfers.Blank, err
+	}
+	// the sender is locked, so no other transfer of the sender's may sneak past the limit meanwhile
+	if s.dailyLimit.IsPositive() {
+		sent, err := s.transfers.GetSentSumSince(ctx, senderID, time.Now().Add(-time.Hour*24))
+		if err != nil {
+			return transfers.Blank, err
+		}
+		if sent.Add(amount).GreaterThan(s.dailyLimit) {
+			return transfers.Blank, ErrTransferDailyLimitExceeded
+		}
+	}
+	if err := s.users.TransferPoints(ctx, senderID, recipientID, amount); err != nil {
+		return transfers.Blank, err
+	}
+	if _, err := s.ledger.Add(ctx, ledgerentries.NewTransfer(senderID, recipientID, amount.Neg())); err != nil {
+		return transfers.Blank, err
+	}
+	if _, err := s.ledger.Add(ctx, ledgerentries.NewTransfer(recipientID, senderID, amount)); err != nil {
+		return transfers.Blank, err
+	}
+	return s.transfers.Add(ctx, transfers.New(senderID, recipientID, amount))
+}
+
+// lockUsers locks the users' rows in the order of their IDs,
+// so that the transfers going in opposite directions never wait for each other
+func (s Service) lockUsers(ctx context.Context, ids ...int) error {
+	sort.Ints(ids)
+	for _, id := range ids {
+		if _, err := s.users.GetByIDForUpdate(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishBalance lets the user know about the user's balance as it is after a change.
+// The balance is obtained anew once the change has been committed, a failure to publish it is only logged
+func (s Service) publishBalance(ctx context.Context, userID int) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to obtain balance to publish")
+		return
+	}
+	e := pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held)
+	if err = s.publisher.Publish(ctx, e); err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to publish balance")
+	}
+}
+
+// recordBalance passes the user's balance as it is within the transaction of a change to the outbox.
+// Unlike publishing, a failure to record the balance fails the change
+func (s Service) recordBalance(ctx context.Context, userID int) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Publish(ctx, pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held))
+}
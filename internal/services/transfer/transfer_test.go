@@ -0,0 +1,223 @@
+package transfer_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	odb "github.com/sergeii/practikum-go-gophermart/internal/core/orders/postgres"
+	tdb "github.com/sergeii/practikum-go-gophermart/internal/core/transfers/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/transfer"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+// prepareUsers creates a pair of users, each with the specified number of points accrued for a processed order
+func prepareUsers(t *testing.T, db *postgres.Database, points string) (urepo.User, urepo.User) {
+	users := udb.New(db)
+	orderRepo := odb.New(db)
+	sender, err := users.Create(context.TODO(), urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, err)
+	recipient, err := users.Create(context.TODO(), urepo.New("shopper", "str0ng"))
+	require.NoError(t, err)
+	for i, u := range []urepo.User{sender, recipient} {
+		var o orders.Order
+		o, err = orderRepo.Add(context.TODO(), orders.New(testutils.NewLuhnNumber(10+i), u.ID))
+		require.NoError(t, err)
+		o.Status = orders.OrderStatusProcessed
+		o.Accrual = decimal.RequireFromString(points)
+		require.NoError(t, orderRepo.Update(context.TODO(), o.ID, o))
+		require.NoError(t, users.AccruePoints(context.TODO(), u.ID, o.Accrual))
+		_, err = ldb.New(db).Add(context.TODO(), ledgerentries.NewAccrual(u.ID, o.Number, o.Accrual))
+		require.NoError(t, err)
+	}
+	return sender, recipient
+}
+
+func TestTransferService_TransferPoints_OK(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	sender, recipient := prepareUsers(t, db, "100")
+	users := udb.New(db)
+	ledger := ldb.New(db)
+	svc := transfer.New(tdb.New(db), users, ledger, db)
+
+	tr, err := svc.TransferPoints(ctx, sender.ID, "Shopper", decimal.RequireFromString("42.5"))
+	require.NoError(t, err)
+	assert.True(t, tr.ID > 0)
+	assert.Equal(t, sender.ID, tr.SenderID)
+	assert.Equal(t, recipient.ID, tr.RecipientID)
+	assert.Equal(t, "42.5", tr.Amount.String())
+
+	sender, _ = users.GetByID(ctx, sender.ID)
+	assert.Equal(t, "57.5", sender.Balance.Current.String())
+	assert.Equal(t, "0", sender.Balance.Withdrawn.String())
+	recipient, _ = users.GetByID(ctx, recipient.ID)
+	assert.Equal(t, "142.5", recipient.Balance.Current.String())
+
+	// the transfer shows up in both users' history
+	entries, _ := ledger.GetPageForUser(ctx, sender.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 2)
+	assert.Equal(t, ledgerentries.KindTransfer, entries[1].Kind)
+	assert.Equal(t, "-42.5", entries[1].Change(ledgerentries.AccountCurrent).String())
+	assert.Equal(t, "57.5", entries[1].Balance.String())
+	assert.Equal(t, recipient.ID, entries[1].CounterpartyID)
+	entries, _ = ledger.GetPageForUser(ctx, recipient.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 2)
+	assert.Equal(t, ledgerentries.KindTransfer, entries[1].Kind)
+	assert.Equal(t, "42.5", entries[1].Change(ledgerentries.AccountCurrent).String())
+	assert.Equal(t, "142.5", entries[1].Balance.String())
+	assert.Equal(t, sender.ID, entries[1].CounterpartyID)
+	assert.Equal(t, 0, entries[0].CounterpartyID)
+
+	// the balances are still in line with the orders and the transfers
+	discrepancies, err := ledger.GetDiscrepancies(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, discrepancies, 0)
+}
+
+func TestTransferService_TransferPoints_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipient string
+		amount    string
+		wantErr   error
+	}{
+		{
+			"positive case",
+			"shopper",
+			"30",
+			nil,
+		},
+		{
+			"unknown recipient",
+			"customer",
+			"30",
+			transfer.ErrTransferRecipientNotFound,
+		},
+		{
+			"transfer to oneself",
+			"happycustomer",
+			"30",
+			transfer.ErrTransferToSelf,
+		},
+		{
+			"zero amount",
+			"shopper",
+			"0",
+			transfer.ErrTransferInvalidAmount,
+		},
+		{
+			"negative amount",
+			"shopper",
+			"-10",
+			transfer.ErrTransferInvalidAmount,
+		},
+		{
+			"more than the sender owns",
+			"shopper",
+			"50.01",
+			urepo.ErrUserHasInsufficientBalance,
+		},
+		{
+			"more than allowed at once",
+			"shopper",
+			"100.01",
+			transfer.ErrTransferAmountLimitExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			_, db, cancel := testutils.PrepareTestDatabase()
+			defer cancel()
+
+			sender, recipient := prepareUsers(t, db, "50")
+			users := udb.New(db)
+			svc := transfer.New(
+				tdb.New(db), users, ldb.New(db), db, transfer.WithMaxAmount(decimal.RequireFromString("100")),
+			)
+
+			_, err := svc.TransferPoints(ctx, sender.ID, tt.recipient, decimal.RequireFromString(tt.amount))
+			sender, _ = users.GetByID(ctx, sender.ID)
+			recipient, _ = users.GetByID(ctx, recipient.ID)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				// nothing is changed
+				assert.Equal(t, "50", sender.Balance.Current.String())
+				assert.Equal(t, "50", recipient.Balance.Current.String())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "20", sender.Balance.Current.String())
+				assert.Equal(t, "80", recipient.Balance.Current.String())
+			}
+		})
+	}
+}
+
+func TestTransferService_TransferPoints_DailyLimit(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	sender, recipient := prepareUsers(t, db, "100")
+	svc := transfer.New(
+		tdb.New(db), udb.New(db), ldb.New(db), db, transfer.WithDailyLimit(decimal.RequireFromString("50")),
+	)
+
+	_, err := svc.TransferPoints(ctx, sender.ID, "shopper", decimal.RequireFromString("30"))
+	require.NoError(t, err)
+	_, err = svc.TransferPoints(ctx, sender.ID, "shopper", decimal.RequireFromString("20.01"))
+	assert.ErrorIs(t, err, transfer.ErrTransferDailyLimitExceeded)
+	_, err = svc.TransferPoints(ctx, sender.ID, "shopper", decimal.RequireFromString("20"))
+	require.NoError(t, err)
+	_, err = svc.TransferPoints(ctx, sender.ID, "shopper", decimal.RequireFromString("0.01"))
+	assert.ErrorIs(t, err, transfer.ErrTransferDailyLimitExceeded)
+
+	// the points received do not count towards the limit
+	_, err = svc.TransferPoints(ctx, recipient.ID, "happycustomer", decimal.RequireFromString("50"))
+	require.NoError(t, err)
+}
+
+func TestTransferService_TransferPoints_Race(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	sender, recipient := prepareUsers(t, db, "10")
+	users := udb.New(db)
+	svc := transfer.New(tdb.New(db), users, ldb.New(db), db)
+
+	// the transfers going in opposite directions must not deadlock
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := svc.TransferPoints(ctx, sender.ID, "shopper", decimal.RequireFromString("1"))
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := svc.TransferPoints(ctx, recipient.ID, "happycustomer", decimal.RequireFromString("1"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	sender, _ = users.GetByID(ctx, sender.ID)
+	assert.Equal(t, "10", sender.Balance.Current.String())
+	recipient, _ = users.GetByID(ctx, recipient.ID)
+	assert.Equal(t, "10", recipient.Balance.Current.String())
+}
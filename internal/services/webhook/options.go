@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"time"
+)
+
+const (
+	DefaultTimeout      = time.Second * 5
+	DefaultMaxAttempts  = 8
+	DefaultBaseDelay    = time.Second * 10
+	DefaultMaxDelay     = time.Hour
+	DefaultDisableAfter = 20
+	DefaultBatchSize    = 50
+)
+
+type Option func(*Service)
+
+// WithTimeout limits the time a webhook has to respond to a delivery
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.timeout = timeout
+		}
+	}
+}
+
+// WithPrivateNetworks lets the webhooks point at loopback and private addresses,
+// which are refused by default. It is only meant for development and testing
+func WithPrivateNetworks(allow bool) Option {
+	return func(s *Service) {
+		s.allowPrivate = allow
+	}
+}
+
+// WithMaxAttempts configures the number of attempts after which a delivery is given up
+func WithMaxAttempts(attempts int) Option {
+	return func(s *Service) {
+		if attempts > 0 {
+			s.maxAttempts = attempts
+		}
+	}
+}
+
+// WithBackoff configures the delay between the attempts of a delivery.
+// The delay doubles with every failed attempt, starting from base and up to max
+func WithBackoff(base, max time.Duration) Option {
+	return func(s *Service) {
+		if base > 0 {
+			s.baseDelay = base
+		}
+		if max > 0 {
+			s.maxDelay = max
+		}
+	}
+}
+
+// WithDisableAfter configures the number of failed deliveries in a row after which a webhook is disabled
+func WithDisableAfter(failures int) Option {
+	return func(s *Service) {
+		if failures > 0 {
+			s.disableAfter = failures
+		}
+	}
+}
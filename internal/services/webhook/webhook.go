@@ -0,0 +1,324 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/orders"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhooks"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/pkg/encode"
+	"github.com/sergeii/practikum-go-gophermart/pkg/security/signature"
+)
+
+const (
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+	HeaderTimestamp = "X-Gophermart-Timestamp"
+	HeaderSignature = "X-Gophermart-Signature"
+	// the error is only kept for the delivery log, so a short excerpt suffices
+	maxErrorLength = 255
+	// the body of a response is read up to this length, so that the connection can be reused
+	maxDiscardLength = 4096
+)
+
+var ErrURLNotAllowed = errors.New("webhook url must be either http or https and point to a public address")
+var errUnexpectedStatus = errors.New("webhook responded with unexpected status")
+
+type orderPayload struct {
+	Number  string  `json:"number"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual"`
+}
+
+type balancePayload struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+	Held      float64 `json:"held"`
+}
+
+// Payload is the body of a notification sent to a webhook
+type Payload struct {
+	Event     string          `json:"event"`
+	Order     *orderPayload   `json:"order,omitempty"`
+	Balance   *balancePayload `json:"balance,omitempty"`
+	CreatedAt time.Time       `json:"created_at"` // nolint: tagliatelle
+}
+
+type Service struct {
+	webhooks     webhooks.Repository
+	deliveries   webhookdeliveries.Repository
+	client       *http.Client
+	timeout      time.Duration
+	allowPrivate bool
+	maxAttempts  int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	disableAfter int
+	batchSize    int
+}
+
+func New(webhooks webhooks.Repository, deliveries webhookdeliveries.Repository, opts ...Option) Service {
+	s := Service{
+		webhooks:     webhooks,
+		deliveries:   deliveries,
+		timeout:      DefaultTimeout,
+		maxAttempts:  DefaultMaxAttempts,
+		baseDelay:    DefaultBaseDelay,
+		maxDelay:     DefaultMaxDelay,
+		disableAfter: DefaultDisableAfter,
+		batchSize:    DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	s.client = newClient(s.timeout, s.allowPrivate)
+	return s
+}
+
+// Register adds a webhook for the user. Unless the events are specified, the webhook is notified of all events.
+// Webhooks with a scheme other than http or https, as well as the ones pointing at loopback, private,
+// link-local or unspecified addresses are refused with ErrURLNotAllowed
+func (s Service) Register(
+	ctx context.Context, userID int, url, secret string, events []string,
+) (webhooks.Webhook, error) {
+	if !isHTTPURL(url) || (!s.allowPrivate && !isPublicURL(url)) {
+		return webhooks.Blank, ErrURLNotAllowed
+	}
+	if len(events) == 0 {
+		events = []string{webhooks.EventOrder, webhooks.EventBalance}
+	}
+	return s.webhooks.Add(ctx, webhooks.New(userID, url, secret, events))
+}
+
+// GetUserWebhooks returns all webhooks registered by the user
+func (s Service) GetUserWebhooks(ctx context.Context, userID int) ([]webhooks.Webhook, error) {
+	return s.webhooks.GetListForUser(ctx, userID)
+}
+
+// Delete removes the user's webhook. Webhooks of other users are reported as not found
+func (s Service) Delete(ctx context.Context, userID int, webhookID int) error {
+	if _, err := s.getUserWebhook(ctx, userID, webhookID); err != nil {
+		return err
+	}
+	return s.webhooks.Delete(ctx, webhookID)
+}
+
+// Enable turns the user's webhook back on after it has been disabled because of failed deliveries
+func (s Service) Enable(ctx context.Context, userID int, webhookID int) (webhooks.Webhook, error) {
+	if _, err := s.getUserWebhook(ctx, userID, webhookID); err != nil {
+		return webhooks.Blank, err
+	}
+	if err := s.webhooks.Enable(ctx, webhookID); err != nil {
+		return webhooks.Blank, err
+	}
+	return s.webhooks.GetByID(ctx, webhookID)
+}
+
+// GetDeliveries returns the latest deliveries to the user's webhook, the newest first
+func (s Service) GetDeliveries(
+	ctx context.Context, userID int, webhookID int, limit int,
+) ([]webhookdeliveries.Delivery, error) {
+	if _, err := s.getUserWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.deliveries.GetListForWebhook(ctx, webhookID, limit)
+}
+
+func (s Service) getUserWebhook(ctx context.Context, userID int, webhookID int) (webhooks.Webhook, error) {
+	w, err := s.webhooks.GetByID(ctx, webhookID)
+	if err != nil {
+		return webhooks.Blank, err
+	}
+	if w.UserID != userID {
+		return webhooks.Blank, webhooks.ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+// Publish schedules the notifications of the event to the user's enabled webhooks.
+// Only the orders that have reached their final status are notified of.
+// The service is meant to be the outbox of the change, so the notifications are stored
+// within the transaction from the context and are discarded along with the change, should it fail.
+// The notifications are sent later on by DeliverDue
+func (s Service) Publish(ctx context.Context, e pubsub.Event) error {
+	event, payload := eventPayload(e)
+	if event == "" {
+		return nil
+	}
+	items, err := s.webhooks.GetListForUser(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	for _, w := range items {
+		if !w.Enabled || !w.Subscribes(event) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(payload); err != nil {
+				return err
+			}
+		}
+		if _, err = s.deliveries.Add(ctx, webhookdeliveries.New(w.ID, event, body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eventPayload(e pubsub.Event) (string, Payload) {
+	switch {
+	case e.Order != nil:
+		status := orders.OrderStatus(e.Order.Status)
+		if status != orders.OrderStatusProcessed && status != orders.OrderStatusInvalid {
+			return "", Payload{}
+		}
+		return webhooks.EventOrder, Payload{
+			Event:     webhooks.EventOrder,
+			Order:     &orderPayload{e.Order.Number, e.Order.Status, encode.DecimalToFloat(e.Order.Accrual)},
+			CreatedAt: e.CreatedAt,
+		}
+	case e.Balance != nil:
+		return webhooks.EventBalance, Payload{
+			Event: webhooks.EventBalance,
+			Balance: &balancePayload{
+				encode.DecimalToFloat(e.Balance.Current),
+				encode.DecimalToFloat(e.Balance.Withdrawn),
+				encode.DecimalToFloat(e.Balance.Held),
+			},
+			CreatedAt: e.CreatedAt,
+		}
+	default:
+		return "", Payload{}
+	}
+}
+
+// DeliverDue sends a batch of the notifications that are due.
+// A failed notification is retried with exponential backoff until it runs out of attempts,
+// and a webhook that has failed too many notifications in a row is disabled.
+// The method returns the number of attempted notifications
+func (s Service) DeliverDue(ctx context.Context) (int, error) {
+	// the deliveries stay hidden long enough to be attempted one after another
+	lease := s.client.Timeout*time.Duration(s.batchSize) + time.Minute
+	batch, err := s.deliveries.LeaseDue(ctx, s.batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range batch {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if err = s.deliver(ctx, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+func (s Service) deliver(ctx context.Context, d webhookdeliveries.Delivery) error {
+	w, err := s.webhooks.GetByID(ctx, d.WebhookID)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrWebhookNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !w.Enabled {
+		d.Status = webhookdeliveries.StatusFailed
+		d.LastError = "webhook is disabled"
+		return s.deliveries.Update(ctx, d)
+	}
+
+	d.Attempts++
+	statusCode, sendErr := s.send(ctx, w, d)
+	d.LastStatusCode = statusCode
+	if sendErr == nil {
+		d.Status = webhookdeliveries.StatusDelivered
+		d.LastError = ""
+		d.DeliveredAt = time.Now()
+		if err = s.deliveries.Update(ctx, d); err != nil {
+			return err
+		}
+		return s.webhooks.RecordSuccess(ctx, w.ID)
+	}
+
+	d.LastError = truncate(sendErr.Error(), maxErrorLength)
+	if d.Attempts >= s.maxAttempts {
+		d.Status = webhookdeliveries.StatusFailed
+	} else {
+		d.NextAttemptAt = time.Now().Add(s.backoff(d.Attempts))
+	}
+	log.Warn().
+		Err(sendErr).Int("webhookID", w.ID).Int("deliveryID", d.ID).Int("attempts", d.Attempts).
+		Msg("Failed to deliver webhook notification")
+	if err = s.deliveries.Update(ctx, d); err != nil {
+		return err
+	}
+	failed, err := s.webhooks.RecordFailure(ctx, w.ID, s.disableAfter)
+	if err != nil {
+		return err
+	}
+	if !failed.Enabled && w.Enabled {
+		log.Warn().Int("webhookID", w.ID).Int("userID", w.UserID).Msg("Webhook is disabled after repeated failures")
+	}
+	return nil
+}
+
+// send posts the notification to the webhook. Any response other than 2xx is considered a failure,
+// and so are redirects, which are never followed.
+// Only the status code of a failed response is reported, the response body is never kept
+func (s Service) send(ctx context.Context, w webhooks.Webhook, d webhookdeliveries.Delivery) (int, error) {
+	now := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(d.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, "sha256="+signature.Sign([]byte(w.Secret), now, d.Payload))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDiscardLength))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("%w %d", errUnexpectedStatus, resp.StatusCode)
+}
+
+// backoff returns the delay before the next attempt of a delivery that has failed the given number of attempts
+func (s Service) backoff(attempts int) time.Duration {
+	delay := s.baseDelay
+	for i := 1; i < attempts && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.maxDelay {
+		delay = s.maxDelay
+	}
+	return delay
+}
+
+// truncate cuts the error message to the given length.
+// The message may mention the webhook's url, so it is also made safe to be stored as text
+func truncate(s string, length int) string {
+	if len(s) > length {
+		s = s[:length]
+	}
+	return strings.ReplaceAll(strings.ToValidUTF8(s, ""), "\x00", "")
+}
@@ -0,0 +1,337 @@
+package webhook_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries"
+	ddb "github.com/sergeii/practikum-go-gophermart/internal/core/webhookdeliveries/postgres"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/webhooks/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/webhook"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+	"github.com/sergeii/practikum-go-gophermart/pkg/security/signature"
+)
+
+const testSecret = "0123456789abcdef"
+
+type receivedNotification struct {
+	event   string
+	body    string
+	isValid bool
+}
+
+// webhookServer records the notifications it receives and responds with the given status
+func webhookServer(status int) (*httptest.Server, func() []receivedNotification) {
+	var mu sync.Mutex
+	var received []receivedNotification
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		unix, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		sig := strings.TrimPrefix(r.Header.Get(webhook.HeaderSignature), "sha256=")
+		mu.Lock()
+		received = append(received, receivedNotification{
+			event:   r.Header.Get(webhook.HeaderEvent),
+			body:    string(body),
+			isValid: signature.Verify([]byte(testSecret), time.Unix(unix, 0), body, sig),
+		})
+		mu.Unlock()
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("boom"))
+	}))
+	return ts, func() []receivedNotification {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedNotification(nil), received...)
+	}
+}
+
+// newService returns a service that is able to deliver to the test servers listening on the loopback address
+func newService(db *postgres.Database, opts ...webhook.Option) webhook.Service {
+	opts = append([]webhook.Option{webhook.WithPrivateNetworks(true)}, opts...)
+	return webhook.New(wdb.New(db), ddb.New(db), opts...)
+}
+
+func TestWebhookService_Publish(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	other, _ := users.Create(ctx, urepo.New("othercustomer", "str0ng"))
+
+	s := newService(db)
+	orderHook, err := s.Register(ctx, u.ID, "https://example.com/orders", testSecret, []string{"order"})
+	require.NoError(t, err)
+	allHook, err := s.Register(ctx, u.ID, "https://example.com/all", testSecret, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order", "balance"}, allHook.Events)
+	otherHook, err := s.Register(ctx, other.ID, "https://example.org/all", testSecret, nil)
+	require.NoError(t, err)
+
+	events := []pubsub.Event{
+		pubsub.NewOrderEvent(u.ID, "79927398713", "PROCESSING", decimal.Zero),
+		pubsub.NewOrderEvent(u.ID, "79927398713", "PROCESSED", decimal.RequireFromString("10.5")),
+		pubsub.NewOrderEvent(u.ID, "49927398716", "INVALID", decimal.Zero),
+		pubsub.NewBalanceEvent(u.ID, decimal.RequireFromString("10.5"), decimal.Zero, decimal.RequireFromString("2")),
+	}
+	for _, e := range events {
+		require.NoError(t, s.Publish(ctx, e))
+	}
+
+	orderLog, err := s.GetDeliveries(ctx, u.ID, orderHook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, orderLog, 2)
+	assert.Equal(t, "order", orderLog[0].Event)
+	assert.Contains(t, string(orderLog[0].Payload), `"status": "INVALID"`)
+	assert.Contains(t, string(orderLog[1].Payload), `"accrual": 10.5`)
+	assert.Equal(t, webhookdeliveries.StatusPending, orderLog[1].Status)
+
+	allLog, err := s.GetDeliveries(ctx, u.ID, allHook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, allLog, 3)
+	assert.Equal(t, "balance", allLog[0].Event)
+	assert.Contains(t, string(allLog[0].Payload), `"current": 10.5`)
+	assert.Contains(t, string(allLog[0].Payload), `"held": 2`)
+
+	otherLog, err := s.GetDeliveries(ctx, other.ID, otherHook.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, otherLog, 0)
+
+	// the delivery log is private
+	_, err = s.GetDeliveries(ctx, other.ID, orderHook.ID, 10)
+	assert.Error(t, err)
+}
+
+func TestWebhookService_DeliverDue_OK(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	ts, received := webhookServer(http.StatusNoContent)
+	defer ts.Close()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	s := newService(db)
+	hook, _ := s.Register(ctx, u.ID, ts.URL, testSecret, nil)
+	e := pubsub.NewOrderEvent(u.ID, "79927398713", "PROCESSED", decimal.NewFromInt(100))
+	require.NoError(t, s.Publish(ctx, e))
+
+	sent, err := s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	sent, err = s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	notifications := received()
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "order", notifications[0].event)
+	assert.True(t, notifications[0].isValid)
+	assert.JSONEq(
+		t,
+		`{"event": "order", "order": {"number": "79927398713", "status": "PROCESSED", "accrual": 100}, "created_at": "`+
+			e.CreatedAt.Format(time.RFC3339Nano)+`"}`,
+		notifications[0].body,
+	)
+
+	deliveries, _ := s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, webhookdeliveries.StatusDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, 204, deliveries[0].LastStatusCode)
+	assert.False(t, deliveries[0].DeliveredAt.IsZero())
+}
+
+func TestWebhookService_Register_RefusesPrivateAddresses(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	s := webhook.New(wdb.New(db), ddb.New(db))
+	for _, url := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"ftp://93.184.216.34/hook",
+		"file:///etc/passwd",
+		"example.com/hook",
+	} {
+		_, err := s.Register(ctx, u.ID, url, testSecret, nil)
+		assert.ErrorIs(t, err, webhook.ErrURLNotAllowed, url)
+	}
+	_, err := s.Register(ctx, u.ID, "https://93.184.216.34/hook", testSecret, nil)
+	require.NoError(t, err)
+	_, err = s.Register(ctx, u.ID, "https://example.com/hook", testSecret, nil)
+	require.NoError(t, err)
+
+	// the scheme is checked even if private networks are allowed
+	_, err = newService(db).Register(ctx, u.ID, "ftp://127.0.0.1/hook", testSecret, nil)
+	assert.ErrorIs(t, err, webhook.ErrURLNotAllowed)
+}
+
+func TestWebhookService_DeliverDue_RefusesPrivateAddresses(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	ts, received := webhookServer(http.StatusNoContent)
+	defer ts.Close()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	// the webhook has been registered while private networks were allowed,
+	// or its host has resolved to a public address at the time
+	hook, err := newService(db).Register(ctx, u.ID, ts.URL, testSecret, nil)
+	require.NoError(t, err)
+	s := webhook.New(wdb.New(db), ddb.New(db), webhook.WithMaxAttempts(1))
+	require.NoError(t, s.Publish(ctx, pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(10), decimal.Zero, decimal.Zero)))
+
+	sent, err := s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, received(), 0)
+
+	deliveries, _ := s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, webhookdeliveries.StatusFailed, deliveries[0].Status)
+	assert.Equal(t, 0, deliveries[0].LastStatusCode)
+	assert.Contains(t, deliveries[0].LastError, webhook.ErrURLNotAllowed.Error())
+}
+
+func TestWebhookService_DeliverDue_DoesNotFollowRedirects(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	target, received := webhookServer(http.StatusNoContent)
+	defer target.Close()
+	ts := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer ts.Close()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	s := newService(db, webhook.WithMaxAttempts(1))
+	hook, _ := s.Register(ctx, u.ID, ts.URL, testSecret, nil)
+	require.NoError(t, s.Publish(ctx, pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(10), decimal.Zero, decimal.Zero)))
+
+	sent, err := s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, received(), 0)
+
+	deliveries, _ := s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, webhookdeliveries.StatusFailed, deliveries[0].Status)
+	assert.Equal(t, 307, deliveries[0].LastStatusCode)
+}
+
+func TestWebhookService_DeliverDue_Retries(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	ts, received := webhookServer(http.StatusInternalServerError)
+	defer ts.Close()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	s := newService(
+		db,
+		webhook.WithMaxAttempts(3),
+		webhook.WithBackoff(time.Millisecond, time.Millisecond*10),
+		webhook.WithDisableAfter(10),
+	)
+	hook, _ := s.Register(ctx, u.ID, ts.URL, testSecret, nil)
+	require.NoError(t, s.Publish(ctx, pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(10), decimal.Zero, decimal.Zero)))
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond * 20)
+		sent, err := s.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+	}
+	time.Sleep(time.Millisecond * 20)
+	sent, err := s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Len(t, received(), 3)
+
+	deliveries, _ := s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, webhookdeliveries.StatusFailed, deliveries[0].Status)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, 500, deliveries[0].LastStatusCode)
+	// the response body is never stored
+	assert.Contains(t, deliveries[0].LastError, "500")
+	assert.NotContains(t, deliveries[0].LastError, "boom")
+
+	webhooks, _ := s.GetUserWebhooks(ctx, u.ID)
+	require.Len(t, webhooks, 1)
+	assert.True(t, webhooks[0].Enabled)
+	assert.Equal(t, 3, webhooks[0].ConsecutiveFailures)
+}
+
+func TestWebhookService_DeliverDue_DisablesFailingWebhook(t *testing.T) {
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+	ctx := context.TODO()
+
+	ts, received := webhookServer(http.StatusBadGateway)
+	defer ts.Close()
+
+	u, _ := udb.New(db).Create(ctx, urepo.New("happycustomer", "str0ng"))
+	s := newService(db, webhook.WithBackoff(time.Millisecond, time.Millisecond), webhook.WithDisableAfter(2))
+	hook, _ := s.Register(ctx, u.ID, ts.URL, testSecret, nil)
+	for _, points := range []int64{10, 20} {
+		e := pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(points), decimal.Zero, decimal.Zero)
+		require.NoError(t, s.Publish(ctx, e))
+	}
+
+	sent, err := s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+
+	// the pending deliveries of a disabled webhook are given up
+	time.Sleep(time.Millisecond * 20)
+	sent, err = s.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Len(t, received(), 2)
+
+	deliveries, _ := s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	require.Len(t, deliveries, 2)
+	for _, d := range deliveries {
+		assert.Equal(t, webhookdeliveries.StatusFailed, d.Status)
+		assert.Equal(t, "webhook is disabled", d.LastError)
+	}
+
+	// disabled webhooks are not notified anymore
+	require.NoError(t, s.Publish(ctx, pubsub.NewBalanceEvent(u.ID, decimal.NewFromInt(30), decimal.Zero, decimal.Zero)))
+	deliveries, _ = s.GetDeliveries(ctx, u.ID, hook.ID, 10)
+	assert.Len(t, deliveries, 2)
+
+	enabled, err := s.Enable(ctx, u.ID, hook.ID)
+	require.NoError(t, err)
+	assert.True(t, enabled.Enabled)
+	assert.Equal(t, 0, enabled.ConsecutiveFailures)
+}
@@ -0,0 +1,204 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+)
+
+var ErrHoldAlreadyRegistered = errors.New("points have already been held for this order")
+var ErrHoldIsFinalized = errors.New("hold has already been captured or released")
+var ErrHoldExpired = errors.New("hold has expired")
+
+// ReserveWithdrawal holds the specified sum on the user's balance for the order being checked out.
+// The held points cannot be spent on anything else until the hold is captured, released or expires.
+// The same rules apply as for RequestWithdrawal, besides the points cannot be held for an order twice
+func (s Service) ReserveWithdrawal(
+	ctx context.Context,
+	number string,
+	userID int,
+	sum decimal.Decimal,
+) (holds.Hold, error) {
+	if _, err := s.withdrawals.GetByNumber(ctx, number); !errors.Is(err, withdrawals.ErrWithdrawalNotFound) {
+		return holds.Blank, ErrWithdrawalAlreadyRegistered
+	}
+	if _, err := s.holds.GetHeldByNumber(ctx, number); !errors.Is(err, holds.ErrHoldNotFound) {
+		return holds.Blank, ErrHoldAlreadyRegistered
+	}
+	if sum.LessThanOrEqual(decimal.Zero) {
+		return holds.Blank, ErrWithdrawalInvalidSumSum
+	}
+	var hold holds.Hold
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := s.users.HoldPoints(txCtx, userID, sum); err != nil {
+			log.Warn().
+				Err(err).Str("order", number).Int("userID", userID).Stringer("sum", sum).
+				Msg("Unable to hold requested sum on user balance")
+			return err
+		}
+		if _, err := s.ledger.Add(txCtx, ledgerentries.NewHold(userID, number, sum)); err != nil {
+			return err
+		}
+		h, err := s.holds.Add(txCtx, holds.New(number, userID, sum, s.holdTTL))
+		if err != nil {
+			return err
+		}
+		hold = h
+		return s.recordBalance(txCtx, userID)
+	})
+	if err != nil {
+		return holds.Blank, err
+	}
+	s.publishBalance(ctx, userID)
+	return hold, nil
+}
+
+// CaptureHold withdraws the points held for the order, as long as the hold belongs to the user.
+// The hold cannot be captured once it has expired, even if the points are yet to be returned to the user
+func (s Service) CaptureHold(ctx context.Context, holdID int, userID int) (withdrawals.Withdrawal, error) {
+	var withdrawal withdrawals.Withdrawal
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		h, err := s.lockHold(txCtx, holdID, userID)
+		if err != nil {
+			return err
+		}
+		if h.IsExpired(time.Now()) {
+			return ErrHoldExpired
+		}
+		if _, err = s.withdrawals.GetByNumber(txCtx, h.Number); !errors.Is(err, withdrawals.ErrWithdrawalNotFound) {
+			return ErrWithdrawalAlreadyRegistered
+		}
+		if err = s.users.CaptureHeldPoints(txCtx, h.UserID, h.Number, h.Sum); err != nil {
+			return err
+		}
+		if _, err = s.ledger.Add(txCtx, ledgerentries.NewCapture(h.UserID, h.Number, h.Sum)); err != nil {
+			return err
+		}
+		if withdrawal, err = s.withdrawals.Add(txCtx, withdrawals.New(h.Number, h.UserID, h.Sum)); err != nil {
+			return err
+		}
+		if err = s.holds.Update(txCtx, h.ID, h.Finalize(holds.HoldStatusCaptured, time.Now())); err != nil {
+			return err
+		}
+		return s.recordBalance(txCtx, h.UserID)
+	})
+	if err != nil {
+		return withdrawals.Blank, err
+	}
+	log.Info().Int("holdID", holdID).Str("order", withdrawal.Number).Msg("Captured hold")
+	s.publishBalance(ctx, userID)
+	return withdrawal, nil
+}
+
+// ReleaseHold returns the points held for the order back to the user, as long as the hold belongs to the user
+func (s Service) ReleaseHold(ctx context.Context, holdID int, userID int) (holds.Hold, error) {
+	var released holds.Hold
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		h, err := s.lockHold(txCtx, holdID, userID)
+		if err != nil {
+			return err
+		}
+		if released, err = s.release(txCtx, h, holds.HoldStatusReleased); err != nil {
+			return err
+		}
+		return s.recordBalance(txCtx, h.UserID)
+	})
+	if err != nil {
+		return holds.Blank, err
+	}
+	log.Info().Int("holdID", holdID).Str("order", released.Number).Msg("Released hold")
+	s.publishBalance(ctx, userID)
+	return released, nil
+}
+
+// ExpireHolds returns the points held for too long back to the users.
+// The holds are released batch by batch until there are no expired holds left.
+// Returns the number of the released holds
+func (s Service) ExpireHolds(ctx context.Context) (int, error) {
+	expired := 0
+	for {
+		ids, err := s.holds.GetExpiredIDs(ctx, time.Now(), s.expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+		for _, id := range ids {
+			ok, err := s.expireHold(ctx, id)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+		if len(ids) < s.expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// expireHold releases the expired hold, telling whether it has been released.
+// The hold may have been captured or released in the meantime, in which case it is left alone
+func (s Service) expireHold(ctx context.Context, holdID int) (bool, error) {
+	var released holds.Hold
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		h, err := s.holds.GetByIDForUpdate(txCtx, holdID)
+		if err != nil {
+			return err
+		}
+		if h.Status != holds.HoldStatusHeld || !h.IsExpired(time.Now()) {
+			return nil
+		}
+		if released, err = s.release(txCtx, h, holds.HoldStatusExpired); err != nil {
+			return err
+		}
+		return s.recordBalance(txCtx, h.UserID)
+	})
+	if err != nil {
+		log.Error().Err(err).Int("holdID", holdID).Msg("Failed to release expired hold")
+		return false, err
+	}
+	if released.ID == 0 {
+		return false, nil
+	}
+	log.Info().Int("holdID", holdID).Str("order", released.Number).Msg("Released expired hold")
+	s.publishBalance(ctx, released.UserID)
+	return true, nil
+}
+
+// lockHold locks the user's hold for the duration of the transaction from the context.
+// Someone else's hold is reported as missing
+func (s Service) lockHold(ctx context.Context, holdID int, userID int) (holds.Hold, error) {
+	h, err := s.holds.GetByIDForUpdate(ctx, holdID)
+	if err != nil {
+		return holds.Blank, err
+	}
+	if h.UserID != userID {
+		return holds.Blank, holds.ErrHoldNotFound
+	}
+	if h.Status != holds.HoldStatusHeld {
+		return holds.Blank, ErrHoldIsFinalized
+	}
+	return h, nil
+}
+
+// release returns the held points back to the user within the transaction from the context
+func (s Service) release(ctx context.Context, h holds.Hold, status holds.HoldStatus) (holds.Hold, error) {
+	if err := s.users.ReleaseHeldPoints(ctx, h.UserID, h.Sum); err != nil {
+		return holds.Blank, err
+	}
+	if _, err := s.ledger.Add(ctx, ledgerentries.NewRelease(h.UserID, h.Number, h.Sum)); err != nil {
+		return holds.Blank, err
+	}
+	h = h.Finalize(status, time.Now())
+	if err := s.holds.Update(ctx, h.ID, h); err != nil {
+		return holds.Blank, err
+	}
+	return h, nil
+}
@@ -0,0 +1,215 @@
+package withdrawal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	hdb "github.com/sergeii/practikum-go-gophermart/internal/core/holds/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
+	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
+	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
+	wrepo "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
+	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
+)
+
+func prepareHoldUser(t *testing.T, db *postgres.Database, login string) urepo.User {
+	users := udb.New(db)
+	u, err := users.Create(context.TODO(), urepo.New(login, "str0ng"))
+	require.NoError(t, err)
+	require.NoError(t, users.AccruePoints(context.TODO(), u.ID, decimal.RequireFromString("10")))
+	_, err = ldb.New(db).Add(
+		context.TODO(), ledgerentries.NewAccrual(u.ID, "49927398716", decimal.RequireFromString("10")),
+	)
+	require.NoError(t, err)
+	return u
+}
+
+func assertBalance(t *testing.T, db *postgres.Database, userID int, current, withdrawn, held string) {
+	u, err := udb.New(db).GetByID(context.TODO(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, current, u.Balance.Current.String())
+	assert.Equal(t, withdrawn, u.Balance.Withdrawn.String())
+	assert.Equal(t, held, u.Balance.Held.String())
+	// the balance is always in line with the ledger
+	expected, err := ldb.New(db).GetBalanceForUser(context.TODO(), userID)
+	require.NoError(t, err)
+	assert.True(t, u.Balance.Equal(expected))
+}
+
+func TestWithdrawalService_CaptureHold_OK(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u := prepareHoldUser(t, db, "happycustomer")
+	withdrawals := wdb.New(db)
+	ws := newService(withdrawals, udb.New(db), db)
+
+	before := time.Now()
+	h, err := ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("4.99"))
+	require.NoError(t, err)
+	assert.True(t, h.ID > 0)
+	assert.Equal(t, holds.HoldStatusHeld, h.Status)
+	assert.True(t, h.ExpiresAt.After(before.Add(withdrawal.DefaultHoldTTL-time.Second)))
+	assertBalance(t, db, u.ID, "5.01", "0", "4.99")
+
+	// the held points cannot be spent on anything else
+	_, err = ws.RequestWithdrawal(ctx, "79927398713", u.ID, decimal.RequireFromString("5.02"))
+	assert.ErrorIs(t, err, urepo.ErrUserHasInsufficientBalance)
+
+	w, err := ws.CaptureHold(ctx, h.ID, u.ID)
+	require.NoError(t, err)
+	assert.True(t, w.ID > 0)
+	assert.Equal(t, "1234567812345670", w.Number)
+	assert.Equal(t, "4.99", w.Sum.String())
+	assert.Equal(t, u.ID, w.User.ID)
+	assertBalance(t, db, u.ID, "5.01", "4.99", "0")
+
+	items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
+	assert.Len(t, items, 1)
+	entries, _ := ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 3)
+	assert.Equal(t, ledgerentries.KindHold, entries[1].Kind)
+	assert.Equal(t, ledgerentries.KindWithdrawal, entries[2].Kind)
+	assert.Equal(t, "1234567812345670", entries[2].OrderNumber)
+
+	// the hold is captured only once
+	_, err = ws.CaptureHold(ctx, h.ID, u.ID)
+	assert.ErrorIs(t, err, withdrawal.ErrHoldIsFinalized)
+	_, err = ws.ReleaseHold(ctx, h.ID, u.ID)
+	assert.ErrorIs(t, err, withdrawal.ErrHoldIsFinalized)
+	// the order has been paid already
+	_, err = ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("1"))
+	assert.ErrorIs(t, err, withdrawal.ErrWithdrawalAlreadyRegistered)
+	assertBalance(t, db, u.ID, "5.01", "4.99", "0")
+}
+
+func TestWithdrawalService_ReleaseHold_OK(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u := prepareHoldUser(t, db, "happycustomer")
+	withdrawals := wdb.New(db)
+	ws := newService(withdrawals, udb.New(db), db)
+
+	h, err := ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("10"))
+	require.NoError(t, err)
+	assertBalance(t, db, u.ID, "0", "0", "10")
+
+	released, err := ws.ReleaseHold(ctx, h.ID, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, h.ID, released.ID)
+	assert.Equal(t, holds.HoldStatusReleased, released.Status)
+	assert.False(t, released.FinalizedAt.IsZero())
+	assertBalance(t, db, u.ID, "10", "0", "0")
+
+	_, err = ws.CaptureHold(ctx, h.ID, u.ID)
+	assert.ErrorIs(t, err, withdrawal.ErrHoldIsFinalized)
+	items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
+	assert.Len(t, items, 0)
+
+	// the points may be held for the order again
+	_, err = ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("1"))
+	assert.NoError(t, err)
+	assertBalance(t, db, u.ID, "9", "0", "1")
+}
+
+func TestWithdrawalService_ReserveWithdrawal_Errors(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u := prepareHoldUser(t, db, "happycustomer")
+	other := prepareHoldUser(t, db, "shopper")
+	ws := newService(wdb.New(db), udb.New(db), db)
+
+	h, err := ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("1"))
+	require.NoError(t, err)
+
+	_, err = ws.ReserveWithdrawal(ctx, "1234567812345670", other.ID, decimal.RequireFromString("1"))
+	assert.ErrorIs(t, err, withdrawal.ErrHoldAlreadyRegistered)
+	_, err = ws.ReserveWithdrawal(ctx, "79927398713", u.ID, decimal.RequireFromString("9.01"))
+	assert.ErrorIs(t, err, urepo.ErrUserHasInsufficientBalance)
+	_, err = ws.ReserveWithdrawal(ctx, "79927398713", u.ID, decimal.Zero)
+	assert.ErrorIs(t, err, withdrawal.ErrWithdrawalInvalidSumSum)
+
+	// someone else's hold cannot be touched
+	_, err = ws.CaptureHold(ctx, h.ID, other.ID)
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+	_, err = ws.ReleaseHold(ctx, h.ID, other.ID)
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+	_, err = ws.CaptureHold(ctx, 999999, u.ID)
+	assert.ErrorIs(t, err, holds.ErrHoldNotFound)
+
+	assertBalance(t, db, u.ID, "9", "0", "1")
+	assertBalance(t, db, other.ID, "10", "0", "0")
+}
+
+func TestWithdrawalService_ExpireHolds(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	u := prepareHoldUser(t, db, "happycustomer")
+	other := prepareHoldUser(t, db, "shopper")
+	withdrawals := wdb.New(db)
+	holdsRepo := hdb.New(db)
+	ws := withdrawal.New(
+		withdrawals, holdsRepo, udb.New(db), ldb.New(db), db,
+		withdrawal.WithHoldTTL(time.Millisecond*100), withdrawal.WithExpiryBatchSize(1),
+	)
+
+	h1, err := ws.ReserveWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("1"))
+	require.NoError(t, err)
+	h2, err := ws.ReserveWithdrawal(ctx, "79927398713", u.ID, decimal.RequireFromString("2"))
+	require.NoError(t, err)
+	h3, err := ws.ReserveWithdrawal(ctx, "4561261212345467", other.ID, decimal.RequireFromString("3"))
+	require.NoError(t, err)
+	_, err = ws.CaptureHold(ctx, h3.ID, other.ID)
+	require.NoError(t, err)
+
+	// nothing has expired yet
+	released, err := ws.ExpireHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	time.Sleep(time.Millisecond * 150)
+	// an expired hold cannot be captured anymore
+	_, err = ws.CaptureHold(ctx, h1.ID, u.ID)
+	assert.ErrorIs(t, err, withdrawal.ErrHoldExpired)
+
+	released, err = ws.ExpireHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, released)
+	assertBalance(t, db, u.ID, "10", "0", "0")
+	assertBalance(t, db, other.ID, "7", "3", "0")
+
+	for _, id := range []int{h1.ID, h2.ID} {
+		h, _ := holdsRepo.GetByIDForUpdate(ctx, id)
+		assert.Equal(t, holds.HoldStatusExpired, h.Status)
+	}
+	items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
+	assert.Len(t, items, 0)
+	entries, _ := ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 5)
+	assert.Equal(t, ledgerentries.KindRelease, entries[3].Kind)
+	assert.Equal(t, ledgerentries.KindRelease, entries[4].Kind)
+
+	released, err = ws.ExpireHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	_, err = ws.ReleaseHold(ctx, h1.ID, u.ID)
+	assert.ErrorIs(t, err, withdrawal.ErrHoldIsFinalized)
+}
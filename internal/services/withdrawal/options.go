@@ -0,0 +1,51 @@
+package withdrawal
+
+import (
+	"time"
+
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
+)
+
+const (
+	DefaultHoldTTL         = time.Minute * 15
+	DefaultExpiryBatchSize = 100
+)
+
+type Option func(*Service)
+
+// WithPublisher configures where the changes of the users' balance are published to
+func WithPublisher(publisher pubsub.Publisher) Option {
+	return func(s *Service) {
+		if publisher != nil {
+			s.publisher = publisher
+		}
+	}
+}
+
+// WithOutbox configures where the changes of the users' balance are recorded to
+// within the transaction that makes them, so that the records are kept if and only if the change is
+func WithOutbox(outbox pubsub.Publisher) Option {
+	return func(s *Service) {
+		if outbox != nil {
+			s.outbox = outbox
+		}
+	}
+}
+
+// WithHoldTTL configures how long the points stay held unless the hold is captured or released
+func WithHoldTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.holdTTL = ttl
+		}
+	}
+}
+
+// WithExpiryBatchSize configures how many expired holds are released at once
+func WithExpiryBatchSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.expiryBatchSize = size
+		}
+	}
+}
@@ -3,30 +3,60 @@ package withdrawal
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
+	"github.com/sergeii/practikum-go-gophermart/internal/core/holds"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	"github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
 	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
 )
 
 var ErrWithdrawalAlreadyRegistered = errors.New("withdrawal for this order has already been registered")
 var ErrWithdrawalInvalidSumSum = errors.New("can withdraw positive sum only")
+var ErrWithdrawalAlreadyRefunded = errors.New("withdrawal has already been refunded for another sum")
+var ErrWithdrawalInvalidRefundSum = errors.New("can refund positive sum not exceeding withdrawn sum only")
 
 type Service struct {
-	withdrawals withdrawals.Repository
-	users       users.Repository
-	transactor  transactor.Transactor
+	withdrawals     withdrawals.Repository
+	holds           holds.Repository
+	users           users.Repository
+	ledger          ledgerentries.Repository
+	transactor      transactor.Transactor
+	publisher       pubsub.Publisher
+	outbox          pubsub.Publisher
+	holdTTL         time.Duration
+	expiryBatchSize int
 }
 
-func New(withdrawals withdrawals.Repository, users users.Repository, transactor transactor.Transactor) Service {
-	return Service{
-		withdrawals: withdrawals,
-		users:       users,
-		transactor:  transactor,
+func New(
+	withdrawals withdrawals.Repository,
+	holds holds.Repository,
+	users users.Repository,
+	ledger ledgerentries.Repository,
+	transactor transactor.Transactor,
+	opts ...Option,
+) Service {
+	s := Service{
+		withdrawals:     withdrawals,
+		holds:           holds,
+		users:           users,
+		ledger:          ledger,
+		transactor:      transactor,
+		publisher:       pubsub.Discard,
+		outbox:          pubsub.Discard,
+		holdTTL:         DefaultHoldTTL,
+		expiryBatchSize: DefaultExpiryBatchSize,
 	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
 }
 
 // RequestWithdrawal attempts to withdraw specified sum from the selected user's account.
@@ -51,12 +81,15 @@ func (s Service) RequestWithdrawal(
 	}
 	var withdrawal withdrawals.Withdrawal
 	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
-		if err := s.users.WithdrawPoints(txCtx, userID, sum); err != nil {
+		if err := s.users.WithdrawPoints(txCtx, userID, number, sum); err != nil {
 			log.Warn().
 				Err(err).Str("order", number).Int("userID", userID).Stringer("sum", sum).
 				Msg("Unable to withdraw requested sum from user balance")
 			return err
 		}
+		if _, err := s.ledger.Add(txCtx, ledgerentries.NewWithdrawal(userID, number, sum)); err != nil {
+			return err
+		}
 		w, err := s.withdrawals.Add(txCtx, withdrawals.New(number, userID, sum))
 		if err != nil {
 			log.Error().
@@ -65,17 +98,137 @@ func (s Service) RequestWithdrawal(
 			return err
 		}
 		withdrawal = w
-		return nil
+		return s.recordBalance(txCtx, userID)
 	})
 
 	if err != nil {
 		return withdrawal, err
 	}
 
+	s.publishBalance(ctx, userID)
 	return withdrawal, nil
 }
 
-// GetUserWithdrawals returns all successful withdrawals requested by the specified user
-func (s Service) GetUserWithdrawals(ctx context.Context, userID int) ([]withdrawals.Withdrawal, error) {
-	return s.withdrawals.GetListForUser(ctx, userID)
+// RefundWithdrawal returns the points spent on a withdrawal back to the user's current balance.
+// The withdrawal is refunded in full unless a positive sum not exceeding the withdrawn one is specified.
+// A withdrawal is refunded only once: refunding it again for the same sum changes nothing
+// and returns the refunded withdrawal, whereas refunding it for another sum is an error
+func (s Service) RefundWithdrawal(
+	ctx context.Context,
+	number string,
+	sum decimal.Decimal,
+) (withdrawals.Withdrawal, error) {
+	var refunded withdrawals.Withdrawal
+	var changed bool
+	err := s.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		var err error
+		refunded, changed, err = s.refund(txCtx, number, sum)
+		if err != nil || !changed {
+			return err
+		}
+		return s.recordBalance(txCtx, refunded.User.ID)
+	})
+	if err != nil {
+		return withdrawals.Blank, err
+	}
+	if !changed {
+		log.Info().Str("order", number).Msg("Withdrawal has already been refunded")
+		return refunded, nil
+	}
+	log.Info().
+		Str("order", number).Int("userID", refunded.User.ID).Stringer("sum", refunded.Refunded).
+		Msg("Refunded withdrawal")
+	s.publishBalance(ctx, refunded.User.ID)
+	return refunded, nil
+}
+
+// refund refunds the withdrawal within the transaction from the context,
+// telling whether the withdrawal has been refunded now or has already been refunded before.
+// The withdrawal and then the user are locked for the duration of the transaction,
+// so concurrent refunds of the same withdrawal are not able to return the points twice
+func (s Service) refund(
+	ctx context.Context,
+	number string,
+	sum decimal.Decimal,
+) (withdrawals.Withdrawal, bool, error) {
+	w, err := s.withdrawals.GetByNumberForUpdate(ctx, number)
+	if err != nil {
+		return withdrawals.Blank, false, err
+	}
+	amount := sum
+	if amount.IsZero() {
+		amount = w.Sum
+	}
+	if w.Status != withdrawals.WithdrawalStatusProcessed {
+		if !w.Refunded.Equal(amount) {
+			return withdrawals.Blank, false, ErrWithdrawalAlreadyRefunded
+		}
+		return w, false, nil
+	}
+	if amount.IsNegative() || amount.GreaterThan(w.Sum) {
+		return withdrawals.Blank, false, ErrWithdrawalInvalidRefundSum
+	}
+	if err = s.users.RefundPoints(ctx, w.User.ID, number, amount); err != nil {
+		log.Warn().
+			Err(err).Str("order", number).Int("userID", w.User.ID).Stringer("sum", amount).
+			Msg("Unable to refund withdrawal to user balance")
+		return withdrawals.Blank, false, err
+	}
+	if _, err = s.ledger.Add(ctx, ledgerentries.NewReversal(w.User.ID, number, amount)); err != nil {
+		return withdrawals.Blank, false, err
+	}
+	w = w.Refund(amount, time.Now())
+	if err = s.withdrawals.Update(ctx, w.ID, w); err != nil {
+		return withdrawals.Blank, false, err
+	}
+	return w, true, nil
+}
+
+// GetUserWithdrawalsPage returns a page of the withdrawals requested by the specified user.
+// Unless the page is the last one, the cursor pointing at the next page is returned along with the page.
+// Zero limit returns every matching withdrawal at once
+func (s Service) GetUserWithdrawalsPage(
+	ctx context.Context, userID int, q withdrawals.ListQuery,
+) ([]withdrawals.Withdrawal, *pagination.Cursor, error) {
+	if q.Limit == 0 {
+		items, err := s.withdrawals.GetPageForUser(ctx, userID, q)
+		return items, nil, err
+	}
+	// fetch an extra withdrawal to tell whether there is another page
+	limit := q.Limit
+	q.Limit++
+	items, err := s.withdrawals.GetPageForUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+	items = items[:limit]
+	last := items[limit-1]
+	return items, &pagination.Cursor{Time: last.ProcessedAt, ID: last.ID}, nil
+}
+
+// publishBalance lets the user know about the user's balance as it is after a change.
+// The balance is obtained anew once the change has been committed, a failure to publish it is only logged
+func (s Service) publishBalance(ctx context.Context, userID int) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to obtain balance to publish")
+		return
+	}
+	e := pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held)
+	if err = s.publisher.Publish(ctx, e); err != nil {
+		log.Warn().Err(err).Int("userID", userID).Msg("Failed to publish balance")
+	}
+}
+
+// recordBalance passes the user's balance as it is within the transaction of a change to the outbox.
+// Unlike publishing, a failure to record the balance fails the change
+func (s Service) recordBalance(ctx context.Context, userID int) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Publish(ctx, pubsub.NewBalanceEvent(userID, u.Balance.Current, u.Balance.Withdrawn, u.Balance.Held))
 }
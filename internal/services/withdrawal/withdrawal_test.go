@@ -2,6 +2,8 @@ package withdrawal_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,17 +11,68 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	hdb "github.com/sergeii/practikum-go-gophermart/internal/core/holds/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries"
+	ldb "github.com/sergeii/practikum-go-gophermart/internal/core/ledgerentries/postgres"
 	urepo "github.com/sergeii/practikum-go-gophermart/internal/core/users"
 	udb "github.com/sergeii/practikum-go-gophermart/internal/core/users/postgres"
 	wrepo "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals"
 	wdb "github.com/sergeii/practikum-go-gophermart/internal/core/withdrawals/postgres"
-	"github.com/sergeii/practikum-go-gophermart/internal/ports/transactor"
+	"github.com/sergeii/practikum-go-gophermart/internal/persistence/postgres"
+	"github.com/sergeii/practikum-go-gophermart/internal/ports/pubsub"
 	"github.com/sergeii/practikum-go-gophermart/internal/services/withdrawal"
 	"github.com/sergeii/practikum-go-gophermart/internal/testutils"
 )
 
-func newService(withdrawals wrepo.Repository, users urepo.Repository, trans transactor.Transactor) withdrawal.Service {
-	return withdrawal.New(withdrawals, users, trans)
+func newService(withdrawals wrepo.Repository, users urepo.Repository, db *postgres.Database) withdrawal.Service {
+	return withdrawal.New(withdrawals, hdb.New(db), users, ldb.New(db), db)
+}
+
+type outboxFunc func(context.Context, pubsub.Event) error
+
+func (f outboxFunc) Publish(ctx context.Context, e pubsub.Event) error {
+	return f(ctx, e)
+}
+
+func TestWithdrawalService_RequestWithdrawal_Outbox(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, users.AccruePoints(ctx, u.ID, decimal.RequireFromString("10")))
+	withdrawals := wdb.New(db)
+
+	var recorded []pubsub.Event
+	ws := withdrawal.New(
+		withdrawals, hdb.New(db), users, ldb.New(db), db,
+		withdrawal.WithOutbox(outboxFunc(func(_ context.Context, e pubsub.Event) error {
+			recorded = append(recorded, e)
+			return nil
+		})),
+	)
+	_, err := ws.RequestWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("4"))
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, u.ID, recorded[0].UserID)
+	assert.Equal(t, "6", recorded[0].Balance.Current.String())
+	assert.Equal(t, "4", recorded[0].Balance.Withdrawn.String())
+
+	// the withdrawal is discarded along with the record of it
+	errOutbox := errors.New("outbox is unavailable")
+	ws = withdrawal.New(
+		withdrawals, hdb.New(db), users, ldb.New(db), db,
+		withdrawal.WithOutbox(outboxFunc(func(context.Context, pubsub.Event) error {
+			return errOutbox
+		})),
+	)
+	_, err = ws.RequestWithdrawal(ctx, "4561261212345467", u.ID, decimal.RequireFromString("1"))
+	assert.ErrorIs(t, err, errOutbox)
+	u, _ = users.GetByID(ctx, u.ID)
+	assert.Equal(t, "6", u.Balance.Current.String())
+	_, err = withdrawals.GetByNumber(ctx, "4561261212345467")
+	assert.ErrorIs(t, err, wrepo.ErrWithdrawalNotFound)
 }
 
 func TestWithdrawalService_RequestWithdrawal_OK(t *testing.T) {
@@ -64,14 +117,22 @@ func TestWithdrawalService_RequestWithdrawal_OK(t *testing.T) {
 	u1, _ = users.GetByID(ctx, u1.ID)
 	assert.Equal(t, "0.01", u1.Balance.Current.String())
 	assert.Equal(t, "9.99", u1.Balance.Withdrawn.String())
-	u1Items, _ := withdrawals.GetListForUser(ctx, u1.ID)
+	u1Items, _ := withdrawals.GetPageForUser(ctx, u1.ID, wrepo.ListQuery{})
 	assert.Len(t, u1Items, 2)
 
 	u2, _ = users.GetByID(ctx, u2.ID)
 	assert.Equal(t, "99.99", u2.Balance.Current.String())
 	assert.Equal(t, "0.01", u2.Balance.Withdrawn.String())
-	u2Items, _ := withdrawals.GetListForUser(ctx, u2.ID)
+	u2Items, _ := withdrawals.GetPageForUser(ctx, u2.ID, wrepo.ListQuery{})
 	assert.Len(t, u2Items, 1)
+
+	entries, _ := ldb.New(db).GetPageForUser(ctx, u1.ID, ledgerentries.ListQuery{Limit: 10})
+	require.Len(t, entries, 2)
+	for i, w := range []wrepo.Withdrawal{w1, w2} {
+		assert.Equal(t, ledgerentries.KindWithdrawal, entries[i].Kind)
+		assert.Equal(t, w.Number, entries[i].OrderNumber)
+		assert.Equal(t, w.Sum.String(), entries[i].Amount.String())
+	}
 }
 
 func TestWithdrawalService_RequestWithdrawal_Duplicate(t *testing.T) {
@@ -101,13 +162,13 @@ func TestWithdrawalService_RequestWithdrawal_Duplicate(t *testing.T) {
 	u1, _ = users.GetByID(ctx, u1.ID)
 	assert.Equal(t, "5.01", u1.Balance.Current.String())
 	assert.Equal(t, "4.99", u1.Balance.Withdrawn.String())
-	u1Items, _ := withdrawals.GetListForUser(ctx, u1.ID)
+	u1Items, _ := withdrawals.GetPageForUser(ctx, u1.ID, wrepo.ListQuery{})
 	assert.Len(t, u1Items, 1)
 
 	u2, _ = users.GetByID(ctx, u2.ID)
 	assert.Equal(t, "100", u2.Balance.Current.String())
 	assert.Equal(t, "0", u2.Balance.Withdrawn.String())
-	u2Items, _ := withdrawals.GetListForUser(ctx, u2.ID)
+	u2Items, _ := withdrawals.GetPageForUser(ctx, u2.ID, wrepo.ListQuery{})
 	assert.Len(t, u2Items, 0)
 }
 
@@ -148,8 +209,10 @@ func TestWithdrawalService_RequestWithdrawal_NegativeSum(t *testing.T) {
 			u, _ = users.GetByID(ctx, u.ID)
 			assert.Equal(t, "10", u.Balance.Current.String())
 			assert.Equal(t, "0", u.Balance.Withdrawn.String())
-			u1Items, _ := withdrawals.GetListForUser(ctx, u.ID)
+			u1Items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
 			assert.Len(t, u1Items, 0)
+			entries, _ := ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+			assert.Len(t, entries, 0)
 		})
 	}
 }
@@ -197,8 +260,149 @@ func TestWithdrawalService_RequestWithdrawal_NotEnoughPoints(t *testing.T) {
 			u, _ = users.GetByID(ctx, u.ID)
 			assert.Equal(t, tt.initial, u.Balance.Current.String())
 			assert.Equal(t, "0", u.Balance.Withdrawn.String())
-			u1Items, _ := withdrawals.GetListForUser(ctx, u.ID)
+			u1Items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
 			assert.Len(t, u1Items, 0)
 		})
 	}
 }
+
+func TestWithdrawalService_RefundWithdrawal_OK(t *testing.T) {
+	tests := []struct {
+		name        string
+		sum         string
+		wantStatus  wrepo.WithdrawalStatus
+		wantCurrent string
+	}{
+		{
+			"refund in full",
+			"0",
+			wrepo.WithdrawalStatusRefunded,
+			"10",
+		},
+		{
+			"refund whole sum",
+			"4.99",
+			wrepo.WithdrawalStatusRefunded,
+			"10",
+		},
+		{
+			"refund part of sum",
+			"1.5",
+			wrepo.WithdrawalStatusPartiallyRefunded,
+			"6.51",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			_, db, cancel := testutils.PrepareTestDatabase()
+			defer cancel()
+
+			users := udb.New(db)
+			u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+			require.NoError(t, users.AccruePoints(ctx, u.ID, decimal.RequireFromString("10")))
+
+			withdrawals := wdb.New(db)
+			ws := newService(withdrawals, users, db)
+			w, err := ws.RequestWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("4.99"))
+			require.NoError(t, err)
+
+			before := time.Now()
+			refunded, err := ws.RefundWithdrawal(ctx, "1234567812345670", decimal.RequireFromString(tt.sum))
+			require.NoError(t, err)
+			assert.Equal(t, w.ID, refunded.ID)
+			assert.Equal(t, tt.wantStatus, refunded.Status)
+			assert.Equal(t, "4.99", refunded.Sum.String())
+			assert.True(t, !refunded.RefundedAt.Before(before))
+
+			u, _ = users.GetByID(ctx, u.ID)
+			assert.Equal(t, tt.wantCurrent, u.Balance.Current.String())
+			assert.Equal(t, "10", u.Balance.Current.Add(u.Balance.Withdrawn).String())
+			items, _ := withdrawals.GetPageForUser(ctx, u.ID, wrepo.ListQuery{})
+			require.Len(t, items, 1)
+			assert.Equal(t, tt.wantStatus, items[0].Status)
+			assert.Equal(t, refunded.Refunded.String(), items[0].Refunded.String())
+
+			entries, _ := ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+			require.Len(t, entries, 2)
+			assert.Equal(t, ledgerentries.KindReversal, entries[1].Kind)
+			assert.Equal(t, "1234567812345670", entries[1].OrderNumber)
+			assert.Equal(t, refunded.Refunded.String(), entries[1].Change(ledgerentries.AccountCurrent).String())
+			assert.Equal(t, tt.wantCurrent, entries[1].Balance.String())
+
+			// refunding the withdrawal again changes nothing
+			again, err := ws.RefundWithdrawal(ctx, "1234567812345670", refunded.Refunded)
+			require.NoError(t, err)
+			assert.Equal(t, refunded.Status, again.Status)
+			assert.Equal(t, refunded.Refunded.String(), again.Refunded.String())
+			u, _ = users.GetByID(ctx, u.ID)
+			assert.Equal(t, tt.wantCurrent, u.Balance.Current.String())
+			entries, _ = ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+			assert.Len(t, entries, 2)
+
+			// but refunding it for another sum is not allowed
+			_, err = ws.RefundWithdrawal(ctx, "1234567812345670", decimal.RequireFromString("0.01"))
+			assert.ErrorIs(t, err, withdrawal.ErrWithdrawalAlreadyRefunded)
+		})
+	}
+}
+
+func TestWithdrawalService_RefundWithdrawal_Errors(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, users.AccruePoints(ctx, u.ID, decimal.RequireFromString("10")))
+
+	withdrawals := wdb.New(db)
+	ws := newService(withdrawals, users, db)
+	_, err := ws.RequestWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("4.99"))
+	require.NoError(t, err)
+
+	_, err = ws.RefundWithdrawal(ctx, "4561261212345467", decimal.Zero)
+	assert.ErrorIs(t, err, wrepo.ErrWithdrawalNotFound)
+	_, err = ws.RefundWithdrawal(ctx, "1234567812345670", decimal.RequireFromString("5"))
+	assert.ErrorIs(t, err, withdrawal.ErrWithdrawalInvalidRefundSum)
+	_, err = ws.RefundWithdrawal(ctx, "1234567812345670", decimal.RequireFromString("-1"))
+	assert.ErrorIs(t, err, withdrawal.ErrWithdrawalInvalidRefundSum)
+
+	u, _ = users.GetByID(ctx, u.ID)
+	assert.Equal(t, "5.01", u.Balance.Current.String())
+	assert.Equal(t, "4.99", u.Balance.Withdrawn.String())
+	w, _ := withdrawals.GetByNumber(ctx, "1234567812345670")
+	assert.Equal(t, wrepo.WithdrawalStatusProcessed, w.Status)
+}
+
+func TestWithdrawalService_RefundWithdrawal_Race(t *testing.T) {
+	ctx := context.TODO()
+	_, db, cancel := testutils.PrepareTestDatabase()
+	defer cancel()
+
+	users := udb.New(db)
+	u, _ := users.Create(ctx, urepo.New("happycustomer", "str0ng"))
+	require.NoError(t, users.AccruePoints(ctx, u.ID, decimal.RequireFromString("10")))
+
+	ws := newService(wdb.New(db), users, db)
+	_, err := ws.RequestWithdrawal(ctx, "1234567812345670", u.ID, decimal.RequireFromString("4.99"))
+	require.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ws.RefundWithdrawal(ctx, "1234567812345670", decimal.Zero)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// the points are returned only once
+	u, _ = users.GetByID(ctx, u.ID)
+	assert.Equal(t, "10", u.Balance.Current.String())
+	assert.Equal(t, "0", u.Balance.Withdrawn.String())
+	entries, _ := ldb.New(db).GetPageForUser(ctx, u.ID, ledgerentries.ListQuery{Limit: 10})
+	assert.Len(t, entries, 2)
+}
@@ -101,3 +101,11 @@ func JSONReader(v interface{}) io.Reader {
 	}
 	return bytes.NewReader(jsonBytes)
 }
+
+func WithHeader(name, value string) TestRequestOpt {
+	return func(req *http.Request, resp *http.Response) {
+		if req != nil {
+			req.Header.Set(name, value)
+		}
+	}
+}
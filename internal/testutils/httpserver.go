@@ -10,6 +10,7 @@ import (
 	"github.com/sergeii/practikum-go-gophermart/cmd/gophermart/config"
 	"github.com/sergeii/practikum-go-gophermart/internal/adapters/rest"
 	"github.com/sergeii/practikum-go-gophermart/internal/application"
+	httpserver "github.com/sergeii/practikum-go-gophermart/pkg/http/server"
 )
 
 type TestServerOpt func(*config.Config)
@@ -37,7 +38,12 @@ func PrepareTestServer(opts ...TestServerOpt) (*httptest.Server, *application.Ap
 	if err != nil {
 		panic(err)
 	}
-	ts := httptest.NewServer(router)
+	// the test server is configured the same way the service's server is
+	ts := httptest.NewUnstartedServer(router)
+	ts.Config.ReadTimeout = cfg.ServerReadTimeout
+	ts.Config.WriteTimeout = cfg.ServerWriteTimeout
+	ts.Config.ConnContext = httpserver.ConnContext
+	ts.Start()
 	return ts, app, func() {
 		defer cancelDatabase()
 		defer ts.Close()
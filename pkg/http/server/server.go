@@ -18,6 +18,9 @@ const (
 )
 
 var ErrServerShutdownFailed = fmt.Errorf("server shutdown failed")
+var ErrConnUnknown = errors.New("connection of the request is unknown")
+
+type connContextKey struct{}
 
 type serverConfig struct {
 	readTimeout     time.Duration
@@ -96,9 +99,29 @@ func New(addr string, opts ...Option) (*HTTPServer, error) {
 	svr.WriteTimeout = cfg.writeTimeout
 	svr.ReadTimeout = cfg.readTimeout
 	svr.Handler = cfg.handler
+	svr.ConnContext = ConnContext
 	return server, nil
 }
 
+// ConnContext remembers the connection a request is received on in the request's context,
+// so that the handler is able to extend the deadline for writing the response with ExtendWriteDeadline.
+// Servers created with New have it set up already
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// ExtendWriteDeadline moves the deadline for writing the response beyond the server's write timeout,
+// which long-lived responses such as event streams would outlive otherwise.
+// A zero deadline lifts the deadline altogether.
+// ErrConnUnknown is returned unless the connection has been remembered by ConnContext
+func ExtendWriteDeadline(ctx context.Context, deadline time.Time) error {
+	conn, ok := ctx.Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return ErrConnUnknown
+	}
+	return conn.SetWriteDeadline(deadline)
+}
+
 func (s *HTTPServer) ListenAndServe(ctx context.Context) error {
 	fatal := make(chan error, 1)
 
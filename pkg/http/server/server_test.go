@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -57,3 +58,51 @@ func TestHTTPServerListenAndServe(t *testing.T) {
 	respBody, _ := io.ReadAll(resp.Body)
 	assert.Equal(t, "!dlroW olleH", string(respBody))
 }
+
+func TestHTTPServerExtendWriteDeadline(t *testing.T) {
+	tests := []struct {
+		name   string
+		extend bool
+		want   string
+	}{
+		{"deadline extended", true, "done"},
+		{"write timeout", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			svr, err := server.New(
+				"localhost:0",
+				server.WithWriteTimeout(time.Millisecond*100),
+				server.WithHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					if tt.extend {
+						assert.NoError(t, server.ExtendWriteDeadline(r.Context(), time.Now().Add(time.Second)))
+					}
+					time.Sleep(time.Millisecond * 200)
+					rw.Write([]byte("done")) // nolint:errcheck
+				})),
+				server.WithReadySignal(func() {
+					ready <- struct{}{}
+				}),
+			)
+			defer svr.Stop() // nolint: errcheck
+			require.NoError(t, err)
+
+			go func() {
+				svr.ListenAndServe(ctx) // nolint: errcheck
+			}()
+			<-ready
+
+			var body []byte
+			resp, err := http.Get(fmt.Sprintf("http://%s", svr.ListenAddr())) // nolint: noctx
+			if err == nil {
+				body, _ = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+	assert.ErrorIs(t, server.ExtendWriteDeadline(context.TODO(), time.Time{}), server.ErrConnUnknown)
+}
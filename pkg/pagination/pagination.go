@@ -0,0 +1,45 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrCursorInvalid = errors.New("invalid cursor")
+
+// Cursor points at the last item of a page in a list sorted by time and then by ID.
+// The next page starts right after the item the cursor points at
+type Cursor struct {
+	Time time.Time
+	ID   int
+}
+
+// Encode turns the cursor into an opaque string that is safe to pass in a URL
+func (c Cursor) Encode() string {
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Decode restores the cursor encoded with Encode
+func Decode(encoded string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrCursorInvalid
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 {
+		return Cursor{}, ErrCursorInvalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return Cursor{}, ErrCursorInvalid
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Cursor{}, ErrCursorInvalid
+	}
+	return Cursor{Time: t, ID: id}, nil
+}
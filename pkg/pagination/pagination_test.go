@@ -0,0 +1,26 @@
+package pagination_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/pagination"
+)
+
+func TestCursor_EncodeDecode(t *testing.T) {
+	c := pagination.Cursor{Time: time.Date(2022, 3, 14, 15, 9, 26, 535897000, time.FixedZone("MSK", 3*3600)), ID: 42}
+	decoded, err := pagination.Decode(c.Encode())
+	require.NoError(t, err)
+	assert.True(t, c.Time.Equal(decoded.Time))
+	assert.Equal(t, 42, decoded.ID)
+}
+
+func TestCursor_Decode_Invalid(t *testing.T) {
+	for _, encoded := range []string{"", "!!!", "Zm9v", "Zm9vfGJhcg", "MjAyMi0wMy0xNHw0Mg"} {
+		_, err := pagination.Decode(encoded)
+		assert.ErrorIs(t, err, pagination.ErrCursorInvalid, encoded)
+	}
+}
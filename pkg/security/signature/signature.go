@@ -0,0 +1,32 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Sign calculates a hex-encoded HMAC-SHA256 signature of the payload sent at the specified time.
+// The timestamp is signed along with the payload, so that the signed payload cannot be replayed at a later time
+func Sign(secret []byte, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells whether the signature matches the payload sent at the specified time
+func Verify(secret []byte, timestamp time.Time, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(Sign(secret, timestamp, payload))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
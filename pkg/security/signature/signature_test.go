@@ -0,0 +1,41 @@
+package signature_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sergeii/practikum-go-gophermart/pkg/security/signature"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("s3cr3t")
+	now := time.Unix(1665000000, 0)
+	payload := []byte(`{"order": "79927398713", "status": "PROCESSED", "accrual": 500}`)
+
+	sig := signature.Sign(secret, now, payload)
+	assert.Len(t, sig, 64)
+	assert.Equal(t, sig, signature.Sign(secret, now, payload))
+	assert.True(t, signature.Verify(secret, now, payload, sig))
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		timestamp time.Time
+		payload   []byte
+		signature string
+	}{
+		{"another secret", []byte("secret"), now, payload, sig},
+		{"another timestamp", secret, now.Add(time.Second), payload, sig},
+		{"another payload", secret, now, []byte(`{}`), sig},
+		{"truncated signature", secret, now, payload, sig[:32]},
+		{"not hex", secret, now, payload, "foo"},
+		{"empty signature", secret, now, payload, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.False(t, signature.Verify(tt.secret, tt.timestamp, tt.payload, tt.signature))
+		})
+	}
+}